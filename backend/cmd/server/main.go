@@ -1,15 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"os"
+	"time"
 
 	"mini-paas/backend/internal/api"
 	"mini-paas/backend/internal/db"
 	"mini-paas/backend/internal/repository"
 	"mini-paas/backend/internal/services"
+	"mini-paas/backend/pkg/k8s"
+	"mini-paas/backend/pkg/secretbox"
 
 	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
 )
 
 func main() {
@@ -26,7 +32,7 @@ func main() {
 
 	if len(os.Args) > 1 && os.Args[1] == "migrate" {
 		if err := db.RunMigrations(gormDB); err != nil {
-			log.Fatalf("Migration failed: %w", err)
+			log.Fatalf("Migration failed: %v", err)
 		}
 		return
 	}
@@ -34,18 +40,89 @@ func main() {
 	// repo layers
 	appRepo := repository.NewAppRepository(gormDB)
 	depRepo := repository.NewDeploymentRepository(gormDB)
+	depEventRepo := repository.NewDeploymentEventRepository(gormDB)
+	portRepo := repository.NewPortEndpointRepository(gormDB)
 	userRepo := repository.NewUserRepository(gormDB)
 	logRepo := repository.NewLogRepository(gormDB)
+	cronRepo := repository.NewCronJobRepository(gormDB)
+	runRepo := repository.NewRunRepository(gormDB)
+	auditRepo := repository.NewAuditRepository(gormDB)
+	volumeRepo := repository.NewVolumeRepository(gormDB)
+	addOnRepo := repository.NewAddOnRepository(gormDB)
+	teamRepo := repository.NewTeamRepository(gormDB)
+	registryCredRepo := repository.NewRegistryCredentialRepository(gormDB)
+	domainRepo := repository.NewDomainRepository(gormDB)
+	linkRepo := repository.NewAppLinkRepository(gormDB)
+	quotaRepo := repository.NewQuotaRepository(gormDB)
+	envRepo := repository.NewEnvironmentRepository(gormDB)
+	releaseRepo := repository.NewReleaseRepository(gormDB)
+
+	k8sConfig, err := k8s.NewConfigFromKubeConfig()
+	if err != nil {
+		log.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Fatalf("failed to create k8s client: %v", err)
+	}
+
+	// registry tokens are encrypted at rest with this key
+	credentialBox, err := secretbox.NewFromEnv("CREDENTIALS_KEY")
+	if err != nil {
+		log.Fatalf("failed to load credentials key: %v", err)
+	}
 
 	// service layers
-	appService := services.NewAppService(appRepo)
-	depService := services.NewDeploymentService(depRepo)
+	quotaService := services.NewQuotaService(quotaRepo, appRepo, volumeRepo, domainRepo, userRepo, teamRepo, k8sClient)
+	volumeService := services.NewVolumeService(volumeRepo, appRepo, quotaService, k8sClient)
+	releaseService := services.NewReleaseService(releaseRepo, appRepo)
+	teamService := services.NewTeamService(teamRepo, userRepo)
+	cronService := services.NewCronService(cronRepo, appRepo, depRepo, logRepo, k8sClient)
+	addOnService := services.NewAddOnService(addOnRepo, appRepo, depRepo, releaseService, k8sClient)
+	appService := services.NewAppService(appRepo, volumeService, cronService, addOnService, quotaService, releaseService, teamService)
 	userService := services.NewUserService(userRepo)
+	registryService := services.NewRegistryService(registryCredRepo, teamService, credentialBox, k8sClient)
+	depService := services.NewDeploymentService(depRepo, depEventRepo, portRepo, appRepo, logRepo, volumeRepo, addOnRepo, linkRepo, envRepo, cronService, registryService, quotaService, releaseService, teamService, services.NewNotifierFromEnv(), services.NewErrorRateSourceFromEnv())
 	logService := services.NewLogService(logRepo)
+	runService := services.NewRunService(runRepo, appRepo, depRepo, logRepo, teamService, k8sClient)
+	k8sLogService := services.NewK8sLogService(k8sClient, depRepo)
+	execService := services.NewExecService(k8sClient, k8sConfig, depRepo, appRepo, auditRepo, teamService)
+	domainService := services.NewDomainService(domainRepo, appRepo, quotaService, net.DefaultResolver, k8sClient)
+	linkService := services.NewLinkService(linkRepo, appRepo, depRepo, releaseService, teamService, k8sClient)
+	activatorService := services.NewActivatorService(appRepo, depRepo, depEventRepo, domainRepo, domainService, services.NewTrafficSourceFromEnv(), k8sClient)
+	gcService := services.NewGCService(depRepo, appRepo, logRepo, k8sClient)
+	previewService := services.NewPreviewEnvService(appRepo, appService, depService, domainService, teamService, registryService, k8sClient)
+	envService := services.NewEnvironmentService(envRepo, appRepo, depRepo, appService, depService, teamService)
+
+	// apps only reach each other through links
+	if err := linkService.EnsureNamespacePolicies(context.Background()); err != nil {
+		log.Printf("failed to apply namespace network policies: %v", err)
+	}
+
+	// background workers
+	go cronService.WatchRuns(context.Background(), 30*time.Second)
+	go depService.ProcessQueue(context.Background(), 5*time.Second)
+	go activatorService.WatchIdle(context.Background(), time.Minute)
+	go gcService.Run(context.Background(), time.Hour)
+	go previewService.ReapExpired(context.Background(), 10*time.Minute)
+
+	// the domains of apps scaled to zero are routed to the activator
+	activatorAddr := os.Getenv("ACTIVATOR_ADDR")
+	if activatorAddr == "" {
+		activatorAddr = ":8081"
+	}
+	activator := gin.Default()
+	api.SetUpActivatorRoutes(activator, activatorService)
+	go func() {
+		log.Printf("activator running at %s", activatorAddr)
+		if err := activator.Run(activatorAddr); err != nil {
+			log.Fatal("failed to start activator: ", err)
+		}
+	}()
 
 	// api router
 	r := gin.Default()
-	api.SetUpRoutes(r, appService, depService, userService, logService)
+	api.SetUpRoutes(r, appService, depService, userService, logService, cronService, runService, k8sLogService, execService, volumeService, addOnService, teamService, registryService, domainService, activatorService, linkService, quotaService, gcService, previewService, envService, releaseService)
 
 	// start server
 	log.Println("server running at http://localhost:8080")
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ActivatorHandler receives the requests for apps scaled to zero or in
+// maintenance, whose domains are routed to the activator meanwhile.
+type ActivatorHandler struct {
+	activator services.ActivatorService
+}
+
+func NewActivatorHandler(activator services.ActivatorService) *ActivatorHandler {
+	return &ActivatorHandler{activator: activator}
+}
+
+// SetUpActivatorRoutes serves every path of every host through the activator.
+func SetUpActivatorRoutes(r *gin.Engine, activator services.ActivatorService) {
+	h := NewActivatorHandler(activator)
+	r.NoRoute(h.ForwardHandler)
+}
+
+// ANY /*path on the activator listener
+func (h *ActivatorHandler) ForwardHandler(c *gin.Context) {
+	host := c.Request.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	m, err := h.activator.MaintenancePage(c.Request.Context(), host, c.ClientIP(), c.GetHeader(services.MaintenanceBypassHeader))
+	if err == nil && m != nil {
+		writeMaintenancePage(c, m)
+		return
+	}
+	if err == nil {
+		// the app sees neither the token nor that it was let through
+		c.Request.Header.Del(services.MaintenanceBypassHeader)
+	}
+
+	var upstream *services.Upstream
+	if err == nil {
+		upstream, err = h.activator.Wake(c.Request.Context(), host, c.Request.URL.Path)
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "no app is served on " + host})
+		return
+	case errors.Is(err, services.ErrAppUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, context.DeadlineExceeded):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := upstream.URL
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(req.URL.Path, "/")
+			req.URL.RawPath = ""
+			req.Host = target.Host
+		},
+		Transport: upstream.Transport,
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
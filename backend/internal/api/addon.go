@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AddOnHandler struct {
+	addOnService services.AddOnService
+}
+
+func NewAddOnHandler(s services.AddOnService) *AddOnHandler {
+	return &AddOnHandler{addOnService: s}
+}
+
+// GET /api/addons/catalog
+func (h *AddOnHandler) CatalogHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"items": h.addOnService.Catalog()})
+}
+
+// POST /api/apps/app/:id/addons
+func (h *AddOnHandler) ProvisionAddOnHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req ProvisionAddOnRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	addOn, err := h.addOnService.Provision(c.Request.Context(), appID, req.Type, req.Size)
+	if err != nil {
+		writeAddOnError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, toAddOnResponse(addOn))
+}
+
+// GET /api/apps/app/:id/addons
+func (h *AddOnHandler) ListAddOnsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	addOns, err := h.addOnService.ListAddOns(c.Request.Context(), appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]AddOnResponse, 0, len(addOns))
+	for _, a := range addOns {
+		resp = append(resp, toAddOnResponse(&a))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// GET /api/apps/app/:id/addons/:addonId
+func (h *AddOnHandler) GetAddOnHandler(c *gin.Context) {
+	appID, addOnID, ok := parseAddOnParams(c)
+	if !ok {
+		return
+	}
+
+	addOn, err := h.addOnService.GetAddOn(c.Request.Context(), appID, addOnID)
+	if err != nil {
+		writeAddOnError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toAddOnResponse(addOn))
+}
+
+// DELETE /api/apps/app/:id/addons/:addonId
+func (h *AddOnHandler) DeprovisionAddOnHandler(c *gin.Context) {
+	appID, addOnID, ok := parseAddOnParams(c)
+	if !ok {
+		return
+	}
+
+	addOn, err := h.addOnService.Deprovision(c.Request.Context(), appID, addOnID)
+	if err != nil {
+		writeAddOnError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, toAddOnResponse(addOn))
+}
+
+func parseAddOnParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	addOnID, err := uuid.Parse(c.Param("addonId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return appID, addOnID, true
+}
+
+func writeAddOnError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "add-on or application not found"})
+	case errors.Is(err, services.ErrInvalidAddOn):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAddOnExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toAddOnResponse(a *models.AddOn) AddOnResponse {
+	return AddOnResponse{
+		ID:        a.ID.String(),
+		AppID:     a.AppID.String(),
+		Type:      a.Type,
+		ConfigVar: a.ConfigVar,
+		Size:      a.Size,
+		Status:    a.Status,
+		CreatedAt: a.CreatedAt,
+	}
+}
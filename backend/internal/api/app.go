@@ -1,6 +1,8 @@
 package api
 
 import (
+	"errors"
+	"io"
 	"net/http"
 
 	"mini-paas/backend/internal/models"
@@ -9,14 +11,19 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"sigs.k8s.io/yaml"
 )
 
+// app.yaml files are small; this only guards against runaway uploads
+const maxManifestSize = 1 << 20
+
 type AppHandler struct {
-	appService services.AppService
+	appService  services.AppService
+	teamService services.TeamService
 }
 
-func NewAppHandler(service services.AppService) *AppHandler {
-	return &AppHandler{appService: service}
+func NewAppHandler(service services.AppService, teamService services.TeamService) *AppHandler {
+	return &AppHandler{appService: service, teamService: teamService}
 }
 
 // POST /api/apps
@@ -28,22 +35,30 @@ func (h *AppHandler) CreateNewApp(c *gin.Context) {
 	}
 
 	app := &models.Application{
-		Name:        req.Name,
-		GitURL:      req.GitURL,
-		Description: req.Description,
+		Name:           req.Name,
+		GitURL:         req.GitURL,
+		Description:    req.Description,
+		ReleaseCommand: req.ReleaseCommand,
+	}
+	if !h.setOwnership(c, app, req.TeamID) {
+		return
 	}
 
 	newApp, err := h.appService.CreateApp(c.Request.Context(), app)
 	if err != nil {
+		if writeQuotaError(c, err) {
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, CreateAppResponse{
-		ID:          newApp.ID.String(),
-		Name:        newApp.Name,
-		Description: newApp.Description,
-		Status:      newApp.Status,
+		ID:             newApp.ID.String(),
+		Name:           newApp.Name,
+		Description:    newApp.Description,
+		Status:         newApp.Status,
+		ReleaseCommand: newApp.ReleaseCommand,
 	})
 }
 
@@ -112,14 +127,73 @@ func (h *AppHandler) GetApplicatonByID(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, CreateAppResponse{
-		ID:          app.ID.String(),
-		Name:        app.Name,
-		Status:      app.Status,
-		Description: app.Description,
+		ID:             app.ID.String(),
+		Name:           app.Name,
+		Status:         app.Status,
+		Description:    app.Description,
+		ReleaseCommand: app.ReleaseCommand,
+		SleepingSince:  app.SleepingSince,
+	})
+}
+
+// PATCH /api/apps/app/:id
+func (h *AppHandler) UpdateApplication(c *gin.Context) {
+	idStr := c.Param("id")
+	uid, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req UpdateAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	app, err := h.appService.GetAppByID(c.Request.Context(), uid)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		return
+	}
+	// the release command runs with the app's secrets on the next deploy
+	if err := h.appService.RequireAccess(c.Request.Context(), currentUser(c), app); err != nil {
+		writeAppAccessError(c, err)
+		return
+	}
+
+	if req.Name != nil {
+		app.Name = *req.Name
+	}
+	if req.GitURL != nil {
+		app.GitURL = *req.GitURL
+	}
+	if req.Description != nil {
+		app.Description = *req.Description
+	}
+	if req.ReleaseCommand != nil {
+		app.ReleaseCommand = *req.ReleaseCommand
+	}
+
+	updated, err := h.appService.UpdateApp(c.Request.Context(), app)
+	if err != nil {
+		if writeQuotaError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, CreateAppResponse{
+		ID:             updated.ID.String(),
+		Name:           updated.Name,
+		Status:         updated.Status,
+		Description:    updated.Description,
+		ReleaseCommand: updated.ReleaseCommand,
 	})
 }
 
-// DELETE /api/app/:id
+// DELETE /api/app/:id?purge_volumes=true
 func (h *AppHandler) DeleteApplication(c *gin.Context) {
 	idStr := c.Param("id")
 	uid, err := uuid.Parse(idStr)
@@ -128,11 +202,143 @@ func (h *AppHandler) DeleteApplication(c *gin.Context) {
 		return
 	}
 
-	err = h.appService.DeleteApp(c.Request.Context(), uid)
+	app, err := h.appService.GetAppByID(c.Request.Context(), uid)
 	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		return
+	}
+	if err := h.appService.RequireAccess(c.Request.Context(), currentUser(c), app); err != nil {
+		writeAppAccessError(c, err)
+		return
+	}
+
+	purgeVolumes := c.Query("purge_volumes") == "true"
+	err = h.appService.DeleteApp(c.Request.Context(), uid, purgeVolumes)
+	if err != nil {
+		if errors.Is(err, services.ErrVolumesAttached) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "application deleted"})
 }
+
+// PUT /api/apps/apply
+func (h *AppHandler) ApplyManifest(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxManifestSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	manifest, err := services.ParseAppManifest(body)
+	if err != nil {
+		writeManifestError(c, err)
+		return
+	}
+
+	var teamID *uuid.UUID
+	if raw := c.Query("team_id"); raw != "" {
+		tid, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team_id"})
+			return
+		}
+		teamID = &tid
+	}
+	app, created, err := h.appService.ApplyManifest(c.Request.Context(), manifest, currentUser(c), teamID)
+	if err != nil {
+		writeManifestError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, ApplyManifestResponse{
+		ID:      app.ID.String(),
+		Name:    app.Name,
+		Status:  app.Status,
+		Created: created,
+	})
+}
+
+// GET /api/apps/app/:id/manifest?format=json
+func (h *AppHandler) ExportManifest(c *gin.Context) {
+	idStr := c.Param("id")
+	uid, err := uuid.Parse(idStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	manifest, err := h.appService.ExportManifest(c.Request.Context(), uid)
+	if err != nil {
+		writeManifestError(c, err)
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, manifest)
+		return
+	}
+	out, err := yaml.Marshal(manifest)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "application/yaml", out)
+}
+
+// setOwnership records the calling user as owner and, when teamID is given,
+// puts the app in that team after checking membership.
+func (h *AppHandler) setOwnership(c *gin.Context, app *models.Application, teamID *string) bool {
+	user := currentUser(c)
+	app.OwnerID = &user.ID
+	if teamID == nil {
+		return true
+	}
+
+	tid, err := uuid.Parse(*teamID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team_id"})
+		return false
+	}
+	if err := h.teamService.RequireMember(c.Request.Context(), tid, user.ID); err != nil {
+		writeTeamError(c, err)
+		return false
+	}
+	app.TeamID = &tid
+	return true
+}
+
+func writeAppAccessError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrAppForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func writeManifestError(c *gin.Context, err error) {
+	if writeQuotaError(c, err) {
+		return
+	}
+	var manifestErr *services.ManifestError
+	switch {
+	case errors.As(err, &manifestErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrInvalidManifest.Error(), "details": manifestErr.Problems})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+	case errors.Is(err, services.ErrAppForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotTeamMember):
+		writeTeamError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CronHandler struct {
+	cronService services.CronService
+}
+
+func NewCronHandler(s services.CronService) *CronHandler {
+	return &CronHandler{cronService: s}
+}
+
+// GET /api/apps/app/:id/cron
+func (h *CronHandler) ListCronJobsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	crons, err := h.cronService.ListCronJobs(c.Request.Context(), appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]CronJobResponse, 0, len(crons))
+	for _, cron := range crons {
+		resp = append(resp, toCronJobResponse(&cron))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/cron
+func (h *CronHandler) CreateCronJobHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req CronJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cron, err := h.cronService.CreateCronJob(c.Request.Context(), req.toModel(appID))
+	if err != nil {
+		writeCronError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toCronJobResponse(cron))
+}
+
+// PUT /api/apps/app/:id/cron/:cronId
+func (h *CronHandler) UpdateCronJobHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	cronID, err := uuid.Parse(c.Param("cronId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req CronJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cron := req.toModel(appID)
+	cron.ID = cronID
+	updated, err := h.cronService.UpdateCronJob(c.Request.Context(), cron)
+	if err != nil {
+		writeCronError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toCronJobResponse(updated))
+}
+
+// DELETE /api/apps/app/:id/cron/:cronId
+func (h *CronHandler) DeleteCronJobHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	cronID, err := uuid.Parse(c.Param("cronId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	if err := h.cronService.DeleteCronJob(c.Request.Context(), appID, cronID); err != nil {
+		writeCronError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "cron job deleted"})
+}
+
+func writeCronError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "cron job or application not found"})
+	case errors.Is(err, services.ErrInvalidCronJob):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (r CronJobRequest) toModel(appID uuid.UUID) *models.CronJob {
+	cron := &models.CronJob{
+		AppID:                      appID,
+		Name:                       r.Name,
+		Schedule:                   r.Schedule,
+		Command:                    r.Command,
+		ConcurrencyPolicy:          r.ConcurrencyPolicy,
+		SuccessfulJobsHistoryLimit: 3,
+		FailedJobsHistoryLimit:     1,
+		Suspend:                    r.Suspend,
+	}
+	if r.SuccessfulJobsHistoryLimit != nil {
+		cron.SuccessfulJobsHistoryLimit = *r.SuccessfulJobsHistoryLimit
+	}
+	if r.FailedJobsHistoryLimit != nil {
+		cron.FailedJobsHistoryLimit = *r.FailedJobsHistoryLimit
+	}
+	return cron
+}
+
+func toCronJobResponse(cron *models.CronJob) CronJobResponse {
+	return CronJobResponse{
+		ID:                         cron.ID.String(),
+		AppID:                      cron.AppID.String(),
+		Name:                       cron.Name,
+		Schedule:                   cron.Schedule,
+		Command:                    cron.Command,
+		ConcurrencyPolicy:          cron.ConcurrencyPolicy,
+		SuccessfulJobsHistoryLimit: cron.SuccessfulJobsHistoryLimit,
+		FailedJobsHistoryLimit:     cron.FailedJobsHistoryLimit,
+		Suspend:                    cron.Suspend,
+	}
+}
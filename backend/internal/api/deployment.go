@@ -1,7 +1,9 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"mini-paas/backend/internal/models"
@@ -12,6 +14,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// requests to a preview are for smoke tests, not uploads
+const maxProxyBody = 10 << 20
+
 type DeploymentHandler struct {
 	deploymentService services.DeploymentService
 }
@@ -46,10 +51,12 @@ func (h *DeploymentHandler) CreateDeploymentHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusCreated, DeploymentResponse{
-		ID:      newDep.ID.String(),
-		AppID:   newDep.AppID.String(),
-		Version: newDep.Version,
-		Status:  newDep.Status,
+		ID:          newDep.ID.String(),
+		AppID:       newDep.AppID.String(),
+		Version:     newDep.Version,
+		Status:      newDep.Status,
+		ImageURL:    newDep.ImageURL,
+		ImageDigest: newDep.ImageDigest,
 	})
 }
 
@@ -72,8 +79,9 @@ func (h *DeploymentHandler) ListAllDeploymentsHandler(c *gin.Context) {
 	}
 
 	f := repository.DeploymentFilter{
-		AppID:  appUUID,
-		Status: req.Status,
+		AppID:       appUUID,
+		Status:      req.Status,
+		Environment: req.Environment,
 	}
 
 	page := repository.Page{Limit: req.Limit, Offset: req.Offset}
@@ -87,12 +95,7 @@ func (h *DeploymentHandler) ListAllDeploymentsHandler(c *gin.Context) {
 
 	resp := make([]DeploymentResponse, 0, len(deps.Items))
 	for _, a := range deps.Items {
-		resp = append(resp, DeploymentResponse{
-			ID:      a.ID.String(),
-			AppID:   a.AppID.String(),
-			Version: a.Version,
-			Status:  a.Status,
-		})
+		resp = append(resp, toDeploymentResponse(&a))
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -118,12 +121,152 @@ func (h *DeploymentHandler) GetDeploymentByIDHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, DeploymentResponse{
-		ID:      dep.ID.String(),
-		AppID:   dep.AppID.String(),
-		Version: dep.Version,
-		Status:  dep.Status,
-	})
+	c.JSON(http.StatusOK, toDeploymentResponse(dep))
+}
+
+// POST /api/deployments/:id/cancel
+func (h *DeploymentHandler) CancelDeploymentHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	dep, err := h.deploymentService.CancelDeployment(c.Request.Context(), uid, currentUser(c))
+	if err != nil {
+		writeDeploymentActionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toDeploymentResponse(dep))
+}
+
+// POST /api/deployments/:id/promote
+func (h *DeploymentHandler) PromoteDeploymentHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	dep, err := h.deploymentService.PromoteDeployment(c.Request.Context(), uid, currentUser(c))
+	if err != nil {
+		writeDeploymentActionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toDeploymentResponse(dep))
+}
+
+// POST /api/deployments/:id/discard
+func (h *DeploymentHandler) DiscardDeploymentHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	dep, err := h.deploymentService.DiscardDeployment(c.Request.Context(), uid, currentUser(c))
+	if err != nil {
+		writeDeploymentActionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toDeploymentResponse(dep))
+}
+
+// POST /api/deployments/:id/advance
+func (h *DeploymentHandler) AdvanceCanaryHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	dep, err := h.deploymentService.AdvanceCanary(c.Request.Context(), uid, currentUser(c))
+	if err != nil {
+		writeDeploymentActionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toDeploymentResponse(dep))
+}
+
+// GET /api/apps/app/:id/ports
+func (h *DeploymentHandler) ListPortsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	ports, err := h.deploymentService.ListPorts(c.Request.Context(), appID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]PortEndpointResponse, 0, len(ports))
+	for _, p := range ports {
+		resp = append(resp, PortEndpointResponse{
+			Name:        p.Name,
+			Protocol:    p.Protocol,
+			Port:        p.Port,
+			ServiceType: p.ServiceType,
+			ServiceName: p.ServiceName,
+			NodePort:    p.NodePort,
+			Address:     p.Address,
+			UpdatedAt:   p.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// ANY /api/deployments/:id/proxy/*path
+func (h *DeploymentHandler) ProxyPreviewHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxProxyBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// the caller's user_id is for this API, not for the app
+	query := c.Request.URL.Query()
+	query.Del("user_id")
+
+	status, out, err := h.deploymentService.ProxyPreview(c.Request.Context(), uid, c.Request.Method, c.Param("path"), query, body)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, services.ErrNotPromotable) {
+			writeDeploymentActionError(c, err)
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(status, http.DetectContentType(out), out)
+}
+
+func writeDeploymentActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+	case errors.Is(err, services.ErrDeploymentNotCancellable), errors.Is(err, services.ErrNotPromotable),
+		errors.Is(err, services.ErrNotCanary):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDeploymentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
 }
 
 // POST /api/deployments/deploy
@@ -134,32 +277,153 @@ func (h *DeploymentHandler) DeployAppHandler(c *gin.Context) {
 		return
 	}
 
-	appUUID, err := uuid.Parse(req.AppID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid AppID"})
+	app, ok := deployRequestApp(c, req)
+	if !ok {
+		return
 	}
 
-	app := models.Application{
-		ID:       appUUID,
-		Name:     fmt.Sprintf("app-%s", req.AppID[:8]),
-		ImageURL: req.ImageURL,
+	if c.Query("dry_run") == "true" {
+		h.writePreview(c, app)
+		return
 	}
 
 	deployment, err := h.deploymentService.DeployApp(c.Request.Context(), app)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		writeDeployError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusAccepted, DeployAppResponse{
-		ID:      deployment.ID.String(),
-		AppID:   deployment.AppID.String(),
-		Version: req.Version,
-		Status:  deployment.Status,
-		Message: "Deployment initiated successfully",
+		ID:          deployment.ID.String(),
+		AppID:       deployment.AppID.String(),
+		Version:     req.Version,
+		Status:      deployment.Status,
+		ImageURL:    deployment.ImageURL,
+		ImageDigest: deployment.ImageDigest,
+		Message:     "Deployment queued",
 	})
 }
 
+// POST /api/deployments/preview
+func (h *DeploymentHandler) PreviewDeployHandler(c *gin.Context) {
+	var req DeployAppRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	app, ok := deployRequestApp(c, req)
+	if !ok {
+		return
+	}
+	h.writePreview(c, app)
+}
+
+// writePreview renders the manifests of a deploy as JSON, or as YAML with ?format=yaml.
+func (h *DeploymentHandler) writePreview(c *gin.Context, app models.Application) {
+	preview, err := h.deploymentService.PreviewDeploy(c.Request.Context(), app)
+	if err != nil {
+		writeDeployError(c, err)
+		return
+	}
+
+	if c.Query("format") == "yaml" {
+		out, err := preview.YAML()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/yaml", out)
+		return
+	}
+
+	resp := DeployPreviewResponse{
+		AppID:       app.ID.String(),
+		Objects:     make([]any, 0, len(preview.Objects)),
+		DryRun:      preview.DryRun,
+		DryRunError: preview.DryRunError,
+	}
+	for _, obj := range preview.Objects {
+		resp.Objects = append(resp.Objects, obj)
+	}
+	for _, d := range preview.Diffs {
+		resp.Diffs = append(resp.Diffs, ManifestDiffResponse{
+			Kind:     d.Kind,
+			Name:     d.Name,
+			LiveName: d.LiveName,
+			Diff:     d.Diff,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func toDeploymentResponse(dep *models.Deployment) DeploymentResponse {
+	resp := DeploymentResponse{
+		ID:             dep.ID.String(),
+		AppID:          dep.AppID.String(),
+		Version:        dep.Version,
+		Status:         dep.Status,
+		ImageURL:       dep.ImageURL,
+		ImageDigest:    dep.ImageDigest,
+		CancelledAt:    dep.CancelledAt,
+		RollbackReason: dep.RollbackReason,
+		Color:          dep.Color,
+		RetireAt:       dep.RetireAt,
+	}
+	if dep.Color != "" && dep.Status == "READY" {
+		resp.PreviewURL = fmt.Sprintf("/api/deployments/%s/proxy/", dep.ID)
+	}
+	if dep.CancelledBy != nil {
+		resp.CancelledBy = dep.CancelledBy.String()
+	}
+	if dep.CanaryOf != nil {
+		resp.CanaryOf = dep.CanaryOf.String()
+	}
+	if dep.EnvironmentID != nil {
+		resp.EnvironmentID = dep.EnvironmentID.String()
+	}
+	if dep.PromotedFrom != nil {
+		resp.PromotedFrom = dep.PromotedFrom.String()
+	}
+	if dep.ReleaseID != nil {
+		resp.ReleaseID = dep.ReleaseID.String()
+	}
+	if dep.SupersededBy != nil {
+		resp.SupersededBy = dep.SupersededBy.String()
+	}
+	return resp
+}
+
+func writeDeployError(c *gin.Context, err error) {
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+	case errors.Is(err, services.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrRegistryUnavailable):
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func deployRequestApp(c *gin.Context, req DeployAppRequest) (models.Application, bool) {
+	appUUID, err := uuid.Parse(req.AppID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid AppID"})
+		return models.Application{}, false
+	}
+
+	return models.Application{
+		ID:       appUUID,
+		Name:     fmt.Sprintf("app-%s", req.AppID[:8]),
+		ImageURL: req.ImageURL,
+	}, true
+}
+
 // GET /api/deployments/:id/status
 func (h *DeploymentHandler) GetDeploymentStatusHandler(c *gin.Context) {
 	idStr := c.Param("id")
@@ -175,10 +439,64 @@ func (h *DeploymentHandler) GetDeploymentStatusHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, DeploymentStatusResponse{
-		ID:     uid.String(),
-		Status: status,
-	})
+	resp := DeploymentStatusResponse{
+		ID:            uid.String(),
+		Status:        status.Status,
+		QueuePosition: status.QueuePosition,
+		Events:        make([]DeploymentEventResponse, 0, len(status.Events)),
+	}
+	if p := status.Canary; p != nil {
+		resp.Canary = &CanaryProgressResponse{
+			Step:           p.Step,
+			Steps:          p.Steps,
+			Weight:         p.Weight,
+			StableID:       p.StableID.String(),
+			CanaryReplicas: p.CanaryReplicas,
+			StableReplicas: p.StableReplicas,
+		}
+	}
+	for _, e := range status.Events {
+		resp.Events = append(resp.Events, DeploymentEventResponse{
+			Type:      e.Type,
+			Step:      e.Step,
+			Weight:    e.Weight,
+			Message:   e.Message,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GET /api/apps/app/:id/history
+func (h *DeploymentHandler) ListAppHistoryHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	events, err := h.deploymentService.ListAppHistory(c.Request.Context(), appID)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]DeploymentEventResponse, 0, len(events))
+	for _, e := range events {
+		resp = append(resp, DeploymentEventResponse{
+			DeploymentID: e.DeploymentID.String(),
+			Type:         e.Type,
+			Step:         e.Step,
+			Weight:       e.Weight,
+			Message:      e.Message,
+			CreatedAt:    e.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
 }
 
 // // DELETE /api/deployments/:id
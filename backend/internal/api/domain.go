@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DomainHandler struct {
+	domainService services.DomainService
+}
+
+func NewDomainHandler(s services.DomainService) *DomainHandler {
+	return &DomainHandler{domainService: s}
+}
+
+// GET /api/apps/app/:id/domains
+func (h *DomainHandler) ListDomainsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	domains, err := h.domainService.ListDomains(c.Request.Context(), appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]DomainResponse, 0, len(domains))
+	for i := range domains {
+		resp = append(resp, h.toDomainResponse(&domains[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/domains
+func (h *DomainHandler) AddDomainHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req AddDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	d, err := h.domainService.AddDomain(c.Request.Context(), appID, req.Hostname, req.TLS)
+	if err != nil {
+		writeDomainError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, h.toDomainResponse(d))
+}
+
+// POST /api/apps/app/:id/domains/:domainId/verify
+func (h *DomainHandler) VerifyDomainHandler(c *gin.Context) {
+	appID, domainID, ok := domainParams(c)
+	if !ok {
+		return
+	}
+
+	d, err := h.domainService.VerifyDomain(c.Request.Context(), appID, domainID)
+	if err != nil {
+		writeDomainError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.toDomainResponse(d))
+}
+
+// PUT /api/apps/app/:id/domains/:domainId/certificate
+func (h *DomainHandler) UploadCertificateHandler(c *gin.Context) {
+	appID, domainID, ok := domainParams(c)
+	if !ok {
+		return
+	}
+
+	var req UploadCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	d, err := h.domainService.UploadCertificate(c.Request.Context(), appID, domainID, req.Certificate, req.PrivateKey)
+	if err != nil {
+		writeDomainError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, h.toDomainResponse(d))
+}
+
+// DELETE /api/apps/app/:id/domains/:domainId
+func (h *DomainHandler) RemoveDomainHandler(c *gin.Context) {
+	appID, domainID, ok := domainParams(c)
+	if !ok {
+		return
+	}
+
+	if err := h.domainService.RemoveDomain(c.Request.Context(), appID, domainID); err != nil {
+		writeDomainError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "domain removed"})
+}
+
+func domainParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	domainID, err := uuid.Parse(c.Param("domainId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return appID, domainID, true
+}
+
+func writeDomainError(c *gin.Context, err error) {
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain or application not found"})
+	case errors.Is(err, services.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDomainExists), errors.Is(err, services.ErrDomainNotVerified):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *DomainHandler) toDomainResponse(d *models.Domain) DomainResponse {
+	resp := DomainResponse{
+		ID:            d.ID.String(),
+		AppID:         d.AppID.String(),
+		Hostname:      d.Hostname,
+		Verified:      d.VerifiedAt != nil,
+		VerifiedAt:    d.VerifiedAt,
+		TLS:           d.TLS,
+		CertStatus:    d.CertStatus,
+		CertExpiresAt: d.CertExpiresAt,
+		CreatedAt:     d.CreatedAt,
+	}
+	// the record is only needed until ownership is proven
+	if d.VerifiedAt == nil {
+		ch := h.domainService.Challenge(d)
+		resp.Challenge = &DomainChallengeResponse{Type: ch.Type, Name: ch.Name, Value: ch.Value}
+	}
+	return resp
+}
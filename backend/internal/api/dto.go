@@ -1,19 +1,41 @@
 package api
 
-import "time"
+import (
+	"time"
+
+	"mini-paas/backend/internal/models"
+)
 
 // ===== Application DTOs =====
 type CreateAppRequest struct {
-	Name        string `json:"name" binding:"required"`
-	GitURL      string `json:"git_url" binding:"required,url"`
-	Description string `json:"description"`
+	Name           string  `json:"name" binding:"required"`
+	GitURL         string  `json:"git_url" binding:"required,url"`
+	Description    string  `json:"description"`
+	ReleaseCommand string  `json:"release_command"`
+	TeamID         *string `json:"team_id"`
+}
+
+type UpdateAppRequest struct {
+	Name           *string `json:"name" binding:"omitempty,min=1"`
+	GitURL         *string `json:"git_url" binding:"omitempty,url"`
+	Description    *string `json:"description"`
+	ReleaseCommand *string `json:"release_command"`
 }
 
 type CreateAppResponse struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	Status      string `json:"status"`
-	Description string `json:"description"`
+	ID             string     `json:"id"`
+	Name           string     `json:"name"`
+	Status         string     `json:"status"`
+	Description    string     `json:"description"`
+	ReleaseCommand string     `json:"release_command,omitempty"`
+	SleepingSince  *time.Time `json:"sleeping_since,omitempty"`
+}
+
+type ApplyManifestResponse struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Created bool   `json:"created"`
 }
 
 type AppItem struct {
@@ -45,19 +67,33 @@ type CreateDeploymentRequest struct {
 }
 
 type DeploymentResponse struct {
-	ID      string `json:"id"`
-	AppID   string `json:"app_id"`
-	Version string `json:"version"`
-	Status  string `json:"status"`
+	ID             string     `json:"id"`
+	AppID          string     `json:"app_id"`
+	Version        string     `json:"version"`
+	Status         string     `json:"status"`
+	ImageURL       string     `json:"image_url,omitempty"`
+	ImageDigest    string     `json:"image_digest,omitempty"`
+	CancelledBy    string     `json:"cancelled_by,omitempty"`
+	CancelledAt    *time.Time `json:"cancelled_at,omitempty"`
+	RollbackReason string     `json:"rollback_reason,omitempty"`
+	Color          string     `json:"color,omitempty"`
+	PreviewURL     string     `json:"preview_url,omitempty"`
+	RetireAt       *time.Time `json:"retire_at,omitempty"`
+	CanaryOf       string     `json:"canary_of,omitempty"`
+	EnvironmentID  string     `json:"environment_id,omitempty"`
+	PromotedFrom   string     `json:"promoted_from,omitempty"`
+	ReleaseID      string     `json:"release_id,omitempty"`
+	SupersededBy   string     `json:"superseded_by,omitempty"`
 }
 
 type ListDeploymentsRequest struct {
-	AppID  *string `form:"owner_id"`
-	Status *string `form:"status"`
-	Limit  int     `form:"limit"`
-	Offset int     `form:"offset"`
-	SortBy string  `form:"sort"`
-	Desc   bool    `form:"desc"`
+	AppID       *string `form:"owner_id"`
+	Status      *string `form:"status"`
+	Environment *string `form:"environment"` // id or name
+	Limit       int     `form:"limit"`
+	Offset      int     `form:"offset"`
+	SortBy      string  `form:"sort"`
+	Desc        bool    `form:"desc"`
 }
 
 type DeployAppRequest struct {
@@ -67,16 +103,389 @@ type DeployAppRequest struct {
 }
 
 type DeployAppResponse struct {
-	ID      string `json:"id"`
-	AppID   string `json:"app_id"`
-	Version string `json:"version"`
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	ID          string `json:"id"`
+	AppID       string `json:"app_id"`
+	Version     string `json:"version"`
+	Status      string `json:"status"`
+	ImageURL    string `json:"image_url"`
+	ImageDigest string `json:"image_digest"`
+	Message     string `json:"message"`
+}
+
+type DeployPreviewResponse struct {
+	AppID       string                 `json:"app_id"`
+	Objects     []any                  `json:"objects"`
+	DryRun      bool                   `json:"dry_run"`
+	DryRunError string                 `json:"dry_run_error,omitempty"`
+	Diffs       []ManifestDiffResponse `json:"diffs,omitempty"`
+}
+
+type ManifestDiffResponse struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	LiveName string `json:"live_name,omitempty"`
+	Diff     string `json:"diff"`
 }
 
 type DeploymentStatusResponse struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
+	ID            string                    `json:"id"`
+	Status        string                    `json:"status"`
+	QueuePosition int                       `json:"queue_position,omitempty"`
+	Canary        *CanaryProgressResponse   `json:"canary,omitempty"`
+	Events        []DeploymentEventResponse `json:"events"`
+}
+
+type CanaryProgressResponse struct {
+	Step           int     `json:"step"`
+	Steps          []int32 `json:"steps"`
+	Weight         int32   `json:"weight"`
+	StableID       string  `json:"stable_id"`
+	CanaryReplicas int32   `json:"canary_replicas,omitempty"`
+	StableReplicas int32   `json:"stable_replicas,omitempty"`
+}
+
+type DeploymentEventResponse struct {
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	Type         string    `json:"type"`
+	Step         int       `json:"step,omitempty"`
+	Weight       int32     `json:"weight"`
+	Message      string    `json:"message"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ===== Cron DTOs =====
+type CronJobRequest struct {
+	Name                       string `json:"name" binding:"required"`
+	Schedule                   string `json:"schedule" binding:"required"`
+	Command                    string `json:"command" binding:"required"`
+	ConcurrencyPolicy          string `json:"concurrency_policy" binding:"omitempty,oneof=Allow Forbid Replace"`
+	SuccessfulJobsHistoryLimit *int32 `json:"successful_jobs_history_limit" binding:"omitempty,min=0"`
+	FailedJobsHistoryLimit     *int32 `json:"failed_jobs_history_limit" binding:"omitempty,min=0"`
+	Suspend                    bool   `json:"suspend"`
+}
+
+type CronJobResponse struct {
+	ID                         string `json:"id"`
+	AppID                      string `json:"app_id"`
+	Name                       string `json:"name"`
+	Schedule                   string `json:"schedule"`
+	Command                    string `json:"command"`
+	ConcurrencyPolicy          string `json:"concurrency_policy"`
+	SuccessfulJobsHistoryLimit int32  `json:"successful_jobs_history_limit"`
+	FailedJobsHistoryLimit     int32  `json:"failed_jobs_history_limit"`
+	Suspend                    bool   `json:"suspend"`
+}
+
+// ===== Volume DTOs =====
+type CreateVolumeRequest struct {
+	Name         string `json:"name" binding:"required"`
+	Size         string `json:"size" binding:"required"`
+	AccessMode   string `json:"access_mode" binding:"omitempty,oneof=ReadWriteOnce ReadOnlyMany ReadWriteMany"`
+	MountPath    string `json:"mount_path" binding:"required"`
+	StorageClass string `json:"storage_class"`
+}
+
+type VolumeResponse struct {
+	ID           string `json:"id"`
+	AppID        string `json:"app_id"`
+	Name         string `json:"name"`
+	Size         string `json:"size"`
+	AccessMode   string `json:"access_mode"`
+	MountPath    string `json:"mount_path"`
+	StorageClass string `json:"storage_class"`
+	ClaimName    string `json:"claim_name"`
+}
+
+// ===== Domain DTOs =====
+type AddDomainRequest struct {
+	Hostname string `json:"hostname" binding:"required"`
+	TLS      string `json:"tls" binding:"omitempty,oneof=cert-manager none"`
+}
+
+type UploadCertificateRequest struct {
+	Certificate string `json:"certificate" binding:"required"`
+	PrivateKey  string `json:"private_key" binding:"required"`
+}
+
+type DomainChallengeResponse struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type DomainResponse struct {
+	ID            string                   `json:"id"`
+	AppID         string                   `json:"app_id"`
+	Hostname      string                   `json:"hostname"`
+	Verified      bool                     `json:"verified"`
+	VerifiedAt    *time.Time               `json:"verified_at,omitempty"`
+	Challenge     *DomainChallengeResponse `json:"challenge,omitempty"`
+	TLS           string                   `json:"tls"`
+	CertStatus    string                   `json:"cert_status,omitempty"`
+	CertExpiresAt *time.Time               `json:"cert_expires_at,omitempty"`
+	CreatedAt     time.Time                `json:"created_at"`
+}
+
+type CreateLinkRequest struct {
+	TargetAppID string `json:"target_app_id" binding:"required"`
+	Alias       string `json:"alias"`
+}
+
+type LinkResponse struct {
+	ID          string    `json:"id"`
+	AppID       string    `json:"app_id"`
+	TargetAppID string    `json:"target_app_id"`
+	Alias       string    `json:"alias"`
+	Env         []string  `json:"env"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type MaintenanceRequest struct {
+	Message           string   `json:"message"`
+	RetryAfterSeconds int32    `json:"retry_after_seconds"`
+	AllowIPs          []string `json:"allow_ips"`
+	BypassToken       string   `json:"bypass_token"`
+}
+
+type MaintenanceResponse struct {
+	Enabled           bool       `json:"enabled"`
+	Message           string     `json:"message,omitempty"`
+	RetryAfterSeconds int32      `json:"retry_after_seconds,omitempty"`
+	AllowIPs          []string   `json:"allow_ips,omitempty"`
+	BypassHeader      string     `json:"bypass_header,omitempty"`
+	BypassToken       string     `json:"bypass_token,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
+
+type PortEndpointResponse struct {
+	Name        string    `json:"name"`
+	Protocol    string    `json:"protocol"`
+	Port        int32     `json:"port"`
+	ServiceType string    `json:"service_type"`
+	ServiceName string    `json:"service_name"`
+	NodePort    int32     `json:"node_port,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ===== Release DTOs =====
+type ListReleasesRequest struct {
+	Limit  int `form:"limit"`
+	Offset int `form:"offset"`
+}
+
+type ReleaseResponse struct {
+	ID             string           `json:"id"`
+	AppID          string           `json:"app_id"`
+	Version        int              `json:"version"`
+	ImageURL       string           `json:"image_url"`
+	ImageDigest    string           `json:"image_digest,omitempty"`
+	ReleaseCommand string           `json:"release_command,omitempty"`
+	Config         models.AppConfig `json:"config"`
+	Reason         string           `json:"reason"`
+	CreatedAt      time.Time        `json:"created_at"`
+}
+
+type DiffReleasesRequest struct {
+	From int `form:"from" binding:"required,min=1"`
+	To   int `form:"to" binding:"required,min=1"`
+}
+
+type ReleaseDiffResponse struct {
+	From    int    `json:"from"`
+	To      int    `json:"to"`
+	Changed bool   `json:"changed"`
+	Diff    string `json:"diff"`
+}
+
+// ===== Environment DTOs =====
+type CreateEnvironmentRequest struct {
+	Name     string            `json:"name" binding:"required"`
+	Replicas *int32            `json:"replicas" binding:"omitempty,min=0"`
+	Env      map[string]string `json:"env"`
+}
+
+type EnvironmentResponse struct {
+	ID        string              `json:"id"`
+	AppID     string              `json:"app_id"`
+	Name      string              `json:"name"`
+	Position  int                 `json:"position"`
+	EnvAppID  string              `json:"env_app_id"`
+	EnvApp    string              `json:"env_app"`
+	Namespace string              `json:"namespace,omitempty"`
+	Release   *DeploymentResponse `json:"release,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+// PromoteEnvironmentResponse is the release queued on the next environment.
+// It runs the promoted image with that environment's own config.
+type PromoteEnvironmentResponse struct {
+	Environment string             `json:"environment"`
+	Deployment  DeploymentResponse `json:"deployment"`
+}
+
+// ===== Preview DTOs =====
+// OpenPreviewRequest deploys the head of a pull request. The platform does not
+// build previews: without image it runs the parent's image repository tagged
+// with commit_sha, which CI has to push first. A missing tag is a 400.
+type OpenPreviewRequest struct {
+	PullRequest int    `json:"pull_request" binding:"required,min=1"`
+	Branch      string `json:"branch"`
+	CommitSHA   string `json:"commit_sha"`
+	Image       string `json:"image"`
+}
+
+type PreviewResponse struct {
+	ID           string     `json:"id"`
+	ParentID     string     `json:"parent_id"`
+	Name         string     `json:"name"`
+	PullRequest  int        `json:"pull_request"`
+	Branch       string     `json:"branch,omitempty"`
+	CommitSHA    string     `json:"commit_sha,omitempty"`
+	ImageURL     string     `json:"image_url"`
+	URL          string     `json:"url,omitempty"`
+	Namespace    string     `json:"namespace"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	DeploymentID string     `json:"deployment_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// PullRequestWebhook is the part of a git provider's pull_request webhook
+// that previews need; GitHub and Gitea send it in this shape.
+type PullRequestWebhook struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+	Repository struct {
+		CloneURL string `json:"clone_url"`
+		HTMLURL  string `json:"html_url"`
+		SSHURL   string `json:"ssh_url"`
+	} `json:"repository"`
+}
+
+// ===== Add-on DTOs =====
+type ProvisionAddOnRequest struct {
+	Type string `json:"type" binding:"required"`
+	Size string `json:"size"`
+}
+
+type AddOnResponse struct {
+	ID        string    `json:"id"`
+	AppID     string    `json:"app_id"`
+	Type      string    `json:"type"`
+	ConfigVar string    `json:"config_var"`
+	Size      string    `json:"size"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ===== Run DTOs =====
+type RunCommandRequest struct {
+	Command string `json:"command" binding:"required"`
+}
+
+type RunResponse struct {
+	ID           string     `json:"id"`
+	AppID        string     `json:"app_id"`
+	DeploymentID string     `json:"deployment_id"`
+	Command      string     `json:"command"`
+	Status       string     `json:"status"`
+	ExitCode     *int32     `json:"exit_code"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	DurationMs   int64      `json:"duration_ms"`
+	StreamURL    string     `json:"stream_url"`
+}
+
+// ===== Team DTOs =====
+type CreateTeamRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type AddTeamMemberRequest struct {
+	UserID string `json:"user_id" binding:"required"`
+}
+
+type TeamResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ===== Registry DTOs =====
+type CreateRegistryCredentialRequest struct {
+	Server   string  `json:"server" binding:"required"`
+	Username string  `json:"username" binding:"required"`
+	Token    string  `json:"token" binding:"required"`
+	TeamID   *string `json:"team_id"`
+}
+
+type RegistryCredentialResponse struct {
+	ID        string    `json:"id"`
+	Server    string    `json:"server"`
+	Username  string    `json:"username"`
+	UserID    string    `json:"user_id,omitempty"`
+	TeamID    string    `json:"team_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ===== Quota DTOs =====
+// QuotaRequest puts a user or team on a plan; a nil limit uses the plan's.
+type QuotaRequest struct {
+	Plan         string `json:"plan"`
+	MaxApps      *int64 `json:"max_apps"`
+	MaxCPUMillis *int64 `json:"max_cpu_millis"`
+	MaxMemoryMiB *int64 `json:"max_memory_mib"`
+	MaxReplicas  *int64 `json:"max_replicas"`
+	MaxVolumes   *int64 `json:"max_volumes"`
+	MaxDomains   *int64 `json:"max_domains"`
+}
+
+type QuotaLimitsResponse struct {
+	Apps      int64 `json:"apps"`
+	CPUMillis int64 `json:"cpu_millis"`
+	MemoryMiB int64 `json:"memory_mib"`
+	Replicas  int64 `json:"replicas"`
+	Volumes   int64 `json:"volumes"`
+	Domains   int64 `json:"domains"`
+}
+
+type QuotaResponse struct {
+	Plan   string              `json:"plan"`
+	Limits QuotaLimitsResponse `json:"limits"`
+	Usage  QuotaLimitsResponse `json:"usage"`
+}
+
+// ===== Garbage collection DTOs =====
+type GCReleaseResponse struct {
+	ID        string    `json:"id"`
+	AppID     string    `json:"app_id"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GCObjectResponse struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+type GCReportResponse struct {
+	DryRun         bool                `json:"dry_run"`
+	RetainReleases int                 `json:"retain_releases"`
+	RetainLogDays  int                 `json:"retain_log_days"`
+	Retired        []GCReleaseResponse `json:"retired"`
+	Pruned         []GCReleaseResponse `json:"pruned"`
+	LogsBefore     time.Time           `json:"logs_before"`
+	Logs           int64               `json:"logs"`
+	ReplicaSets    []string            `json:"replica_sets"`
+	Orphans        []GCObjectResponse  `json:"orphans"`
+	Errors         []string            `json:"errors,omitempty"`
 }
 
 // ===== User DTOs =====
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type EnvironmentHandler struct {
+	envService services.EnvironmentService
+}
+
+func NewEnvironmentHandler(s services.EnvironmentService) *EnvironmentHandler {
+	return &EnvironmentHandler{envService: s}
+}
+
+// GET /api/apps/app/:id/environments
+func (h *EnvironmentHandler) ListEnvironmentsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	envs, err := h.envService.ListEnvironments(c.Request.Context(), appID)
+	if err != nil {
+		writeEnvironmentError(c, err)
+		return
+	}
+	resp := make([]EnvironmentResponse, 0, len(envs))
+	for i := range envs {
+		resp = append(resp, toEnvironmentResponse(&envs[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/environments
+func (h *EnvironmentHandler) CreateEnvironmentHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req CreateEnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	env, err := h.envService.CreateEnvironment(c.Request.Context(), currentUser(c), appID, req.Name, services.EnvironmentConfig{
+		Replicas: req.Replicas,
+		Env:      req.Env,
+	})
+	if err != nil {
+		writeEnvironmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toEnvironmentResponse(env))
+}
+
+// POST /api/apps/app/:id/environments/:env/promote
+// Only the image is promoted; the next environment keeps its own config.
+func (h *EnvironmentHandler) PromoteHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	to, deploy, err := h.envService.Promote(c.Request.Context(), currentUser(c), appID, c.Param("env"))
+	if err != nil {
+		writeEnvironmentError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, PromoteEnvironmentResponse{
+		Environment: to.Name,
+		Deployment:  toDeploymentResponse(deploy),
+	})
+}
+
+func writeEnvironmentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "environment or application not found"})
+	case errors.Is(err, services.ErrInvalidEnvironment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEnvironmentForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEnvironmentExists), errors.Is(err, services.ErrNothingToPromote):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeDeployError(c, err)
+	}
+}
+
+func toEnvironmentResponse(s *services.EnvironmentStatus) EnvironmentResponse {
+	resp := EnvironmentResponse{
+		ID:        s.Environment.ID.String(),
+		AppID:     s.Environment.AppID.String(),
+		Name:      s.Environment.Name,
+		Position:  s.Environment.Position,
+		EnvAppID:  s.Environment.EnvAppID.String(),
+		EnvApp:    s.App.Name,
+		Namespace: s.Environment.Namespace,
+		CreatedAt: s.Environment.CreatedAt,
+	}
+	if s.Release != nil {
+		release := toDeploymentResponse(s.Release)
+		resp.Release = &release
+	}
+	return resp
+}
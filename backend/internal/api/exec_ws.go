@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// execMessage is sent by the client: terminal input or a resize.
+type execMessage struct {
+	Op   string `json:"op"` // stdin | resize
+	Data string `json:"data"`
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+type ExecWSHandler struct {
+	execService services.ExecService
+	ws          *LogWSHandler // ping/pong and deadline handling
+	readLimit   int64
+}
+
+func NewExecWSHandler(es services.ExecService, ws *LogWSHandler) *ExecWSHandler {
+	return &ExecWSHandler{execService: es, ws: ws, readLimit: 64 * 1024}
+}
+
+// GET /api/deployments/:id/exec?pod=&container=&command=
+func (h *ExecWSHandler) ExecDeployment(c *gin.Context) {
+	deployID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	command := strings.Fields(c.DefaultQuery("command", "/bin/sh"))
+
+	// checked before the upgrade, so a refused shell is a plain HTTP error
+	target, err := h.execService.ResolveTarget(c.Request.Context(), currentUser(c), deployID, c.Query("pod"), c.Query("container"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "deployment not found"})
+		case errors.Is(err, services.ErrExecForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrPodNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	wsConn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	defer wsConn.Close()
+
+	h.ws.prepareConn(wsConn, h.readLimit)
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	go h.ws.keepAlive(ctx, cancel, wsConn)
+
+	stdinR, stdinW := io.Pipe()
+	resize := newTerminalSizeQueue()
+	out := &wsWriter{conn: wsConn, writeWait: h.ws.writeWait}
+
+	// reader: client messages feed stdin and resizes
+	go func() {
+		defer cancel()
+		defer stdinW.Close()
+		defer resize.close()
+		for {
+			_, data, err := wsConn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg execMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Op {
+			case "stdin":
+				if _, err := stdinW.Write([]byte(msg.Data)); err != nil {
+					return
+				}
+			case "resize":
+				resize.push(remotecommand.TerminalSize{Width: msg.Cols, Height: msg.Rows})
+			}
+		}
+	}()
+
+	// closing stdin when the session is cancelled ends the remote shell
+	go func() {
+		<-ctx.Done()
+		stdinW.Close()
+	}()
+
+	err = h.execService.Exec(ctx, currentUser(c), target, command, services.ExecStreams{
+		Stdin:  stdinR,
+		Stdout: out,
+		Resize: resize,
+	})
+	if err != nil {
+		_, _ = out.Write([]byte(fmt.Sprintf("\r\nerror: %v\r\n", err)))
+	}
+	_ = wsConn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(h.ws.writeWait))
+}
+
+// wsWriter forwards terminal output as binary frames with a write deadline.
+type wsWriter struct {
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	writeWait time.Duration
+}
+
+func (w *wsWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.writeWait))
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// terminalSizeQueue implements remotecommand.TerminalSizeQueue over a channel.
+type terminalSizeQueue struct {
+	ch   chan remotecommand.TerminalSize
+	once sync.Once
+}
+
+func newTerminalSizeQueue() *terminalSizeQueue {
+	return &terminalSizeQueue{ch: make(chan remotecommand.TerminalSize, 4)}
+}
+
+func (q *terminalSizeQueue) push(size remotecommand.TerminalSize) {
+	select {
+	case q.ch <- size:
+	default:
+		// drop stale sizes, the next resize will catch up
+	}
+}
+
+func (q *terminalSizeQueue) close() {
+	q.once.Do(func() { close(q.ch) })
+}
+
+// Next returns nil once the session is over, which stops the resize loop.
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q.ch
+	if !ok {
+		return nil
+	}
+	return &size
+}
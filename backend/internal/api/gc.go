@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GCHandler struct {
+	gcService services.GCService
+}
+
+func NewGCHandler(s services.GCService) *GCHandler {
+	return &GCHandler{gcService: s}
+}
+
+// GET /api/admin/gc
+func (h *GCHandler) PlanHandler(c *gin.Context) {
+	report, err := h.gcService.Plan(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toGCReportResponse(report))
+}
+
+// POST /api/admin/gc
+func (h *GCHandler) CollectHandler(c *gin.Context) {
+	report, err := h.gcService.Collect(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, toGCReportResponse(report))
+}
+
+func toGCReportResponse(r *services.GCReport) GCReportResponse {
+	releases := func(deps []models.Deployment) []GCReleaseResponse {
+		out := make([]GCReleaseResponse, 0, len(deps))
+		for _, d := range deps {
+			out = append(out, GCReleaseResponse{
+				ID:        d.ID.String(),
+				AppID:     d.AppID.String(),
+				Status:    d.Status,
+				CreatedAt: d.CreatedAt,
+			})
+		}
+		return out
+	}
+	orphans := make([]GCObjectResponse, 0, len(r.Orphans))
+	for _, o := range r.Orphans {
+		orphans = append(orphans, GCObjectResponse{Kind: o.Kind, Name: o.Name, Reason: o.Reason})
+	}
+	replicaSets := r.ReplicaSets
+	if replicaSets == nil {
+		replicaSets = []string{}
+	}
+	return GCReportResponse{
+		DryRun:         r.DryRun,
+		RetainReleases: r.Policy.Releases,
+		RetainLogDays:  r.Policy.LogDays,
+		Retired:        releases(r.Retired),
+		Pruned:         releases(r.Pruned),
+		LogsBefore:     r.LogsBefore,
+		Logs:           r.Logs,
+		ReplicaSets:    replicaSets,
+		Orphans:        orphans,
+		Errors:         r.Errors,
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type LinkHandler struct {
+	linkService services.LinkService
+}
+
+func NewLinkHandler(s services.LinkService) *LinkHandler {
+	return &LinkHandler{linkService: s}
+}
+
+// GET /api/apps/app/:id/links
+func (h *LinkHandler) ListLinksHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	links, err := h.linkService.ListLinks(c.Request.Context(), appID)
+	if err != nil {
+		writeLinkError(c, err)
+		return
+	}
+	resp := make([]LinkResponse, 0, len(links))
+	for i := range links {
+		resp = append(resp, toLinkResponse(&links[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/links
+func (h *LinkHandler) CreateLinkHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req CreateLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targetID, err := uuid.Parse(req.TargetAppID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid target_app_id"})
+		return
+	}
+
+	link, err := h.linkService.CreateLink(c.Request.Context(), currentUser(c), appID, targetID, req.Alias)
+	if err != nil {
+		writeLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toLinkResponse(link))
+}
+
+// DELETE /api/apps/app/:id/links/:linkId
+func (h *LinkHandler) DeleteLinkHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	linkID, err := uuid.Parse(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid link UUID"})
+		return
+	}
+
+	if err := h.linkService.DeleteLink(c.Request.Context(), currentUser(c), appID, linkID); err != nil {
+		writeLinkError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "link removed"})
+}
+
+func writeLinkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "link or application not found"})
+	case errors.Is(err, services.ErrInvalidLink):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLinkForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLinkExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toLinkResponse(l *models.AppLink) LinkResponse {
+	return LinkResponse{
+		ID:          l.ID.String(),
+		AppID:       l.AppID.String(),
+		TargetAppID: l.TargetAppID.String(),
+		Alias:       l.Alias,
+		Env:         []string{l.Alias + "_URL", l.Alias + "_HOST", l.Alias + "_PORT"},
+		CreatedAt:   l.CreatedAt,
+	}
+}
@@ -103,6 +103,7 @@ func (h *LogHandler) ListAllLogsHandler(c *gin.Context) {
 	})
 }
 
+// GET /api/deployments/:id/logs/stream?follow=true
 func (h *LogHandler) StreamLogsHandler(c *gin.Context) {
 	deploymentID := c.Param("id")
 	follow := c.Query("follow") == "true"
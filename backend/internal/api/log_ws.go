@@ -65,12 +65,7 @@ func (h *LogWSHandler) StreamDeploymentLogs(c *gin.Context) {
 	defer wsConn.Close()
 
 	// set deadlines and handlers
-	wsConn.SetReadLimit(512)
-	_ = wsConn.SetReadDeadline(time.Now().Add(h.pongWait))
-	wsConn.SetPongHandler(func(string) error {
-		_ = wsConn.SetReadDeadline(time.Now().Add(h.pongWait))
-		return nil
-	})
+	h.prepareConn(wsConn, 512)
 
 	// find pods
 	ctx, cancel := context.WithCancel(c.Request.Context())
@@ -95,22 +90,17 @@ func (h *LogWSHandler) StreamDeploymentLogs(c *gin.Context) {
 	lineCh := make(chan string, h.maxQueue)
 	go services.StreamToLines(ctx, stream, lineCh)
 
+	go h.keepAlive(ctx, cancel, wsConn)
+
 	// writer: send lines to ws with write deadline
 	writeErrCh := make(chan error, 1)
 	go func() {
-		ticker := time.NewTicker(h.pingPeriod)
-		defer ticker.Stop()
 		for {
 			select {
 			case <-ctx.Done():
 				writeErrCh <- nil
 				return
 
-			case <-ticker.C:
-				if err := wsConn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(h.writeWait)); err != nil {
-					writeErrCh <- nil
-					return
-				}
 			case line, ok := <-lineCh:
 				if !ok {
 					writeErrCh <- nil
@@ -145,3 +135,32 @@ func (h *LogWSHandler) StreamDeploymentLogs(c *gin.Context) {
 		// cancelled
 	}
 }
+
+// prepareConn applies the read limit and extends the read deadline on every pong,
+// so a silent client is dropped after pongWait.
+func (h *LogWSHandler) prepareConn(wsConn *websocket.Conn, readLimit int64) {
+	wsConn.SetReadLimit(readLimit)
+	_ = wsConn.SetReadDeadline(time.Now().Add(h.pongWait))
+	wsConn.SetPongHandler(func(string) error {
+		_ = wsConn.SetReadDeadline(time.Now().Add(h.pongWait))
+		return nil
+	})
+}
+
+// keepAlive pings the client every pingPeriod and cancels the session once a
+// ping cannot be written. WriteControl is safe to call alongside other writers.
+func (h *LogWSHandler) keepAlive(ctx context.Context, cancel context.CancelFunc, wsConn *websocket.Conn) {
+	ticker := time.NewTicker(h.pingPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := wsConn.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(h.writeWait)); err != nil {
+				cancel()
+				return
+			}
+		}
+	}
+}
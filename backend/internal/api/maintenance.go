@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type MaintenanceHandler struct {
+	activator services.ActivatorService
+}
+
+func NewMaintenanceHandler(activator services.ActivatorService) *MaintenanceHandler {
+	return &MaintenanceHandler{activator: activator}
+}
+
+// GET /api/apps/app/:id/maintenance
+func (h *MaintenanceHandler) GetMaintenanceHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	m, err := h.activator.GetMaintenance(c.Request.Context(), appID)
+	if err != nil {
+		writeMaintenanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toMaintenanceResponse(m))
+}
+
+// POST /api/apps/app/:id/maintenance
+func (h *MaintenanceHandler) EnableMaintenanceHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req MaintenanceRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	m, err := h.activator.EnableMaintenance(c.Request.Context(), appID, services.MaintenanceOptions{
+		Message:           req.Message,
+		RetryAfterSeconds: req.RetryAfterSeconds,
+		AllowIPs:          req.AllowIPs,
+		BypassToken:       req.BypassToken,
+	})
+	if err != nil {
+		writeMaintenanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toMaintenanceResponse(m))
+}
+
+// DELETE /api/apps/app/:id/maintenance
+func (h *MaintenanceHandler) DisableMaintenanceHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	if err := h.activator.DisableMaintenance(c.Request.Context(), appID); err != nil {
+		writeMaintenanceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, MaintenanceResponse{Enabled: false})
+}
+
+func writeMaintenanceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+	case errors.Is(err, services.ErrInvalidMaintenance):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNoPlatformEndpoint):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toMaintenanceResponse(m *models.AppMaintenance) MaintenanceResponse {
+	if !m.Enabled {
+		return MaintenanceResponse{Enabled: false}
+	}
+	return MaintenanceResponse{
+		Enabled:           true,
+		Message:           m.Message,
+		RetryAfterSeconds: m.RetryAfterSeconds,
+		AllowIPs:          m.AllowIPs,
+		BypassHeader:      services.MaintenanceBypassHeader,
+		BypassToken:       m.BypassToken,
+		Since:             m.Since,
+	}
+}
+
+var maintenancePage = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Down for maintenance</title>
+<style>body{font-family:sans-serif;max-width:40em;margin:4em auto;padding:0 1em;color:#333}</style>
+</head>
+<body>
+<h1>Down for maintenance</h1>
+<p>{{.}}</p>
+</body>
+</html>
+`))
+
+// writeMaintenancePage answers in place of an app in maintenance.
+func writeMaintenancePage(c *gin.Context, m *models.AppMaintenance) {
+	c.Header("Retry-After", strconv.Itoa(int(m.RetryAfterSeconds)))
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(http.StatusServiceUnavailable)
+	if err := maintenancePage.Execute(c.Writer, m.Message); err != nil {
+		c.Error(err)
+	}
+}
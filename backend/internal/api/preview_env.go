@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type PreviewEnvHandler struct {
+	previewService services.PreviewEnvService
+}
+
+func NewPreviewEnvHandler(s services.PreviewEnvService) *PreviewEnvHandler {
+	return &PreviewEnvHandler{previewService: s}
+}
+
+// GET /api/apps/app/:id/previews
+func (h *PreviewEnvHandler) ListPreviewsHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	previews, err := h.previewService.ListPreviews(c.Request.Context(), appID)
+	if err != nil {
+		writePreviewError(c, err)
+		return
+	}
+	resp := make([]PreviewResponse, 0, len(previews))
+	for i := range previews {
+		resp = append(resp, toPreviewResponse(&previews[i], nil))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/previews
+func (h *PreviewEnvHandler) OpenPreviewHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req OpenPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, deploy, err := h.previewService.OpenPreview(c.Request.Context(), currentUser(c), appID, services.PreviewSpec{
+		PullRequest: req.PullRequest,
+		Branch:      req.Branch,
+		CommitSHA:   req.CommitSHA,
+		Image:       req.Image,
+	})
+	if err != nil {
+		writePreviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, toPreviewResponse(preview, deploy))
+}
+
+// DELETE /api/apps/app/:id/previews/:number
+func (h *PreviewEnvHandler) ClosePreviewHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	number, err := strconv.Atoi(c.Param("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pull request number"})
+		return
+	}
+
+	if err := h.previewService.ClosePreview(c.Request.Context(), currentUser(c), appID, number); err != nil {
+		writePreviewError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "preview closed"})
+}
+
+// POST /api/webhooks/git
+func (h *PreviewEnvHandler) GitWebhookHandler(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.previewService.VerifyWebhook(payload, c.GetHeader("X-Hub-Signature-256")); err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	event := c.GetHeader("X-GitHub-Event")
+	if event == "" {
+		event = c.GetHeader("X-Gitea-Event")
+	}
+	if event != "pull_request" {
+		c.JSON(http.StatusOK, gin.H{"message": "event ignored"})
+		return
+	}
+
+	var hook PullRequestWebhook
+	if err := json.Unmarshal(payload, &hook); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	previews, err := h.previewService.HandlePullRequest(c.Request.Context(), services.PullRequestEvent{
+		Action:      hook.Action,
+		PullRequest: hook.Number,
+		Branch:      hook.PullRequest.Head.Ref,
+		CommitSHA:   hook.PullRequest.Head.SHA,
+		RepoURLs:    []string{hook.Repository.CloneURL, hook.Repository.HTMLURL, hook.Repository.SSHURL},
+	})
+	if err != nil {
+		writePreviewError(c, err)
+		return
+	}
+	resp := make([]PreviewResponse, 0, len(previews))
+	for i := range previews {
+		resp = append(resp, toPreviewResponse(&previews[i], nil))
+	}
+	c.JSON(http.StatusAccepted, gin.H{"items": resp})
+}
+
+func writePreviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "preview or application not found"})
+	case errors.Is(err, services.ErrInvalidPreview), errors.Is(err, services.ErrInvalidDomain):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPreviewForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDomainExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		writeDeployError(c, err)
+	}
+}
+
+func toPreviewResponse(app *models.Application, deploy *models.Deployment) PreviewResponse {
+	resp := PreviewResponse{
+		ID:          app.ID.String(),
+		Name:        app.Name,
+		PullRequest: app.PullRequest,
+		Branch:      app.Branch,
+		CommitSHA:   app.CommitSHA,
+		ImageURL:    app.ImageURL,
+		URL:         app.DeployURL,
+		Namespace:   app.Namespace,
+		ExpiresAt:   app.ExpiresAt,
+		CreatedAt:   app.CreatedAt,
+	}
+	if app.ParentID != nil {
+		resp.ParentID = app.ParentID.String()
+	}
+	if deploy != nil {
+		resp.DeploymentID = deploy.ID.String()
+	}
+	return resp
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type QuotaHandler struct {
+	quotaService services.QuotaService
+}
+
+func NewQuotaHandler(s services.QuotaService) *QuotaHandler {
+	return &QuotaHandler{quotaService: s}
+}
+
+// GET /api/admin/quotas/users/:id
+func (h *QuotaHandler) GetUserQuotaHandler(c *gin.Context) {
+	h.get(c, h.quotaService.GetUserQuota)
+}
+
+// GET /api/admin/quotas/teams/:id
+func (h *QuotaHandler) GetTeamQuotaHandler(c *gin.Context) {
+	h.get(c, h.quotaService.GetTeamQuota)
+}
+
+// PUT /api/admin/quotas/users/:id
+func (h *QuotaHandler) SetUserQuotaHandler(c *gin.Context) {
+	h.set(c, h.quotaService.SetUserQuota)
+}
+
+// PUT /api/admin/quotas/teams/:id
+func (h *QuotaHandler) SetTeamQuotaHandler(c *gin.Context) {
+	h.set(c, h.quotaService.SetTeamQuota)
+}
+
+func (h *QuotaHandler) get(c *gin.Context, get func(context.Context, uuid.UUID) (*services.QuotaStatus, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	status, err := get(c.Request.Context(), id)
+	if err != nil {
+		writeQuotaAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toQuotaResponse(status))
+}
+
+func (h *QuotaHandler) set(c *gin.Context, set func(context.Context, uuid.UUID, models.Quota) (*services.QuotaStatus, error)) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := set(c.Request.Context(), id, models.Quota{
+		Plan:         req.Plan,
+		MaxApps:      req.MaxApps,
+		MaxCPUMillis: req.MaxCPUMillis,
+		MaxMemoryMiB: req.MaxMemoryMiB,
+		MaxReplicas:  req.MaxReplicas,
+		MaxVolumes:   req.MaxVolumes,
+		MaxDomains:   req.MaxDomains,
+	})
+	if err != nil {
+		writeQuotaAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toQuotaResponse(status))
+}
+
+func writeQuotaAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "user or team not found"})
+	case errors.Is(err, services.ErrInvalidQuota):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// writeQuotaError answers 403 naming the exceeded limit when err is a quota
+// error, and reports whether it was.
+func writeQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *services.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":     quotaErr.Error(),
+		"limit":     quotaErr.Limit,
+		"max":       quotaErr.Max,
+		"requested": quotaErr.Requested,
+	})
+	return true
+}
+
+func toQuotaResponse(s *services.QuotaStatus) QuotaResponse {
+	limits := func(l services.QuotaLimits) QuotaLimitsResponse {
+		return QuotaLimitsResponse{
+			Apps:      l.Apps,
+			CPUMillis: l.CPUMillis,
+			MemoryMiB: l.MemoryMiB,
+			Replicas:  l.Replicas,
+			Volumes:   l.Volumes,
+			Domains:   l.Domains,
+		}
+	}
+	return QuotaResponse{Plan: s.Plan, Limits: limits(s.Limits), Usage: limits(s.Usage)}
+}
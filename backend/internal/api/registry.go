@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RegistryHandler struct {
+	registryService services.RegistryService
+}
+
+func NewRegistryHandler(s services.RegistryService) *RegistryHandler {
+	return &RegistryHandler{registryService: s}
+}
+
+// GET /api/registry-credentials
+func (h *RegistryHandler) ListCredentialsHandler(c *gin.Context) {
+	creds, err := h.registryService.ListCredentials(c.Request.Context(), currentUser(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]RegistryCredentialResponse, 0, len(creds))
+	for i := range creds {
+		resp = append(resp, toRegistryCredentialResponse(&creds[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/registry-credentials
+func (h *RegistryHandler) CreateCredentialHandler(c *gin.Context) {
+	var req CreateRegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var teamID *uuid.UUID
+	if req.TeamID != nil {
+		tid, err := uuid.Parse(*req.TeamID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid team_id"})
+			return
+		}
+		teamID = &tid
+	}
+
+	cred, err := h.registryService.CreateCredential(c.Request.Context(), currentUser(c), teamID, req.Server, req.Username, req.Token)
+	if err != nil {
+		writeRegistryError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toRegistryCredentialResponse(cred))
+}
+
+// DELETE /api/registry-credentials/:id
+func (h *RegistryHandler) DeleteCredentialHandler(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	if err := h.registryService.DeleteCredential(c.Request.Context(), currentUser(c), id); err != nil {
+		writeRegistryError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "registry credential deleted"})
+}
+
+func writeRegistryError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "registry credential or team not found"})
+	case errors.Is(err, services.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCredential):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// the token is write-only and never leaves the server
+func toRegistryCredentialResponse(cred *models.RegistryCredential) RegistryCredentialResponse {
+	resp := RegistryCredentialResponse{
+		ID:        cred.ID.String(),
+		Server:    cred.Server,
+		Username:  cred.Username,
+		CreatedAt: cred.CreatedAt,
+	}
+	if cred.UserID != nil {
+		resp.UserID = cred.UserID.String()
+	}
+	if cred.TeamID != nil {
+		resp.TeamID = cred.TeamID.String()
+	}
+	return resp
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ReleaseHandler struct {
+	releaseService services.ReleaseService
+}
+
+func NewReleaseHandler(s services.ReleaseService) *ReleaseHandler {
+	return &ReleaseHandler{releaseService: s}
+}
+
+// GET /api/apps/app/:id/releases
+func (h *ReleaseHandler) ListReleasesHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req ListReleasesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := repository.Page{Limit: req.Limit, Offset: req.Offset}
+	releases, err := h.releaseService.ListReleases(c.Request.Context(), appID, page)
+	if err != nil {
+		writeReleaseError(c, err)
+		return
+	}
+	resp := make([]ReleaseResponse, 0, len(releases.Items))
+	for i := range releases.Items {
+		resp = append(resp, toReleaseResponse(&releases.Items[i]))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"items":  resp,
+		"total":  releases.Total,
+		"limit":  page.Limit,
+		"offset": page.Offset,
+	})
+}
+
+// GET /api/apps/app/:id/releases/:version
+func (h *ReleaseHandler) GetReleaseHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid release version"})
+		return
+	}
+
+	release, err := h.releaseService.GetRelease(c.Request.Context(), appID, version)
+	if err != nil {
+		writeReleaseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, toReleaseResponse(release))
+}
+
+// GET /api/apps/app/:id/releases/diff?from=&to=
+func (h *ReleaseHandler) DiffReleasesHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	var req DiffReleasesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	diff, err := h.releaseService.DiffReleases(c.Request.Context(), appID, req.From, req.To)
+	if err != nil {
+		writeReleaseError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, ReleaseDiffResponse{
+		From:    diff.From.Version,
+		To:      diff.To.Version,
+		Changed: diff.Diff != "",
+		Diff:    diff.Diff,
+	})
+}
+
+func writeReleaseError(c *gin.Context, err error) {
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "release or application not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+func toReleaseResponse(r *models.Release) ReleaseResponse {
+	return ReleaseResponse{
+		ID:             r.ID.String(),
+		AppID:          r.AppID.String(),
+		Version:        r.Version,
+		ImageURL:       r.ImageURL,
+		ImageDigest:    r.ImageDigest,
+		ReleaseCommand: r.ReleaseCommand,
+		Config:         r.Config,
+		Reason:         r.Reason,
+		CreatedAt:      r.CreatedAt,
+	}
+}
@@ -12,15 +12,68 @@ func SetUpRoutes(
 	deployService services.DeploymentService,
 	userService services.UserService,
 	logService services.LogService,
+	cronService services.CronService,
+	runService services.RunService,
+	k8sLogService services.K8sLogService,
+	execService services.ExecService,
+	volumeService services.VolumeService,
+	addOnService services.AddOnService,
+	teamService services.TeamService,
+	registryService services.RegistryService,
+	domainService services.DomainService,
+	activatorService services.ActivatorService,
+	linkService services.LinkService,
+	quotaService services.QuotaService,
+	gcService services.GCService,
+	previewService services.PreviewEnvService,
+	envService services.EnvironmentService,
+	releaseService services.ReleaseService,
 ) {
 	api := r.Group("/api")
 
 	// app routes
-	appHandler := NewAppHandler(appService)
-	api.POST("/apps", appHandler.CreateNewApp)
+	appHandler := NewAppHandler(appService, teamService)
+	api.POST("/apps", RequireUser(userService), appHandler.CreateNewApp)
 	api.GET("/apps", appHandler.ListAllApps)
 	api.GET("/apps/app/:id", appHandler.GetApplicatonByID)
-	api.DELETE("/apps/app/:id", appHandler.DeleteApplication)
+	api.PATCH("/apps/app/:id", RequireUser(userService), appHandler.UpdateApplication)
+	api.DELETE("/apps/app/:id", RequireUser(userService), appHandler.DeleteApplication)
+	api.PUT("/apps/apply", RequireUser(userService), appHandler.ApplyManifest)
+	api.GET("/apps/app/:id/manifest", appHandler.ExportManifest)
+
+	// volumes
+	volumeHandler := NewVolumeHandler(volumeService)
+	api.GET("/apps/app/:id/volumes", volumeHandler.ListVolumesHandler)
+	api.POST("/apps/app/:id/volumes", volumeHandler.CreateVolumeHandler)
+	api.DELETE("/apps/app/:id/volumes/:volumeId", volumeHandler.DeleteVolumeHandler)
+
+	// custom domains
+	domainHandler := NewDomainHandler(domainService)
+	api.GET("/apps/app/:id/domains", domainHandler.ListDomainsHandler)
+	api.POST("/apps/app/:id/domains", domainHandler.AddDomainHandler)
+	api.POST("/apps/app/:id/domains/:domainId/verify", domainHandler.VerifyDomainHandler)
+	api.PUT("/apps/app/:id/domains/:domainId/certificate", domainHandler.UploadCertificateHandler)
+	api.DELETE("/apps/app/:id/domains/:domainId", domainHandler.RemoveDomainHandler)
+
+	// add-ons
+	addOnHandler := NewAddOnHandler(addOnService)
+	api.GET("/addons/catalog", addOnHandler.CatalogHandler)
+	api.GET("/apps/app/:id/addons", addOnHandler.ListAddOnsHandler)
+	api.POST("/apps/app/:id/addons", addOnHandler.ProvisionAddOnHandler)
+	api.GET("/apps/app/:id/addons/:addonId", addOnHandler.GetAddOnHandler)
+	api.DELETE("/apps/app/:id/addons/:addonId", addOnHandler.DeprovisionAddOnHandler)
+
+	// cron
+	cronHandler := NewCronHandler(cronService)
+	api.GET("/apps/app/:id/cron", cronHandler.ListCronJobsHandler)
+	api.POST("/apps/app/:id/cron", cronHandler.CreateCronJobHandler)
+	api.PUT("/apps/app/:id/cron/:cronId", cronHandler.UpdateCronJobHandler)
+	api.DELETE("/apps/app/:id/cron/:cronId", cronHandler.DeleteCronJobHandler)
+
+	// one-off runs
+	runHandler := NewRunHandler(runService)
+	api.POST("/apps/app/:id/run", RequireUser(userService), runHandler.StartRunHandler)
+	api.GET("/runs/:id", RequireUser(userService), runHandler.GetRunHandler)
 
 	// deployment
 	depHandler := NewDeploymentHandler(deployService)
@@ -28,7 +81,70 @@ func SetUpRoutes(
 	api.GET("/deployments", depHandler.ListAllDeploymentsHandler)
 	api.GET("/deployments/:id", depHandler.GetDeploymentByIDHandler)
 	api.POST("/deployments/deploy", depHandler.DeployAppHandler)
+	api.POST("/deployments/preview", depHandler.PreviewDeployHandler)
 	api.GET("/deployments/:id/status", depHandler.GetDeploymentStatusHandler)
+	api.POST("/deployments/:id/cancel", RequireUser(userService), depHandler.CancelDeploymentHandler)
+	api.POST("/deployments/:id/promote", RequireUser(userService), depHandler.PromoteDeploymentHandler)
+	api.POST("/deployments/:id/discard", RequireUser(userService), depHandler.DiscardDeploymentHandler)
+	api.POST("/deployments/:id/advance", RequireUser(userService), depHandler.AdvanceCanaryHandler)
+	api.Any("/deployments/:id/proxy/*path", RequireUser(userService), depHandler.ProxyPreviewHandler)
+	api.GET("/apps/app/:id/ports", depHandler.ListPortsHandler)
+	api.GET("/apps/app/:id/history", depHandler.ListAppHistoryHandler)
+
+	// links
+	linkHandler := NewLinkHandler(linkService)
+	api.GET("/apps/app/:id/links", linkHandler.ListLinksHandler)
+	api.POST("/apps/app/:id/links", RequireUser(userService), linkHandler.CreateLinkHandler)
+	api.DELETE("/apps/app/:id/links/:linkId", RequireUser(userService), linkHandler.DeleteLinkHandler)
+
+	// environments
+	envHandler := NewEnvironmentHandler(envService)
+	api.GET("/apps/app/:id/environments", envHandler.ListEnvironmentsHandler)
+	api.POST("/apps/app/:id/environments", RequireUser(userService), envHandler.CreateEnvironmentHandler)
+	api.POST("/apps/app/:id/environments/:env/promote", RequireUser(userService), envHandler.PromoteHandler)
+
+	// releases
+	releaseHandler := NewReleaseHandler(releaseService)
+	api.GET("/apps/app/:id/releases", releaseHandler.ListReleasesHandler)
+	api.GET("/apps/app/:id/releases/diff", releaseHandler.DiffReleasesHandler)
+	api.GET("/apps/app/:id/releases/:version", releaseHandler.GetReleaseHandler)
+
+	// pull request previews
+	previewHandler := NewPreviewEnvHandler(previewService)
+	api.GET("/apps/app/:id/previews", previewHandler.ListPreviewsHandler)
+	api.POST("/apps/app/:id/previews", RequireUser(userService), previewHandler.OpenPreviewHandler)
+	api.DELETE("/apps/app/:id/previews/:number", RequireUser(userService), previewHandler.ClosePreviewHandler)
+	api.POST("/webhooks/git", previewHandler.GitWebhookHandler)
+
+	// maintenance
+	maintenanceHandler := NewMaintenanceHandler(activatorService)
+	api.GET("/apps/app/:id/maintenance", RequireUser(userService), maintenanceHandler.GetMaintenanceHandler)
+	api.POST("/apps/app/:id/maintenance", RequireUser(userService), maintenanceHandler.EnableMaintenanceHandler)
+	api.DELETE("/apps/app/:id/maintenance", RequireUser(userService), maintenanceHandler.DisableMaintenanceHandler)
+
+	// teams
+	teamHandler := NewTeamHandler(teamService)
+	api.POST("/teams", RequireUser(userService), teamHandler.CreateTeamHandler)
+	api.GET("/teams", RequireUser(userService), teamHandler.ListTeamsHandler)
+	api.POST("/teams/:id/members", RequireUser(userService), teamHandler.AddMemberHandler)
+
+	// quotas
+	quotaHandler := NewQuotaHandler(quotaService)
+	api.GET("/admin/quotas/users/:id", RequireAdmin(userService), quotaHandler.GetUserQuotaHandler)
+	api.PUT("/admin/quotas/users/:id", RequireAdmin(userService), quotaHandler.SetUserQuotaHandler)
+	api.GET("/admin/quotas/teams/:id", RequireAdmin(userService), quotaHandler.GetTeamQuotaHandler)
+	api.PUT("/admin/quotas/teams/:id", RequireAdmin(userService), quotaHandler.SetTeamQuotaHandler)
+
+	// garbage collection
+	gcHandler := NewGCHandler(gcService)
+	api.GET("/admin/gc", RequireAdmin(userService), gcHandler.PlanHandler)
+	api.POST("/admin/gc", RequireAdmin(userService), gcHandler.CollectHandler)
+
+	// private registries
+	registryHandler := NewRegistryHandler(registryService)
+	api.GET("/registry-credentials", RequireUser(userService), registryHandler.ListCredentialsHandler)
+	api.POST("/registry-credentials", RequireUser(userService), registryHandler.CreateCredentialHandler)
+	api.DELETE("/registry-credentials/:id", RequireUser(userService), registryHandler.DeleteCredentialHandler)
 
 	// user
 	userHandler := NewUserHandler(userService)
@@ -40,5 +156,13 @@ func SetUpRoutes(
 	logHandler := NewLogHandler(logService)
 	api.POST("/logs", logHandler.CreateLogHandler)
 	api.GET("/logs", logHandler.ListAllLogsHandler)
-	api.GET("/deployments/:id", logHandler.StreamLogsHandler)
+
+	logWSHandler := NewLogWSHandler(k8sLogService)
+	api.GET("/logs/ws/:id", logWSHandler.StreamDeploymentLogs)
+
+	// interactive shell
+	execHandler := NewExecWSHandler(execService, logWSHandler)
+	api.GET("/deployments/:id/exec", RequireUser(userService), execHandler.ExecDeployment)
+	// GET /deployments/:id is the deployment itself
+	api.GET("/deployments/:id/logs/stream", logHandler.StreamLogsHandler)
 }
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RunHandler struct {
+	runService services.RunService
+}
+
+func NewRunHandler(s services.RunService) *RunHandler {
+	return &RunHandler{runService: s}
+}
+
+// POST /api/apps/app/:id/run
+func (h *RunHandler) StartRunHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req RunCommandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	run, err := h.runService.StartRun(c.Request.Context(), currentUser(c), appID, req.Command)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "application not found"})
+		case errors.Is(err, services.ErrRunForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrEmptyCommand):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrNoRunningDeployment):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, toRunResponse(run))
+}
+
+// GET /api/runs/:id
+func (h *RunHandler) GetRunHandler(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	run, err := h.runService.GetRun(c.Request.Context(), currentUser(c), uid)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRunForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "run not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, toRunResponse(run))
+}
+
+func toRunResponse(run *models.Run) RunResponse {
+	// job pods are named after the job, which LogWSHandler resolves by prefix
+	streamURL := "/api/logs/ws/" + run.JobName
+	if run.Namespace != "" {
+		streamURL += "?namespace=" + url.QueryEscape(run.Namespace)
+	}
+	return RunResponse{
+		ID:           run.ID.String(),
+		AppID:        run.AppID.String(),
+		DeploymentID: run.DeploymentID.String(),
+		Command:      run.Command,
+		Status:       run.Status,
+		ExitCode:     run.ExitCode,
+		StartedAt:    run.StartedAt,
+		FinishedAt:   run.FinishedAt,
+		DurationMs:   run.DurationMs,
+		StreamURL:    streamURL,
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TeamHandler struct {
+	teamService services.TeamService
+}
+
+func NewTeamHandler(s services.TeamService) *TeamHandler {
+	return &TeamHandler{teamService: s}
+}
+
+// POST /api/teams
+func (h *TeamHandler) CreateTeamHandler(c *gin.Context) {
+	var req CreateTeamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	team, err := h.teamService.CreateTeam(c.Request.Context(), currentUser(c), req.Name)
+	if err != nil {
+		writeTeamError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, TeamResponse{
+		ID:        team.ID.String(),
+		Name:      team.Name,
+		CreatedAt: team.CreatedAt,
+	})
+}
+
+// GET /api/teams
+func (h *TeamHandler) ListTeamsHandler(c *gin.Context) {
+	teams, err := h.teamService.ListTeams(c.Request.Context(), currentUser(c).ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]TeamResponse, 0, len(teams))
+	for _, t := range teams {
+		resp = append(resp, TeamResponse{ID: t.ID.String(), Name: t.Name, CreatedAt: t.CreatedAt})
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/teams/:id/members
+func (h *TeamHandler) AddMemberHandler(c *gin.Context) {
+	teamID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req AddTeamMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	memberID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+		return
+	}
+
+	if err := h.teamService.AddMember(c.Request.Context(), currentUser(c), teamID, memberID); err != nil {
+		writeTeamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "member added"})
+}
+
+func writeTeamError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "team or user not found"})
+	case errors.Is(err, services.ErrNotTeamMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidTeam):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrTeamExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type VolumeHandler struct {
+	volumeService services.VolumeService
+}
+
+func NewVolumeHandler(s services.VolumeService) *VolumeHandler {
+	return &VolumeHandler{volumeService: s}
+}
+
+// GET /api/apps/app/:id/volumes
+func (h *VolumeHandler) ListVolumesHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	volumes, err := h.volumeService.ListVolumes(c.Request.Context(), appID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]VolumeResponse, 0, len(volumes))
+	for _, v := range volumes {
+		resp = append(resp, toVolumeResponse(&v))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": resp})
+}
+
+// POST /api/apps/app/:id/volumes
+func (h *VolumeHandler) CreateVolumeHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	var req CreateVolumeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	v, err := h.volumeService.CreateVolume(c.Request.Context(), &models.Volume{
+		AppID:        appID,
+		Name:         req.Name,
+		Size:         req.Size,
+		AccessMode:   req.AccessMode,
+		MountPath:    req.MountPath,
+		StorageClass: req.StorageClass,
+	})
+	if err != nil {
+		writeVolumeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, toVolumeResponse(v))
+}
+
+// DELETE /api/apps/app/:id/volumes/:volumeId
+func (h *VolumeHandler) DeleteVolumeHandler(c *gin.Context) {
+	appID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+	volumeID, err := uuid.Parse(c.Param("volumeId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid UUID"})
+		return
+	}
+
+	if err := h.volumeService.DeleteVolume(c.Request.Context(), appID, volumeID); err != nil {
+		writeVolumeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "volume deleted"})
+}
+
+func writeVolumeError(c *gin.Context, err error) {
+	if writeQuotaError(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "volume or application not found"})
+	case errors.Is(err, services.ErrInvalidVolume):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrVolumeExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func toVolumeResponse(v *models.Volume) VolumeResponse {
+	return VolumeResponse{
+		ID:           v.ID.String(),
+		AppID:        v.AppID.String(),
+		Name:         v.Name,
+		Size:         v.Size,
+		AccessMode:   v.AccessMode,
+		MountPath:    v.MountPath,
+		StorageClass: v.StorageClass,
+		ClaimName:    v.ClaimName,
+	}
+}
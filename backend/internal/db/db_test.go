@@ -29,7 +29,7 @@ func ConnectTestDB(dsn string) (*gorm.DB, error) {
 }
 
 func TruncateAll(db *gorm.DB) error {
-	tables := []string{"applications", "users", "deployments", "logs"}
+	tables := []string{"applications", "users", "deployments", "logs", "cron_jobs", "runs", "audit_events", "volumes", "add_ons", "teams", "team_members", "registry_credentials", "deployment_events", "domains", "port_endpoints", "app_links", "quotas", "environments", "releases"}
 	for _, t := range tables {
 		if err := db.Exec("TRUNCATE TABLE " + t + " RESTART IDENTITY CASCADE").Error; err != nil {
 			return err
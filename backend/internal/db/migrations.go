@@ -47,6 +47,286 @@ func RunMigrations(db *gorm.DB) error {
 				return d.Migrator().DropTable("logs")
 			},
 		},
+		{
+			ID: "202309040005_add_log_source",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Log{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Log{}, "source")
+			},
+		},
+		{
+			ID: "202309040006_create_cron_jobs",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.CronJob{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("cron_jobs")
+			},
+		},
+		{
+			ID: "202309040007_create_runs",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Run{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("runs")
+			},
+		},
+		{
+			ID: "202309040008_create_audit_events",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.AuditEvent{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("audit_events")
+			},
+		},
+		{
+			ID: "202309040009_add_app_release_command",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Application{}, "release_command")
+			},
+		},
+		{
+			ID: "202309040010_create_volumes",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Volume{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("volumes")
+			},
+		},
+		{
+			ID: "202309040011_create_addons",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.AddOn{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("add_ons")
+			},
+		},
+		{
+			ID: "202309040012_add_app_config",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Application{}, "config")
+			},
+		},
+		{
+			ID: "202309040013_create_teams_and_registry_credentials",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Team{}, &models.TeamMember{}, &models.RegistryCredential{}, &models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				if err := d.Migrator().DropColumn(&models.Application{}, "owner_id"); err != nil {
+					return err
+				}
+				if err := d.Migrator().DropColumn(&models.Application{}, "team_id"); err != nil {
+					return err
+				}
+				return d.Migrator().DropTable("registry_credentials", "team_members", "teams")
+			},
+		},
+		{
+			ID: "202309040014_add_deployment_image_digest",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Deployment{}, "image_digest")
+			},
+		},
+		{
+			ID: "202309040015_add_deployment_queue_index",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropIndex(&models.Deployment{}, "idx_deployments_queue")
+			},
+		},
+		{
+			ID: "202309040016_add_deployment_cancellation",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				if err := d.Migrator().DropColumn(&models.Deployment{}, "cancelled_by"); err != nil {
+					return err
+				}
+				return d.Migrator().DropColumn(&models.Deployment{}, "cancelled_at")
+			},
+		},
+		{
+			ID: "202309040017_add_deployment_rollback_reason",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Deployment{}, "rollback_reason")
+			},
+		},
+		{
+			ID: "202309040018_add_deployment_color",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				if err := d.Migrator().DropColumn(&models.Deployment{}, "color"); err != nil {
+					return err
+				}
+				return d.Migrator().DropColumn(&models.Deployment{}, "retire_at")
+			},
+		},
+		{
+			ID: "202309040019_create_deployment_events",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{}, &models.DeploymentEvent{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				if err := d.Migrator().DropTable("deployment_events"); err != nil {
+					return err
+				}
+				return d.Migrator().DropColumn(&models.Deployment{}, "canary_of")
+			},
+		},
+		{
+			ID: "202309040020_create_domains",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Domain{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("domains")
+			},
+		},
+		{
+			ID: "202309040021_create_port_endpoints",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.PortEndpoint{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("port_endpoints")
+			},
+		},
+		{
+			ID: "202309040022_add_app_sleeping_since",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Application{}, "sleeping_since")
+			},
+		},
+		{
+			ID: "202309040023_add_app_maintenance",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Application{}, "maintenance")
+			},
+		},
+		{
+			ID: "202309040024_create_app_links",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.AppLink{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("app_links")
+			},
+		},
+		{
+			ID: "202309040025_create_quotas",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Quota{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropTable("quotas")
+			},
+		},
+		{
+			ID: "202309040026_add_app_previews",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				for _, column := range []string{"parent_id", "pull_request", "branch", "commit_sha", "expires_at"} {
+					if err := d.Migrator().DropColumn(&models.Application{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "202309040027_create_environments",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Environment{}, &models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				for _, column := range []string{"environment_id", "promoted_from"} {
+					if err := d.Migrator().DropColumn(&models.Deployment{}, column); err != nil {
+						return err
+					}
+				}
+				return d.Migrator().DropTable("environments")
+			},
+		},
+		{
+			ID: "202309040028_create_releases",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Release{}, &models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				if err := d.Migrator().DropColumn(&models.Deployment{}, "release_id"); err != nil {
+					return err
+				}
+				return d.Migrator().DropTable("releases")
+			},
+		},
+		{
+			ID: "202309040029_add_deployment_superseded_by",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Deployment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Deployment{}, "superseded_by")
+			},
+		},
+		{
+			ID: "202309040030_add_app_namespace",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Application{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Application{}, "namespace")
+			},
+		},
+		{
+			ID: "202309040031_add_environment_namespace",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Environment{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Environment{}, "namespace")
+			},
+		},
+		{
+			ID: "202309040032_add_run_namespace",
+			Migrate: func(d *gorm.DB) error {
+				return d.AutoMigrate(&models.Run{})
+			},
+			Rollback: func(d *gorm.DB) error {
+				return d.Migrator().DropColumn(&models.Run{}, "namespace")
+			},
+		},
 	})
 
 	if err := m.Migrate(); err != nil {
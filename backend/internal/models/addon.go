@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AddOn is a managed backing service (database, cache) bound to an application.
+// Its credentials live in a k8s Secret named SecretName.
+type AddOn struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID        uuid.UUID `gorm:"type:uuid;not null;index" json:"app_id"`
+	Type         string    `gorm:"type:varchar(50);not null" json:"type"`
+	ResourceName string    `gorm:"type:varchar(63);not null" json:"resource_name"`
+	SecretName   string    `gorm:"type:varchar(253);not null" json:"secret_name"`
+	ConfigVar    string    `gorm:"type:varchar(100);not null" json:"config_var"`
+	Size         string    `gorm:"type:varchar(20);not null" json:"size"`
+	Status       string    `gorm:"type:varchar(50);default:'PROVISIONING'" json:"status"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AppLink lets the pods of an app reach another app. The linking app gets the
+// target's address in config vars named after Alias, such as ALIAS_URL.
+type AppLink struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_app_links_target;uniqueIndex:idx_app_links_alias" json:"app_id"`
+	TargetAppID uuid.UUID `gorm:"type:uuid;not null;index;uniqueIndex:idx_app_links_target" json:"target_app_id"`
+	Alias       string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_app_links_alias" json:"alias"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -1,20 +1,182 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Application struct {
-	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	Name        string    `gorm:"type:varchar(255);not null" json:"name"`
-	Description string    `gorm:"type:text" json:"description"`
-	GitURL      string    `gorm:"type:varchar(255)" json:"git_url"`
-	ImageURL    string    `gorm:"type:varchar(255)" json:"image_url"`
-	DeployURL   string    `gorm:"type:varchar(255)" json:"deploy_url"`
-	Runtime     string    `gorm:"size:50"`
-	Status      string    `gorm:"type:varchar(50);default:'pending'" json:"status"`
-	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID             uuid.UUID      `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	Name           string         `gorm:"type:varchar(255);not null" json:"name"`
+	OwnerID        *uuid.UUID     `gorm:"type:uuid;index" json:"owner_id,omitempty"`
+	TeamID         *uuid.UUID     `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	Description    string         `gorm:"type:text" json:"description"`
+	GitURL         string         `gorm:"type:varchar(255)" json:"git_url"`
+	ImageURL       string         `gorm:"type:varchar(255)" json:"image_url"`
+	DeployURL      string         `gorm:"type:varchar(255)" json:"deploy_url"`
+	Runtime        string         `gorm:"size:50"`
+	ReleaseCommand string         `gorm:"type:text" json:"release_command"`
+	Config         AppConfig      `gorm:"type:jsonb;not null;default:'{}'" json:"config"`
+	Status         string         `gorm:"type:varchar(50);default:'pending'" json:"status"`
+	SleepingSince  *time.Time     `json:"sleeping_since,omitempty"`
+	Maintenance    AppMaintenance `gorm:"type:jsonb;not null;default:'{}'" json:"maintenance"`
+	Namespace      string         `gorm:"type:varchar(63)" json:"namespace,omitempty"` // k8s namespace of its objects, the default one when empty
+	CreatedAt      time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+
+	// set on the preview of a pull request, a temporary copy of ParentID
+	ParentID    *uuid.UUID `gorm:"type:uuid;uniqueIndex:idx_app_preview" json:"parent_id,omitempty"`
+	PullRequest int        `gorm:"uniqueIndex:idx_app_preview" json:"pull_request,omitempty"`
+	Branch      string     `gorm:"type:varchar(255)" json:"branch,omitempty"`
+	CommitSHA   string     `gorm:"type:varchar(64)" json:"commit_sha,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// AppConfig is the runtime configuration of an application's containers.
+type AppConfig struct {
+	Port      int32             `json:"port,omitempty"`
+	Ports     []AppPort         `json:"ports,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+	Resources AppResources      `json:"resources,omitempty"`
+	Readiness *AppProbe         `json:"readiness,omitempty"`
+	Liveness  *AppProbe         `json:"liveness,omitempty"`
+	Replicas  *int32            `json:"replicas,omitempty"`
+	Domains   []string          `json:"domains,omitempty"`
+	Rollback  *AppRollback      `json:"rollback,omitempty"`
+	Strategy  *AppStrategy      `json:"strategy,omitempty"`
+	// scale the app to zero after this long without traffic; 0 never does
+	IdleTimeoutSeconds int32 `json:"idle_timeout_seconds,omitempty"`
+}
+
+func (c AppConfig) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+func (c *AppConfig) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = AppConfig{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	default:
+		return fmt.Errorf("unsupported config type %T", src)
+	}
+}
+
+// AppMaintenance is the maintenance mode of an app: while it is enabled the
+// app's domains serve a maintenance page with HTTP 503, except to clients from
+// AllowIPs or that send the bypass token, which still reach the app.
+type AppMaintenance struct {
+	Enabled           bool       `json:"enabled"`
+	Message           string     `json:"message,omitempty"`
+	RetryAfterSeconds int32      `json:"retry_after_seconds,omitempty"`
+	AllowIPs          []string   `json:"allow_ips,omitempty"` // addresses or CIDRs
+	BypassToken       string     `json:"bypass_token,omitempty"`
+	Since             *time.Time `json:"since,omitempty"`
+}
+
+func (m AppMaintenance) Value() (driver.Value, error) {
+	return json.Marshal(m)
+}
+
+func (m *AppMaintenance) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = AppMaintenance{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("unsupported maintenance type %T", src)
+	}
+}
+
+const (
+	PortHTTP = "http"
+	PortTCP  = "tcp"
+	PortUDP  = "udp"
+
+	ExposeNodePort     = "NodePort"
+	ExposeLoadBalancer = "LoadBalancer"
+)
+
+// AppPort is a named port the app listens on. HTTP ports are routed to by
+// the app's Ingress under Path; TCP and UDP ports get a Service of their own,
+// of type Expose, so clients can reach them from outside the cluster.
+type AppPort struct {
+	Name     string `json:"name"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol,omitempty"` // http when empty
+	Path     string `json:"path,omitempty"`
+	Expose   string `json:"expose,omitempty"`
+}
+
+type AppResources struct {
+	CPURequest    string `json:"cpu_request,omitempty"`
+	MemoryRequest string `json:"memory_request,omitempty"`
+	CPULimit      string `json:"cpu_limit,omitempty"`
+	MemoryLimit   string `json:"memory_limit,omitempty"`
+}
+
+// AppProbe is an HTTP GET health check against the app's port.
+type AppProbe struct {
+	Path                string `json:"path"`
+	InitialDelaySeconds int32  `json:"initial_delay_seconds,omitempty"`
+	PeriodSeconds       int32  `json:"period_seconds,omitempty"`
+	TimeoutSeconds      int32  `json:"timeout_seconds,omitempty"`
+	FailureThreshold    int32  `json:"failure_threshold,omitempty"`
+}
+
+// AppRollback is the opt-in policy that reverts a release to the previous
+// RUNNING deployment when it turns out unhealthy. Zero durations use the
+// platform defaults; zero thresholds are not checked.
+type AppRollback struct {
+	Enabled bool `json:"enabled"`
+	// how long a rollout may take to become ready
+	HealthyWithinSeconds int32 `json:"healthy_within_seconds,omitempty"`
+	// how long a release is watched after going RUNNING
+	WatchSeconds int32 `json:"watch_seconds,omitempty"`
+	// container restarts tolerated during the watch window
+	MaxRestarts int32 `json:"max_restarts,omitempty"`
+	// fraction of failed requests tolerated, 0..1; needs an error-rate source
+	MaxErrorRate float64 `json:"max_error_rate,omitempty"`
+}
+
+const (
+	StrategyRolling   = "rolling"
+	StrategyBlueGreen = "blue-green"
+	StrategyCanary    = "canary"
+)
+
+// AppStrategy is how a new release replaces the running one. With blue-green
+// the release is started next to the live one and only receives traffic once
+// it is promoted; the replaced release is kept idle for KeepIdleSeconds so it
+// can be promoted back. With canary the release first gets CanarySteps
+// percent of the traffic, one step at a time, every StepSeconds or when
+// advanced through the API.
+type AppStrategy struct {
+	Type            string  `json:"type"`
+	KeepIdleSeconds int32   `json:"keep_idle_seconds,omitempty"`
+	CanarySteps     []int32 `json:"canary_steps,omitempty"`
+	// 0 leaves advancing to the API
+	StepSeconds int32 `json:"step_seconds,omitempty"`
+}
+
+// IsBlueGreen reports whether the config asks for blue/green releases.
+func (c AppConfig) IsBlueGreen() bool {
+	return c.Strategy != nil && c.Strategy.Type == StrategyBlueGreen
+}
+
+// IsCanary reports whether the config asks for canary releases.
+func (c AppConfig) IsCanary() bool {
+	return c.Strategy != nil && c.Strategy.Type == StrategyCanary
 }
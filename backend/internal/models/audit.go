@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditEvent records who performed a sensitive action and when.
+type AuditEvent struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Action       string    `gorm:"type:varchar(100);not null" json:"action"`
+	ResourceType string    `gorm:"type:varchar(50);not null" json:"resource_type"`
+	ResourceID   uuid.UUID `gorm:"type:uuid;index" json:"resource_id"`
+	Detail       string    `gorm:"type:text" json:"detail"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
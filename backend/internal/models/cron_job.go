@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type CronJob struct {
+	ID                         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID                      uuid.UUID `gorm:"type:uuid;not null;index" json:"app_id"`
+	Name                       string    `gorm:"type:varchar(255);not null" json:"name"`
+	Schedule                   string    `gorm:"type:varchar(100);not null" json:"schedule"`
+	Command                    string    `gorm:"type:text;not null" json:"command"`
+	ConcurrencyPolicy          string    `gorm:"type:varchar(20);default:'Forbid'" json:"concurrency_policy"`
+	SuccessfulJobsHistoryLimit int32     `json:"successful_jobs_history_limit"`
+	FailedJobsHistoryLimit     int32     `json:"failed_jobs_history_limit"`
+	Suspend                    bool      `gorm:"default:false" json:"suspend"`
+	CreatedAt                  time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt                  time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -1,17 +1,45 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Deployment struct {
-	ID         uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
-	AppID      uuid.UUID `gorm:"type:uuid;not null"`
-	Version    string    `gorm:"not null"`
-	ImageURL   string
-	Status     string `gorm:"default:pending"`
-	DeployedAt time.Time
-	CreatedAt  time.Time
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID          uuid.UUID `gorm:"type:uuid;not null;index:idx_deployments_queue,priority:2"`
+	Version        string    `gorm:"not null"`
+	ImageURL       string
+	ImageDigest    string     `gorm:"type:varchar(100)"`
+	Status         string     `gorm:"default:pending;index:idx_deployments_queue,priority:1"`
+	CancelledBy    *uuid.UUID `gorm:"type:uuid"`
+	CancelledAt    *time.Time
+	RollbackReason string `gorm:"type:text"`
+	Color          string `gorm:"type:varchar(10)"`
+	RetireAt       *time.Time
+	CanaryOf       *uuid.UUID `gorm:"type:uuid"`
+	EnvironmentID  *uuid.UUID `gorm:"type:uuid;index"`
+	PromotedFrom   *uuid.UUID `gorm:"type:uuid"` // release of the previous environment
+	ReleaseID      *uuid.UUID `gorm:"type:uuid;index"`
+	SupersededBy   *uuid.UUID `gorm:"type:uuid;index"` // release that replaced it while it was RUNNING
+	DeployedAt     time.Time
+	CreatedAt      time.Time
+}
+
+// PinnedImage is the reference the deployment runs: the image by digest when
+// it was resolved, else the image as given.
+func (d *Deployment) PinnedImage() string {
+	if d.ImageDigest == "" {
+		return d.ImageURL
+	}
+	name := d.ImageURL
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name = name[:i]
+	}
+	return name + "@" + d.ImageDigest
 }
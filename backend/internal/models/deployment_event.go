@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventCanaryStep     = "canary_step"
+	EventCanaryPromoted = "canary_promoted"
+	EventCanaryAborted  = "canary_aborted"
+	EventSlept          = "slept"
+	EventWoke           = "woke"
+)
+
+// DeploymentEvent records a step of a deployment's progress, such as the
+// traffic share of a canary, or a running release being scaled to zero and
+// back.
+type DeploymentEvent struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	DeploymentID uuid.UUID `gorm:"type:uuid;not null;index"`
+	Type         string    `gorm:"type:varchar(50);not null"`
+	Step         int
+	Weight       int32  // percent of the app's traffic
+	Message      string `gorm:"type:text"`
+	CreatedAt    time.Time
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// how a domain's certificate is obtained
+const (
+	DomainTLSCertManager = "cert-manager"
+	DomainTLSUploaded    = "uploaded"
+	DomainTLSNone        = "none"
+)
+
+// Domain is a hostname of the app's own, routed to it once a DNS TXT record
+// proves the owner controls it.
+type Domain struct {
+	ID                uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID             uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	Hostname          string     `gorm:"type:varchar(253);not null;uniqueIndex" json:"hostname"`
+	VerificationToken string     `gorm:"type:varchar(64);not null" json:"-"`
+	VerifiedAt        *time.Time `json:"verified_at"`
+	TLS               string     `gorm:"type:varchar(20);default:'cert-manager'" json:"tls"`
+	CertSecret        string     `gorm:"type:varchar(253)" json:"cert_secret"`
+	CertStatus        string     `gorm:"type:varchar(20)" json:"cert_status"` // PENDING, ISSUED, EXPIRED
+	CertExpiresAt     *time.Time `json:"cert_expires_at"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
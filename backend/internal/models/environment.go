@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Environment is a stage of an app's promotion pipeline, such as staging or
+// production. It runs as an app of its own, EnvAppID, in a k8s namespace of
+// its own, so it has its own config and scaling; releases move to the
+// environment with the next Position when they are promoted.
+// Environments created before namespaces have none and run in the default one.
+type Environment struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_app_environment" json:"app_id"`
+	Name      string    `gorm:"type:varchar(32);not null;uniqueIndex:idx_app_environment" json:"name"`
+	Position  int       `gorm:"not null" json:"position"`
+	EnvAppID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"env_app_id"`
+	Namespace string    `gorm:"type:varchar(63)" json:"namespace,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -11,5 +11,6 @@ type Log struct {
 	DeploymentID uuid.UUID `gorm:"type:uuid;not null"`
 	Message      string    `gorm:"not null"`
 	Level        string    `gorm:"default:INFO"`
+	Source       string    `gorm:"type:varchar(100);default:'runtime'"` // runtime, cron:<name>, ...
 	Timestamp    time.Time `gorm:"autoCreatetime"`
 }
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortEndpoint is where a TCP or UDP port of an app is reachable from
+// outside the cluster.
+type PortEndpoint struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_port_endpoints_app_name" json:"app_id"`
+	Name        string    `gorm:"type:varchar(15);not null;uniqueIndex:idx_port_endpoints_app_name" json:"name"`
+	Protocol    string    `gorm:"type:varchar(10);not null" json:"protocol"`
+	Port        int32     `json:"port"`
+	ServiceType string    `gorm:"type:varchar(20)" json:"service_type"`
+	ServiceName string    `gorm:"type:varchar(63)" json:"service_name"`
+	NodePort    int32     `json:"node_port"`
+	// host:port clients connect to; empty until the cluster has allocated it
+	Address   string    `gorm:"type:varchar(255)" json:"address"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanEnterprise = "enterprise"
+)
+
+// Quota is the plan of a user or a team, exactly one of UserID and TeamID is
+// set. The Max fields override the plan's limit when set.
+type Quota struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID       *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"user_id,omitempty"`
+	TeamID       *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"team_id,omitempty"`
+	Plan         string     `gorm:"type:varchar(30);not null;default:'free'" json:"plan"`
+	MaxApps      *int64     `json:"max_apps,omitempty"`
+	MaxCPUMillis *int64     `json:"max_cpu_millis,omitempty"`
+	MaxMemoryMiB *int64     `json:"max_memory_mib,omitempty"`
+	MaxReplicas  *int64     `json:"max_replicas,omitempty"`
+	MaxVolumes   *int64     `json:"max_volumes,omitempty"`
+	MaxDomains   *int64     `json:"max_domains,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegistryCredential lets deployments pull from a private registry. It belongs
+// to either a user or a team; the token is stored encrypted.
+type RegistryCredential struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID         *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	TeamID         *uuid.UUID `gorm:"type:uuid;index" json:"team_id,omitempty"`
+	Server         string     `gorm:"type:varchar(255);not null" json:"server"`
+	Username       string     `gorm:"type:varchar(255);not null" json:"username"`
+	TokenEncrypted []byte     `gorm:"type:bytea;not null" json:"-"`
+	CreatedAt      time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Release is an immutable record of what an app ran: the image, pinned to
+// its digest, and a snapshot of the config and release command it ran with.
+// Creating the app, every deploy and config change, and link and add-on
+// changes make one; Version counts up per app.
+type Release struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID          uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_app_release_version" json:"app_id"`
+	Version        int       `gorm:"not null;uniqueIndex:idx_app_release_version" json:"version"`
+	ImageURL       string    `json:"image_url"`
+	ImageDigest    string    `gorm:"type:varchar(100)" json:"image_digest"`
+	ReleaseCommand string    `gorm:"type:text" json:"release_command"`
+	Config         AppConfig `gorm:"type:jsonb;not null;default:'{}'" json:"config"`
+	Reason         string    `gorm:"type:varchar(255)" json:"reason"` // what made it, such as a deploy or a config change
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
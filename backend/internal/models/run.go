@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Run is a one-off command executed as a Kubernetes Job with an app's release image.
+type Run struct {
+	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"app_id"`
+	DeploymentID uuid.UUID  `gorm:"type:uuid;not null" json:"deployment_id"`
+	Command      string     `gorm:"type:text;not null" json:"command"`
+	JobName      string     `gorm:"type:varchar(63);not null" json:"job_name"`
+	Namespace    string     `gorm:"type:varchar(63)" json:"namespace"` // of the Job, the default one when empty
+	Status       string     `gorm:"type:varchar(50);default:'PENDING'" json:"status"`
+	ExitCode     *int32     `json:"exit_code"`
+	StartedAt    *time.Time `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at"`
+	DurationMs   int64      `json:"duration_ms"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Volume struct {
+	ID           uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	AppID        uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_volumes_app_name" json:"app_id"`
+	Name         string    `gorm:"type:varchar(63);not null;uniqueIndex:idx_volumes_app_name" json:"name"`
+	Size         string    `gorm:"type:varchar(20);not null" json:"size"`
+	AccessMode   string    `gorm:"type:varchar(30);default:'ReadWriteOnce'" json:"access_mode"`
+	MountPath    string    `gorm:"type:varchar(255);not null" json:"mount_path"`
+	StorageClass string    `gorm:"type:varchar(100)" json:"storage_class"`
+	ClaimName    string    `gorm:"type:varchar(253);not null" json:"claim_name"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
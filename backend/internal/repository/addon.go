@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AddOnRepository interface {
+	Create(ctx context.Context, a *models.AddOn) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.AddOn, error)
+	ListByApp(ctx context.Context, appID uuid.UUID, statuses ...string) ([]models.AddOn, error)
+	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+}
+
+type addOnRepository struct{ db *gorm.DB }
+
+func NewAddOnRepository(db *gorm.DB) AddOnRepository {
+	return &addOnRepository{db: db}
+}
+
+func (r *addOnRepository) Create(ctx context.Context, a *models.AddOn) error {
+	return getDB(ctx, r.db).Create(a).Error
+}
+
+func (r *addOnRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.AddOn, error) {
+	var a models.AddOn
+	if err := getDB(ctx, r.db).First(&a, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *addOnRepository) ListByApp(ctx context.Context, appID uuid.UUID, statuses ...string) ([]models.AddOn, error) {
+	db := getDB(ctx, r.db).Where("app_id = ?", appID)
+	if len(statuses) > 0 {
+		db = db.Where("status IN ?", statuses)
+	}
+
+	var items []models.AddOn
+	if err := db.Order("created_at ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *addOnRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	return getDB(ctx, r.db).Model(&models.AddOn{}).Where("id = ?", id).Update("status", status).Error
+}
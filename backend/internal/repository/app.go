@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"mini-paas/backend/internal/models"
 
@@ -21,8 +22,21 @@ type AppRepository interface {
 	Update(ctx context.Context, app *models.Application) error
 	DeleteHard(ctx context.Context, id uuid.UUID) error
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Application, error)
+	GetByName(ctx context.Context, name string) (*models.Application, error)
+	GetByNameInScope(ctx context.Context, name string, ownerID uuid.UUID, teamID *uuid.UUID) (*models.Application, error)
 	List(ctx context.Context, f AppFilter, page Page, sort Sort) (ListResult[models.Application], error)
 	ExistsByNameForOwner(ctx context.Context, ownerID uuid.UUID, name string) (bool, error)
+	ListIdleScalable(ctx context.Context) ([]models.Application, error)
+	SetSleeping(ctx context.Context, id uuid.UUID, since *time.Time) error
+	SetMaintenance(ctx context.Context, id uuid.UUID, m models.AppMaintenance) error
+	ListByTeam(ctx context.Context, teamID uuid.UUID) ([]models.Application, error)
+	ListPersonal(ctx context.Context, ownerID uuid.UUID) ([]models.Application, error)
+	ExistingIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]bool, error)
+	ListByGitURL(ctx context.Context, urls []string) ([]models.Application, error)
+	GetPreview(ctx context.Context, parentID uuid.UUID, pullRequest int) (*models.Application, error)
+	ListPreviews(ctx context.Context, parentID uuid.UUID) ([]models.Application, error)
+	ListExpiredPreviews(ctx context.Context, now time.Time) ([]models.Application, error)
+	SetPreviewHead(ctx context.Context, id uuid.UUID, branch, commitSHA, image string, expiresAt time.Time) error
 }
 
 type appRepository struct {
@@ -54,11 +68,14 @@ func (r *appRepository) Update(ctx context.Context, app *models.Application) err
 	if err := db.Model(&models.Application{}).
 		Where("id = ?", app.ID).
 		Updates(map[string]any{
-			"name":        app.Name,
-			"description": app.Description,
-			"repo_url":    app.GitURL,
-			"runtime":     app.Runtime,
-			"status":      app.Status,
+			"name":            app.Name,
+			"description":     app.Description,
+			"git_url":         app.GitURL,
+			"image_url":       app.ImageURL,
+			"runtime":         app.Runtime,
+			"status":          app.Status,
+			"release_command": app.ReleaseCommand,
+			"config":          app.Config,
 		}).Error; err != nil {
 		return mapGormError(err)
 	}
@@ -144,3 +161,132 @@ func (r *appRepository) ExistsByNameForOwner(ctx context.Context, ownerID uuid.U
 	}
 	return count > 0, nil
 }
+
+// GetByName returns the oldest application with the given name.
+func (r *appRepository) GetByName(ctx context.Context, name string) (*models.Application, error) {
+	db := getDB(ctx, r.db)
+
+	var app models.Application
+	if err := db.Where("name = ?", name).Order("created_at ASC").First(&app).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &app, nil
+}
+
+// GetByNameInScope returns the oldest application with the given name of
+// the team, or of the owner's personal apps when teamID is nil.
+func (r *appRepository) GetByNameInScope(ctx context.Context, name string, ownerID uuid.UUID, teamID *uuid.UUID) (*models.Application, error) {
+	db := getDB(ctx, r.db).Where("name = ?", name)
+	if teamID != nil {
+		db = db.Where("team_id = ?", *teamID)
+	} else {
+		db = db.Where("owner_id = ? AND team_id IS NULL", ownerID)
+	}
+
+	var app models.Application
+	if err := db.Order("created_at ASC").First(&app).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &app, nil
+}
+
+// ListIdleScalable returns the apps that have an idle timeout and are awake.
+// Apps in maintenance see no traffic but are kept running.
+func (r *appRepository) ListIdleScalable(ctx context.Context) ([]models.Application, error) {
+	var items []models.Application
+	err := getDB(ctx, r.db).
+		Where("(config->>'idle_timeout_seconds')::int > 0 AND sleeping_since IS NULL").
+		Where("(maintenance->>'enabled')::boolean IS NOT TRUE").
+		Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// SetSleeping records since when the app is scaled to zero, or clears it.
+func (r *appRepository) SetSleeping(ctx context.Context, id uuid.UUID, since *time.Time) error {
+	err := getDB(ctx, r.db).Model(&models.Application{}).
+		Where("id = ?", id).
+		Update("sleeping_since", since).Error
+	return mapGormError(err)
+}
+
+func (r *appRepository) SetMaintenance(ctx context.Context, id uuid.UUID, m models.AppMaintenance) error {
+	res := getDB(ctx, r.db).Model(&models.Application{}).
+		Where("id = ?", id).
+		Update("maintenance", m)
+	if res.Error != nil {
+		return mapGormError(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *appRepository) ListByTeam(ctx context.Context, teamID uuid.UUID) ([]models.Application, error) {
+	var items []models.Application
+	err := getDB(ctx, r.db).Where("team_id = ?", teamID).Order("created_at ASC").Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// ListPersonal returns the apps the user owns outside of any team.
+func (r *appRepository) ListPersonal(ctx context.Context, ownerID uuid.UUID) ([]models.Application, error) {
+	var items []models.Application
+	err := getDB(ctx, r.db).Where("owner_id = ? AND team_id IS NULL", ownerID).Order("created_at ASC").Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// ExistingIDs reports which of ids are apps.
+func (r *appRepository) ExistingIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	return existingIDs(ctx, r.db, &models.Application{}, ids)
+}
+
+// ListByGitURL returns the apps whose repository is one of urls, leaving out
+// previews and the apps that run another app's environments.
+func (r *appRepository) ListByGitURL(ctx context.Context, urls []string) ([]models.Application, error) {
+	var items []models.Application
+	if len(urls) == 0 {
+		return items, nil
+	}
+	err := getDB(ctx, r.db).
+		Where("git_url IN ? AND parent_id IS NULL", urls).
+		Where("id NOT IN (?)", getDB(ctx, r.db).Model(&models.Environment{}).Select("env_app_id")).
+		Order("created_at ASC").
+		Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// GetPreview returns the preview of the parent app for a pull request.
+func (r *appRepository) GetPreview(ctx context.Context, parentID uuid.UUID, pullRequest int) (*models.Application, error) {
+	var app models.Application
+	if err := getDB(ctx, r.db).Where("parent_id = ? AND pull_request = ?", parentID, pullRequest).First(&app).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &app, nil
+}
+
+func (r *appRepository) ListPreviews(ctx context.Context, parentID uuid.UUID) ([]models.Application, error) {
+	var items []models.Application
+	err := getDB(ctx, r.db).Where("parent_id = ?", parentID).Order("pull_request ASC").Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// ListExpiredPreviews returns the previews whose TTL ran out before now.
+func (r *appRepository) ListExpiredPreviews(ctx context.Context, now time.Time) ([]models.Application, error) {
+	var items []models.Application
+	err := getDB(ctx, r.db).Where("parent_id IS NOT NULL AND expires_at < ?", now).Find(&items).Error
+	return items, mapGormError(err)
+}
+
+// SetPreviewHead records the commit a preview was last deployed from and
+// when it expires.
+func (r *appRepository) SetPreviewHead(ctx context.Context, id uuid.UUID, branch, commitSHA, image string, expiresAt time.Time) error {
+	err := getDB(ctx, r.db).Model(&models.Application{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"branch":     branch,
+			"commit_sha": commitSHA,
+			"image_url":  image,
+			"expires_at": expiresAt,
+		}).Error
+	return mapGormError(err)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AppLinkRepository interface {
+	Create(ctx context.Context, l *models.AppLink) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.AppLink, error)
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.AppLink, error)
+	ListByTarget(ctx context.Context, targetAppID uuid.UUID) ([]models.AppLink, error)
+}
+
+type appLinkRepository struct{ db *gorm.DB }
+
+func NewAppLinkRepository(db *gorm.DB) AppLinkRepository {
+	return &appLinkRepository{db: db}
+}
+
+func (r *appLinkRepository) Create(ctx context.Context, l *models.AppLink) error {
+	return getDB(ctx, r.db).Create(l).Error
+}
+
+func (r *appLinkRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return getDB(ctx, r.db).Delete(&models.AppLink{}, "id = ?", id).Error
+}
+
+func (r *appLinkRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.AppLink, error) {
+	var l models.AppLink
+	if err := getDB(ctx, r.db).First(&l, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &l, nil
+}
+
+// ListByApp returns the links the app reaches other apps through.
+func (r *appLinkRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.AppLink, error) {
+	var items []models.AppLink
+	err := getDB(ctx, r.db).Where("app_id = ?", appID).Order("alias ASC").Find(&items).Error
+	return items, err
+}
+
+// ListByTarget returns the links other apps reach the app through.
+func (r *appLinkRepository) ListByTarget(ctx context.Context, targetAppID uuid.UUID) ([]models.AppLink, error) {
+	var items []models.AppLink
+	err := getDB(ctx, r.db).Where("target_app_id = ?", targetAppID).Order("created_at ASC").Find(&items).Error
+	return items, err
+}
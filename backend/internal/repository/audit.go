@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository interface {
+	Create(ctx context.Context, e *models.AuditEvent) error
+}
+
+type auditRepository struct{ db *gorm.DB }
+
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &auditRepository{db: db}
+}
+
+func (r *auditRepository) Create(ctx context.Context, e *models.AuditEvent) error {
+	return getDB(ctx, r.db).Create(e).Error
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type CronJobRepository interface {
+	Create(ctx context.Context, c *models.CronJob) error
+	Update(ctx context.Context, c *models.CronJob) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.CronJob, error)
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.CronJob, error)
+}
+
+type cronJobRepository struct{ db *gorm.DB }
+
+func NewCronJobRepository(db *gorm.DB) CronJobRepository {
+	return &cronJobRepository{db: db}
+}
+
+func (r *cronJobRepository) Create(ctx context.Context, c *models.CronJob) error {
+	return getDB(ctx, r.db).Create(c).Error
+}
+
+func (r *cronJobRepository) Update(ctx context.Context, c *models.CronJob) error {
+	return getDB(ctx, r.db).Model(&models.CronJob{}).
+		Where("id = ?", c.ID).
+		Updates(map[string]any{
+			"name":                          c.Name,
+			"schedule":                      c.Schedule,
+			"command":                       c.Command,
+			"concurrency_policy":            c.ConcurrencyPolicy,
+			"successful_jobs_history_limit": c.SuccessfulJobsHistoryLimit,
+			"failed_jobs_history_limit":     c.FailedJobsHistoryLimit,
+			"suspend":                       c.Suspend,
+		}).Error
+}
+
+func (r *cronJobRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return getDB(ctx, r.db).Delete(&models.CronJob{}, "id = ?", id).Error
+}
+
+func (r *cronJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.CronJob, error) {
+	var c models.CronJob
+	if err := getDB(ctx, r.db).First(&c, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *cronJobRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.CronJob, error) {
+	var items []models.CronJob
+	if err := getDB(ctx, r.db).
+		Where("app_id = ?", appID).
+		Order("created_at ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -2,16 +2,32 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"mini-paas/backend/internal/models"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ActiveDeploymentStatuses are the states of a deployment that holds a
+// rollout slot; an app has at most one deployment in them.
+var ActiveDeploymentStatuses = []string{"PENDING", "RELEASING", "DEPLOYING"}
+
+// FinishedDeploymentStatuses are the states of a deployment that no longer
+// serves traffic; only a rollback brings a SUPERSEDED release back.
+var FinishedDeploymentStatuses = []string{"FAILED", "CANCELLED", "ROLLED_BACK", "RETIRED", "SUPERSEDED", "DISCARDED"}
+
+// deployQueueLockKey is the advisory lock that serializes queue changes, so
+// concurrent enqueues and claims see each other's rows.
+const deployQueueLockKey = 7_310_442_018
+
 type DeploymentFilter struct {
 	AppID  *uuid.UUID
 	Status *string
+	// an environment's id, or a name matching the environments of every app
+	Environment *string
 }
 
 type DeploymentRepository interface {
@@ -19,6 +35,25 @@ type DeploymentRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.Deployment, error)
 	List(ctx context.Context, f DeploymentFilter, page Page, sort Sort) (ListResult[models.Deployment], error)
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
+	GetLatestByApp(ctx context.Context, appID uuid.UUID, statuses ...string) (*models.Deployment, error)
+	ListByStatus(ctx context.Context, statuses ...string) ([]models.Deployment, error)
+	ListByApp(ctx context.Context, appID uuid.UUID, statuses ...string) ([]models.Deployment, error)
+	Supersede(ctx context.Context, id, by uuid.UUID) error
+	GetSupersededBy(ctx context.Context, by uuid.UUID) (*models.Deployment, error)
+	Enqueue(ctx context.Context, d *models.Deployment) error
+	EnqueueAhead(ctx context.Context, d *models.Deployment) error
+	ClaimQueued(ctx context.Context, maxActive int) ([]models.Deployment, error)
+	QueuePosition(ctx context.Context, d *models.Deployment) (int, error)
+	Cancel(ctx context.Context, id, userID uuid.UUID, from ...string) (bool, error)
+	SetRollbackReason(ctx context.Context, id uuid.UUID, reason string) error
+	SetColor(ctx context.Context, id uuid.UUID, color string) error
+	SetCanaryOf(ctx context.Context, id, stableID uuid.UUID) error
+	Promote(ctx context.Context, d *models.Deployment, retireAt time.Time) error
+	ListRetirable(ctx context.Context, now time.Time) ([]models.Deployment, error)
+	ListSuperseded(ctx context.Context, keepRunning int) ([]models.Deployment, error)
+	ListExpired(ctx context.Context, keep int, statuses ...string) ([]models.Deployment, error)
+	ExistingIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]bool, error)
+	DeleteWithHistory(ctx context.Context, ids []uuid.UUID) error
 }
 type deploymentRepository struct{ db *gorm.DB }
 
@@ -51,6 +86,14 @@ func (r *deploymentRepository) List(ctx context.Context, f DeploymentFilter, pag
 		db = db.Where("app_id = ?", *f.AppID)
 	}
 
+	if f.Environment != nil {
+		if id, err := uuid.Parse(*f.Environment); err == nil {
+			db = db.Where("environment_id = ?", id)
+		} else {
+			db = db.Where("environment_id IN (?)", getDB(ctx, r.db).Model(&models.Environment{}).Select("id").Where("name = ?", *f.Environment))
+		}
+	}
+
 	var total int64
 	if err := db.Count(&total).Error; err != nil {
 		return ListResult[models.Deployment]{}, err
@@ -73,6 +116,253 @@ func (r *deploymentRepository) List(ctx context.Context, f DeploymentFilter, pag
 	return ListResult[models.Deployment]{Items: items, Total: total}, nil
 }
 
+// UpdateStatus sets the status of a deployment unless it was cancelled; a
+// cancelled deployment stays cancelled whatever its background work reports.
 func (r *deploymentRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
-	return getDB(ctx, r.db).Model(&models.Deployment{}).Where("id = ?", id).Update("status", status).Error
+	return getDB(ctx, r.db).Model(&models.Deployment{}).
+		Where("id = ? AND status <> ?", id, "CANCELLED").
+		Update("status", status).Error
+}
+
+// GetLatestByApp returns the most recent deployment of an app, optionally
+// restricted to the given statuses.
+func (r *deploymentRepository) GetLatestByApp(ctx context.Context, appID uuid.UUID, statuses ...string) (*models.Deployment, error) {
+	db := getDB(ctx, r.db).Where("app_id = ?", appID)
+	if len(statuses) > 0 {
+		db = db.Where("status IN ?", statuses)
+	}
+
+	var d models.Deployment
+	if err := db.Order("created_at DESC").First(&d).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *deploymentRepository) ListByStatus(ctx context.Context, statuses ...string) ([]models.Deployment, error) {
+	var items []models.Deployment
+	err := getDB(ctx, r.db).Where("status IN ?", statuses).Order("created_at").Find(&items).Error
+	return items, err
+}
+
+// ListByApp returns the deployments of an app in statuses, newest first.
+func (r *deploymentRepository) ListByApp(ctx context.Context, appID uuid.UUID, statuses ...string) ([]models.Deployment, error) {
+	var items []models.Deployment
+	err := getDB(ctx, r.db).Where("app_id = ? AND status IN ?", appID, statuses).Order("created_at DESC").Find(&items).Error
+	return items, err
+}
+
+// Supersede marks the RUNNING release id as SUPERSEDED by the release that
+// replaced it.
+func (r *deploymentRepository) Supersede(ctx context.Context, id, by uuid.UUID) error {
+	return getDB(ctx, r.db).Model(&models.Deployment{}).
+		Where("id = ? AND status = ?", id, "RUNNING").
+		Updates(map[string]any{"status": "SUPERSEDED", "superseded_by": by}).Error
+}
+
+// GetSupersededBy returns the SUPERSEDED release that by replaced.
+func (r *deploymentRepository) GetSupersededBy(ctx context.Context, by uuid.UUID) (*models.Deployment, error) {
+	var d models.Deployment
+	if err := getDB(ctx, r.db).Where("superseded_by = ? AND status = ?", by, "SUPERSEDED").
+		Order("created_at DESC").First(&d).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Enqueue stores d as QUEUED and supersedes the app's older queued
+// deployments, so only the newest request for an app is rolled out.
+func (r *deploymentRepository) Enqueue(ctx context.Context, d *models.Deployment) error {
+	return getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", deployQueueLockKey).Error; err != nil {
+			return err
+		}
+		d.Status = "QUEUED"
+		if err := tx.Create(d).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Deployment{}).
+			Where("app_id = ? AND status = ? AND id <> ?", d.AppID, "QUEUED", d.ID).
+			Update("status", "SUPERSEDED").Error
+	})
+}
+
+// EnqueueAhead stores d as QUEUED ahead of the app's queued deployments,
+// which stay queued and are rolled out after it.
+func (r *deploymentRepository) EnqueueAhead(ctx context.Context, d *models.Deployment) error {
+	return getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", deployQueueLockKey).Error; err != nil {
+			return err
+		}
+		var first models.Deployment
+		err := tx.Where("app_id = ? AND status = ?", d.AppID, "QUEUED").Order("created_at").First(&first).Error
+		if err == nil {
+			// the queue is claimed in order of creation
+			d.CreatedAt = first.CreatedAt.Add(-time.Microsecond)
+		} else if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		d.Status = "QUEUED"
+		return tx.Create(d).Error
+	})
+}
+
+// ClaimQueued moves the oldest queued deployments of apps without an active
+// one to PENDING, keeping at most maxActive deployments active overall.
+func (r *deploymentRepository) ClaimQueued(ctx context.Context, maxActive int) ([]models.Deployment, error) {
+	var claimed []models.Deployment
+	err := getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", deployQueueLockKey).Error; err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&models.Deployment{}).Where("status IN ?", ActiveDeploymentStatuses).Count(&active).Error; err != nil {
+			return err
+		}
+		free := maxActive - int(active)
+		if free <= 0 {
+			return nil
+		}
+
+		// a blue/green release waiting to be promoted or a canary taking its
+		// steps also keeps its app busy, without taking a rollout slot
+		busyStatuses := append([]string{"READY", "CANARY"}, ActiveDeploymentStatuses...)
+		busyApps := tx.Model(&models.Deployment{}).Select("app_id").Where("status IN ?", busyStatuses)
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND app_id NOT IN (?)", "QUEUED", busyApps).
+			Order("created_at").
+			Limit(free).
+			Find(&claimed).Error
+		if err != nil || len(claimed) == 0 {
+			return err
+		}
+
+		ids := make([]uuid.UUID, 0, len(claimed))
+		for i := range claimed {
+			claimed[i].Status = "PENDING"
+			ids = append(ids, claimed[i].ID)
+		}
+		return tx.Model(&models.Deployment{}).Where("id IN ?", ids).Update("status", "PENDING").Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// QueuePosition is the 1-based place of a queued deployment among all
+// queued deployments, oldest first.
+func (r *deploymentRepository) QueuePosition(ctx context.Context, d *models.Deployment) (int, error) {
+	var ahead int64
+	err := getDB(ctx, r.db).Model(&models.Deployment{}).
+		Where("status = ? AND created_at < ?", "QUEUED", d.CreatedAt).
+		Count(&ahead).Error
+	return int(ahead) + 1, err
+}
+
+// Cancel marks the deployment CANCELLED by userID if its status is one of
+// from, and reports whether it was.
+func (r *deploymentRepository) Cancel(ctx context.Context, id, userID uuid.UUID, from ...string) (bool, error) {
+	now := time.Now()
+	res := getDB(ctx, r.db).Model(&models.Deployment{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(map[string]any{
+			"status":       "CANCELLED",
+			"cancelled_by": userID,
+			"cancelled_at": now,
+		})
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r *deploymentRepository) SetRollbackReason(ctx context.Context, id uuid.UUID, reason string) error {
+	return getDB(ctx, r.db).Model(&models.Deployment{}).Where("id = ?", id).Update("rollback_reason", reason).Error
+}
+
+func (r *deploymentRepository) SetColor(ctx context.Context, id uuid.UUID, color string) error {
+	return getDB(ctx, r.db).Model(&models.Deployment{}).Where("id = ?", id).Update("color", color).Error
+}
+
+func (r *deploymentRepository) SetCanaryOf(ctx context.Context, id, stableID uuid.UUID) error {
+	return getDB(ctx, r.db).Model(&models.Deployment{}).Where("id = ?", id).Update("canary_of", stableID).Error
+}
+
+// Promote makes d the app's RUNNING release and turns the releases it
+// replaces IDLE until retireAt.
+func (r *deploymentRepository) Promote(ctx context.Context, d *models.Deployment, retireAt time.Time) error {
+	return getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Deployment{}).
+			Where("app_id = ? AND id <> ? AND status = ?", d.AppID, d.ID, "RUNNING").
+			Updates(map[string]any{"status": "IDLE", "retire_at": retireAt}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Deployment{}).
+			Where("id = ?", d.ID).
+			Updates(map[string]any{"status": "RUNNING", "retire_at": nil}).Error
+	})
+}
+
+// ListRetirable returns the IDLE releases whose retire time has passed.
+func (r *deploymentRepository) ListRetirable(ctx context.Context, now time.Time) ([]models.Deployment, error) {
+	var items []models.Deployment
+	err := getDB(ctx, r.db).Where("status = ? AND retire_at <= ?", "IDLE", now).Find(&items).Error
+	return items, err
+}
+
+// ListSuperseded returns the releases of each app that still have objects,
+// RUNNING or scaled down when a newer release replaced them, older than its
+// newest keepRunning ones.
+func (r *deploymentRepository) ListSuperseded(ctx context.Context, keepRunning int) ([]models.Deployment, error) {
+	var items []models.Deployment
+	err := getDB(ctx, r.db).Raw(`
+		SELECT * FROM (
+			SELECT d.*, row_number() OVER (PARTITION BY app_id ORDER BY created_at DESC) AS rank
+			FROM deployments d WHERE status = ? OR (status = ? AND superseded_by IS NOT NULL)
+		) ranked WHERE rank > ? ORDER BY created_at`, "RUNNING", "SUPERSEDED", keepRunning).
+		Scan(&items).Error
+	return items, err
+}
+
+// ListExpired returns the deployments in statuses that are older than the
+// newest keep of their app, and every deployment of apps that are gone.
+func (r *deploymentRepository) ListExpired(ctx context.Context, keep int, statuses ...string) ([]models.Deployment, error) {
+	var items []models.Deployment
+	err := getDB(ctx, r.db).Raw(`
+		SELECT * FROM (
+			SELECT d.*, row_number() OVER (PARTITION BY app_id ORDER BY created_at DESC) AS rank
+			FROM deployments d
+		) ranked
+		WHERE (rank > ? AND status IN ?)
+			OR NOT EXISTS (SELECT 1 FROM applications a WHERE a.id = ranked.app_id)
+		ORDER BY created_at`, keep, statuses).
+		Scan(&items).Error
+	return items, err
+}
+
+// ExistingIDs reports which of ids are deployments.
+func (r *deploymentRepository) ExistingIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	return existingIDs(ctx, r.db, &models.Deployment{}, ids)
+}
+
+// DeleteWithHistory deletes the deployments with their events and logs.
+func (r *deploymentRepository) DeleteWithHistory(ctx context.Context, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("deployment_id IN ?", ids).Delete(&models.Log{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("deployment_id IN ?", ids).Delete(&models.DeploymentEvent{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Deployment{}).Error
+	})
 }
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DeploymentEventRepository interface {
+	Create(ctx context.Context, e *models.DeploymentEvent) error
+	ListByDeployment(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error)
+	Latest(ctx context.Context, deploymentID uuid.UUID, types ...string) (*models.DeploymentEvent, error)
+	ListByApp(ctx context.Context, appID uuid.UUID, limit int) ([]models.DeploymentEvent, error)
+}
+
+type deploymentEventRepository struct{ db *gorm.DB }
+
+func NewDeploymentEventRepository(db *gorm.DB) DeploymentEventRepository {
+	return &deploymentEventRepository{db: db}
+}
+
+func (r *deploymentEventRepository) Create(ctx context.Context, e *models.DeploymentEvent) error {
+	return getDB(ctx, r.db).Create(e).Error
+}
+
+// ListByDeployment returns the deployment's events, oldest first.
+func (r *deploymentEventRepository) ListByDeployment(ctx context.Context, deploymentID uuid.UUID) ([]models.DeploymentEvent, error) {
+	var items []models.DeploymentEvent
+	err := getDB(ctx, r.db).Where("deployment_id = ?", deploymentID).Order("created_at").Find(&items).Error
+	return items, err
+}
+
+// Latest returns the deployment's most recent event of one of types.
+func (r *deploymentEventRepository) Latest(ctx context.Context, deploymentID uuid.UUID, types ...string) (*models.DeploymentEvent, error) {
+	var e models.DeploymentEvent
+	err := getDB(ctx, r.db).
+		Where("deployment_id = ? AND type IN ?", deploymentID, types).
+		Order("created_at DESC").
+		First(&e).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ListByApp returns the most recent events of all the app's deployments,
+// newest first.
+func (r *deploymentEventRepository) ListByApp(ctx context.Context, appID uuid.UUID, limit int) ([]models.DeploymentEvent, error) {
+	var items []models.DeploymentEvent
+	err := getDB(ctx, r.db).
+		Joins("JOIN deployments ON deployments.id = deployment_events.deployment_id").
+		Where("deployments.app_id = ?", appID).
+		Order("deployment_events.created_at DESC").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
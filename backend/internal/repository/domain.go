@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type DomainRepository interface {
+	Create(ctx context.Context, d *models.Domain) error
+	Update(ctx context.Context, d *models.Domain) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Domain, error)
+	GetByHostname(ctx context.Context, hostname string) (*models.Domain, error)
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Domain, error)
+	CountByApps(ctx context.Context, appIDs []uuid.UUID) (int64, error)
+}
+
+type domainRepository struct{ db *gorm.DB }
+
+func NewDomainRepository(db *gorm.DB) DomainRepository {
+	return &domainRepository{db: db}
+}
+
+func (r *domainRepository) Create(ctx context.Context, d *models.Domain) error {
+	return getDB(ctx, r.db).Create(d).Error
+}
+
+func (r *domainRepository) Update(ctx context.Context, d *models.Domain) error {
+	return getDB(ctx, r.db).Save(d).Error
+}
+
+func (r *domainRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return getDB(ctx, r.db).Delete(&models.Domain{}, "id = ?", id).Error
+}
+
+func (r *domainRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Domain, error) {
+	var d models.Domain
+	if err := getDB(ctx, r.db).First(&d, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *domainRepository) GetByHostname(ctx context.Context, hostname string) (*models.Domain, error) {
+	var d models.Domain
+	if err := getDB(ctx, r.db).First(&d, "hostname = ?", hostname).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (r *domainRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Domain, error) {
+	var items []models.Domain
+	if err := getDB(ctx, r.db).
+		Where("app_id = ?", appID).
+		Order("created_at ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *domainRepository) CountByApps(ctx context.Context, appIDs []uuid.UUID) (int64, error) {
+	if len(appIDs) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := getDB(ctx, r.db).Model(&models.Domain{}).Where("app_id IN ?", appIDs).Count(&n).Error
+	return n, err
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EnvironmentRepository interface {
+	Create(ctx context.Context, e *models.Environment) error
+	GetByName(ctx context.Context, appID uuid.UUID, name string) (*models.Environment, error)
+	GetByEnvApp(ctx context.Context, envAppID uuid.UUID) (*models.Environment, error)
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Environment, error)
+}
+
+type environmentRepository struct{ db *gorm.DB }
+
+func NewEnvironmentRepository(db *gorm.DB) EnvironmentRepository {
+	return &environmentRepository{db: db}
+}
+
+func (r *environmentRepository) Create(ctx context.Context, e *models.Environment) error {
+	return getDB(ctx, r.db).Create(e).Error
+}
+
+func (r *environmentRepository) GetByName(ctx context.Context, appID uuid.UUID, name string) (*models.Environment, error) {
+	var e models.Environment
+	if err := getDB(ctx, r.db).Where("app_id = ? AND name = ?", appID, name).First(&e).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &e, nil
+}
+
+// GetByEnvApp returns the environment the app runs.
+func (r *environmentRepository) GetByEnvApp(ctx context.Context, envAppID uuid.UUID) (*models.Environment, error) {
+	var e models.Environment
+	if err := getDB(ctx, r.db).Where("env_app_id = ?", envAppID).First(&e).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &e, nil
+}
+
+// ListByApp returns the app's environments in promotion order.
+func (r *environmentRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Environment, error) {
+	var items []models.Environment
+	err := getDB(ctx, r.db).Where("app_id = ?", appID).Order("position ASC").Find(&items).Error
+	return items, err
+}
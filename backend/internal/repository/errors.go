@@ -1,9 +1,19 @@
 package repository
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 var (
 	ErrNotFound   = errors.New("repository: not found")
 	ErrConflict   = errors.New("repository: conflict")
 	ErrBadRequest = errors.New("repository: bad request")
 )
+
+// isUniqueViolation reports whether err is a Postgres unique constraint error.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -20,6 +20,8 @@ type LogFilter struct {
 type LogRepository interface {
 	Append(ctx context.Context, l *models.Log) error
 	List(ctx context.Context, f LogFilter, limit int) ([]models.Log, error)
+	CountBefore(ctx context.Context, before time.Time) (int64, error)
+	DeleteBefore(ctx context.Context, before time.Time) (int64, error)
 }
 
 type logRepository struct{ db *gorm.DB }
@@ -55,3 +57,15 @@ func (r *logRepository) List(ctx context.Context, f LogFilter, limit int) ([]mod
 	}
 	return items, nil
 }
+
+func (r *logRepository) CountBefore(ctx context.Context, before time.Time) (int64, error) {
+	var n int64
+	err := getDB(ctx, r.db).Model(&models.Log{}).Where("timestamp < ?", before).Count(&n).Error
+	return n, err
+}
+
+// DeleteBefore deletes the log lines written before before and returns how many.
+func (r *logRepository) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	res := getDB(ctx, r.db).Where("timestamp < ?", before).Delete(&models.Log{})
+	return res.RowsAffected, res.Error
+}
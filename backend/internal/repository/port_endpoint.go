@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type PortEndpointRepository interface {
+	Upsert(ctx context.Context, e *models.PortEndpoint) error
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.PortEndpoint, error)
+	DeleteExcept(ctx context.Context, appID uuid.UUID, names []string) error
+}
+
+type portEndpointRepository struct{ db *gorm.DB }
+
+func NewPortEndpointRepository(db *gorm.DB) PortEndpointRepository {
+	return &portEndpointRepository{db: db}
+}
+
+// Upsert stores the endpoint of the app's port, replacing the one recorded before.
+func (r *portEndpointRepository) Upsert(ctx context.Context, e *models.PortEndpoint) error {
+	return getDB(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "app_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"protocol", "port", "service_type", "service_name", "node_port", "address", "updated_at"}),
+	}).Create(e).Error
+}
+
+func (r *portEndpointRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.PortEndpoint, error) {
+	var items []models.PortEndpoint
+	if err := getDB(ctx, r.db).
+		Where("app_id = ?", appID).
+		Order("name ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// DeleteExcept removes the app's endpoints of ports not in names.
+func (r *portEndpointRepository) DeleteExcept(ctx context.Context, appID uuid.UUID, names []string) error {
+	db := getDB(ctx, r.db).Where("app_id = ?", appID)
+	if len(names) > 0 {
+		db = db.Where("name NOT IN ?", names)
+	}
+	return db.Delete(&models.PortEndpoint{}).Error
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type QuotaRepository interface {
+	GetByUser(ctx context.Context, userID uuid.UUID) (*models.Quota, error)
+	GetByTeam(ctx context.Context, teamID uuid.UUID) (*models.Quota, error)
+	Save(ctx context.Context, q *models.Quota) error
+}
+
+type quotaRepository struct{ db *gorm.DB }
+
+func NewQuotaRepository(db *gorm.DB) QuotaRepository {
+	return &quotaRepository{db: db}
+}
+
+func (r *quotaRepository) GetByUser(ctx context.Context, userID uuid.UUID) (*models.Quota, error) {
+	var q models.Quota
+	if err := getDB(ctx, r.db).First(&q, "user_id = ?", userID).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &q, nil
+}
+
+func (r *quotaRepository) GetByTeam(ctx context.Context, teamID uuid.UUID) (*models.Quota, error) {
+	var q models.Quota
+	if err := getDB(ctx, r.db).First(&q, "team_id = ?", teamID).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &q, nil
+}
+
+// Save creates the quota of its user or team, or replaces the existing one.
+func (r *quotaRepository) Save(ctx context.Context, q *models.Quota) error {
+	column := "user_id"
+	if q.TeamID != nil {
+		column = "team_id"
+	}
+	return getDB(ctx, r.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: column}},
+		DoUpdates: clause.AssignmentColumns([]string{"plan", "max_apps", "max_cpu_millis", "max_memory_mib", "max_replicas", "max_volumes", "max_domains", "updated_at"}),
+	}).Create(q).Error
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RegistryCredentialRepository interface {
+	Create(ctx context.Context, cred *models.RegistryCredential) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.RegistryCredential, error)
+	// ListForOwners returns the credentials of a user and of the given teams.
+	ListForOwners(ctx context.Context, userID *uuid.UUID, teamIDs []uuid.UUID) ([]models.RegistryCredential, error)
+}
+
+type registryCredentialRepository struct{ db *gorm.DB }
+
+func NewRegistryCredentialRepository(db *gorm.DB) RegistryCredentialRepository {
+	return &registryCredentialRepository{db: db}
+}
+
+func (r *registryCredentialRepository) Create(ctx context.Context, cred *models.RegistryCredential) error {
+	return getDB(ctx, r.db).Create(cred).Error
+}
+
+func (r *registryCredentialRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return getDB(ctx, r.db).Delete(&models.RegistryCredential{}, "id = ?", id).Error
+}
+
+func (r *registryCredentialRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.RegistryCredential, error) {
+	var c models.RegistryCredential
+	if err := getDB(ctx, r.db).First(&c, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *registryCredentialRepository) ListForOwners(ctx context.Context, userID *uuid.UUID, teamIDs []uuid.UUID) ([]models.RegistryCredential, error) {
+	if userID == nil && len(teamIDs) == 0 {
+		return nil, nil
+	}
+
+	db := getDB(ctx, r.db)
+	owners := db.Where("1 = 0")
+	if userID != nil {
+		owners = owners.Or("user_id = ?", *userID)
+	}
+	if len(teamIDs) > 0 {
+		owners = owners.Or("team_id IN ?", teamIDs)
+	}
+
+	var items []models.RegistryCredential
+	if err := db.Where(owners).Order("created_at ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ReleaseRepository stores releases. They are immutable, so there is no way
+// to change or delete one.
+type ReleaseRepository interface {
+	Create(ctx context.Context, rel *models.Release) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Release, error)
+	GetByVersion(ctx context.Context, appID uuid.UUID, version int) (*models.Release, error)
+	GetLatest(ctx context.Context, appID uuid.UUID) (*models.Release, error)
+	ListByApp(ctx context.Context, appID uuid.UUID, page Page) (ListResult[models.Release], error)
+}
+
+type releaseRepository struct{ db *gorm.DB }
+
+func NewReleaseRepository(db *gorm.DB) ReleaseRepository {
+	return &releaseRepository{db: db}
+}
+
+// Create stores rel as the app's next version.
+func (r *releaseRepository) Create(ctx context.Context, rel *models.Release) error {
+	return getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		// the lock on the app's row hands out its versions one at a time
+		var locked []uuid.UUID
+		if err := tx.Raw("SELECT id FROM applications WHERE id = ? FOR UPDATE", rel.AppID).Scan(&locked).Error; err != nil {
+			return err
+		}
+		if len(locked) == 0 {
+			return ErrNotFound
+		}
+		var last int
+		if err := tx.Model(&models.Release{}).Where("app_id = ?", rel.AppID).
+			Select("COALESCE(MAX(version), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		rel.Version = last + 1
+		return tx.Create(rel).Error
+	})
+}
+
+func (r *releaseRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Release, error) {
+	var rel models.Release
+	if err := getDB(ctx, r.db).First(&rel, "id = ?", id).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &rel, nil
+}
+
+func (r *releaseRepository) GetByVersion(ctx context.Context, appID uuid.UUID, version int) (*models.Release, error) {
+	var rel models.Release
+	if err := getDB(ctx, r.db).Where("app_id = ? AND version = ?", appID, version).First(&rel).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &rel, nil
+}
+
+// GetLatest returns the app's release with the highest version.
+func (r *releaseRepository) GetLatest(ctx context.Context, appID uuid.UUID) (*models.Release, error) {
+	var rel models.Release
+	if err := getDB(ctx, r.db).Where("app_id = ?", appID).Order("version DESC").First(&rel).Error; err != nil {
+		return nil, mapGormError(err)
+	}
+	return &rel, nil
+}
+
+// ListByApp returns the app's releases, newest first.
+func (r *releaseRepository) ListByApp(ctx context.Context, appID uuid.UUID, page Page) (ListResult[models.Release], error) {
+	db := getDB(ctx, r.db).Model(&models.Release{}).Where("app_id = ?", appID)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return ListResult[models.Release]{}, err
+	}
+
+	p := page.Sanitize(100)
+
+	var items []models.Release
+	if err := db.Order("version DESC").Limit(p.Limit).Offset(p.Offset).Find(&items).Error; err != nil {
+		return ListResult[models.Release]{}, err
+	}
+	return ListResult[models.Release]{Items: items, Total: total}, nil
+}
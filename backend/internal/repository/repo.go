@@ -1,5 +1,12 @@
 package repository
 
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
 type Page struct {
 	Limit  int
 	Offset int
@@ -29,3 +36,19 @@ type ListResult[T any] struct {
 	Items []T
 	Total int64
 }
+
+// existingIDs reports which of ids are rows of model's table.
+func existingIDs(ctx context.Context, db *gorm.DB, model any, ids []uuid.UUID) (map[uuid.UUID]bool, error) {
+	found := make(map[uuid.UUID]bool, len(ids))
+	if len(ids) == 0 {
+		return found, nil
+	}
+	var rows []uuid.UUID
+	if err := getDB(ctx, db).Model(model).Where("id IN ?", ids).Pluck("id", &rows).Error; err != nil {
+		return nil, err
+	}
+	for _, id := range rows {
+		found[id] = true
+	}
+	return found, nil
+}
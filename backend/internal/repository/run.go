@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RunRepository interface {
+	Create(ctx context.Context, r *models.Run) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Run, error)
+	UpdateResult(ctx context.Context, r *models.Run) error
+}
+
+type runRepository struct{ db *gorm.DB }
+
+func NewRunRepository(db *gorm.DB) RunRepository {
+	return &runRepository{db: db}
+}
+
+func (r *runRepository) Create(ctx context.Context, run *models.Run) error {
+	return getDB(ctx, r.db).Create(run).Error
+}
+
+func (r *runRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Run, error) {
+	var run models.Run
+	if err := getDB(ctx, r.db).First(&run, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &run, nil
+}
+
+func (r *runRepository) UpdateResult(ctx context.Context, run *models.Run) error {
+	return getDB(ctx, r.db).Model(&models.Run{}).
+		Where("id = ?", run.ID).
+		Updates(map[string]any{
+			"status":      run.Status,
+			"exit_code":   run.ExitCode,
+			"started_at":  run.StartedAt,
+			"finished_at": run.FinishedAt,
+			"duration_ms": run.DurationMs,
+		}).Error
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type TeamRepository interface {
+	// Create stores the team with ownerID as its first member.
+	Create(ctx context.Context, team *models.Team, ownerID uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Team, error)
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Team, error)
+	AddMember(ctx context.Context, teamID, userID uuid.UUID) error
+	IsMember(ctx context.Context, teamID, userID uuid.UUID) (bool, error)
+}
+
+type teamRepository struct{ db *gorm.DB }
+
+func NewTeamRepository(db *gorm.DB) TeamRepository {
+	return &teamRepository{db: db}
+}
+
+func (r *teamRepository) Create(ctx context.Context, team *models.Team, ownerID uuid.UUID) error {
+	err := getDB(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(team).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.TeamMember{TeamID: team.ID, UserID: ownerID}).Error
+	})
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *teamRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Team, error) {
+	var t models.Team
+	if err := getDB(ctx, r.db).First(&t, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *teamRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	var items []models.Team
+	if err := getDB(ctx, r.db).
+		Joins("JOIN team_members ON team_members.team_id = teams.id").
+		Where("team_members.user_id = ?", userID).
+		Order("teams.name ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *teamRepository) AddMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	err := getDB(ctx, r.db).Create(&models.TeamMember{TeamID: teamID, UserID: userID}).Error
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *teamRepository) IsMember(ctx context.Context, teamID, userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := getDB(ctx, r.db).Model(&models.TeamMember{}).
+		Where("team_id = ? AND user_id = ?", teamID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
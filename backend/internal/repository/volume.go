@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type VolumeRepository interface {
+	Create(ctx context.Context, v *models.Volume) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.Volume, error)
+	ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Volume, error)
+	CountByApps(ctx context.Context, appIDs []uuid.UUID) (int64, error)
+}
+
+type volumeRepository struct{ db *gorm.DB }
+
+func NewVolumeRepository(db *gorm.DB) VolumeRepository {
+	return &volumeRepository{db: db}
+}
+
+func (r *volumeRepository) Create(ctx context.Context, v *models.Volume) error {
+	return getDB(ctx, r.db).Create(v).Error
+}
+
+func (r *volumeRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return getDB(ctx, r.db).Delete(&models.Volume{}, "id = ?", id).Error
+}
+
+func (r *volumeRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Volume, error) {
+	var v models.Volume
+	if err := getDB(ctx, r.db).First(&v, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (r *volumeRepository) ListByApp(ctx context.Context, appID uuid.UUID) ([]models.Volume, error) {
+	var items []models.Volume
+	if err := getDB(ctx, r.db).
+		Where("app_id = ?", appID).
+		Order("created_at ASC").
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *volumeRepository) CountByApps(ctx context.Context, appIDs []uuid.UUID) (int64, error) {
+	if len(appIDs) == 0 {
+		return 0, nil
+	}
+	var n int64
+	err := getDB(ctx, r.db).Model(&models.Volume{}).Where("app_id IN ?", appIDs).Count(&n).Error
+	return n, err
+}
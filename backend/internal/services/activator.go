@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var ErrAppUnavailable = errors.New("app has no running release")
+
+const (
+	// how long a woken app may take to have a ready pod
+	wakeTimeout      = 2 * time.Minute
+	wakePollInterval = time.Second
+)
+
+// Upstream is where the activator forwards a request once the app is awake:
+// the app's Service, reached through the API server's service proxy.
+type Upstream struct {
+	URL       *url.URL
+	Transport http.RoundTripper
+}
+
+// activatorBackendFromEnv is the Ingress backend of the activator, the
+// Service named by ACTIVATOR_SERVICE as name:port. It also serves the
+// maintenance page. It is nil when the variable is not set, in which case
+// apps are never scaled to zero and cannot be put in maintenance.
+func activatorBackendFromEnv() *networkingv1.IngressServiceBackend {
+	v := os.Getenv("ACTIVATOR_SERVICE")
+	if v == "" {
+		return nil
+	}
+	name, port, _ := strings.Cut(v, ":")
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 {
+		n = 80
+	}
+	return &networkingv1.IngressServiceBackend{
+		Name: name,
+		Port: networkingv1.ServiceBackendPort{Number: int32(n)},
+	}
+}
+
+type activatorService struct {
+	appRepo    repository.AppRepository
+	depRepo    repository.DeploymentRepository
+	eventRepo  repository.DeploymentEventRepository
+	domainRepo repository.DomainRepository
+	domains    DomainService
+	traffic    TrafficSource
+	client     *kubernetes.Clientset
+	enabled    bool
+
+	mu     sync.Mutex
+	waking map[uuid.UUID]*wakeCall
+}
+
+// wakeCall lets the requests that arrive while an app is waking wait for the
+// same wake.
+type wakeCall struct {
+	done chan struct{}
+	err  error
+}
+
+func NewActivatorService(appRepo repository.AppRepository, depRepo repository.DeploymentRepository, eventRepo repository.DeploymentEventRepository, domainRepo repository.DomainRepository, domains DomainService, traffic TrafficSource, client *kubernetes.Clientset) ActivatorService {
+	return &activatorService{
+		appRepo:    appRepo,
+		depRepo:    depRepo,
+		eventRepo:  eventRepo,
+		domainRepo: domainRepo,
+		domains:    domains,
+		traffic:    traffic,
+		client:     client,
+		enabled:    activatorBackendFromEnv() != nil,
+		waking:     map[uuid.UUID]*wakeCall{},
+	}
+}
+
+// WatchIdle puts apps to sleep once they saw no traffic for their idle
+// timeout, checking every interval until ctx is done.
+func (s *activatorService) WatchIdle(ctx context.Context, interval time.Duration) {
+	if !s.enabled || s.traffic == nil {
+		log.Printf("activator: ACTIVATOR_SERVICE or PROMETHEUS_URL not set, idle apps are not scaled to zero")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sleepIdle(ctx)
+		}
+	}
+}
+
+func (s *activatorService) sleepIdle(ctx context.Context) {
+	apps, err := s.appRepo.ListIdleScalable(ctx)
+	if err != nil {
+		log.Printf("activator: list idle-scalable apps: %v", err)
+		return
+	}
+	for i := range apps {
+		if err := s.sleepIfIdle(ctx, &apps[i]); err != nil {
+			log.Printf("activator: app %s: %v", apps[i].ID, err)
+		}
+	}
+}
+
+func (s *activatorService) sleepIfIdle(ctx context.Context, app *models.Application) error {
+	timeout := time.Duration(app.Config.IdleTimeoutSeconds) * time.Second
+	// a release on its way out replaces the running one's pods anyway
+	if _, err := s.depRepo.GetLatestByApp(ctx, app.ID, "PENDING", "RELEASING", "DEPLOYING", "CANARY"); err == nil {
+		return nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	running, err := s.depRepo.GetLatestByApp(ctx, app.ID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the timeout counts from when the release started or last woke up
+	awakeSince := running.CreatedAt
+	if woke, err := s.eventRepo.Latest(ctx, running.ID, models.EventWoke); err == nil && woke.CreatedAt.After(awakeSince) {
+		awakeSince = woke.CreatedAt
+	}
+	if time.Since(awakeSince) < timeout {
+		return nil
+	}
+	requests, err := s.traffic.Requests(ctx, *app, timeout)
+	if err != nil {
+		return err
+	}
+	if requests > 0 {
+		return nil
+	}
+
+	// route to the activator first so no request reaches a pod being removed
+	now := time.Now()
+	if err := s.appRepo.SetSleeping(ctx, app.ID, &now); err != nil {
+		return err
+	}
+	if err := s.domains.RouteApp(ctx, app.ID); err != nil {
+		return err
+	}
+	if err := scaleDeployment(ctx, s.client, appNamespace(app), running.ID, 0); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, running, models.EventSlept, fmt.Sprintf("scaled to zero after %s without traffic", timeout))
+	return nil
+}
+
+// Wake makes sure the app serving host has ready pods and returns where to
+// forward a request for path to. An app that is asleep is scaled back up;
+// requests arriving meanwhile wait for the same wake.
+func (s *activatorService) Wake(ctx context.Context, host, path string) (*Upstream, error) {
+	app, err := s.appForHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if app.SleepingSince != nil {
+		if err := s.wakeOnce(ctx, app); err != nil {
+			return nil, err
+		}
+	}
+	return s.upstream(app, path)
+}
+
+func (s *activatorService) wakeOnce(ctx context.Context, app *models.Application) error {
+	s.mu.Lock()
+	call, ok := s.waking[app.ID]
+	if !ok {
+		call = &wakeCall{done: make(chan struct{})}
+		s.waking[app.ID] = call
+		go func() {
+			// not tied to the request that started it, the others wait too
+			wctx, cancel := context.WithTimeout(context.Background(), wakeTimeout)
+			defer cancel()
+			call.err = s.wake(wctx, app)
+			s.mu.Lock()
+			delete(s.waking, app.ID)
+			s.mu.Unlock()
+			close(call.done)
+		}()
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *activatorService) wake(ctx context.Context, app *models.Application) error {
+	running, err := s.depRepo.GetLatestByApp(ctx, app.ID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrAppUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	slept := time.Since(*app.SleepingSince).Round(time.Second)
+
+	if err := scaleDeployment(ctx, s.client, appNamespace(app), running.ID, appReplicas(app.Config)); err != nil {
+		return err
+	}
+	if err := s.waitReady(ctx, appNamespace(app), running.ID); err != nil {
+		return err
+	}
+	if err := s.appRepo.SetSleeping(ctx, app.ID, nil); err != nil {
+		return err
+	}
+	if err := s.domains.RouteApp(ctx, app.ID); err != nil {
+		return err
+	}
+	s.recordEvent(ctx, running, models.EventWoke, fmt.Sprintf("woken by a request after sleeping for %s", slept))
+	return nil
+}
+
+// waitReady waits until a pod of the release is ready.
+func (s *activatorService) waitReady(ctx context.Context, namespace string, deployID uuid.UUID) error {
+	ticker := time.NewTicker(wakePollInterval)
+	defer ticker.Stop()
+	for {
+		pods, err := releasePods(ctx, s.client, namespace, deployID)
+		if err != nil {
+			return err
+		}
+		for i := range pods {
+			if podReady(&pods[i]) {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for %s to be ready: %w", deploymentResourceName(deployID), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// upstream is the app Service port serving path: that of the HTTP port with
+// the longest matching path.
+func (s *activatorService) upstream(app *models.Application, path string) (*Upstream, error) {
+	port, best := servicePortName, -1
+	for _, p := range appPorts(app.Config) {
+		if p.Protocol == models.PortHTTP && strings.HasPrefix(path, p.Path) && len(p.Path) > best {
+			port, best = servicePortFor(app.Config, p), len(p.Path)
+		}
+	}
+
+	rc, ok := s.client.CoreV1().RESTClient().(*rest.RESTClient)
+	if !ok {
+		return nil, errors.New("activator: the k8s client has no HTTP transport")
+	}
+	u := rc.Get().
+		Namespace(appNamespace(app)).
+		Resource("services").
+		Name(appResourceName(app.ID) + ":" + port).
+		SubResource("proxy").
+		URL()
+	return &Upstream{URL: u, Transport: rc.Client.Transport}, nil
+}
+
+func (s *activatorService) recordEvent(ctx context.Context, deploy *models.Deployment, typ, msg string) {
+	if err := s.eventRepo.Create(ctx, &models.DeploymentEvent{DeploymentID: deploy.ID, Type: typ, Message: msg}); err != nil {
+		log.Printf("deploy %s: record event: %v", deploy.ID, err)
+	}
+	log.Printf("activator: app %s: %s", deploy.AppID, msg)
+}
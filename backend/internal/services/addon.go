@@ -0,0 +1,431 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidAddOn = errors.New("invalid add-on")
+	ErrAddOnExists  = errors.New("application already has an add-on bound to this config var")
+)
+
+const (
+	addOnSecretPasswordKey = "password"
+	addOnSecretURLKey      = "url"
+	labelAddOnID           = "addon-id"
+
+	addOnReadyTimeout = 10 * time.Minute
+)
+
+// statuses in which an add-on's Secret exists and its config var is bound
+var activeAddOnStatuses = []string{"PROVISIONING", "READY"}
+
+type addOnService struct {
+	repo                repository.AddOnRepository
+	appRepo             repository.AppRepository
+	deployRepo          repository.DeploymentRepository
+	releases            ReleaseService
+	client              *kubernetes.Clientset
+	defaultStorageClass string
+}
+
+func NewAddOnService(
+	repo repository.AddOnRepository,
+	appRepo repository.AppRepository,
+	deployRepo repository.DeploymentRepository,
+	releases ReleaseService,
+	client *kubernetes.Clientset,
+) AddOnService {
+	return &addOnService{
+		repo:                repo,
+		appRepo:             appRepo,
+		deployRepo:          deployRepo,
+		releases:            releases,
+		client:              client,
+		defaultStorageClass: os.Getenv("DEFAULT_STORAGE_CLASS"),
+	}
+}
+
+func (s *addOnService) Catalog() []AddOnType {
+	return AddOnCatalog()
+}
+
+// Provision creates the add-on's credentials Secret, Service and StatefulSet
+// and tracks it until it is ready.
+func (s *addOnService) Provision(ctx context.Context, appID uuid.UUID, typeName, size string) (*models.AddOn, error) {
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	addOnType, ok := addOnCatalog[typeName]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidAddOn, typeName)
+	}
+	if size == "" {
+		size = addOnType.DefaultSize
+	}
+	if _, err := resource.ParseQuantity(size); err != nil {
+		return nil, fmt.Errorf("%w: size %q", ErrInvalidAddOn, size)
+	}
+
+	active, err := s.repo.ListByApp(ctx, appID, activeAddOnStatuses...)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range active {
+		if a.ConfigVar == addOnType.ConfigVar {
+			return nil, fmt.Errorf("%w: %s", ErrAddOnExists, a.ConfigVar)
+		}
+	}
+
+	addOn := &models.AddOn{
+		ID:        uuid.New(),
+		AppID:     appID,
+		Type:      addOnType.Name,
+		ConfigVar: addOnType.ConfigVar,
+		Size:      size,
+		Status:    "PROVISIONING",
+	}
+	addOn.ResourceName = fmt.Sprintf("%s-%s", addOnType.Name, addOn.ID.String()[0:8])
+	addOn.SecretName = addOn.ResourceName + "-credentials"
+
+	password, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	// the app's pods read the credentials Secret, so it lives next to them
+	namespace := appNamespace(app)
+	if err := ensureNamespace(ctx, s.client, namespace); err != nil {
+		return nil, err
+	}
+	if err := s.createResources(ctx, namespace, addOn, addOnType, password); err != nil {
+		s.deleteResources(ctx, namespace, addOn)
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, addOn); err != nil {
+		s.deleteResources(ctx, namespace, addOn)
+		return nil, err
+	}
+	if _, err := s.releases.RecordEnvChange(ctx, app, ReleaseAddOnChange); err != nil {
+		return nil, err
+	}
+
+	go s.trackAddOn(context.WithoutCancel(ctx), namespace, addOn)
+
+	return addOn, nil
+}
+
+func (s *addOnService) ListAddOns(ctx context.Context, appID uuid.UUID) ([]models.AddOn, error) {
+	return s.repo.ListByApp(ctx, appID)
+}
+
+func (s *addOnService) GetAddOn(ctx context.Context, appID, id uuid.UUID) (*models.AddOn, error) {
+	addOn, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if addOn.AppID != appID {
+		return nil, repository.ErrNotFound
+	}
+	return addOn, nil
+}
+
+// Deprovision unbinds the add-on from the app and deletes its resources,
+// including the data volume, in the background.
+func (s *addOnService) Deprovision(ctx context.Context, appID, id uuid.UUID) (*models.AddOn, error) {
+	addOn, err := s.GetAddOn(ctx, appID, id)
+	if err != nil {
+		return nil, err
+	}
+	if addOn.Status == "DEPROVISIONING" || addOn.Status == "DEPROVISIONED" {
+		return addOn, nil
+	}
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	namespace := appNamespace(app)
+
+	if err := s.repo.UpdateStatus(ctx, addOn.ID, "DEPROVISIONING"); err != nil {
+		return nil, err
+	}
+	addOn.Status = "DEPROVISIONING"
+	if _, err := s.releases.RecordEnvChange(ctx, app, ReleaseAddOnChange); err != nil {
+		return nil, err
+	}
+
+	go func(ctx context.Context) {
+		if err := s.syncLiveEnv(ctx, addOn.AppID); err != nil {
+			log.Printf("addon %s: unbind from app: %v", addOn.ID, err)
+		}
+		s.deleteResources(ctx, namespace, addOn)
+		if err := s.repo.UpdateStatus(ctx, addOn.ID, "DEPROVISIONED"); err != nil {
+			log.Printf("addon %s: update status: %v", addOn.ID, err)
+		}
+	}(context.WithoutCancel(ctx))
+
+	return addOn, nil
+}
+
+// DeleteAppAddOns deletes the resources of every add-on of an app that is
+// being deleted, data volume included. There is no release to unbind them
+// from and none is recorded.
+func (s *addOnService) DeleteAppAddOns(ctx context.Context, appID uuid.UUID) error {
+	addOns, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return err
+	}
+	if len(addOns) == 0 {
+		return nil
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, appID)
+	if err != nil {
+		return err
+	}
+	for i := range addOns {
+		if addOns[i].Status == "DEPROVISIONED" {
+			continue
+		}
+		s.deleteResources(ctx, namespace, &addOns[i])
+		if err := s.repo.UpdateStatus(ctx, addOns[i].ID, "DEPROVISIONED"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *addOnService) trackAddOn(ctx context.Context, namespace string, addOn *models.AddOn) {
+	ctx, cancel := context.WithTimeout(ctx, addOnReadyTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			_ = s.repo.UpdateStatus(context.WithoutCancel(ctx), addOn.ID, "FAILED")
+			return
+		case <-ticker.C:
+		}
+
+		sts, err := s.client.AppsV1().StatefulSets(namespace).Get(ctx, addOn.ResourceName, metav1.GetOptions{})
+		if err != nil {
+			continue
+		}
+		if sts.Status.ReadyReplicas >= 1 {
+			_ = s.repo.UpdateStatus(ctx, addOn.ID, "READY")
+
+			// running releases pick up the new config var with a rolling restart
+			if err := s.syncLiveEnv(ctx, addOn.AppID); err != nil {
+				log.Printf("addon %s: bind to app: %v", addOn.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// syncLiveEnv rewrites the add-on config vars of the app's running k8s Deployment.
+func (s *addOnService) syncLiveEnv(ctx context.Context, appID uuid.UUID) error {
+	deploy, err := s.deployRepo.GetLatestByApp(ctx, appID, "RUNNING")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	active, err := s.repo.ListByApp(ctx, appID, activeAddOnStatuses...)
+	if err != nil {
+		return err
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, appID)
+	if err != nil {
+		return err
+	}
+
+	deployments := s.client.AppsV1().Deployments(namespace)
+	live, err := deployments.Get(ctx, deploymentResourceName(deploy.ID), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if len(live.Spec.Template.Spec.Containers) == 0 {
+		return nil
+	}
+
+	c := &live.Spec.Template.Spec.Containers[0]
+	c.Env = withAddOnEnv(c.Env, active)
+	_, err = deployments.Update(ctx, live, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *addOnService) createResources(ctx context.Context, namespace string, addOn *models.AddOn, addOnType AddOnType, password string) error {
+	labels := map[string]string{
+		labelManagedBy: managedByPlatform,
+		labelAppID:     addOn.AppID.String(),
+		labelAddOnID:   addOn.ID.String(),
+	}
+	host := fmt.Sprintf("%s.%s.svc.cluster.local", addOn.ResourceName, namespace)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: addOn.SecretName, Labels: labels},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: map[string]string{
+			addOnSecretPasswordKey: password,
+			addOnSecretURLKey:      addOnType.url(host, password),
+		},
+	}
+	if _, err := s.client.CoreV1().Secrets(namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create k8s secret: %w", err)
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: addOn.ResourceName, Labels: labels},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{labelAddOnID: addOn.ID.String()},
+			Ports: []corev1.ServicePort{{
+				Name:       addOnType.Name,
+				Port:       addOnType.Port,
+				TargetPort: intstr.FromInt(int(addOnType.Port)),
+			}},
+		},
+	}
+	if _, err := s.client.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create k8s service: %w", err)
+	}
+
+	claim := corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data", Labels: labels},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(addOn.Size)},
+			},
+		},
+	}
+	if s.defaultStorageClass != "" {
+		sc := s.defaultStorageClass
+		claim.Spec.StorageClassName = &sc
+	}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: addOn.ResourceName, Labels: labels},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: addOn.ResourceName,
+			Replicas:    int32Ptr(1),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{labelAddOnID: addOn.ID.String()},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{
+						Name:         addOnType.Name,
+						Image:        addOnType.Image,
+						Command:      addOnType.command,
+						Env:          addOnType.env(addOn.SecretName),
+						Ports:        []corev1.ContainerPort{{ContainerPort: addOnType.Port}},
+						VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: addOnType.dataPath}},
+						ReadinessProbe: &corev1.Probe{
+							Handler: corev1.Handler{
+								TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(int(addOnType.Port))},
+							},
+							PeriodSeconds: 5,
+						},
+					}},
+				},
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{claim},
+		},
+	}
+	if _, err := s.client.AppsV1().StatefulSets(namespace).Create(ctx, sts, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create k8s statefulset: %w", err)
+	}
+	return nil
+}
+
+// deleteResources removes everything created for the add-on; missing objects are ignored.
+func (s *addOnService) deleteResources(ctx context.Context, namespace string, addOn *models.AddOn) {
+	propagation := metav1.DeletePropagationForeground
+	opts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	deletes := map[string]func() error{
+		"statefulset": func() error {
+			return s.client.AppsV1().StatefulSets(namespace).Delete(ctx, addOn.ResourceName, opts)
+		},
+		"service": func() error {
+			return s.client.CoreV1().Services(namespace).Delete(ctx, addOn.ResourceName, opts)
+		},
+		"secret": func() error {
+			return s.client.CoreV1().Secrets(namespace).Delete(ctx, addOn.SecretName, opts)
+		},
+		// claims from volumeClaimTemplates outlive the StatefulSet
+		"pvc": func() error {
+			return s.client.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, "data-"+addOn.ResourceName+"-0", opts)
+		},
+	}
+	for kind, del := range deletes {
+		if err := del(); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("addon %s: delete %s: %v", addOn.ID, kind, err)
+		}
+	}
+}
+
+// addOnEnvVars binds each add-on's connection string to its config var.
+func addOnEnvVars(addOns []models.AddOn) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, len(addOns))
+	for _, a := range addOns {
+		env = append(env, corev1.EnvVar{
+			Name:      a.ConfigVar,
+			ValueFrom: secretKeyRef(a.SecretName, addOnSecretURLKey),
+		})
+	}
+	return env
+}
+
+// withAddOnEnv replaces the add-on bindings in env with those of addOns and
+// keeps every other variable.
+func withAddOnEnv(env []corev1.EnvVar, addOns []models.AddOn) []corev1.EnvVar {
+	managed := map[string]bool{}
+	for _, t := range addOnCatalog {
+		managed[t.ConfigVar] = true
+	}
+
+	out := make([]corev1.EnvVar, 0, len(env)+len(addOns))
+	for _, e := range env {
+		if managed[e.Name] && e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+			continue
+		}
+		out = append(out, e)
+	}
+	return append(out, addOnEnvVars(addOns)...)
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate password: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
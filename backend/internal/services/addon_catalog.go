@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// AddOnType describes how one kind of add-on is run and how apps connect to it.
+type AddOnType struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	Port        int32  `json:"port"`
+	ConfigVar   string `json:"config_var"`
+	DefaultSize string `json:"default_size"`
+
+	dataPath string
+	// command overrides the image entrypoint; $(VAR) refers to container env
+	command []string
+	// env returns the container environment; secret values are read from secretName
+	env func(secretName string) []corev1.EnvVar
+	// url is the connection string injected into the app as ConfigVar
+	url func(host, password string) string
+}
+
+var addOnCatalog = map[string]AddOnType{
+	"postgres": {
+		Name:        "postgres",
+		Description: "PostgreSQL 15 database",
+		Image:       "postgres:15",
+		Port:        5432,
+		ConfigVar:   "DATABASE_URL",
+		DefaultSize: "1Gi",
+		dataPath:    "/var/lib/postgresql/data",
+		env: func(secretName string) []corev1.EnvVar {
+			return []corev1.EnvVar{
+				{Name: "POSTGRES_USER", Value: "app"},
+				{Name: "POSTGRES_DB", Value: "app"},
+				{Name: "POSTGRES_PASSWORD", ValueFrom: secretKeyRef(secretName, addOnSecretPasswordKey)},
+				// the mount root holds lost+found on most provisioners
+				{Name: "PGDATA", Value: "/var/lib/postgresql/data/pgdata"},
+			}
+		},
+		url: func(host, password string) string {
+			return fmt.Sprintf("postgres://app:%s@%s:5432/app?sslmode=disable", password, host)
+		},
+	},
+	"redis": {
+		Name:        "redis",
+		Description: "Redis 7 with append-only persistence",
+		Image:       "redis:7",
+		Port:        6379,
+		ConfigVar:   "REDIS_URL",
+		DefaultSize: "512Mi",
+		dataPath:    "/data",
+		command:     []string{"redis-server", "--requirepass", "$(REDIS_PASSWORD)", "--appendonly", "yes"},
+		env: func(secretName string) []corev1.EnvVar {
+			return []corev1.EnvVar{
+				{Name: "REDIS_PASSWORD", ValueFrom: secretKeyRef(secretName, addOnSecretPasswordKey)},
+			}
+		},
+		url: func(host, password string) string {
+			return fmt.Sprintf("redis://:%s@%s:6379/0", password, host)
+		},
+	},
+}
+
+// AddOnCatalog lists the add-on types that can be provisioned.
+func AddOnCatalog() []AddOnType {
+	types := make([]AddOnType, 0, len(addOnCatalog))
+	for _, t := range addOnCatalog {
+		types = append(types, t)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Name < types[j].Name })
+	return types
+}
+
+func secretKeyRef(secretName, key string) *corev1.EnvVarSource {
+	return &corev1.EnvVarSource{
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+			Key:                  key,
+		},
+	}
+}
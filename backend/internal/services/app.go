@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"mini-paas/backend/internal/models"
 	"mini-paas/backend/internal/repository"
@@ -10,24 +11,72 @@ import (
 	"github.com/google/uuid"
 )
 
+var (
+	ErrAppForbidden = errors.New("you cannot manage this app")
+	// ErrAppOwnerRequired is returned for an app that belongs to no user or
+	// team, whose usage no quota would count.
+	ErrAppOwnerRequired = errors.New("an application needs an owner or a team")
+)
+
 type appService struct {
-	repo repository.AppRepository
+	repo          repository.AppRepository
+	volumeService VolumeService
+	cronService   CronService
+	addOnService  AddOnService
+	quotas        QuotaService
+	releases      ReleaseService
+	teamService   TeamService
 }
 
-func NewAppService(repo repository.AppRepository) AppService {
-	return &appService{repo: repo}
+func NewAppService(repo repository.AppRepository, volumeService VolumeService, cronService CronService, addOnService AddOnService, quotas QuotaService, releases ReleaseService, teamService TeamService) AppService {
+	return &appService{repo: repo, volumeService: volumeService, cronService: cronService, addOnService: addOnService, quotas: quotas, releases: releases, teamService: teamService}
 }
 
 func (s *appService) CreateApp(ctx context.Context, app *models.Application) (*models.Application, error) {
 	if app.Name == "" {
 		return nil, errors.New("Application Namm is required")
 	}
+	if app.OwnerID == nil && app.TeamID == nil {
+		return nil, ErrAppOwnerRequired
+	}
+	if err := s.quotas.CheckApp(ctx, app); err != nil {
+		return nil, err
+	}
 	if err := s.repo.Create(ctx, app); err != nil {
 		return nil, err
 	}
+	// the first release holds the config the app starts out with
+	if _, err := s.releases.Record(ctx, app, app.ImageURL, "", ReleaseCreate); err != nil {
+		return nil, err
+	}
 	return app, nil
 }
 
+func (s *appService) UpdateApp(ctx context.Context, app *models.Application) (*models.Application, error) {
+	if app.Name == "" {
+		return nil, errors.New("Application Name is required")
+	}
+	// the config may scale the app up
+	if err := s.quotas.CheckApp(ctx, app); err != nil {
+		return nil, err
+	}
+	previous, err := s.repo.GetByID(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, app); err != nil {
+		return nil, err
+	}
+	updated, err := s.repo.GetByID(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.releases.RecordConfigChange(ctx, previous, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
 func (s *appService) GetAppByID(ctx context.Context, id uuid.UUID) (*models.Application, error) {
 	return s.repo.GetByID(ctx, id)
 }
@@ -36,6 +85,87 @@ func (s *appService) ListApps(ctx context.Context, f repository.AppFilter, page
 	return s.repo.List(ctx, f, page, sort)
 }
 
-func (s *appService) DeleteApp(ctx context.Context, id uuid.UUID) error {
+// DeleteApp removes the application. Volumes hold user data, so an app that
+// still has volumes is only deleted when purgeVolumes is set.
+func (s *appService) DeleteApp(ctx context.Context, id uuid.UUID, purgeVolumes bool) error {
+	volumes, err := s.volumeService.ListVolumes(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(volumes) > 0 {
+		if !purgeVolumes {
+			return ErrVolumesAttached
+		}
+		if err := s.volumeService.DeleteAppVolumes(ctx, id); err != nil {
+			return err
+		}
+	}
+	// a cron job left behind keeps starting runs of an app that is gone
+	if err := s.cronService.DeleteAppCronJobs(ctx, id); err != nil {
+		return err
+	}
+	// add-ons run as StatefulSets of their own, which nothing else removes
+	if err := s.addOnService.DeleteAppAddOns(ctx, id); err != nil {
+		return err
+	}
 	return s.repo.DeleteHard(ctx, id)
 }
+
+// ApplyManifest creates the application named in the manifest, or brings an
+// existing one in line with it. The bool reports whether the app was created.
+// The name is looked up in the team's apps when teamID is set, else in the
+// user's own and then in all apps, where one of that name is only updated
+// when user may manage it. A new app belongs to user and, when set, the team.
+func (s *appService) ApplyManifest(ctx context.Context, m *AppManifest, user *models.User, teamID *uuid.UUID) (*models.Application, bool, error) {
+	if err := m.Validate(); err != nil {
+		return nil, false, err
+	}
+
+	app, err := s.repo.GetByNameInScope(ctx, m.Name, user.ID, teamID)
+	if errors.Is(err, repository.ErrNotFound) && teamID == nil {
+		// such as an app without owner, or one of a team the user is in
+		app, err = s.repo.GetByName(ctx, m.Name)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		if teamID != nil {
+			if err := s.teamService.RequireMember(ctx, *teamID, user.ID); err != nil {
+				return nil, false, err
+			}
+		}
+		app = &models.Application{OwnerID: &user.ID, TeamID: teamID}
+		m.applyTo(app)
+		created, err := s.CreateApp(ctx, app)
+		return created, true, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.RequireAccess(ctx, user, app); err != nil {
+		return nil, false, err
+	}
+	m.applyTo(app)
+	updated, err := s.UpdateApp(ctx, app)
+	return updated, false, err
+}
+
+// RequireAccess returns ErrAppForbidden unless user may manage app.
+func (s *appService) RequireAccess(ctx context.Context, user *models.User, app *models.Application) error {
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAppForbidden, app.Name)
+	}
+	return nil
+}
+
+// ExportManifest returns the app's settings in app.yaml form.
+func (s *appService) ExportManifest(ctx context.Context, id uuid.UUID) (*AppManifest, error) {
+	app, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return manifestFromApp(app), nil
+}
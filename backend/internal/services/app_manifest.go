@@ -0,0 +1,362 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+var ErrInvalidManifest = errors.New("invalid manifest")
+
+// ManifestError lists every problem found in an app manifest.
+type ManifestError struct {
+	Problems []string
+}
+
+func (e *ManifestError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidManifest, strings.Join(e.Problems, "; "))
+}
+
+func (e *ManifestError) Unwrap() error {
+	return ErrInvalidManifest
+}
+
+// AppManifest is the app.yaml schema used to keep an application's settings
+// in version control.
+type AppManifest struct {
+	Name           string               `json:"name"`
+	Description    string               `json:"description,omitempty"`
+	Source         ManifestSource       `json:"source"`
+	Runtime        string               `json:"runtime,omitempty"`
+	ReleaseCommand string               `json:"release_command,omitempty"`
+	Port           int32                `json:"port,omitempty"`
+	Ports          []models.AppPort     `json:"ports,omitempty"`
+	Env            map[string]string    `json:"env,omitempty"`
+	Resources      *models.AppResources `json:"resources,omitempty"`
+	Probes         *ManifestProbes      `json:"probes,omitempty"`
+	Scaling        *ManifestScaling     `json:"scaling,omitempty"`
+	Domains        []string             `json:"domains,omitempty"`
+	Rollback       *models.AppRollback  `json:"rollback,omitempty"`
+	Strategy       *models.AppStrategy  `json:"strategy,omitempty"`
+}
+
+// ManifestSource says where the app's code comes from; exactly one field is set.
+type ManifestSource struct {
+	Image string `json:"image,omitempty"`
+	Git   string `json:"git,omitempty"`
+}
+
+type ManifestProbes struct {
+	Readiness *models.AppProbe `json:"readiness,omitempty"`
+	Liveness  *models.AppProbe `json:"liveness,omitempty"`
+}
+
+type ManifestScaling struct {
+	Replicas           *int32 `json:"replicas,omitempty"`
+	IdleTimeoutSeconds int32  `json:"idle_timeout_seconds,omitempty"`
+}
+
+const (
+	maxReplicas        = 20
+	maxRollbackSeconds = 3600
+	maxKeepIdleSeconds = 7 * 24 * 3600
+	minIdleTimeout     = 60
+)
+
+var (
+	appNameRe  = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+	envNameRe  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	portNameRe = regexp.MustCompile(`^[a-z]([-a-z0-9]*[a-z0-9])?$`)
+	hostnameRe = regexp.MustCompile(`^([a-z0-9]([-a-z0-9]*[a-z0-9])?\.)+[a-z]{2,63}$`)
+	imageRefRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]*[a-z0-9])?(:[0-9]+/[a-z0-9]([a-z0-9._/-]*[a-z0-9])?)?(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+)
+
+// ParseAppManifest decodes an app.yaml (or its JSON form) and validates it.
+// Unknown fields are rejected so typos do not get silently dropped.
+func ParseAppManifest(data []byte) (*AppManifest, error) {
+	var m AppManifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, &ManifestError{Problems: []string{err.Error()}}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate checks the manifest against the schema and reports all problems at once.
+func (m *AppManifest) Validate() error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if !appNameRe.MatchString(m.Name) || len(m.Name) > 50 {
+		add("name: must be a lowercase DNS label of at most 50 characters")
+	}
+
+	switch {
+	case m.Source.Image == "" && m.Source.Git == "":
+		add("source: one of image or git is required")
+	case m.Source.Image != "" && m.Source.Git != "":
+		add("source: image and git are mutually exclusive")
+	case m.Source.Image != "":
+		if !imageRefRe.MatchString(m.Source.Image) {
+			add("source.image: %q is not a valid image reference", m.Source.Image)
+		}
+	default:
+		if u, err := url.Parse(m.Source.Git); err != nil || u.Scheme == "" || u.Host == "" {
+			add("source.git: %q is not a valid URL", m.Source.Git)
+		}
+	}
+
+	if m.Port != 0 && (m.Port < 1 || m.Port > 65535) {
+		add("port: must be between 1 and 65535")
+	}
+	if m.Port != 0 && len(m.Ports) > 0 {
+		add("port: set either port or ports")
+	}
+	validatePorts(m.Ports, add)
+
+	for _, k := range sortedKeys(m.Env) {
+		if !envNameRe.MatchString(k) {
+			add("env.%s: invalid variable name", k)
+		}
+	}
+
+	if r := m.Resources; r != nil {
+		checkQuantity := func(field, value string) {
+			if value == "" {
+				return
+			}
+			if _, err := resource.ParseQuantity(value); err != nil {
+				add("resources.%s: %q is not a valid quantity", field, value)
+			}
+		}
+		checkQuantity("cpu_request", r.CPURequest)
+		checkQuantity("memory_request", r.MemoryRequest)
+		checkQuantity("cpu_limit", r.CPULimit)
+		checkQuantity("memory_limit", r.MemoryLimit)
+		checkRequestWithinLimit := func(field, request, limit string) {
+			req, err1 := resource.ParseQuantity(request)
+			lim, err2 := resource.ParseQuantity(limit)
+			if err1 == nil && err2 == nil && req.Cmp(lim) > 0 {
+				add("resources.%s_request: exceeds the %s limit", field, field)
+			}
+		}
+		checkRequestWithinLimit("cpu", r.CPURequest, r.CPULimit)
+		checkRequestWithinLimit("memory", r.MemoryRequest, r.MemoryLimit)
+	}
+
+	if p := m.Probes; p != nil {
+		validateProbe("probes.readiness", p.Readiness, add)
+		validateProbe("probes.liveness", p.Liveness, add)
+	}
+
+	if s := m.Scaling; s != nil {
+		if s.Replicas != nil && (*s.Replicas < 0 || *s.Replicas > maxReplicas) {
+			add("scaling.replicas: must be between 0 and %d", maxReplicas)
+		}
+		if s.IdleTimeoutSeconds != 0 && s.IdleTimeoutSeconds < minIdleTimeout {
+			add("scaling.idle_timeout_seconds: must be at least %d", minIdleTimeout)
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, d := range m.Domains {
+		if !hostnameRe.MatchString(d) {
+			add("domains[%d]: %q is not a valid hostname", i, d)
+		}
+		if seen[d] {
+			add("domains[%d]: %q is listed twice", i, d)
+		}
+		seen[d] = true
+	}
+
+	if r := m.Rollback; r != nil {
+		if r.HealthyWithinSeconds < 0 || r.WatchSeconds < 0 || r.MaxRestarts < 0 {
+			add("rollback: durations and max_restarts must not be negative")
+		}
+		if r.HealthyWithinSeconds > maxRollbackSeconds || r.WatchSeconds > maxRollbackSeconds {
+			add("rollback: durations must be at most %d seconds", maxRollbackSeconds)
+		}
+		if r.MaxErrorRate < 0 || r.MaxErrorRate > 1 {
+			add("rollback.max_error_rate: must be between 0 and 1")
+		}
+	}
+
+	if st := m.Strategy; st != nil {
+		switch st.Type {
+		case models.StrategyRolling, models.StrategyBlueGreen, models.StrategyCanary:
+		default:
+			add("strategy.type: must be %s, %s or %s", models.StrategyRolling, models.StrategyBlueGreen, models.StrategyCanary)
+		}
+		if st.KeepIdleSeconds < 0 || st.KeepIdleSeconds > maxKeepIdleSeconds {
+			add("strategy.keep_idle_seconds: must be between 0 and %d", maxKeepIdleSeconds)
+		}
+		var prev int32
+		for i, w := range st.CanarySteps {
+			if w <= prev || w > 100 {
+				add("strategy.canary_steps[%d]: steps must increase and be at most 100", i)
+				break
+			}
+			prev = w
+		}
+		if st.StepSeconds < 0 || st.StepSeconds > maxRollbackSeconds {
+			add("strategy.step_seconds: must be between 0 and %d", maxRollbackSeconds)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ManifestError{Problems: problems}
+	}
+	return nil
+}
+
+func validatePorts(ports []models.AppPort, add func(string, ...any)) {
+	names := map[string]bool{}
+	numbers := map[string]bool{}
+	httpSeen := false
+	for i, p := range ports {
+		field := fmt.Sprintf("ports[%d]", i)
+		if !portNameRe.MatchString(p.Name) || len(p.Name) > 15 {
+			add("%s.name: must be a lowercase name of at most 15 characters starting with a letter", field)
+		}
+		if names[p.Name] {
+			add("%s.name: %q is used twice", field, p.Name)
+		}
+		names[p.Name] = true
+		if p.Port < 1 || p.Port > 65535 {
+			add("%s.port: must be between 1 and 65535", field)
+		}
+
+		transport := "tcp"
+		switch p.Protocol {
+		case "", models.PortHTTP:
+			if p.Expose != "" {
+				add("%s.expose: only tcp and udp ports are exposed through a Service of their own", field)
+			}
+			if p.Path != "" && !strings.HasPrefix(p.Path, "/") {
+				add("%s.path: must start with /", field)
+			}
+			// the app Service serves the first HTTP port as http
+			if httpSeen && p.Name == servicePortName {
+				add("%s.name: http is reserved for the first HTTP port", field)
+			}
+			httpSeen = true
+		case models.PortTCP, models.PortUDP:
+			if p.Path != "" {
+				add("%s.path: only HTTP ports are routed by path", field)
+			}
+			switch p.Expose {
+			case "", models.ExposeNodePort, models.ExposeLoadBalancer:
+			default:
+				add("%s.expose: must be %s or %s", field, models.ExposeNodePort, models.ExposeLoadBalancer)
+			}
+			if p.Protocol == models.PortUDP {
+				transport = "udp"
+			}
+		default:
+			add("%s.protocol: must be %s, %s or %s", field, models.PortHTTP, models.PortTCP, models.PortUDP)
+		}
+		key := fmt.Sprintf("%d/%s", p.Port, transport)
+		if numbers[key] {
+			add("%s.port: %s is declared twice", field, key)
+		}
+		numbers[key] = true
+	}
+}
+
+func validateProbe(field string, p *models.AppProbe, add func(string, ...any)) {
+	if p == nil {
+		return
+	}
+	if !strings.HasPrefix(p.Path, "/") {
+		add("%s.path: must start with /", field)
+	}
+	if p.InitialDelaySeconds < 0 || p.PeriodSeconds < 0 || p.TimeoutSeconds < 0 || p.FailureThreshold < 0 {
+		add("%s: timings must not be negative", field)
+	}
+}
+
+// applyTo overwrites the settings of app with the manifest. Anything the
+// manifest leaves out is reset, so applying the same file twice is a no-op.
+func (m *AppManifest) applyTo(app *models.Application) {
+	app.Name = m.Name
+	app.Description = m.Description
+	app.ImageURL = m.Source.Image
+	app.GitURL = m.Source.Git
+	app.Runtime = m.Runtime
+	app.ReleaseCommand = m.ReleaseCommand
+
+	cfg := models.AppConfig{
+		Port:     m.Port,
+		Ports:    m.Ports,
+		Env:      m.Env,
+		Domains:  m.Domains,
+		Rollback: m.Rollback,
+		Strategy: m.Strategy,
+	}
+	if m.Resources != nil {
+		cfg.Resources = *m.Resources
+	}
+	if m.Probes != nil {
+		cfg.Readiness = m.Probes.Readiness
+		cfg.Liveness = m.Probes.Liveness
+	}
+	if m.Scaling != nil {
+		cfg.Replicas = m.Scaling.Replicas
+		cfg.IdleTimeoutSeconds = m.Scaling.IdleTimeoutSeconds
+	}
+	app.Config = cfg
+}
+
+// manifestFromApp is the inverse of applyTo.
+func manifestFromApp(app *models.Application) *AppManifest {
+	cfg := app.Config
+	m := &AppManifest{
+		Name:           app.Name,
+		Description:    app.Description,
+		Source:         ManifestSource{Image: app.ImageURL, Git: app.GitURL},
+		Runtime:        app.Runtime,
+		ReleaseCommand: app.ReleaseCommand,
+		Port:           cfg.Port,
+		Ports:          cfg.Ports,
+		Env:            cfg.Env,
+		Domains:        cfg.Domains,
+		Rollback:       cfg.Rollback,
+		Strategy:       cfg.Strategy,
+	}
+	// a manifest declares a single source, git wins when both are stored
+	if m.Source.Git != "" {
+		m.Source.Image = ""
+	}
+	if cfg.Resources != (models.AppResources{}) {
+		res := cfg.Resources
+		m.Resources = &res
+	}
+	if cfg.Readiness != nil || cfg.Liveness != nil {
+		m.Probes = &ManifestProbes{Readiness: cfg.Readiness, Liveness: cfg.Liveness}
+	}
+	if cfg.Replicas != nil || cfg.IdleTimeoutSeconds != 0 {
+		m.Scaling = &ManifestScaling{Replicas: cfg.Replicas, IdleTimeoutSeconds: cfg.IdleTimeoutSeconds}
+	}
+	return m
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var ErrNotPromotable = errors.New("deployment cannot be promoted")
+
+const (
+	labelColor = "color"
+	colorBlue  = "blue"
+	colorGreen = "green"
+
+	servicePortName = "http"
+	// how long the replaced color is kept when the app does not say
+	defaultKeepIdle = time.Hour
+)
+
+// nextColor is the color a new blue/green release of the app gets: the one
+// that is not live.
+func (s *deploymentService) nextColor(ctx context.Context, appID uuid.UUID) (string, error) {
+	live, err := s.repo.GetLatestByApp(ctx, appID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return colorBlue, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if live.Color == colorBlue {
+		return colorGreen, nil
+	}
+	return colorBlue, nil
+}
+
+// PromoteDeployment switches the app's Service to a blue/green release that
+// is READY, or back to an IDLE one for an instant rollback. The release it
+// replaces stays IDLE for the app's keep-idle time.
+func (s *deploymentService) PromoteDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error) {
+	deploy, err := s.requireAccess(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if deploy.Color == "" {
+		return nil, fmt.Errorf("%w: it was not deployed blue/green", ErrNotPromotable)
+	}
+	if deploy.Status != "READY" && deploy.Status != "IDLE" {
+		return nil, fmt.Errorf("%w: it is %s", ErrNotPromotable, deploy.Status)
+	}
+	stored, err := s.appRepo.GetByID(ctx, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := appNamespace(stored)
+	appName := appResourceName(deploy.AppID)
+	selector := map[string]string{"app": appName, labelColor: deploy.Color}
+	if err := s.applyService(ctx, namespace, buildAppService(appName, selector, appServicePorts(stored.Config))); err != nil {
+		return nil, err
+	}
+	if err := s.exposePorts(ctx, namespace, deploy.AppID, stored.Config, selector); err != nil {
+		return nil, err
+	}
+
+	keepIdle := defaultKeepIdle
+	if st := stored.Config.Strategy; st != nil && st.KeepIdleSeconds > 0 {
+		keepIdle = time.Duration(st.KeepIdleSeconds) * time.Second
+	}
+	if err := s.repo.Promote(ctx, deploy, time.Now().Add(keepIdle)); err != nil {
+		return nil, err
+	}
+	s.deletePreviewService(ctx, namespace, appName)
+
+	// cron jobs run whatever the live color runs
+	if spec, err := livePodSpec(ctx, s.client, namespace, deploy.ID); err == nil && len(spec.Containers) > 0 {
+		if err := s.cronService.RebuildCronJobs(ctx, deploy.AppID, *spec); err != nil {
+			log.Printf("deploy %s: rebuild cron jobs: %v", deploy.ID, err)
+		}
+	}
+
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", fmt.Sprintf("%s promoted to live by %s", deploy.Color, user.Email))
+	s.notifyQueue()
+	return s.repo.GetByID(ctx, id)
+}
+
+// DiscardDeployment removes a blue/green release that is READY without it
+// ever having received traffic.
+func (s *deploymentService) DiscardDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error) {
+	deploy, err := s.requireAccess(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if deploy.Color == "" || deploy.Status != "READY" {
+		return nil, fmt.Errorf("%w: only a blue/green release waiting for promotion can be discarded, it is %s", ErrNotPromotable, deploy.Status)
+	}
+
+	namespace, err := namespaceOf(ctx, s.appRepo, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.discardRelease(ctx, namespace, deploy.ID); err != nil {
+		return nil, err
+	}
+	s.deletePreviewService(ctx, namespace, appResourceName(deploy.AppID))
+	if err := s.repo.UpdateStatus(ctx, deploy.ID, "DISCARDED"); err != nil {
+		return nil, err
+	}
+
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", fmt.Sprintf("%s discarded by %s", deploy.Color, user.Email))
+	// the app can take its next release
+	s.notifyQueue()
+	return s.repo.GetByID(ctx, id)
+}
+
+// ProxyPreview forwards a request to the preview Service of a blue/green
+// release through the API server, so the release can be tried before it is
+// promoted without exposing it publicly.
+func (s *deploymentService) ProxyPreview(ctx context.Context, id uuid.UUID, method, path string, query url.Values, body []byte) (int, []byte, error) {
+	deploy, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return 0, nil, err
+	}
+	if deploy.Color == "" || deploy.Status != "READY" {
+		return 0, nil, fmt.Errorf("%w: there is no preview while it is %s", ErrNotPromotable, deploy.Status)
+	}
+
+	namespace, err := namespaceOf(ctx, s.appRepo, deploy.AppID)
+	if err != nil {
+		return 0, nil, err
+	}
+	req := s.client.CoreV1().RESTClient().Verb(method).
+		Namespace(namespace).
+		Resource("services").
+		Name(previewServiceName(appResourceName(deploy.AppID)) + ":" + servicePortName).
+		SubResource("proxy").
+		Suffix(strings.TrimPrefix(path, "/"))
+	for k, vs := range query {
+		for _, v := range vs {
+			req = req.Param(k, v)
+		}
+	}
+	if len(body) > 0 {
+		req = req.Body(body)
+	}
+
+	var status int
+	raw, err := req.Do(ctx).StatusCode(&status).Raw()
+	if status == 0 {
+		// the proxy itself failed, there is no response from the app
+		return 0, nil, fmt.Errorf("proxy to preview: %w", err)
+	}
+	return status, raw, nil
+}
+
+// retireIdle deletes the objects of IDLE releases whose keep-idle time is over.
+func (s *deploymentService) retireIdle(ctx context.Context) {
+	idle, err := s.repo.ListRetirable(ctx, time.Now())
+	if err != nil {
+		log.Printf("deploy queue: list idle releases: %v", err)
+		return
+	}
+	for i := range idle {
+		s.retire(ctx, &idle[i], "keep-idle time is over")
+	}
+}
+
+// retireColor retires an IDLE release of the app that still has color, as a
+// new release is about to take it over.
+func (s *deploymentService) retireColor(ctx context.Context, appID uuid.UUID, color string) error {
+	idle, err := s.repo.ListByStatus(ctx, "IDLE")
+	if err != nil {
+		return err
+	}
+	for i := range idle {
+		if idle[i].AppID == appID && idle[i].Color == color {
+			s.retire(ctx, &idle[i], "a new release took over its color")
+		}
+	}
+	return nil
+}
+
+func (s *deploymentService) retire(ctx context.Context, deploy *models.Deployment, reason string) {
+	namespace, err := namespaceOf(ctx, s.appRepo, deploy.AppID)
+	if err != nil {
+		log.Printf("deploy %s: retire: %v", deploy.ID, err)
+		return
+	}
+	if err := s.discardRelease(ctx, namespace, deploy.ID); err != nil {
+		log.Printf("deploy %s: retire: %v", deploy.ID, err)
+		return
+	}
+	_ = s.repo.UpdateStatus(ctx, deploy.ID, "RETIRED")
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", fmt.Sprintf("%s retired: %s", deploy.Color, reason))
+}
+
+func (s *deploymentService) applyService(ctx context.Context, namespace string, svc *corev1.Service) error {
+	if len(svc.Spec.Ports) == 0 {
+		// an app without HTTP ports has nothing for its Service to route
+		return nil
+	}
+	services := s.client.CoreV1().Services(namespace)
+	live, err := services.Get(ctx, svc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = services.Create(ctx, svc, metav1.CreateOptions{})
+	} else if err == nil {
+		// ClusterIP is immutable, so only the selector, type and ports move;
+		// allocated node ports are kept so clients' addresses stay the same
+		for i := range svc.Spec.Ports {
+			for _, lp := range live.Spec.Ports {
+				if lp.Name == svc.Spec.Ports[i].Name && svc.Spec.Ports[i].NodePort == 0 {
+					svc.Spec.Ports[i].NodePort = lp.NodePort
+				}
+			}
+		}
+		live.Spec.Selector = svc.Spec.Selector
+		live.Spec.Ports = svc.Spec.Ports
+		if svc.Spec.Type != "" {
+			live.Spec.Type = svc.Spec.Type
+		}
+		_, err = services.Update(ctx, live, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply k8s service %s: %w", svc.Name, err)
+	}
+	return nil
+}
+
+func (s *deploymentService) deletePreviewService(ctx context.Context, namespace, appName string) {
+	err := s.client.CoreV1().Services(namespace).Delete(ctx, previewServiceName(appName), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("delete preview service of %s: %v", appName, err)
+	}
+}
+
+func buildAppService(name string, selector map[string]string, ports []corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{labelManagedBy: managedByPlatform, "app": selector["app"]},
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+			Ports:    ports,
+		},
+	}
+}
+
+func previewServiceName(appName string) string {
+	return appName + "-preview"
+}
@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+var ErrNotCanary = errors.New("deployment is not a canary in progress")
+
+// canary traffic steps when the app does not list its own
+var defaultCanarySteps = []int32{10, 50, 100}
+
+const (
+	// container restarts a canary tolerates when the app has no rollback thresholds
+	defaultCanaryMaxRestarts = 3
+	canaryCheckInterval      = 10 * time.Second
+)
+
+// CanaryProgress is where a canary release is in its traffic steps. Step is
+// 1-based and 0 until the canary is ready; Weight is the share of pods, and so
+// of requests, the canary has, which can differ from the step's percentage
+// when the pods cannot split that finely.
+type CanaryProgress struct {
+	Step           int
+	Steps          []int32
+	Weight         int32
+	StableID       uuid.UUID
+	CanaryReplicas int32
+	StableReplicas int32
+}
+
+// canarySteps returns the app's traffic percentages, always ending at 100.
+func canarySteps(st *models.AppStrategy) []int32 {
+	steps := defaultCanarySteps
+	if st != nil && len(st.CanarySteps) > 0 {
+		steps = st.CanarySteps
+	}
+	if steps[len(steps)-1] != 100 {
+		steps = append(append([]int32{}, steps...), 100)
+	}
+	return steps
+}
+
+// canaryReplicas splits pods between the canary and the stable release so
+// the canary gets as close to weight percent of the Service's traffic as the
+// pods allow. The split may grow the app's total pods up to the quota's
+// headroom, which lets apps with a few replicas take finer steps; both keep
+// at least one pod until the canary takes all of it.
+func canaryReplicas(total, weight int32) (canary, stable int32) {
+	if weight >= 100 {
+		return total, 0
+	}
+	bestDiff := math.Inf(1)
+	for n := max(total, 2); n <= max(total*resourceQuotaHeadroom, 2); n++ {
+		c := min(max(int32(math.Round(float64(n)*float64(weight)/100)), 1), n-1)
+		if diff := math.Abs(float64(c)*100/float64(n) - float64(weight)); diff < bestDiff {
+			bestDiff, canary, stable = diff, c, n-c
+		}
+	}
+	return canary, stable
+}
+
+// canaryWeight is the share of the Service's traffic, in percent, the canary
+// gets from its pods.
+func canaryWeight(canary, stable int32) int32 {
+	if canary+stable == 0 {
+		return 0
+	}
+	return int32(math.Round(float64(canary) * 100 / float64(canary+stable)))
+}
+
+// canaryHealth is the thresholds a canary is aborted on: the app's rollback
+// thresholds when it has them, whether or not rollback is enabled.
+func canaryHealth(cfg models.AppConfig) *models.AppRollback {
+	policy := &models.AppRollback{MaxRestarts: defaultCanaryMaxRestarts}
+	if r := cfg.Rollback; r != nil {
+		if r.MaxRestarts > 0 {
+			policy.MaxRestarts = r.MaxRestarts
+		}
+		policy.MaxErrorRate = r.MaxErrorRate
+	}
+	return policy
+}
+
+func appReplicas(cfg models.AppConfig) int32 {
+	if cfg.Replicas != nil && *cfg.Replicas > 0 {
+		return *cfg.Replicas
+	}
+	return 1
+}
+
+// prepareCanary turns a release of a canary app into a canary of the app's
+// RUNNING release: it starts with the first step's pods, behind a Service
+// that selects the pods of both. The first release of an app has nothing to
+// be compared with and rolls out normally.
+func (s *deploymentService) prepareCanary(ctx context.Context, deploy *models.Deployment, app models.Application, stored *models.Application, m *ReleaseManifests) error {
+	stable, err := s.repo.GetLatestByApp(ctx, app.ID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SetCanaryOf(ctx, deploy.ID, stable.ID); err != nil {
+		return err
+	}
+	deploy.CanaryOf = &stable.ID
+
+	// until it is ready the Service sends the canary nothing
+	canary, _ := canaryReplicas(appReplicas(stored.Config), canarySteps(stored.Config.Strategy)[0])
+	m.Deployment.Spec.Replicas = int32Ptr(canary)
+
+	return s.applyService(ctx, appNamespace(&app), buildAppService(app.Name, map[string]string{"app": app.Name}, appServicePorts(stored.Config)))
+}
+
+// startCanary takes a canary whose pods are ready to its first traffic step
+// and starts the controller that advances and checks it.
+func (s *deploymentService) startCanary(ctx context.Context, deploy *models.Deployment, app models.Application) {
+	if err := s.repo.UpdateStatus(ctx, deploy.ID, "CANARY"); err != nil {
+		log.Printf("deploy %s: start canary: %v", deploy.ID, err)
+		return
+	}
+	deploy.Status = "CANARY"
+	if err := s.advanceCanary(ctx, deploy.ID, "canary ready"); err != nil {
+		log.Printf("deploy %s: start canary: %v", deploy.ID, err)
+	}
+	go s.runCanary(context.WithoutCancel(ctx), deploy.ID, app)
+}
+
+// runCanary checks a canary's health every interval, aborting it when a
+// threshold is crossed, and advances it when the app's step time is over.
+// It returns once the canary is promoted or aborted.
+func (s *deploymentService) runCanary(ctx context.Context, deployID uuid.UUID, app models.Application) {
+	since := time.Now()
+	ticker := time.NewTicker(canaryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deploy, err := s.repo.GetByID(ctx, deployID)
+		if err != nil || deploy.Status != "CANARY" {
+			return
+		}
+		stored, err := s.appRepo.GetByID(ctx, app.ID)
+		if err != nil {
+			log.Printf("deploy %s: canary: %v", deployID, err)
+			continue
+		}
+
+		reason, err := s.canaryUnhealthy(ctx, deploy, app, canaryHealth(stored.Config), since)
+		if err != nil {
+			log.Printf("deploy %s: canary health check: %v", deployID, err)
+			continue
+		}
+		if reason != "" {
+			s.abortCanary(ctx, deploy, reason)
+			return
+		}
+
+		st := stored.Config.Strategy
+		if st == nil || st.StepSeconds <= 0 {
+			continue
+		}
+		last, err := s.eventRepo.Latest(ctx, deployID, models.EventCanaryStep)
+		if err != nil {
+			log.Printf("deploy %s: canary: %v", deployID, err)
+			continue
+		}
+		if time.Since(last.CreatedAt) >= time.Duration(st.StepSeconds)*time.Second {
+			if err := s.advanceCanary(ctx, deployID, fmt.Sprintf("after %ds", st.StepSeconds)); err != nil {
+				log.Printf("deploy %s: advance canary: %v", deployID, err)
+			}
+		}
+	}
+}
+
+// canaryUnhealthy is unhealthyReason plus the canary's pods having to stay ready.
+func (s *deploymentService) canaryUnhealthy(ctx context.Context, deploy *models.Deployment, app models.Application, policy *models.AppRollback, since time.Time) (string, error) {
+	pods, err := releasePods(ctx, s.client, appNamespace(&app), deploy.ID)
+	if err != nil {
+		return "", err
+	}
+	ready := 0
+	for i := range pods {
+		if podReady(&pods[i]) {
+			ready++
+		}
+	}
+	if ready == 0 {
+		return "no canary pod is ready", nil
+	}
+	return s.unhealthyReason(ctx, deploy, app, policy, since)
+}
+
+// AdvanceCanary moves a canary to its next traffic step right away.
+func (s *deploymentService) AdvanceCanary(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error) {
+	if _, err := s.requireAccess(ctx, user, id); err != nil {
+		return nil, err
+	}
+	if err := s.advanceCanary(ctx, id, "advanced by "+user.Email); err != nil {
+		return nil, err
+	}
+	return s.repo.GetByID(ctx, id)
+}
+
+// advanceCanary moves a canary to its next step, promoting it when that step
+// is 100%.
+func (s *deploymentService) advanceCanary(ctx context.Context, id uuid.UUID, why string) error {
+	s.canaryMu.Lock()
+	defer s.canaryMu.Unlock()
+
+	deploy, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deploy.Status != "CANARY" || deploy.CanaryOf == nil {
+		return fmt.Errorf("%w: it is %s", ErrNotCanary, deploy.Status)
+	}
+	stored, err := s.appRepo.GetByID(ctx, deploy.AppID)
+	if err != nil {
+		return err
+	}
+	steps := canarySteps(stored.Config.Strategy)
+
+	step := 1
+	if last, err := s.eventRepo.Latest(ctx, id, models.EventCanaryStep); err == nil {
+		step = last.Step + 1
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	if step > len(steps) {
+		step = len(steps)
+	}
+	weight := steps[step-1]
+	if weight >= 100 {
+		return s.promoteCanary(ctx, deploy, stored, why)
+	}
+
+	canary, stable := canaryReplicas(appReplicas(stored.Config), weight)
+	// the stable release only shrinks once the canary has grown
+	namespace := appNamespace(stored)
+	if err := s.scaleRelease(ctx, namespace, deploy.ID, canary); err != nil {
+		return err
+	}
+	if err := s.scaleRelease(ctx, namespace, *deploy.CanaryOf, stable); err != nil {
+		return err
+	}
+
+	// the pods may not split as finely as the step asks, so the real share is recorded
+	actual := canaryWeight(canary, stable)
+	msg := fmt.Sprintf("step %d/%d: %d%% of traffic (%d%% asked, %d canary, %d stable pods), %s", step, len(steps), actual, weight, canary, stable, why)
+	s.recordEvent(ctx, deploy, models.EventCanaryStep, step, actual, msg)
+	return nil
+}
+
+// promoteCanary gives a canary all the app's pods and retires the stable release.
+func (s *deploymentService) promoteCanary(ctx context.Context, deploy *models.Deployment, stored *models.Application, why string) error {
+	namespace := appNamespace(stored)
+	if err := s.scaleRelease(ctx, namespace, deploy.ID, appReplicas(stored.Config)); err != nil {
+		return err
+	}
+	if err := s.repo.UpdateStatus(ctx, deploy.ID, "RUNNING"); err != nil {
+		return err
+	}
+
+	if stable, err := s.repo.GetByID(ctx, *deploy.CanaryOf); err == nil {
+		if err := s.discardRelease(ctx, namespace, stable.ID); err != nil {
+			log.Printf("deploy %s: retire stable release: %v", deploy.ID, err)
+		}
+		_ = s.repo.UpdateStatus(ctx, stable.ID, "RETIRED")
+		s.appendDeployLog(ctx, stable, "deploy", "INFO", fmt.Sprintf("retired: canary %s was promoted", deploy.ID.String()[0:8]))
+	}
+
+	if err := s.exposePorts(ctx, namespace, deploy.AppID, stored.Config, map[string]string{"app": appResourceName(deploy.AppID)}); err != nil {
+		log.Printf("deploy %s: expose ports: %v", deploy.ID, err)
+	}
+
+	// cron jobs follow the app onto the promoted image
+	if spec, err := livePodSpec(ctx, s.client, namespace, deploy.ID); err == nil && len(spec.Containers) > 0 {
+		if err := s.cronService.RebuildCronJobs(ctx, deploy.AppID, *spec); err != nil {
+			log.Printf("deploy %s: rebuild cron jobs: %v", deploy.ID, err)
+		}
+	}
+
+	s.recordEvent(ctx, deploy, models.EventCanaryPromoted, 0, 100, "promoted to 100% of traffic, "+why)
+	s.notifyQueue()
+	return nil
+}
+
+// abortCanary removes a canary and gives the stable release its pods back.
+func (s *deploymentService) abortCanary(ctx context.Context, deploy *models.Deployment, reason string) {
+	if err := s.repo.UpdateStatus(ctx, deploy.ID, "ROLLED_BACK"); err != nil {
+		log.Printf("deploy %s: abort canary: %v", deploy.ID, err)
+		return
+	}
+	namespace := defaultNamespace
+	if stored, err := s.appRepo.GetByID(ctx, deploy.AppID); err == nil {
+		namespace = appNamespace(stored)
+		if err := s.scaleRelease(ctx, namespace, *deploy.CanaryOf, appReplicas(stored.Config)); err != nil {
+			log.Printf("deploy %s: abort canary: restore stable release: %v", deploy.ID, err)
+		}
+	}
+	if err := s.discardRelease(ctx, namespace, deploy.ID); err != nil {
+		log.Printf("deploy %s: abort canary: %v", deploy.ID, err)
+	}
+
+	msg := fmt.Sprintf("canary aborted, all traffic back on %s: %s", deploy.CanaryOf.String()[0:8], reason)
+	s.recordEvent(ctx, deploy, models.EventCanaryAborted, 0, 0, msg)
+	if err := s.repo.SetRollbackReason(ctx, deploy.ID, msg); err != nil {
+		log.Printf("deploy %s: record rollback reason: %v", deploy.ID, err)
+	}
+	s.notifyRollback(ctx, deploy, fmt.Sprintf("release %s was rolled back: %s", deploy.ID.String()[0:8], msg))
+	s.notifyQueue()
+}
+
+func (s *deploymentService) scaleRelease(ctx context.Context, namespace string, deployID uuid.UUID, replicas int32) error {
+	return scaleDeployment(ctx, s.client, namespace, deployID, replicas)
+}
+
+func scaleDeployment(ctx context.Context, client *kubernetes.Clientset, namespace string, deployID uuid.UUID, replicas int32) error {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	_, err := client.AppsV1().Deployments(namespace).Patch(ctx, deploymentResourceName(deployID), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("scale k8s deployment %s: %w", deploymentResourceName(deployID), err)
+	}
+	return nil
+}
+
+// recordEvent stores a step of the deployment's progress and logs it.
+func (s *deploymentService) recordEvent(ctx context.Context, deploy *models.Deployment, typ string, step int, weight int32, msg string) {
+	err := s.eventRepo.Create(ctx, &models.DeploymentEvent{
+		DeploymentID: deploy.ID,
+		Type:         typ,
+		Step:         step,
+		Weight:       weight,
+		Message:      msg,
+	})
+	if err != nil {
+		log.Printf("deploy %s: record event: %v", deploy.ID, err)
+	}
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", msg)
+}
+
+// canaryProgress reads where a canary deployment is from its events.
+func (s *deploymentService) canaryProgress(ctx context.Context, deploy *models.Deployment, events []models.DeploymentEvent) (*CanaryProgress, error) {
+	stored, err := s.appRepo.GetByID(ctx, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+	p := &CanaryProgress{Steps: canarySteps(stored.Config.Strategy), StableID: *deploy.CanaryOf}
+	for _, e := range events {
+		switch e.Type {
+		case models.EventCanaryStep:
+			p.Step, p.Weight = e.Step, e.Weight
+		case models.EventCanaryPromoted:
+			p.Step, p.Weight = len(p.Steps), 100
+		case models.EventCanaryAborted:
+			p.Weight = 0
+		}
+	}
+	if deploy.Status == "CANARY" && p.Step > 0 {
+		p.CanaryReplicas, p.StableReplicas = canaryReplicas(appReplicas(stored.Config), p.Steps[p.Step-1])
+	}
+	return p, nil
+}
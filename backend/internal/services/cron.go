@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+var ErrInvalidCronJob = errors.New("invalid cron job")
+
+const (
+	labelCronID         = "cron-id"
+	annotationCollected = "mini-paas/collected"
+)
+
+type cronService struct {
+	repo       repository.CronJobRepository
+	appRepo    repository.AppRepository
+	deployRepo repository.DeploymentRepository
+	logRepo    repository.LogRepository
+	client     *kubernetes.Clientset
+}
+
+func NewCronService(
+	repo repository.CronJobRepository,
+	appRepo repository.AppRepository,
+	deployRepo repository.DeploymentRepository,
+	logRepo repository.LogRepository,
+	client *kubernetes.Clientset,
+) CronService {
+	return &cronService{
+		repo:       repo,
+		appRepo:    appRepo,
+		deployRepo: deployRepo,
+		logRepo:    logRepo,
+		client:     client,
+	}
+}
+
+func (s *cronService) CreateCronJob(ctx context.Context, cron *models.CronJob) (*models.CronJob, error) {
+	if _, err := s.appRepo.GetByID(ctx, cron.AppID); err != nil {
+		return nil, err
+	}
+	if err := validateCronJob(cron); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Create(ctx, cron); err != nil {
+		return nil, err
+	}
+	if err := s.applyForCurrentRelease(ctx, cron); err != nil {
+		return nil, err
+	}
+	return cron, nil
+}
+
+func (s *cronService) UpdateCronJob(ctx context.Context, cron *models.CronJob) (*models.CronJob, error) {
+	existing, err := s.repo.GetByID(ctx, cron.ID)
+	if err != nil {
+		return nil, err
+	}
+	if existing.AppID != cron.AppID {
+		return nil, repository.ErrNotFound
+	}
+	if err := validateCronJob(cron); err != nil {
+		return nil, err
+	}
+	if err := s.repo.Update(ctx, cron); err != nil {
+		return nil, err
+	}
+	if err := s.applyForCurrentRelease(ctx, cron); err != nil {
+		return nil, err
+	}
+	return cron, nil
+}
+
+func (s *cronService) DeleteCronJob(ctx context.Context, appID, id uuid.UUID) error {
+	cron, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if cron.AppID != appID {
+		return repository.ErrNotFound
+	}
+
+	namespace, err := namespaceOf(ctx, s.appRepo, appID)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = s.client.BatchV1beta1().CronJobs(namespace).Delete(ctx, cronResourceName(cron.ID), metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete k8s cronjob: %w", err)
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+func (s *cronService) ListCronJobs(ctx context.Context, appID uuid.UUID) ([]models.CronJob, error) {
+	return s.repo.ListByApp(ctx, appID)
+}
+
+// RebuildCronJobs re-applies every cron job of an app so it runs with the
+// image, config vars and pull secrets of the release whose pod spec is given.
+func (s *cronService) RebuildCronJobs(ctx context.Context, appID uuid.UUID, spec corev1.PodSpec) error {
+	crons, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return err
+	}
+	for i := range crons {
+		if err := s.applyCronJob(ctx, &crons[i], spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteAppCronJobs removes every cron job of an app, from k8s and the
+// database, so no run is left whose app is gone.
+func (s *cronService) DeleteAppCronJobs(ctx context.Context, appID uuid.UUID) error {
+	crons, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return err
+	}
+	for _, cron := range crons {
+		if err := s.DeleteCronJob(ctx, appID, cron.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WatchRuns periodically copies the output of finished cron job runs into the logs table.
+func (s *cronService) WatchRuns(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.collectRuns(ctx); err != nil {
+				log.Printf("cron: collect runs: %v", err)
+			}
+		}
+	}
+}
+
+func (s *cronService) collectRuns(ctx context.Context) error {
+	jobs, err := s.client.BatchV1().Jobs(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s,%s", labelManagedBy, managedByPlatform, labelCronID),
+	})
+	if err != nil {
+		return fmt.Errorf("list jobs: %w", err)
+	}
+
+	for i := range jobs.Items {
+		job := &jobs.Items[i]
+		if job.Annotations[annotationCollected] == "true" {
+			continue
+		}
+		done, succeeded := jobFinished(job)
+		if !done {
+			continue
+		}
+		if err := s.collectRun(ctx, job, succeeded); err != nil {
+			log.Printf("cron: collect job %s: %v", job.Name, err)
+			continue
+		}
+
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, annotationCollected)
+		if _, err := s.client.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			log.Printf("cron: mark job %s collected: %v", job.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *cronService) collectRun(ctx context.Context, job *batchv1.Job, succeeded bool) error {
+	appID, err := uuid.Parse(job.Labels[labelAppID])
+	if err != nil {
+		return fmt.Errorf("invalid %s label: %w", labelAppID, err)
+	}
+	cronID, err := uuid.Parse(job.Labels[labelCronID])
+	if err != nil {
+		return fmt.Errorf("invalid %s label: %w", labelCronID, err)
+	}
+
+	// logs are keyed by deployment, so runs are attached to the release they
+	// ran with: the live one, never a queued or failed deploy
+	deploy, err := s.deployRepo.GetLatestByApp(ctx, appID, "RUNNING", "DEPLOYING")
+	if errors.Is(err, repository.ErrNotFound) {
+		if _, appErr := s.appRepo.GetByID(ctx, appID); errors.Is(appErr, repository.ErrNotFound) {
+			// the app was deleted after the run started, there is nothing to keep its output for
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	source := "cron"
+	if cron, err := s.repo.GetByID(ctx, cronID); err == nil {
+		source = "cron:" + cron.Name
+	}
+
+	lines, err := readJobLogs(ctx, s.client, job.Namespace, job.Name)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := s.logRepo.Append(ctx, &models.Log{
+			DeploymentID: deploy.ID,
+			Message:      line,
+			Level:        "INFO",
+			Source:       source,
+		}); err != nil {
+			return err
+		}
+	}
+
+	level, result := "INFO", "succeeded"
+	if !succeeded {
+		level, result = "ERROR", "failed"
+	}
+	return s.logRepo.Append(ctx, &models.Log{
+		DeploymentID: deploy.ID,
+		Message:      fmt.Sprintf("cron run %s %s", job.Name, result),
+		Level:        level,
+		Source:       source,
+	})
+}
+
+// applyForCurrentRelease syncs the cron job to k8s when the app already has
+// a live release to run; one still deploying rebuilds the cron jobs once it
+// is RUNNING.
+func (s *cronService) applyForCurrentRelease(ctx context.Context, cron *models.CronJob) error {
+	deploy, err := s.deployRepo.GetLatestByApp(ctx, cron.AppID, "RUNNING")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if deploy.ImageURL == "" {
+		return nil
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, cron.AppID)
+	if err != nil {
+		return err
+	}
+	// the job runs with the config the app's pods have
+	spec, err := livePodSpec(ctx, s.client, namespace, deploy.ID)
+	if err != nil {
+		return fmt.Errorf("get the pod spec of the live release: %w", err)
+	}
+	if len(spec.Containers) == 0 {
+		return fmt.Errorf("the live release %s has no container", deploy.ID)
+	}
+	return s.applyCronJob(ctx, cron, *spec)
+}
+
+func (s *cronService) applyCronJob(ctx context.Context, cron *models.CronJob, spec corev1.PodSpec) error {
+	namespace, err := namespaceOf(ctx, s.appRepo, cron.AppID)
+	if err != nil {
+		return err
+	}
+	desired := buildCronJob(cron, spec)
+	cronClient := s.client.BatchV1beta1().CronJobs(namespace)
+
+	existing, err := cronClient.Get(ctx, desired.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := cronClient.Create(ctx, desired, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create k8s cronjob: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get k8s cronjob: %w", err)
+	}
+
+	existing.Labels = desired.Labels
+	existing.Spec = desired.Spec
+	if _, err := cronClient.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update k8s cronjob: %w", err)
+	}
+	return nil
+}
+
+// buildCronJob runs the cron job's command with the image and environment of
+// the app container in spec, the pod spec of the app's live release.
+func buildCronJob(cron *models.CronJob, spec corev1.PodSpec) *batchv1beta1.CronJob {
+	labels := map[string]string{
+		labelManagedBy: managedByPlatform,
+		labelAppID:     cron.AppID.String(),
+		labelCronID:    cron.ID.String(),
+	}
+	suspend := cron.Suspend
+	successLimit := cron.SuccessfulJobsHistoryLimit
+	failedLimit := cron.FailedJobsHistoryLimit
+	app := spec.Containers[0]
+
+	return &batchv1beta1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   cronResourceName(cron.ID),
+			Labels: labels,
+		},
+		Spec: batchv1beta1.CronJobSpec{
+			Schedule:                   cron.Schedule,
+			ConcurrencyPolicy:          batchv1beta1.ConcurrencyPolicy(cron.ConcurrencyPolicy),
+			Suspend:                    &suspend,
+			SuccessfulJobsHistoryLimit: &successLimit,
+			FailedJobsHistoryLimit:     &failedLimit,
+			JobTemplate: batchv1beta1.JobTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: batchv1.JobSpec{
+					BackoffLimit: int32Ptr(0),
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{Labels: labels},
+						Spec: corev1.PodSpec{
+							RestartPolicy:    corev1.RestartPolicyNever,
+							ImagePullSecrets: spec.ImagePullSecrets,
+							Containers: []corev1.Container{
+								{
+									Name:    "cron",
+									Image:   app.Image,
+									Command: []string{"sh", "-c", cron.Command},
+									Env:     app.Env,
+									EnvFrom: app.EnvFrom,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func validateCronJob(cron *models.CronJob) error {
+	if cron.Name == "" || cron.Command == "" {
+		return fmt.Errorf("%w: name and command are required", ErrInvalidCronJob)
+	}
+	if fields := strings.Fields(cron.Schedule); len(fields) != 5 && !strings.HasPrefix(cron.Schedule, "@") {
+		return fmt.Errorf("%w: schedule %q", ErrInvalidCronJob, cron.Schedule)
+	}
+
+	switch batchv1beta1.ConcurrencyPolicy(cron.ConcurrencyPolicy) {
+	case "":
+		cron.ConcurrencyPolicy = string(batchv1beta1.ForbidConcurrent)
+	case batchv1beta1.AllowConcurrent, batchv1beta1.ForbidConcurrent, batchv1beta1.ReplaceConcurrent:
+	default:
+		return fmt.Errorf("%w: concurrency policy %q", ErrInvalidCronJob, cron.ConcurrencyPolicy)
+	}
+
+	if cron.SuccessfulJobsHistoryLimit < 0 || cron.FailedJobsHistoryLimit < 0 {
+		return fmt.Errorf("%w: history limits must not be negative", ErrInvalidCronJob)
+	}
+	return nil
+}
+
+func cronResourceName(id uuid.UUID) string {
+	return fmt.Sprintf("cron-%s", id.String()[0:8])
+}
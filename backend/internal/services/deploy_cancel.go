@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrDeploymentNotCancellable = errors.New("deployment cannot be cancelled")
+	ErrDeploymentForbidden      = errors.New("you cannot manage the deployments of this app")
+)
+
+// CancelDeployment cancels a deployment on behalf of user. A queued deployment
+// is simply taken out of the queue. One in progress has its background work
+// stopped and its k8s objects removed; earlier releases are never touched by a
+// rollout, so the previously running one keeps serving.
+func (s *deploymentService) CancelDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error) {
+	deploy, err := s.requireAccess(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+	cancelled, err := s.repo.Cancel(ctx, id, user.ID, "QUEUED")
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		// not queued, or claimed by the queue since
+		cancelled, err = s.repo.Cancel(ctx, id, user.ID, repository.ActiveDeploymentStatuses...)
+		if err != nil {
+			return nil, err
+		}
+		if !cancelled {
+			deploy, err := s.repo.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: it is %s", ErrDeploymentNotCancellable, deploy.Status)
+		}
+
+		s.finish(id)
+		if err := s.discardRelease(ctx, namespace, id); err != nil {
+			return nil, err
+		}
+	}
+
+	deploy, err = s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", fmt.Sprintf("deployment cancelled by %s", user.Email))
+	return deploy, nil
+}
+
+// discardRelease deletes the k8s Deployment and release Job of a deployment,
+// whichever of them were created.
+func (s *deploymentService) discardRelease(ctx context.Context, namespace string, deployID uuid.UUID) error {
+	return deleteReleaseObjects(ctx, s.client, namespace, deployID)
+}
+
+func deleteReleaseObjects(ctx context.Context, client *kubernetes.Clientset, namespace string, deployID uuid.UUID) error {
+	propagation := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	err := client.AppsV1().Deployments(namespace).Delete(ctx, deploymentResourceName(deployID), opts)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete k8s deployment: %w", err)
+	}
+	err = client.BatchV1().Jobs(namespace).Delete(ctx, releaseJobName(deployID), opts)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete release job: %w", err)
+	}
+	return nil
+}
+
+// requireAccess returns the deployment, or ErrDeploymentForbidden unless user
+// may manage its app.
+func (s *deploymentService) requireAccess(ctx context.Context, user *models.User, id uuid.UUID) (*models.Deployment, error) {
+	deploy, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	app, err := s.appRepo.GetByID(ctx, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDeploymentForbidden, app.Name)
+	}
+	return deploy, nil
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// rollouts running at once across all apps, overridable with DEPLOY_CONCURRENCY
+	defaultDeployConcurrency = 4
+
+	rolloutTimeout = 10 * time.Minute
+)
+
+// DeploymentStatus is the state of a deployment; QueuePosition is only set
+// while it waits in the queue, Canary only for a canary release.
+type DeploymentStatus struct {
+	Status        string
+	QueuePosition int
+	Canary        *CanaryProgress
+	Events        []models.DeploymentEvent
+}
+
+func deployConcurrencyFromEnv() int {
+	v := os.Getenv("DEPLOY_CONCURRENCY")
+	if v == "" {
+		return defaultDeployConcurrency
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Printf("deploy queue: ignoring invalid DEPLOY_CONCURRENCY %q", v)
+		return defaultDeployConcurrency
+	}
+	return n
+}
+
+// ProcessQueue starts queued deployments as rollout slots free up. It checks
+// every interval and whenever a deployment is queued or finishes.
+func (s *deploymentService) ProcessQueue(ctx context.Context, interval time.Duration) {
+	s.recoverInterrupted(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		claimed, err := s.repo.ClaimQueued(ctx, s.concurrency)
+		if err != nil {
+			log.Printf("deploy queue: claim: %v", err)
+		}
+		for i := range claimed {
+			go s.start(s.begin(ctx, claimed[i].ID), &claimed[i])
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retireIdle(ctx)
+		case <-s.wake:
+		}
+	}
+}
+
+// notifyQueue wakes ProcessQueue without waiting for its next tick.
+func (s *deploymentService) notifyQueue() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// begin returns the context of a deployment's background work, which
+// CancelDeployment cancels.
+func (s *deploymentService) begin(ctx context.Context, deployID uuid.UUID) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	s.mu.Lock()
+	s.inFlight[deployID] = cancel
+	s.mu.Unlock()
+	return ctx
+}
+
+// finish ends a deployment's background work and hands its rollout slot to
+// the next queued deployment. It is safe to call more than once.
+func (s *deploymentService) finish(deployID uuid.UUID) {
+	s.mu.Lock()
+	cancel, ok := s.inFlight[deployID]
+	delete(s.inFlight, deployID)
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	s.notifyQueue()
+}
+
+// start renders a deployment claimed from the queue and rolls it out.
+func (s *deploymentService) start(ctx context.Context, deploy *models.Deployment) {
+	if err := s.startRelease(ctx, deploy, s.releaseApp(ctx, deploy)); err != nil {
+		if ctx.Err() == nil {
+			_ = s.repo.UpdateStatus(ctx, deploy.ID, "FAILED")
+			s.appendDeployLog(ctx, deploy, "deploy", "ERROR", err.Error())
+		}
+		s.finish(deploy.ID)
+	}
+}
+
+func (s *deploymentService) startRelease(ctx context.Context, deploy *models.Deployment, app models.Application) error {
+	stored, err := s.appRepo.GetByID(ctx, app.ID)
+	if err != nil {
+		return err
+	}
+	// a release runs the config it snapshotted, however the app changed since
+	if deploy.ReleaseID != nil {
+		release, err := s.releases.GetReleaseByID(ctx, *deploy.ReleaseID)
+		if err != nil {
+			return err
+		}
+		stored.Config = release.Config
+		stored.ReleaseCommand = release.ReleaseCommand
+	}
+
+	// resolving the digest again finds the credential the pull secret is made from
+	image, err := s.registry.ResolveImage(ctx, stored, deploy.PinnedImage())
+	if err != nil {
+		return err
+	}
+
+	// the first release of an app in a namespace of its own creates it
+	namespace := appNamespace(&app)
+	if err := ensureNamespace(ctx, s.client, namespace); err != nil {
+		return err
+	}
+
+	m, err := s.renderRelease(ctx, deploy, app, stored, image)
+	if err != nil {
+		return err
+	}
+	if deploy.Color != "" {
+		if err := s.repo.SetColor(ctx, deploy.ID, deploy.Color); err != nil {
+			return err
+		}
+		// the color may still be held by the release replaced last time
+		if err := s.retireColor(ctx, app.ID, deploy.Color); err != nil {
+			return err
+		}
+	}
+	if stored.Config.IsCanary() {
+		if err := s.prepareCanary(ctx, deploy, app, stored, m); err != nil {
+			return err
+		}
+	}
+	if err := s.registry.SyncPullSecret(ctx, namespace, image); err != nil {
+		return err
+	}
+	// the ports the app is reached on may have changed
+	if err := applyAppNetworkPolicy(ctx, s.client, s.linkRepo, namespace, app.ID, stored.Config); err != nil {
+		return err
+	}
+	// the pods run with the PriorityClass of their user or team's quota
+	if err := s.quotas.SyncResourceQuota(ctx, stored); err != nil {
+		return err
+	}
+
+	// the release phase can take minutes, so it and the rollout continue in the background
+	if m.ReleaseJob != nil {
+		if err := s.repo.UpdateStatus(ctx, deploy.ID, "RELEASING"); err != nil {
+			return err
+		}
+		deploy.Status = "RELEASING"
+		go s.releaseAndRollout(ctx, deploy, app, stored.ReleaseCommand, m)
+		return nil
+	}
+
+	return s.rollout(ctx, deploy, app, m)
+}
+
+// recoverInterrupted deals with deployments that were active when the server
+// last stopped: rollouts are tracked and canaries checked again, anything
+// earlier is failed so the app's queue is not blocked forever.
+func (s *deploymentService) recoverInterrupted(ctx context.Context) {
+	canaries, err := s.repo.ListByStatus(ctx, "CANARY")
+	if err != nil {
+		log.Printf("deploy queue: list canaries: %v", err)
+	}
+	for i := range canaries {
+		go s.runCanary(ctx, canaries[i].ID, s.releaseApp(ctx, &canaries[i]))
+	}
+
+	active, err := s.repo.ListByStatus(ctx, repository.ActiveDeploymentStatuses...)
+	if err != nil {
+		log.Printf("deploy queue: list active deployments: %v", err)
+		return
+	}
+	for i := range active {
+		deploy := &active[i]
+		if deploy.Status == "DEPLOYING" {
+			go s.trackDeployment(s.begin(ctx, deploy.ID), deploy.ID, s.releaseApp(ctx, deploy))
+			continue
+		}
+		_ = s.repo.UpdateStatus(ctx, deploy.ID, "FAILED")
+		s.appendDeployLog(ctx, deploy, "deploy", "ERROR", fmt.Sprintf("deployment interrupted while %s by a server restart", deploy.Status))
+	}
+}
+
+// releaseApp is the app as the rollout of deploy sees it: named after its
+// objects, which live in the app's namespace.
+func (s *deploymentService) releaseApp(ctx context.Context, deploy *models.Deployment) models.Application {
+	app := models.Application{
+		ID:       deploy.AppID,
+		Name:     appResourceName(deploy.AppID),
+		ImageURL: deploy.ImageURL,
+	}
+	if stored, err := s.appRepo.GetByID(ctx, deploy.AppID); err == nil {
+		app.Namespace = stored.Namespace
+	}
+	return app
+}
+
+// appResourceName is the "app" label shared by every release of an app.
+func appResourceName(appID uuid.UUID) string {
+	return fmt.Sprintf("app-%s", appID.String()[0:8])
+}
@@ -4,15 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"mini-paas/backend/internal/models"
 	"mini-paas/backend/internal/repository"
 
 	"github.com/google/uuid"
-	appsv1 "k8s.io/api/apps/v1"
-	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
@@ -20,16 +21,78 @@ import (
 )
 
 type deploymentService struct {
-	repo   repository.DeploymentRepository
-	client *kubernetes.Clientset
+	repo        repository.DeploymentRepository
+	eventRepo   repository.DeploymentEventRepository
+	portRepo    repository.PortEndpointRepository
+	appRepo     repository.AppRepository
+	logRepo     repository.LogRepository
+	volumeRepo  repository.VolumeRepository
+	addOnRepo   repository.AddOnRepository
+	linkRepo    repository.AppLinkRepository
+	envRepo     repository.EnvironmentRepository
+	cronService CronService
+	registry    RegistryService
+	quotas      QuotaService
+	releases    ReleaseService
+	teamService TeamService
+	notifier    Notifier
+	errorRates  ErrorRateSource
+	client      *kubernetes.Clientset
+	concurrency int
+	wake        chan struct{}
+
+	// cancel funcs of the background work of deployments in progress
+	mu       sync.Mutex
+	inFlight map[uuid.UUID]context.CancelFunc
+
+	// serializes canary steps taken by the timer and through the API
+	canaryMu sync.Mutex
 }
 
-func NewDeploymentService(repo repository.DeploymentRepository) DeploymentService {
+func NewDeploymentService(
+	repo repository.DeploymentRepository,
+	eventRepo repository.DeploymentEventRepository,
+	portRepo repository.PortEndpointRepository,
+	appRepo repository.AppRepository,
+	logRepo repository.LogRepository,
+	volumeRepo repository.VolumeRepository,
+	addOnRepo repository.AddOnRepository,
+	linkRepo repository.AppLinkRepository,
+	envRepo repository.EnvironmentRepository,
+	cronService CronService,
+	registryService RegistryService,
+	quotaService QuotaService,
+	releaseService ReleaseService,
+	teamService TeamService,
+	notifier Notifier,
+	errorRates ErrorRateSource,
+) DeploymentService {
 	client, err := getK8SClient()
 	if err != nil {
 		return nil
 	}
-	return &deploymentService{repo: repo, client: client}
+	return &deploymentService{
+		repo:        repo,
+		eventRepo:   eventRepo,
+		portRepo:    portRepo,
+		appRepo:     appRepo,
+		logRepo:     logRepo,
+		volumeRepo:  volumeRepo,
+		addOnRepo:   addOnRepo,
+		linkRepo:    linkRepo,
+		envRepo:     envRepo,
+		cronService: cronService,
+		registry:    registryService,
+		quotas:      quotaService,
+		releases:    releaseService,
+		teamService: teamService,
+		notifier:    notifier,
+		errorRates:  errorRates,
+		client:      client,
+		concurrency: deployConcurrencyFromEnv(),
+		wake:        make(chan struct{}, 1),
+		inFlight:    make(map[uuid.UUID]context.CancelFunc),
+	}
 }
 
 func (s *deploymentService) CreateDeployment(ctx context.Context, dep *models.Deployment) (*models.Deployment, error) {
@@ -42,12 +105,37 @@ func (s *deploymentService) CreateDeployment(ctx context.Context, dep *models.De
 	return dep, nil
 }
 
-func (s *deploymentService) GetDeploymentStatus(ctx context.Context, id uuid.UUID) (string, error) {
+// appHistoryLimit is how many of an app's most recent events its history shows.
+const appHistoryLimit = 100
+
+// ListAppHistory returns the events of all the app's releases, newest first.
+func (s *deploymentService) ListAppHistory(ctx context.Context, appID uuid.UUID) ([]models.DeploymentEvent, error) {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return nil, err
+	}
+	return s.eventRepo.ListByApp(ctx, appID, appHistoryLimit)
+}
+
+func (s *deploymentService) GetDeploymentStatus(ctx context.Context, id uuid.UUID) (*DeploymentStatus, error) {
 	deploy, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	status := &DeploymentStatus{Status: deploy.Status}
+	if deploy.Status == "QUEUED" {
+		if status.QueuePosition, err = s.repo.QueuePosition(ctx, deploy); err != nil {
+			return nil, err
+		}
+	}
+	if status.Events, err = s.eventRepo.ListByDeployment(ctx, deploy.ID); err != nil {
+		return nil, err
+	}
+	if deploy.CanaryOf != nil {
+		if status.Canary, err = s.canaryProgress(ctx, deploy, status.Events); err != nil {
+			return nil, err
+		}
 	}
-	return deploy.Status, nil
+	return status, nil
 }
 
 func (s *deploymentService) GetDeploymentByID(ctx context.Context, id uuid.UUID) (*models.Deployment, error) {
@@ -68,92 +156,251 @@ func getK8SClient() (*kubernetes.Clientset, error) {
 }
 
 func (s *deploymentService) DeployApp(ctx context.Context, app models.Application) (*models.Deployment, error) {
-	// 1. save deployment record
+	stored, err := s.appRepo.GetByID(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckApp(ctx, stored); err != nil {
+		return nil, err
+	}
+
+	// a missing image or bad credential fails the request before anything is recorded
+	image, err := s.registry.ResolveImage(ctx, stored, app.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	envID, err := s.environmentOf(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	release, err := s.releases.Record(ctx, stored, app.ImageURL, image.Digest, ReleaseDeploy)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. queue the deployment record; ProcessQueue rolls it out once the app
+	// has no other rollout in progress and a global slot is free.
+	// the tag is kept for display, the release runs the digest it points to now
+	deploy := &models.Deployment{
+		ID:            uuid.New(),
+		AppID:         app.ID,
+		ImageURL:      app.ImageURL,
+		ImageDigest:   image.Digest,
+		EnvironmentID: envID,
+		ReleaseID:     &release.ID,
+	}
+	if err := s.repo.Enqueue(ctx, deploy); err != nil {
+		return nil, err
+	}
+	s.notifyQueue()
+	return deploy, nil
+}
+
+// DeployRelease queues the image of release on app, pinned to the digest
+// the release ran, so the app gets exactly what was running there. The app
+// keeps its own config, so this records a release of its own.
+func (s *deploymentService) DeployRelease(ctx context.Context, app models.Application, release *models.Deployment) (*models.Deployment, error) {
+	stored, err := s.appRepo.GetByID(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.CheckApp(ctx, stored); err != nil {
+		return nil, err
+	}
+	envID, err := s.environmentOf(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := s.releases.Record(ctx, stored, release.ImageURL, release.ImageDigest, ReleasePromotion)
+	if err != nil {
+		return nil, err
+	}
+
 	deploy := &models.Deployment{
-		ID:     uuid.New(),
-		AppID:  app.ID,
-		Status: "PENDING",
+		ID:            uuid.New(),
+		AppID:         app.ID,
+		ImageURL:      release.ImageURL,
+		ImageDigest:   release.ImageDigest,
+		EnvironmentID: envID,
+		PromotedFrom:  &release.ID,
+		ReleaseID:     &snapshot.ID,
+	}
+	if err := s.repo.Enqueue(ctx, deploy); err != nil {
+		return nil, err
+	}
+	s.notifyQueue()
+	return deploy, nil
+}
+
+// environmentOf returns the id of the environment the app runs, or nil for
+// an app that is not one.
+func (s *deploymentService) environmentOf(ctx context.Context, appID uuid.UUID) (*uuid.UUID, error) {
+	env, err := s.envRepo.GetByEnvApp(ctx, appID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
 	}
-	if err := s.repo.Create(ctx, deploy); err != nil {
+	if err != nil {
 		return nil, err
 	}
+	return &env.ID, nil
+}
 
+// rollout creates the k8s objects of a release and starts tracking it.
+func (s *deploymentService) rollout(ctx context.Context, deploy *models.Deployment, app models.Application, m *ReleaseManifests) error {
 	// 2. create resrouce in K8S
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name: fmt.Sprintf("app-%s", deploy.ID.String()[0:8]),
-			Labels: map[string]string{
-				"app": app.Name,
-			},
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: int32Ptr(1),
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{"app": app.Name},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{"app": app.Name},
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  app.Name,
-							Image: app.ImageURL,
-							Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	_, err := s.client.AppsV1().Deployments("default").Create(ctx, deployment, metav1.CreateOptions{})
+	namespace := appNamespace(&app)
+	_, err := s.client.AppsV1().Deployments(namespace).Create(ctx, m.Deployment, metav1.CreateOptions{})
 	if err != nil {
 		_ = s.repo.UpdateStatus(ctx, deploy.ID, "FAILED")
-		return nil, fmt.Errorf("failed to create k8s deployment: %w", err)
+		return fmt.Errorf("failed to create k8s deployment: %w", err)
+	}
+	if ctx.Err() != nil {
+		// cancelled while the create was in flight, so the cancel found nothing to remove
+		return s.discardRelease(context.WithoutCancel(ctx), namespace, deploy.ID)
+	}
+	if m.PreviewService != nil {
+		if err := s.applyService(ctx, namespace, m.PreviewService); err != nil {
+			_ = s.repo.UpdateStatus(ctx, deploy.ID, "FAILED")
+			return err
+		}
 	}
 
 	// 3. update status = DEPLOYING
 	if err := s.repo.UpdateStatus(ctx, deploy.ID, "DEPLOYING"); err != nil {
-		return nil, err
+		return err
 	}
+	deploy.Status = "DEPLOYING"
 
-	// 4. Start background goroutine to track status
-	go s.trackDeployment(ctx, deploy.ID, app.Name)
+	// 4. Start background goroutine to track status; cancelling the deployment stops it
+	go s.trackDeployment(ctx, deploy.ID, app)
 
-	return deploy, nil
+	return nil
 }
 
-func (s *deploymentService) trackDeployment(ctx context.Context, deployID uuid.UUID, appName string) {
+func (s *deploymentService) trackDeployment(ctx context.Context, deployID uuid.UUID, app models.Application) {
+	// whatever the outcome, the app's rollout slot is free again
+	defer s.finish(deployID)
+
+	// apps with a rollback policy get their own deadline
+	var policy *models.AppRollback
+	timeout := rolloutTimeout
+	if stored, err := s.appRepo.GetByID(ctx, app.ID); err == nil {
+		if policy = rollbackPolicy(stored.Config); policy != nil {
+			timeout = healthyWithin(policy)
+		}
+	}
+	deploy, err := s.repo.GetByID(ctx, deployID)
+	if err != nil {
+		log.Printf("deploy %s: track: %v", deployID, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		// check pods status
-		pods, err := s.client.CoreV1().Pods("default").List(ctx, metav1.ListOptions{
-			LabelSelector: fmt.Sprintf("app=%s", appName),
-		})
+	for {
+		select {
+		case <-ctx.Done():
+			if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return
+			}
+			// the status update outlives the expired tracking context
+			ctx := context.WithoutCancel(ctx)
+			if policy != nil {
+				s.rollback(ctx, deployID, app, fmt.Sprintf("not ready within %s", timeout))
+				return
+			}
+			_ = s.repo.UpdateStatus(ctx, deployID, "FAILED")
+			log.Printf("deploy %s: not ready within %s", deployID, timeout)
+			return
+		case <-ticker.C:
+		}
+
+		// check the pods of this release only; the previous release keeps serving meanwhile
+		pods, err := releasePods(ctx, s.client, appNamespace(&app), deployID)
 		if err != nil {
 			_ = s.repo.UpdateStatus(ctx, deployID, "FAILED")
 			return
 		}
 
 		ready := true
-		for _, pod := range pods.Items {
-			if pod.Status.Phase != corev1.PodRunning {
+		for i := range pods {
+			if !podReady(&pods[i]) {
 				ready = false
 				break
 			}
 		}
 
-		if len(pods.Items) > 0 && ready {
+		if len(pods) > 0 && ready && deploy.Color != "" {
+			// blue/green: the Service keeps pointing at the live color until promotion
+			_ = s.repo.UpdateStatus(ctx, deployID, "READY")
+			return
+		}
+		if len(pods) > 0 && ready && deploy.CanaryOf != nil {
+			// canary: traffic moves over in steps, the new release is RUNNING once it has all of it
+			s.startCanary(ctx, deploy, app)
+			return
+		}
+		if len(pods) > 0 && ready {
 			_ = s.repo.UpdateStatus(ctx, deployID, "RUNNING")
+			s.supersedeReleases(ctx, deploy, app)
+
+			// cron jobs follow the app onto the new release's image and config
+			if spec, err := livePodSpec(ctx, s.client, appNamespace(&app), deployID); err == nil && len(spec.Containers) > 0 {
+				if err := s.cronService.RebuildCronJobs(ctx, app.ID, *spec); err != nil {
+					log.Printf("deploy %s: rebuild cron jobs: %v", deployID, err)
+				}
+			}
+			if stored, err := s.appRepo.GetByID(ctx, app.ID); err == nil {
+				if err := s.exposePorts(ctx, appNamespace(&app), app.ID, stored.Config, map[string]string{"app": app.Name}); err != nil {
+					log.Printf("deploy %s: expose ports: %v", deployID, err)
+				}
+			}
+
+			if policy != nil {
+				go s.watchRelease(context.WithoutCancel(ctx), deployID, app, policy)
+			}
 			return
 		}
 	}
 }
 
+// supersedeReleases scales the app's other RUNNING releases to zero now
+// that deploy serves it, so their pods no longer match the app's Service.
+// Their objects stay for a rollback to scale back up until garbage
+// collection retires them.
+func (s *deploymentService) supersedeReleases(ctx context.Context, deploy *models.Deployment, app models.Application) {
+	running, err := s.repo.ListByApp(ctx, app.ID, "RUNNING")
+	if err != nil {
+		log.Printf("deploy %s: supersede releases: %v", deploy.ID, err)
+		return
+	}
+	for i := range running {
+		old := &running[i]
+		if old.ID == deploy.ID {
+			continue
+		}
+		if err := s.scaleRelease(ctx, appNamespace(&app), old.ID, 0); err != nil && !apierrors.IsNotFound(err) {
+			log.Printf("deploy %s: supersede %s: %v", deploy.ID, old.ID, err)
+			continue
+		}
+		if err := s.repo.Supersede(ctx, old.ID, deploy.ID); err != nil {
+			log.Printf("deploy %s: supersede %s: %v", deploy.ID, old.ID, err)
+			continue
+		}
+		s.appendDeployLog(ctx, old, "deploy", "INFO", fmt.Sprintf("superseded by %s: scaled to 0, kept for rollback", deploy.ID.String()[0:8]))
+	}
+}
+
+// deploymentResourceName is the name of the k8s Deployment created for a deployment record.
+func deploymentResourceName(id uuid.UUID) string {
+	return fmt.Sprintf("app-%s", id.String()[0:8])
+}
+
 // int32Ptr returns a pointer to the given int32 value.
 func int32Ptr(i int32) *int32 {
 	return &i
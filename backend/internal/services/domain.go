@@ -0,0 +1,530 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidDomain     = errors.New("invalid domain")
+	ErrDomainExists      = errors.New("domain is already attached")
+	ErrDomainNotVerified = errors.New("domain ownership could not be verified")
+)
+
+const (
+	// the TXT record proving ownership lives at this label under the domain
+	domainChallengeLabel = "_mini-paas-challenge"
+	domainChallengeValue = "mini-paas-verification="
+
+	labelDomainID = "domain-id"
+	// issuer used when CERT_MANAGER_ISSUER is not set
+	defaultClusterIssuer = "letsencrypt"
+)
+
+// DomainChallenge is the DNS record that proves ownership of a domain.
+type DomainChallenge struct {
+	Type  string
+	Name  string
+	Value string
+}
+
+type domainService struct {
+	repo     repository.DomainRepository
+	appRepo  repository.AppRepository
+	quotas   QuotaService
+	resolver DNSResolver
+	client   *kubernetes.Clientset
+	// ClusterIssuer cert-manager issues certificates from
+	issuer string
+	// IngressClass of the domain Ingresses; empty uses the cluster default
+	ingressClass string
+	// where the domains of sleeping apps and apps in maintenance are routed;
+	// nil when there is none
+	activator *networkingv1.IngressServiceBackend
+}
+
+func NewDomainService(repo repository.DomainRepository, appRepo repository.AppRepository, quotas QuotaService, resolver DNSResolver, client *kubernetes.Clientset) DomainService {
+	issuer := os.Getenv("CERT_MANAGER_ISSUER")
+	if issuer == "" {
+		issuer = defaultClusterIssuer
+	}
+	return &domainService{
+		repo:         repo,
+		appRepo:      appRepo,
+		quotas:       quotas,
+		resolver:     resolver,
+		client:       client,
+		issuer:       issuer,
+		ingressClass: os.Getenv("INGRESS_CLASS"),
+		activator:    activatorBackendFromEnv(),
+	}
+}
+
+// Challenge returns the TXT record the owner of d has to publish.
+func (s *domainService) Challenge(d *models.Domain) DomainChallenge {
+	return DomainChallenge{
+		Type:  "TXT",
+		Name:  domainChallengeLabel + "." + d.Hostname,
+		Value: domainChallengeValue + d.VerificationToken,
+	}
+}
+
+// AddDomain attaches a hostname to the app. It is not routed until its
+// ownership is verified.
+func (s *domainService) AddDomain(ctx context.Context, appID uuid.UUID, hostname, tlsMode string) (*models.Domain, error) {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return nil, err
+	}
+	hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+	if !hostnameRe.MatchString(hostname) {
+		return nil, fmt.Errorf("%w: %q is not a valid hostname", ErrInvalidDomain, hostname)
+	}
+	switch tlsMode {
+	case "":
+		tlsMode = models.DomainTLSCertManager
+	case models.DomainTLSCertManager, models.DomainTLSNone:
+	default:
+		// an uploaded certificate replaces the mode once it is uploaded
+		return nil, fmt.Errorf("%w: tls must be %s or %s", ErrInvalidDomain, models.DomainTLSCertManager, models.DomainTLSNone)
+	}
+
+	if _, err := s.repo.GetByHostname(ctx, hostname); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDomainExists, hostname)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err := s.quotas.CheckDomain(ctx, appID); err != nil {
+		return nil, err
+	}
+
+	token, err := randomPassword()
+	if err != nil {
+		return nil, err
+	}
+	d := &models.Domain{
+		ID:                uuid.New(),
+		AppID:             appID,
+		Hostname:          hostname,
+		VerificationToken: token,
+		TLS:               tlsMode,
+	}
+	if tlsMode == models.DomainTLSCertManager {
+		d.CertSecret = domainResourceName(d.ID) + "-tls"
+	}
+	if err := s.repo.Create(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// AttachPlatformDomain routes a hostname under the platform's own domain to
+// the app right away. The platform controls that domain, so there is nothing
+// to verify, and the hostname does not count against the app's quota.
+func (s *domainService) AttachPlatformDomain(ctx context.Context, appID uuid.UUID, hostname string) (*models.Domain, error) {
+	hostname = strings.ToLower(hostname)
+	if !hostnameRe.MatchString(hostname) {
+		return nil, fmt.Errorf("%w: %q is not a valid hostname", ErrInvalidDomain, hostname)
+	}
+	d, err := s.repo.GetByHostname(ctx, hostname)
+	switch {
+	case err == nil && d.AppID != appID:
+		return nil, fmt.Errorf("%w: %s", ErrDomainExists, hostname)
+	case errors.Is(err, repository.ErrNotFound):
+		now := time.Now()
+		d = &models.Domain{
+			ID:         uuid.New(),
+			AppID:      appID,
+			Hostname:   hostname,
+			VerifiedAt: &now,
+			TLS:        models.DomainTLSCertManager,
+			CertStatus: "PENDING",
+		}
+		d.CertSecret = domainResourceName(d.ID) + "-tls"
+		if d.VerificationToken, err = randomPassword(); err != nil {
+			return nil, err
+		}
+		if err := s.repo.Create(ctx, d); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+	if err := s.applyIngress(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// ListDomains returns the app's domains with their certificates' current state.
+func (s *domainService) ListDomains(ctx context.Context, appID uuid.UUID) ([]models.Domain, error) {
+	domains, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range domains {
+		if err := s.refreshCertificate(ctx, &domains[i]); err != nil {
+			return nil, err
+		}
+	}
+	return domains, nil
+}
+
+// VerifyDomain checks the domain's TXT challenge and, once it is found,
+// routes the hostname to the app.
+func (s *domainService) VerifyDomain(ctx context.Context, appID, id uuid.UUID) (*models.Domain, error) {
+	d, err := s.getDomain(ctx, appID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.VerifiedAt == nil {
+		ch := s.Challenge(d)
+		records, err := s.resolver.LookupTXT(ctx, ch.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: look up TXT %s: %v", ErrDomainNotVerified, ch.Name, err)
+		}
+		found := false
+		for _, r := range records {
+			if strings.TrimSpace(r) == ch.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: TXT %s does not contain %q", ErrDomainNotVerified, ch.Name, ch.Value)
+		}
+
+		now := time.Now()
+		d.VerifiedAt = &now
+		if d.TLS == models.DomainTLSCertManager {
+			d.CertStatus = "PENDING"
+		}
+		if err := s.repo.Update(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+
+	// verifying again re-applies the Ingress
+	if err := s.applyIngress(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, s.refreshCertificate(ctx, d)
+}
+
+// UploadCertificate stores a certificate of the owner's for the domain
+// instead of one from cert-manager.
+func (s *domainService) UploadCertificate(ctx context.Context, appID, id uuid.UUID, certPEM, keyPEM string) (*models.Domain, error) {
+	d, err := s.getDomain(ctx, appID, id)
+	if err != nil {
+		return nil, err
+	}
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDomain, err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDomain, err)
+	}
+	if err := leaf.VerifyHostname(d.Hostname); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDomain, err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   domainResourceName(d.ID) + "-cert",
+			Labels: s.domainLabels(d),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte(certPEM),
+			corev1.TLSPrivateKeyKey: []byte(keyPEM),
+		},
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, d.AppID)
+	if err != nil {
+		return nil, err
+	}
+	secrets := s.client.CoreV1().Secrets(namespace)
+	if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("update certificate secret: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("create certificate secret: %w", err)
+	}
+
+	d.TLS = models.DomainTLSUploaded
+	d.CertSecret = secret.Name
+	d.CertStatus = "ISSUED"
+	d.CertExpiresAt = &leaf.NotAfter
+	if err := s.repo.Update(ctx, d); err != nil {
+		return nil, err
+	}
+	if d.VerifiedAt != nil {
+		if err := s.applyIngress(ctx, d); err != nil {
+			return nil, err
+		}
+	}
+	return d, s.refreshCertificate(ctx, d)
+}
+
+// RemoveDomain stops routing the hostname and detaches it from the app.
+func (s *domainService) RemoveDomain(ctx context.Context, appID, id uuid.UUID) error {
+	d, err := s.getDomain(ctx, appID, id)
+	if err != nil {
+		return err
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, appID)
+	if err != nil {
+		return err
+	}
+	name := domainResourceName(d.ID)
+	err = s.client.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete k8s ingress %s: %w", name, err)
+	}
+	for _, secret := range []string{name + "-tls", name + "-cert"} {
+		err := s.client.CoreV1().Secrets(namespace).Delete(ctx, secret, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete certificate secret %s: %w", secret, err)
+		}
+	}
+	return s.repo.Delete(ctx, d.ID)
+}
+
+func (s *domainService) getDomain(ctx context.Context, appID, id uuid.UUID) (*models.Domain, error) {
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.AppID != appID {
+		return nil, repository.ErrNotFound
+	}
+	return d, nil
+}
+
+// applyIngress routes a verified domain to the app's Service. Each domain has
+// an Ingress of its own so that cert-manager, which acts on every TLS entry
+// of an annotated Ingress, never touches an uploaded certificate.
+func (s *domainService) applyIngress(ctx context.Context, d *models.Domain) error {
+	app, err := s.appRepo.GetByID(ctx, d.AppID)
+	if err != nil {
+		return err
+	}
+	namespace := appNamespace(app)
+	appName := appResourceName(d.AppID)
+	if err := ensureAppService(ctx, s.client, namespace, appName, app.Config); err != nil {
+		return err
+	}
+
+	var backend *networkingv1.IngressServiceBackend
+	if app.SleepingSince != nil || app.Maintenance.Enabled {
+		if backend, err = s.activatorBackend(ctx, namespace); err != nil {
+			return err
+		}
+	}
+	ing := buildDomainIngress(d, appName, app.Config, s.domainLabels(d), s.issuer, s.ingressClass, backend)
+	ingresses := s.client.NetworkingV1().Ingresses(namespace)
+	live, err := ingresses.Get(ctx, ing.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = ingresses.Create(ctx, ing, metav1.CreateOptions{})
+	} else if err == nil {
+		live.Annotations = ing.Annotations
+		live.Spec = ing.Spec
+		_, err = ingresses.Update(ctx, live, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply k8s ingress %s: %w", ing.Name, err)
+	}
+	return nil
+}
+
+// activatorBackend is where the Ingresses of a sleeping app in namespace
+// route. An Ingress only reaches Services of its own namespace, so other
+// namespaces get an ExternalName Service in front of the activator's.
+func (s *domainService) activatorBackend(ctx context.Context, namespace string) (*networkingv1.IngressServiceBackend, error) {
+	if s.activator == nil || namespace == defaultNamespace {
+		return s.activator, nil
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   s.activator.Name,
+			Labels: map[string]string{labelManagedBy: managedByPlatform},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:         corev1.ServiceTypeExternalName,
+			ExternalName: fmt.Sprintf("%s.%s.svc.cluster.local", s.activator.Name, defaultNamespace),
+			Ports:        []corev1.ServicePort{{Name: "http", Port: s.activator.Port.Number}},
+		},
+	}
+	_, err := s.client.CoreV1().Services(namespace).Create(ctx, svc, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return nil, fmt.Errorf("create k8s service %s: %w", svc.Name, err)
+	}
+	return s.activator, nil
+}
+
+// RouteApp applies the Ingresses of the app's verified domains again, to the
+// activator while the app sleeps or is in maintenance and to the app otherwise.
+func (s *domainService) RouteApp(ctx context.Context, appID uuid.UUID) error {
+	domains, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return err
+	}
+	for i := range domains {
+		if domains[i].VerifiedAt == nil {
+			continue
+		}
+		if err := s.applyIngress(ctx, &domains[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureAppService creates the Service the app's Ingresses and linked apps
+// point at. Blue/green and canary releases manage its selector themselves, so
+// an existing one is left alone.
+func ensureAppService(ctx context.Context, client *kubernetes.Clientset, namespace, appName string, cfg models.AppConfig) error {
+	services := client.CoreV1().Services(namespace)
+	_, err := services.Get(ctx, appName, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("get k8s service %s: %w", appName, err)
+	}
+	ports := appServicePorts(cfg)
+	if len(ports) == 0 {
+		return fmt.Errorf("%w: the app has no HTTP port to route to", ErrInvalidDomain)
+	}
+	svc := buildAppService(appName, map[string]string{"app": appName}, ports)
+	if _, err := services.Create(ctx, svc, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("create k8s service %s: %w", appName, err)
+	}
+	return nil
+}
+
+// refreshCertificate reads the state and expiry of the domain's certificate
+// from its TLS secret and stores them when they changed.
+func (s *domainService) refreshCertificate(ctx context.Context, d *models.Domain) error {
+	if d.VerifiedAt == nil || d.TLS == models.DomainTLSNone || d.CertSecret == "" {
+		return nil
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, d.AppID)
+	if err != nil {
+		return err
+	}
+	status, expires := "PENDING", (*time.Time)(nil)
+	secret, err := s.client.CoreV1().Secrets(namespace).Get(ctx, d.CertSecret, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		// cert-manager has not issued it yet
+	case err != nil:
+		return fmt.Errorf("read certificate secret %s: %w", d.CertSecret, err)
+	default:
+		if block, _ := pem.Decode(secret.Data[corev1.TLSCertKey]); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				status, expires = "ISSUED", &cert.NotAfter
+				if time.Now().After(cert.NotAfter) {
+					status = "EXPIRED"
+				}
+			}
+		}
+	}
+
+	if d.CertStatus == status && timesEqual(d.CertExpiresAt, expires) {
+		return nil
+	}
+	d.CertStatus, d.CertExpiresAt = status, expires
+	return s.repo.Update(ctx, d)
+}
+
+func (s *domainService) domainLabels(d *models.Domain) map[string]string {
+	return map[string]string{
+		labelManagedBy: managedByPlatform,
+		labelAppID:     d.AppID.String(),
+		labelDomainID:  d.ID.String(),
+		"app":          appResourceName(d.AppID),
+	}
+}
+
+// buildDomainIngress routes the domain to each HTTP port of the app under the
+// port's path, or every path to activator when it is set.
+func buildDomainIngress(d *models.Domain, appName string, cfg models.AppConfig, labels map[string]string, issuer, class string, activator *networkingv1.IngressServiceBackend) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	var paths []networkingv1.HTTPIngressPath
+	for _, p := range appPorts(cfg) {
+		if p.Protocol != models.PortHTTP {
+			continue
+		}
+		backend := &networkingv1.IngressServiceBackend{
+			Name: appName,
+			Port: networkingv1.ServiceBackendPort{Name: servicePortFor(cfg, p)},
+		}
+		if activator != nil {
+			backend = activator
+		}
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     p.Path,
+			PathType: &pathType,
+			Backend:  networkingv1.IngressBackend{Service: backend},
+		})
+	}
+	ing := &networkingv1.Ingress{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "Ingress"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   domainResourceName(d.ID),
+			Labels: labels,
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{{
+				Host: d.Hostname,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+				},
+			}},
+		},
+	}
+	if class != "" {
+		ing.Spec.IngressClassName = &class
+	}
+	if d.TLS != models.DomainTLSNone && d.CertSecret != "" {
+		ing.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{d.Hostname}, SecretName: d.CertSecret}}
+	}
+	if d.TLS == models.DomainTLSCertManager {
+		ing.Annotations = map[string]string{"cert-manager.io/cluster-issuer": issuer}
+	}
+	return ing
+}
+
+// domainResourceName is the name of the Ingress and secrets of a domain.
+func domainResourceName(id uuid.UUID) string {
+	return fmt.Sprintf("domain-%s", id.String()[0:8])
+}
+
+func timesEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
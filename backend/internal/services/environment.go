@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidEnvironment   = errors.New("invalid environment")
+	ErrEnvironmentExists    = errors.New("environment already exists")
+	ErrEnvironmentForbidden = errors.New("you cannot manage the environments of this app")
+	ErrNothingToPromote     = errors.New("nothing to promote")
+)
+
+var environmentNameRe = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// EnvironmentConfig is what an environment changes of its app's config when
+// it is created; later changes go to the environment's app directly.
+type EnvironmentConfig struct {
+	Replicas *int32
+	// merged over the app's config vars
+	Env map[string]string
+}
+
+// EnvironmentStatus is an environment with the app that runs it and the
+// release it is running, if any.
+type EnvironmentStatus struct {
+	Environment models.Environment
+	App         models.Application
+	Release     *models.Deployment
+}
+
+type environmentService struct {
+	repo        repository.EnvironmentRepository
+	appRepo     repository.AppRepository
+	depRepo     repository.DeploymentRepository
+	apps        AppService
+	deployments DeploymentService
+	teamService TeamService
+}
+
+func NewEnvironmentService(repo repository.EnvironmentRepository, appRepo repository.AppRepository, depRepo repository.DeploymentRepository, apps AppService, deployments DeploymentService, teamService TeamService) EnvironmentService {
+	return &environmentService{
+		repo:        repo,
+		appRepo:     appRepo,
+		depRepo:     depRepo,
+		apps:        apps,
+		deployments: deployments,
+		teamService: teamService,
+	}
+}
+
+// CreateEnvironment adds an environment after the app's last one. It runs as
+// a copy of the app named <app>-<env>, with cfg applied to the app's config,
+// in a namespace of its own that its first release creates.
+func (s *environmentService) CreateEnvironment(ctx context.Context, user *models.User, appID uuid.UUID, name string, cfg EnvironmentConfig) (*EnvironmentStatus, error) {
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return nil, err
+	}
+	if app.ParentID != nil {
+		return nil, fmt.Errorf("%w: previews have no environments", ErrInvalidEnvironment)
+	}
+	if _, err := s.repo.GetByEnvApp(ctx, app.ID); err == nil {
+		return nil, fmt.Errorf("%w: %s runs an environment and has none of its own", ErrInvalidEnvironment, app.Name)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if !environmentNameRe.MatchString(name) {
+		return nil, fmt.Errorf("%w: name %q must be lower case letters, digits and dashes, starting with a letter", ErrInvalidEnvironment, name)
+	}
+	if _, err := s.repo.GetByName(ctx, app.ID, name); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrEnvironmentExists, name)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	envs, err := s.repo.ListByApp(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	position := 1
+	if len(envs) > 0 {
+		position = envs[len(envs)-1].Position + 1
+	}
+
+	namespace := namespaceFor(app, "", "-"+name)
+	draft := environmentApp(app, name, namespace, cfg)
+	if draft.OwnerID == nil && draft.TeamID == nil {
+		// an app from before owners were required; its environment is
+		// counted against the user who creates it
+		draft.OwnerID = &user.ID
+	}
+	envApp, err := s.apps.CreateApp(ctx, draft)
+	if err != nil {
+		return nil, err
+	}
+	env := &models.Environment{AppID: app.ID, Name: name, Position: position, EnvAppID: envApp.ID, Namespace: namespace}
+	if err := s.repo.Create(ctx, env); err != nil {
+		_ = s.appRepo.DeleteHard(ctx, envApp.ID)
+		return nil, err
+	}
+	return &EnvironmentStatus{Environment: *env, App: *envApp}, nil
+}
+
+// ListEnvironments returns the app's environments in promotion order.
+func (s *environmentService) ListEnvironments(ctx context.Context, appID uuid.UUID) ([]EnvironmentStatus, error) {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return nil, err
+	}
+	envs, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]EnvironmentStatus, 0, len(envs))
+	for _, env := range envs {
+		status, err := s.status(ctx, env)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *status)
+	}
+	return out, nil
+}
+
+// Promote deploys the release running in the named environment to the next
+// one, pinned to the same image digest. Only the image moves: config is per
+// environment, so the next one keeps its own config vars, scaling and
+// release command, and its release snapshots those.
+func (s *environmentService) Promote(ctx context.Context, user *models.User, appID uuid.UUID, name string) (*models.Environment, *models.Deployment, error) {
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return nil, nil, err
+	}
+	envs, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	i := 0
+	for i < len(envs) && envs[i].Name != name {
+		i++
+	}
+	switch {
+	case i == len(envs):
+		return nil, nil, repository.ErrNotFound
+	case i == len(envs)-1:
+		return nil, nil, fmt.Errorf("%w: %s is the last environment", ErrInvalidEnvironment, name)
+	}
+	from, to := envs[i], envs[i+1]
+
+	release, err := s.depRepo.GetLatestByApp(ctx, from.EnvAppID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: %s has no RUNNING release", ErrNothingToPromote, from.Name)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := s.appRepo.GetByID(ctx, to.EnvAppID)
+	if err != nil {
+		return nil, nil, err
+	}
+	deploy, err := s.deployments.DeployRelease(ctx, *target, release)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &to, deploy, nil
+}
+
+func (s *environmentService) status(ctx context.Context, env models.Environment) (*EnvironmentStatus, error) {
+	app, err := s.appRepo.GetByID(ctx, env.EnvAppID)
+	if err != nil {
+		return nil, err
+	}
+	status := &EnvironmentStatus{Environment: env, App: *app}
+	release, err := s.depRepo.GetLatestByApp(ctx, env.EnvAppID, "RUNNING")
+	switch {
+	case err == nil:
+		status.Release = release
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	return status, nil
+}
+
+// requireAccess returns ErrEnvironmentForbidden unless user may manage app.
+func (s *environmentService) requireAccess(ctx context.Context, user *models.User, app *models.Application) error {
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrEnvironmentForbidden, app.Name)
+	}
+	return nil
+}
+
+// environmentApp returns the app that runs environment name of app in
+// namespace. The app's domains stay with the app.
+func environmentApp(app *models.Application, name, namespace string, cfg EnvironmentConfig) *models.Application {
+	config := app.Config
+	config.Domains = nil
+	if cfg.Replicas != nil {
+		config.Replicas = cfg.Replicas
+	}
+	if len(cfg.Env) > 0 {
+		env := make(map[string]string, len(config.Env)+len(cfg.Env))
+		for k, v := range config.Env {
+			env[k] = v
+		}
+		for k, v := range cfg.Env {
+			env[k] = v
+		}
+		config.Env = env
+	}
+	return &models.Application{
+		Name:           app.Name + "-" + name,
+		OwnerID:        app.OwnerID,
+		TeamID:         app.TeamID,
+		Description:    fmt.Sprintf("The %s environment of %s", name, app.Name),
+		GitURL:         app.GitURL,
+		ImageURL:       app.ImageURL,
+		Runtime:        app.Runtime,
+		ReleaseCommand: app.ReleaseCommand,
+		Config:         config,
+		Namespace:      namespace,
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+)
+
+// defaultErrorRateQuery assumes request metrics labelled with the pod's app and
+// deployment-id labels, as the Prometheus kubernetes_sd relabelling gives them.
+const defaultErrorRateQuery = `sum(rate(http_requests_total{app="$app",deployment_id="$deployment",code=~"5.."}[$window]))` +
+	` / sum(rate(http_requests_total{app="$app",deployment_id="$deployment"}[$window]))`
+
+// NewErrorRateSourceFromEnv queries the Prometheus at PROMETHEUS_URL with
+// PROMETHEUS_ERROR_RATE_QUERY. It returns nil when PROMETHEUS_URL is not set,
+// in which case error-rate rollback thresholds are not checked.
+func NewErrorRateSourceFromEnv() ErrorRateSource {
+	base := os.Getenv("PROMETHEUS_URL")
+	if base == "" {
+		return nil
+	}
+	query := os.Getenv("PROMETHEUS_ERROR_RATE_QUERY")
+	if query == "" {
+		query = defaultErrorRateQuery
+	}
+	return &prometheusErrorRate{
+		base:  strings.TrimSuffix(base, "/"),
+		query: query,
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type prometheusErrorRate struct {
+	base  string
+	query string
+	http  *http.Client
+}
+
+func (p *prometheusErrorRate) ErrorRate(ctx context.Context, deploy *models.Deployment, app models.Application, since time.Time) (float64, bool, error) {
+	window := time.Since(since).Round(time.Second)
+	if window < time.Minute {
+		window = time.Minute
+	}
+	query := strings.NewReplacer(
+		"$app", app.Name,
+		"$deployment", deploy.ID.String(),
+		"$window", fmt.Sprintf("%ds", int(window.Seconds())),
+	).Replace(p.query)
+
+	rate, ok, err := queryPrometheus(ctx, p.http, p.base, query)
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	// no traffic yields 0/0
+	if math.IsNaN(rate) {
+		return 0, false, nil
+	}
+	return rate, true, nil
+}
+
+// queryPrometheus runs an instant query and returns the value of its first
+// series; ok is false when the query matched none.
+func queryPrometheus(ctx context.Context, client *http.Client, base, query string) (float64, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v1/query?query="+url.QueryEscape(query), nil)
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, fmt.Errorf("query prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, false, fmt.Errorf("query prometheus: %s", resp.Status)
+	}
+
+	var body struct {
+		Data struct {
+			Result []struct {
+				Value [2]any `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, false, fmt.Errorf("decode prometheus response: %w", err)
+	}
+	if len(body.Data.Result) == 0 {
+		return 0, false, nil
+	}
+	raw, _ := body.Data.Result[0].Value[1].(string)
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("parse prometheus value %q: %w", raw, err)
+	}
+	return v, true, nil
+}
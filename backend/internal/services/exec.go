@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var ErrExecForbidden = errors.New("you cannot open a shell in this app")
+
+// ExecTarget is the pod and container an exec session attaches to.
+type ExecTarget struct {
+	DeploymentID uuid.UUID
+	Namespace    string
+	Pod          string
+	Container    string
+}
+
+// ExecStreams carries the terminal I/O of an exec session.
+type ExecStreams struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Resize remotecommand.TerminalSizeQueue
+}
+
+type execService struct {
+	client      *kubernetes.Clientset
+	config      *rest.Config
+	deployRepo  repository.DeploymentRepository
+	appRepo     repository.AppRepository
+	auditRepo   repository.AuditRepository
+	teamService TeamService
+}
+
+func NewExecService(
+	client *kubernetes.Clientset,
+	config *rest.Config,
+	deployRepo repository.DeploymentRepository,
+	appRepo repository.AppRepository,
+	auditRepo repository.AuditRepository,
+	teamService TeamService,
+) ExecService {
+	return &execService{
+		client:      client,
+		config:      config,
+		deployRepo:  deployRepo,
+		appRepo:     appRepo,
+		auditRepo:   auditRepo,
+		teamService: teamService,
+	}
+}
+
+// ResolveTarget picks a running pod of the deployment. An explicit pod or
+// container must belong to the deployment, and user must be able to manage
+// its app.
+func (s *execService) ResolveTarget(ctx context.Context, user *models.User, deploymentID uuid.UUID, podName, container string) (*ExecTarget, error) {
+	deploy, err := s.deployRepo.GetByID(ctx, deploymentID)
+	if err != nil {
+		return nil, err
+	}
+	app, err := s.appRepo.GetByID(ctx, deploy.AppID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrExecForbidden, app.Name)
+	}
+
+	prefix := deploymentResourceName(deploymentID) + "-"
+	pods, err := s.client.CoreV1().Pods(appNamespace(app)).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+
+	for _, pod := range pods.Items {
+		if !strings.HasPrefix(pod.Name, prefix) || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		if podName != "" && pod.Name != podName {
+			continue
+		}
+
+		target := &ExecTarget{DeploymentID: deploymentID, Namespace: pod.Namespace, Pod: pod.Name}
+		for _, c := range pod.Spec.Containers {
+			if container == "" || c.Name == container {
+				target.Container = c.Name
+				return target, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: container %q", ErrPodNotFound, container)
+	}
+	return nil, ErrPodNotFound
+}
+
+// Exec runs command with a TTY in the target container until the session ends.
+// Opening and closing the session is written to the audit log.
+func (s *execService) Exec(ctx context.Context, user *models.User, target *ExecTarget, command []string, streams ExecStreams) error {
+	detail := fmt.Sprintf("pod=%s container=%s command=%q", target.Pod, target.Container, strings.Join(command, " "))
+	if err := s.audit(ctx, user, "exec.open", target.DeploymentID, detail); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+	started := time.Now()
+	defer func() {
+		closeDetail := fmt.Sprintf("%s duration=%s", detail, time.Since(started).Round(time.Second))
+		_ = s.audit(context.WithoutCancel(ctx), user, "exec.close", target.DeploymentID, closeDetail)
+	}()
+
+	req := s.client.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(target.Namespace).
+		Name(target.Pod).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: target.Container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(s.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("create executor: %w", err)
+	}
+
+	// Stream has no context parameter; closing stdin on cancel ends the session
+	return executor.Stream(remotecommand.StreamOptions{
+		Stdin:             streams.Stdin,
+		Stdout:            streams.Stdout,
+		Tty:               true,
+		TerminalSizeQueue: streams.Resize,
+	})
+}
+
+func (s *execService) audit(ctx context.Context, user *models.User, action string, deploymentID uuid.UUID, detail string) error {
+	return s.auditRepo.Create(ctx, &models.AuditEvent{
+		UserID:       user.ID,
+		Action:       action,
+		ResourceType: "deployment",
+		ResourceID:   deploymentID,
+		Detail:       detail,
+	})
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultRetainReleases = 10
+	defaultRetainLogDays  = 30
+
+	// the live release and the one a rollback returns to keep their objects
+	keepRunningReleases = 2
+)
+
+// RetentionPolicy is how much history garbage collection keeps.
+type RetentionPolicy struct {
+	// deployment records kept per app, newest first; releases still in
+	// progress or serving are kept whatever their age
+	Releases int
+	// log lines older than this many days are deleted
+	LogDays int
+}
+
+// retentionPolicyFromEnv reads RETAIN_RELEASES and RETAIN_LOG_DAYS.
+func retentionPolicyFromEnv() RetentionPolicy {
+	policy := RetentionPolicy{Releases: defaultRetainReleases, LogDays: defaultRetainLogDays}
+	if n, err := strconv.Atoi(os.Getenv("RETAIN_RELEASES")); err == nil && n >= keepRunningReleases {
+		policy.Releases = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("RETAIN_LOG_DAYS")); err == nil && n > 0 {
+		policy.LogDays = n
+	}
+	return policy
+}
+
+// GCReport is what a garbage collection pass removes, or would remove on a
+// dry run.
+type GCReport struct {
+	DryRun bool
+	Policy RetentionPolicy
+	// RUNNING releases replaced twice over: their k8s objects are deleted and
+	// they become RETIRED
+	Retired []models.Deployment
+	// deployment records deleted with their events and logs
+	Pruned     []models.Deployment
+	LogsBefore time.Time
+	Logs       int64
+	// ReplicaSets left behind by earlier rollouts of a k8s Deployment
+	ReplicaSets []string
+	// k8s objects of apps or releases that no longer exist
+	Orphans []GCObject
+	// what could not be removed; the next pass tries again
+	Errors []string
+}
+
+type GCObject struct {
+	Kind   string
+	Name   string
+	Reason string
+}
+
+// appObject is a k8s object created for an app or release, which it outlives
+// when that is gone.
+type appObject struct {
+	kind         string
+	name         string
+	appID        *uuid.UUID
+	deploymentID *uuid.UUID
+	delete       func(ctx context.Context) error
+}
+
+type gcService struct {
+	depRepo repository.DeploymentRepository
+	appRepo repository.AppRepository
+	logRepo repository.LogRepository
+	client  *kubernetes.Clientset
+	policy  RetentionPolicy
+}
+
+func NewGCService(depRepo repository.DeploymentRepository, appRepo repository.AppRepository, logRepo repository.LogRepository, client *kubernetes.Clientset) GCService {
+	return &gcService{
+		depRepo: depRepo,
+		appRepo: appRepo,
+		logRepo: logRepo,
+		client:  client,
+		policy:  retentionPolicyFromEnv(),
+	}
+}
+
+// Run collects garbage every interval until ctx is done.
+func (s *gcService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := s.Collect(ctx)
+		if err != nil {
+			log.Printf("gc: %v", err)
+			continue
+		}
+		log.Printf("gc: retired %d releases, pruned %d, deleted %d log lines, %d replica sets and %d orphaned objects",
+			len(report.Retired), len(report.Pruned), report.Logs, len(report.ReplicaSets), len(report.Orphans))
+		for _, e := range report.Errors {
+			log.Printf("gc: %s", e)
+		}
+	}
+}
+
+// Plan reports what Collect would remove without removing anything.
+func (s *gcService) Plan(ctx context.Context) (*GCReport, error) {
+	return s.collect(ctx, true)
+}
+
+// Collect removes what the retention policy no longer keeps.
+func (s *gcService) Collect(ctx context.Context) (*GCReport, error) {
+	return s.collect(ctx, false)
+}
+
+func (s *gcService) collect(ctx context.Context, dryRun bool) (*GCReport, error) {
+	report := &GCReport{DryRun: dryRun, Policy: s.policy}
+	fail := func(format string, args ...any) {
+		report.Errors = append(report.Errors, fmt.Sprintf(format, args...))
+	}
+
+	superseded, err := s.depRepo.ListSuperseded(ctx, keepRunningReleases)
+	if err != nil {
+		return nil, err
+	}
+	retired := map[uuid.UUID]bool{}
+	for i := range superseded {
+		d := &superseded[i]
+		if !dryRun {
+			if err := deleteReleaseObjects(ctx, s.client, s.namespaceOf(ctx, d.AppID), d.ID); err != nil {
+				fail("retire %s: %v", d.ID, err)
+				continue
+			}
+			_ = s.depRepo.UpdateStatus(ctx, d.ID, "RETIRED")
+			s.appendLog(ctx, d, "retired by garbage collection: two newer releases went RUNNING")
+		}
+		retired[d.ID] = true
+		report.Retired = append(report.Retired, *d)
+	}
+
+	// what was just retired is RUNNING no more, a dry run counts it as if
+	statuses := append([]string{"RUNNING"}, repository.FinishedDeploymentStatuses...)
+	expired, err := s.depRepo.ListExpired(ctx, s.policy.Releases, statuses...)
+	if err != nil {
+		return nil, err
+	}
+	var pruned []uuid.UUID
+	for _, d := range expired {
+		if d.Status == "RUNNING" && !retired[d.ID] {
+			if _, err := s.appRepo.GetByID(ctx, d.AppID); err == nil {
+				continue
+			}
+		}
+		if !dryRun {
+			if err := deleteReleaseObjects(ctx, s.client, s.namespaceOf(ctx, d.AppID), d.ID); err != nil {
+				fail("prune %s: %v", d.ID, err)
+				continue
+			}
+		}
+		pruned = append(pruned, d.ID)
+		report.Pruned = append(report.Pruned, d)
+	}
+	if !dryRun {
+		if err := s.depRepo.DeleteWithHistory(ctx, pruned); err != nil {
+			return nil, err
+		}
+	}
+
+	report.LogsBefore = time.Now().AddDate(0, 0, -s.policy.LogDays)
+	if dryRun {
+		report.Logs, err = s.logRepo.CountBefore(ctx, report.LogsBefore)
+	} else {
+		report.Logs, err = s.logRepo.DeleteBefore(ctx, report.LogsBefore)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.collectReplicaSets(ctx, report, dryRun); err != nil {
+		fail("replica sets: %v", err)
+	}
+	if err := s.collectOrphans(ctx, report, dryRun); err != nil {
+		fail("orphaned objects: %v", err)
+	}
+	return report, nil
+}
+
+// collectReplicaSets removes the scaled-down ReplicaSets of release
+// Deployments other than their current revision. The deployment controller
+// keeps them for `kubectl rollout undo`, which releases never use.
+func (s *gcService) collectReplicaSets(ctx context.Context, report *GCReport, dryRun bool) error {
+	deployments, err := s.client.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	revisions := map[string]string{}
+	for _, d := range deployments.Items {
+		revisions[d.Namespace+"/"+d.Name] = d.Annotations[annotationRevision]
+	}
+
+	list, err := s.client.AppsV1().ReplicaSets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{LabelSelector: labelDeploymentID})
+	if err != nil {
+		return err
+	}
+	for _, rs := range list.Items {
+		owner := metav1.GetControllerOf(&rs)
+		if owner == nil || owner.Kind != "Deployment" || rs.DeletionTimestamp != nil {
+			continue
+		}
+		current, ok := revisions[rs.Namespace+"/"+owner.Name]
+		if !ok || rs.Annotations[annotationRevision] == current {
+			continue
+		}
+		if (rs.Spec.Replicas != nil && *rs.Spec.Replicas > 0) || rs.Status.Replicas > 0 {
+			continue
+		}
+		if !dryRun {
+			if err := s.client.AppsV1().ReplicaSets(rs.Namespace).Delete(ctx, rs.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete replica set %s: %v", rs.Name, err))
+				continue
+			}
+		}
+		report.ReplicaSets = append(report.ReplicaSets, rs.Name)
+	}
+	return nil
+}
+
+// collectOrphans removes the k8s objects whose app or release record is gone;
+// those of records pruned on a dry run are reported with the records. Volume
+// claims hold data and are only ever deleted through the volumes API.
+func (s *gcService) collectOrphans(ctx context.Context, report *GCReport, dryRun bool) error {
+	candidates, err := listAppObjects(ctx, s.client)
+	if err != nil {
+		return err
+	}
+
+	var appIDs, deployIDs []uuid.UUID
+	for _, c := range candidates {
+		if c.appID != nil {
+			appIDs = append(appIDs, *c.appID)
+		}
+		if c.deploymentID != nil {
+			deployIDs = append(deployIDs, *c.deploymentID)
+		}
+	}
+	apps, err := s.appRepo.ExistingIDs(ctx, appIDs)
+	if err != nil {
+		return err
+	}
+	deploys, err := s.depRepo.ExistingIDs(ctx, deployIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range candidates {
+		var reason string
+		switch {
+		case c.deploymentID != nil && !deploys[*c.deploymentID]:
+			reason = fmt.Sprintf("deployment %s does not exist", *c.deploymentID)
+		case c.appID != nil && !apps[*c.appID]:
+			reason = fmt.Sprintf("app %s does not exist", *c.appID)
+		default:
+			continue
+		}
+		if !dryRun {
+			if err := c.delete(ctx); err != nil && !apierrors.IsNotFound(err) {
+				report.Errors = append(report.Errors, fmt.Sprintf("delete %s %s: %v", c.kind, c.name, err))
+				continue
+			}
+		}
+		report.Orphans = append(report.Orphans, GCObject{Kind: c.kind, Name: c.name, Reason: reason})
+	}
+	return nil
+}
+
+// listAppObjects lists the k8s objects created for apps and releases in
+// every namespace. Those of add-ons are left out: an add-on's StatefulSet,
+// Secret and data volume go together, through the add-ons API or with the
+// app.
+func listAppObjects(ctx context.Context, client *kubernetes.Clientset) ([]appObject, error) {
+	propagation := metav1.DeletePropagationBackground
+	opts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+	appSelector := metav1.ListOptions{LabelSelector: labelAppID}
+	var out []appObject
+	add := func(kind string, meta metav1.ObjectMeta, labels map[string]string, del func(context.Context, string, metav1.DeleteOptions) error) {
+		if meta.DeletionTimestamp != nil || labels[labelAddOnID] != "" {
+			return
+		}
+		c := appObject{kind: kind, name: meta.Name}
+		if id, err := uuid.Parse(labels[labelAppID]); err == nil {
+			c.appID = &id
+		}
+		if id, err := uuid.Parse(labels[labelDeploymentID]); err == nil {
+			c.deploymentID = &id
+		}
+		if c.appID == nil && c.deploymentID == nil {
+			return
+		}
+		name := meta.Name
+		c.delete = func(ctx context.Context) error { return del(ctx, name, opts) }
+		out = append(out, c)
+	}
+
+	dl, err := client.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dl.Items {
+		// release Deployments carry their ids on the pod template only
+		labels := map[string]string{}
+		for k, v := range d.Spec.Template.Labels {
+			labels[k] = v
+		}
+		for k, v := range d.Labels {
+			labels[k] = v
+		}
+		add("Deployment", d.ObjectMeta, labels, client.AppsV1().Deployments(d.Namespace).Delete)
+	}
+
+	jl, err := client.BatchV1().Jobs(metav1.NamespaceAll).List(ctx, appSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jl.Items {
+		add("Job", j.ObjectMeta, j.Labels, client.BatchV1().Jobs(j.Namespace).Delete)
+	}
+
+	cl, err := client.BatchV1beta1().CronJobs(metav1.NamespaceAll).List(ctx, appSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, cj := range cl.Items {
+		add("CronJob", cj.ObjectMeta, cj.Labels, client.BatchV1beta1().CronJobs(cj.Namespace).Delete)
+	}
+
+	sl, err := client.CoreV1().Services(metav1.NamespaceAll).List(ctx, appSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, svc := range sl.Items {
+		add("Service", svc.ObjectMeta, svc.Labels, client.CoreV1().Services(svc.Namespace).Delete)
+	}
+
+	pl, err := client.NetworkingV1().NetworkPolicies(metav1.NamespaceAll).List(ctx, appSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, np := range pl.Items {
+		add("NetworkPolicy", np.ObjectMeta, np.Labels, client.NetworkingV1().NetworkPolicies(np.Namespace).Delete)
+	}
+
+	il, err := client.NetworkingV1().Ingresses(metav1.NamespaceAll).List(ctx, appSelector)
+	if err != nil {
+		return nil, err
+	}
+	for _, ing := range il.Items {
+		add("Ingress", ing.ObjectMeta, ing.Labels, client.NetworkingV1().Ingresses(ing.Namespace).Delete)
+	}
+	return out, nil
+}
+
+// namespaceOf returns the namespace of the app's objects. Those of an app
+// that is gone are looked for in the default namespace; elsewhere they are
+// orphans collectOrphans finds.
+func (s *gcService) namespaceOf(ctx context.Context, appID uuid.UUID) string {
+	if namespace, err := namespaceOf(ctx, s.appRepo, appID); err == nil {
+		return namespace
+	}
+	return defaultNamespace
+}
+
+func (s *gcService) appendLog(ctx context.Context, deploy *models.Deployment, message string) {
+	if err := s.logRepo.Append(ctx, &models.Log{
+		DeploymentID: deploy.ID,
+		Message:      message,
+		Level:        "INFO",
+		Source:       "deploy",
+	}); err != nil {
+		log.Printf("deploy %s: append log: %v", deploy.ID, err)
+	}
+}
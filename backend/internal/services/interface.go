@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"io"
+	"net/url"
+	"time"
 
 	"mini-paas/backend/internal/models"
 	"mini-paas/backend/internal/repository"
@@ -13,9 +15,13 @@ import (
 
 type AppService interface {
 	CreateApp(ctx context.Context, app *models.Application) (*models.Application, error)
+	UpdateApp(ctx context.Context, app *models.Application) (*models.Application, error)
 	GetAppByID(ctx context.Context, id uuid.UUID) (*models.Application, error)
 	ListApps(ctx context.Context, f repository.AppFilter, page repository.Page, sort repository.Sort) (repository.ListResult[models.Application], error)
-	DeleteApp(ctx context.Context, id uuid.UUID) error
+	DeleteApp(ctx context.Context, id uuid.UUID, purgeVolumes bool) error
+	RequireAccess(ctx context.Context, user *models.User, app *models.Application) error
+	ApplyManifest(ctx context.Context, m *AppManifest, user *models.User, teamID *uuid.UUID) (*models.Application, bool, error)
+	ExportManifest(ctx context.Context, id uuid.UUID) (*AppManifest, error)
 }
 
 type DeploymentService interface {
@@ -25,7 +31,17 @@ type DeploymentService interface {
 	// ListDeploymentsByApp(ctx context.Context, appID uuid.UUID, page repository.Page, sort repository.Sort) (repository.ListResult[models.Deployment], error)
 	// k8
 	DeployApp(ctx context.Context, app models.Application) (*models.Deployment, error)
-	GetDeploymentStatus(ctx context.Context, id uuid.UUID) (string, error)
+	DeployRelease(ctx context.Context, app models.Application, release *models.Deployment) (*models.Deployment, error)
+	PreviewDeploy(ctx context.Context, app models.Application) (*ManifestPreview, error)
+	GetDeploymentStatus(ctx context.Context, id uuid.UUID) (*DeploymentStatus, error)
+	ProcessQueue(ctx context.Context, interval time.Duration)
+	CancelDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error)
+	PromoteDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error)
+	DiscardDeployment(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error)
+	AdvanceCanary(ctx context.Context, id uuid.UUID, user *models.User) (*models.Deployment, error)
+	ListPorts(ctx context.Context, appID uuid.UUID) ([]models.PortEndpoint, error)
+	ListAppHistory(ctx context.Context, appID uuid.UUID) ([]models.DeploymentEvent, error)
+	ProxyPreview(ctx context.Context, id uuid.UUID, method, path string, query url.Values, body []byte) (int, []byte, error)
 }
 
 type UserService interface {
@@ -42,7 +58,168 @@ type LogService interface {
 	StreamPodLogs(ctx context.Context, namespace, podName string, follow bool, tailLines *int64) (<-chan string, error)
 }
 
+type CronService interface {
+	CreateCronJob(ctx context.Context, cron *models.CronJob) (*models.CronJob, error)
+	UpdateCronJob(ctx context.Context, cron *models.CronJob) (*models.CronJob, error)
+	DeleteCronJob(ctx context.Context, appID, id uuid.UUID) error
+	ListCronJobs(ctx context.Context, appID uuid.UUID) ([]models.CronJob, error)
+	RebuildCronJobs(ctx context.Context, appID uuid.UUID, spec corev1.PodSpec) error
+	DeleteAppCronJobs(ctx context.Context, appID uuid.UUID) error
+	WatchRuns(ctx context.Context, interval time.Duration)
+}
+
+type RunService interface {
+	StartRun(ctx context.Context, user *models.User, appID uuid.UUID, command string) (*models.Run, error)
+	GetRun(ctx context.Context, user *models.User, id uuid.UUID) (*models.Run, error)
+}
+
+type ExecService interface {
+	ResolveTarget(ctx context.Context, user *models.User, deploymentID uuid.UUID, podName, container string) (*ExecTarget, error)
+	Exec(ctx context.Context, user *models.User, target *ExecTarget, command []string, streams ExecStreams) error
+}
+
+type VolumeService interface {
+	CreateVolume(ctx context.Context, v *models.Volume) (*models.Volume, error)
+	ListVolumes(ctx context.Context, appID uuid.UUID) ([]models.Volume, error)
+	DeleteVolume(ctx context.Context, appID, id uuid.UUID) error
+	DeleteAppVolumes(ctx context.Context, appID uuid.UUID) error
+}
+
+type AddOnService interface {
+	Catalog() []AddOnType
+	Provision(ctx context.Context, appID uuid.UUID, typeName, size string) (*models.AddOn, error)
+	ListAddOns(ctx context.Context, appID uuid.UUID) ([]models.AddOn, error)
+	GetAddOn(ctx context.Context, appID, id uuid.UUID) (*models.AddOn, error)
+	Deprovision(ctx context.Context, appID, id uuid.UUID) (*models.AddOn, error)
+	DeleteAppAddOns(ctx context.Context, appID uuid.UUID) error
+}
+
 type K8sLogService interface {
 	FindPodsForDeployment(ctx context.Context, deploymentName, namespace string) ([]corev1.Pod, error)
 	StreamPodLogs(ctx context.Context, namespace, podName string, follow bool, tailLine *int64) (io.ReadCloser, error)
 }
+
+type TeamService interface {
+	CreateTeam(ctx context.Context, user *models.User, name string) (*models.Team, error)
+	ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error)
+	AddMember(ctx context.Context, user *models.User, teamID, memberID uuid.UUID) error
+	RequireMember(ctx context.Context, teamID, userID uuid.UUID) error
+}
+
+type RegistryService interface {
+	CreateCredential(ctx context.Context, user *models.User, teamID *uuid.UUID, server, username, token string) (*models.RegistryCredential, error)
+	ListCredentials(ctx context.Context, user *models.User) ([]models.RegistryCredential, error)
+	DeleteCredential(ctx context.Context, user *models.User, id uuid.UUID) error
+	ResolveImage(ctx context.Context, app *models.Application, image string) (*ResolvedImage, error)
+	SyncPullSecret(ctx context.Context, namespace string, img *ResolvedImage) error
+}
+
+type DomainService interface {
+	AddDomain(ctx context.Context, appID uuid.UUID, hostname, tlsMode string) (*models.Domain, error)
+	AttachPlatformDomain(ctx context.Context, appID uuid.UUID, hostname string) (*models.Domain, error)
+	ListDomains(ctx context.Context, appID uuid.UUID) ([]models.Domain, error)
+	VerifyDomain(ctx context.Context, appID, id uuid.UUID) (*models.Domain, error)
+	UploadCertificate(ctx context.Context, appID, id uuid.UUID, certPEM, keyPEM string) (*models.Domain, error)
+	RemoveDomain(ctx context.Context, appID, id uuid.UUID) error
+	Challenge(d *models.Domain) DomainChallenge
+	RouteApp(ctx context.Context, appID uuid.UUID) error
+}
+
+// LinkService isolates apps from each other with network policies and lets
+// an app reach another through an explicit link.
+type LinkService interface {
+	EnsureNamespacePolicies(ctx context.Context) error
+	CreateLink(ctx context.Context, user *models.User, appID, targetID uuid.UUID, alias string) (*models.AppLink, error)
+	ListLinks(ctx context.Context, appID uuid.UUID) ([]models.AppLink, error)
+	DeleteLink(ctx context.Context, user *models.User, appID, linkID uuid.UUID) error
+}
+
+// QuotaService limits what the apps of a user or team may use according to
+// their plan, and mirrors the limits into k8s ResourceQuotas.
+type QuotaService interface {
+	CheckApp(ctx context.Context, app *models.Application) error
+	CheckVolume(ctx context.Context, appID uuid.UUID) error
+	CheckDomain(ctx context.Context, appID uuid.UUID) error
+	SyncResourceQuota(ctx context.Context, app *models.Application) error
+	GetUserQuota(ctx context.Context, userID uuid.UUID) (*QuotaStatus, error)
+	GetTeamQuota(ctx context.Context, teamID uuid.UUID) (*QuotaStatus, error)
+	SetUserQuota(ctx context.Context, userID uuid.UUID, q models.Quota) (*QuotaStatus, error)
+	SetTeamQuota(ctx context.Context, teamID uuid.UUID, q models.Quota) (*QuotaStatus, error)
+}
+
+// GCService removes the deployment history, logs and k8s objects the
+// retention policy no longer keeps.
+type GCService interface {
+	Run(ctx context.Context, interval time.Duration)
+	Plan(ctx context.Context) (*GCReport, error)
+	Collect(ctx context.Context) (*GCReport, error)
+}
+
+// PreviewEnvService runs a temporary copy of an app for each open pull
+// request against its repository, and destroys it when the pull request is
+// closed or has not been pushed to for the preview TTL.
+type PreviewEnvService interface {
+	OpenPreview(ctx context.Context, user *models.User, parentID uuid.UUID, spec PreviewSpec) (*models.Application, *models.Deployment, error)
+	ListPreviews(ctx context.Context, parentID uuid.UUID) ([]models.Application, error)
+	ClosePreview(ctx context.Context, user *models.User, parentID uuid.UUID, pullRequest int) error
+	VerifyWebhook(payload []byte, signature string) error
+	HandlePullRequest(ctx context.Context, ev PullRequestEvent) ([]models.Application, error)
+	ReapExpired(ctx context.Context, interval time.Duration)
+}
+
+// EnvironmentService runs an app in a pipeline of environments, such as
+// dev, staging and production, and promotes releases along it.
+type EnvironmentService interface {
+	CreateEnvironment(ctx context.Context, user *models.User, appID uuid.UUID, name string, cfg EnvironmentConfig) (*EnvironmentStatus, error)
+	ListEnvironments(ctx context.Context, appID uuid.UUID) ([]EnvironmentStatus, error)
+	Promote(ctx context.Context, user *models.User, appID uuid.UUID, name string) (*models.Environment, *models.Deployment, error)
+}
+
+// ReleaseService keeps the immutable history of what each app ran: its
+// creation, every deploy and config change, and every link or add-on bound
+// or unbound records a numbered release, and any two releases of an app can
+// be compared.
+type ReleaseService interface {
+	Record(ctx context.Context, app *models.Application, image, digest, reason string) (*models.Release, error)
+	RecordConfigChange(ctx context.Context, previous, updated *models.Application) (*models.Release, error)
+	RecordEnvChange(ctx context.Context, app *models.Application, reason string) (*models.Release, error)
+	ListReleases(ctx context.Context, appID uuid.UUID, page repository.Page) (repository.ListResult[models.Release], error)
+	GetRelease(ctx context.Context, appID uuid.UUID, version int) (*models.Release, error)
+	GetReleaseByID(ctx context.Context, id uuid.UUID) (*models.Release, error)
+	DiffReleases(ctx context.Context, appID uuid.UUID, from, to int) (*ReleaseDiff, error)
+}
+
+// ActivatorService scales apps that saw no traffic for their idle timeout to
+// zero and wakes them on their next request. It also puts apps in
+// maintenance, serving a maintenance page in their place.
+type ActivatorService interface {
+	WatchIdle(ctx context.Context, interval time.Duration)
+	Wake(ctx context.Context, host, path string) (*Upstream, error)
+	EnableMaintenance(ctx context.Context, appID uuid.UUID, opts MaintenanceOptions) (*models.AppMaintenance, error)
+	DisableMaintenance(ctx context.Context, appID uuid.UUID) error
+	GetMaintenance(ctx context.Context, appID uuid.UUID) (*models.AppMaintenance, error)
+	MaintenancePage(ctx context.Context, host, clientIP, bypassToken string) (*models.AppMaintenance, error)
+}
+
+// Notifier delivers platform events such as automatic rollbacks.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// ErrorRateSource reports the fraction of a release's requests that failed
+// since a point in time; ok is false when there was no traffic to judge by.
+type ErrorRateSource interface {
+	ErrorRate(ctx context.Context, deploy *models.Deployment, app models.Application, since time.Time) (rate float64, ok bool, err error)
+}
+
+// TrafficSource reports how many requests reached an app through its
+// Ingresses within the last window.
+type TrafficSource interface {
+	Requests(ctx context.Context, app models.Application, window time.Duration) (float64, error)
+}
+
+// DNSResolver looks up the TXT records that prove ownership of a domain;
+// *net.Resolver is one.
+type DNSResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
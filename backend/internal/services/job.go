@@ -0,0 +1,209 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultNamespace = "default"
+
+	labelManagedBy    = "managed-by"
+	labelAppID        = "app-id"
+	managedByPlatform = "mini-paas"
+)
+
+var ErrPodCannotStart = errors.New("pod cannot start")
+
+// podStuckReasons are the waiting reasons of a container that will not start
+// without someone changing the image or the config.
+var podStuckReasons = map[string]bool{
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// jobFinished reports whether a Job has terminated and whether it succeeded.
+func jobFinished(job *batchv1.Job) (done bool, succeeded bool) {
+	for _, c := range job.Status.Conditions {
+		if c.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return true, true
+		case batchv1.JobFailed:
+			return true, false
+		}
+	}
+	return false, false
+}
+
+// readJobLogs returns the output of every pod that belongs to the Job.
+func readJobLogs(ctx context.Context, client *kubernetes.Clientset, namespace, jobName string) ([]string, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list job pods: %w", err)
+	}
+
+	var lines []string
+	for _, pod := range pods.Items {
+		stream, err := client.CoreV1().Pods(namespace).GetLogs(pod.Name, &corev1.PodLogOptions{}).Stream(ctx)
+		if err != nil {
+			return lines, fmt.Errorf("get logs stream: %w", err)
+		}
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		stream.Close()
+	}
+	return lines, nil
+}
+
+// buildJob returns a single-attempt Job that runs command through sh.
+func buildJob(name, image, command string, env []corev1.EnvVar, envFrom []corev1.EnvFromSource, labels map[string]string) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: int32Ptr(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:    "job",
+							Image:   image,
+							Command: []string{"sh", "-c", command},
+							Env:     env,
+							EnvFrom: envFrom,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// waitForJob polls the Job until it completes or fails.
+func waitForJob(ctx context.Context, client *kubernetes.Clientset, namespace, jobName string) (*batchv1.Job, bool, error) {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		job, err := client.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			return nil, false, fmt.Errorf("get job: %w", err)
+		}
+		if done, succeeded := jobFinished(job); done {
+			return job, succeeded, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return job, false, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForJobPod blocks until a pod of the Job has left the Pending phase, so
+// its logs can be streamed. A pod whose container cannot start, such as one
+// whose image cannot be pulled, fails it with ErrPodCannotStart.
+func waitForJobPod(ctx context.Context, client *kubernetes.Clientset, namespace, jobName string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+		})
+		if err != nil {
+			return fmt.Errorf("list job pods: %w", err)
+		}
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != corev1.PodPending {
+				return nil
+			}
+			for _, cs := range pod.Status.ContainerStatuses {
+				if w := cs.State.Waiting; w != nil && podStuckReasons[w.Reason] {
+					return fmt.Errorf("%w: %s: %s", ErrPodCannotStart, w.Reason, w.Message)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// jobExitCode returns the exit code of the Job's last terminated container.
+func jobExitCode(ctx context.Context, client *kubernetes.Clientset, namespace, jobName string) (*int32, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list job pods: %w", err)
+	}
+
+	var code *int32
+	for _, pod := range pods.Items {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Terminated != nil {
+				c := cs.State.Terminated.ExitCode
+				code = &c
+			}
+		}
+	}
+	return code, nil
+}
+
+// livePodSpec returns the pod template of a release's k8s Deployment.
+func livePodSpec(ctx context.Context, client *kubernetes.Clientset, namespace string, deployID uuid.UUID) (*corev1.PodSpec, error) {
+	live, err := client.AppsV1().Deployments(namespace).Get(ctx, deploymentResourceName(deployID), metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &live.Spec.Template.Spec, nil
+}
+
+// releasePods returns the pods of a release's k8s Deployment.
+func releasePods(ctx context.Context, client *kubernetes.Clientset, namespace string, deployID uuid.UUID) ([]corev1.Pod, error) {
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", labelDeploymentID, deployID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list release pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+// podReady reports whether the pod passes its readiness checks.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
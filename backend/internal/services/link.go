@@ -0,0 +1,291 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidLink   = errors.New("invalid link")
+	ErrLinkExists    = errors.New("link already exists")
+	ErrLinkForbidden = errors.New("you cannot manage one of the linked apps")
+)
+
+// annotationLinkEnv lists the config vars of a k8s Deployment that come from
+// the app's links, so they can be replaced when the links change.
+const annotationLinkEnv = "link-env"
+
+var linkAliasRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]{0,39}$`)
+
+type linkService struct {
+	repo        repository.AppLinkRepository
+	appRepo     repository.AppRepository
+	deployRepo  repository.DeploymentRepository
+	releases    ReleaseService
+	teamService TeamService
+	client      *kubernetes.Clientset
+}
+
+func NewLinkService(repo repository.AppLinkRepository, appRepo repository.AppRepository, deployRepo repository.DeploymentRepository, releases ReleaseService, teamService TeamService, client *kubernetes.Clientset) LinkService {
+	return &linkService{
+		repo:        repo,
+		appRepo:     appRepo,
+		deployRepo:  deployRepo,
+		releases:    releases,
+		teamService: teamService,
+		client:      client,
+	}
+}
+
+// EnsureNamespacePolicies applies the namespace's default-deny policies.
+func (s *linkService) EnsureNamespacePolicies(ctx context.Context) error {
+	return ensureNamespacePolicies(ctx, s.client, defaultNamespace)
+}
+
+// CreateLink lets the pods of app reach target. The target's policy allows
+// the traffic right away; the app's running release is restarted with the
+// target's config vars. alias defaults to the target's name.
+func (s *linkService) CreateLink(ctx context.Context, user *models.User, appID, targetID uuid.UUID, alias string) (*models.AppLink, error) {
+	if appID == targetID {
+		return nil, fmt.Errorf("%w: an app cannot link to itself", ErrInvalidLink)
+	}
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.appRepo.GetByID(ctx, targetID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return nil, err
+	}
+	if err := s.requireAccess(ctx, user, target); err != nil {
+		return nil, err
+	}
+	if appNamespace(app) != appNamespace(target) {
+		return nil, fmt.Errorf("%w: %s and %s run in different namespaces", ErrInvalidLink, app.Name, target.Name)
+	}
+
+	if alias == "" {
+		alias = envAlias(target.Name)
+	}
+	if !linkAliasRe.MatchString(alias) {
+		return nil, fmt.Errorf("%w: alias %q must be upper case letters, digits and underscores, starting with a letter", ErrInvalidLink, alias)
+	}
+	existing, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range existing {
+		if l.TargetAppID == targetID {
+			return nil, fmt.Errorf("%w: the app is already linked to %s", ErrLinkExists, target.Name)
+		}
+		if l.Alias == alias {
+			return nil, fmt.Errorf("%w: alias %s is taken", ErrLinkExists, alias)
+		}
+	}
+
+	link := &models.AppLink{AppID: appID, TargetAppID: targetID, Alias: alias}
+	if err := s.repo.Create(ctx, link); err != nil {
+		return nil, err
+	}
+	if _, err := s.releases.RecordEnvChange(ctx, app, ReleaseLinkChange); err != nil {
+		return nil, err
+	}
+	if err := ensureAppService(ctx, s.client, appNamespace(target), appResourceName(targetID), target.Config); err != nil {
+		return nil, err
+	}
+	if err := s.applyPolicy(ctx, target); err != nil {
+		return nil, err
+	}
+	s.syncLiveEnv(ctx, app)
+	return link, nil
+}
+
+func (s *linkService) ListLinks(ctx context.Context, appID uuid.UUID) ([]models.AppLink, error) {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByApp(ctx, appID)
+}
+
+// DeleteLink cuts the app off from the link's target again.
+func (s *linkService) DeleteLink(ctx context.Context, user *models.User, appID, linkID uuid.UUID) error {
+	link, err := s.repo.GetByID(ctx, linkID)
+	if err != nil {
+		return err
+	}
+	if link.AppID != appID {
+		return repository.ErrNotFound
+	}
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(ctx, link.ID); err != nil {
+		return err
+	}
+	if _, err := s.releases.RecordEnvChange(ctx, app, ReleaseLinkChange); err != nil {
+		return err
+	}
+	target, err := s.appRepo.GetByID(ctx, link.TargetAppID)
+	if err == nil {
+		if err := s.applyPolicy(ctx, target); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	s.syncLiveEnv(ctx, app)
+	return nil
+}
+
+// requireAccess returns ErrLinkForbidden unless user may manage app.
+func (s *linkService) requireAccess(ctx context.Context, user *models.User, app *models.Application) error {
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLinkForbidden, app.Name)
+	}
+	return nil
+}
+
+// canManageApp reports whether user may manage app: the app's team members,
+// or its owner for apps without a team.
+func canManageApp(ctx context.Context, teams TeamService, user *models.User, app *models.Application) (bool, error) {
+	switch {
+	case app.TeamID != nil:
+		err := teams.RequireMember(ctx, *app.TeamID, user.ID)
+		if errors.Is(err, ErrNotTeamMember) {
+			return false, nil
+		}
+		return err == nil, err
+	case app.OwnerID != nil && *app.OwnerID != user.ID:
+		return false, nil
+	}
+	return true, nil
+}
+
+// applyPolicy applies the network policy of target with the apps linked to it.
+func (s *linkService) applyPolicy(ctx context.Context, target *models.Application) error {
+	return applyAppNetworkPolicy(ctx, s.client, s.repo, appNamespace(target), target.ID, target.Config)
+}
+
+// syncLiveEnv rewrites the link config vars of the app's running k8s
+// Deployment, which restarts its pods. Failing to is logged; the next release
+// gets them anyway.
+func (s *linkService) syncLiveEnv(ctx context.Context, app *models.Application) {
+	appID := app.ID
+	deploy, err := s.deployRepo.GetLatestByApp(ctx, appID, "RUNNING")
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			log.Printf("app %s: sync link env: %v", appID, err)
+		}
+		return
+	}
+	links, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		log.Printf("app %s: sync link env: %v", appID, err)
+		return
+	}
+
+	namespace := appNamespace(app)
+	deployments := s.client.AppsV1().Deployments(namespace)
+	live, err := deployments.Get(ctx, deploymentResourceName(deploy.ID), metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Printf("app %s: sync link env: %v", appID, err)
+		}
+		return
+	}
+	if len(live.Spec.Template.Spec.Containers) == 0 {
+		return
+	}
+	c := &live.Spec.Template.Spec.Containers[0]
+	c.Env = withLinkEnv(c.Env, live.Annotations[annotationLinkEnv], namespace, links)
+	if live.Annotations == nil {
+		live.Annotations = map[string]string{}
+	}
+	live.Annotations[annotationLinkEnv] = linkEnvNames(namespace, links)
+	if _, err := deployments.Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+		log.Printf("app %s: sync link env: %v", appID, err)
+	}
+}
+
+// applyAppNetworkPolicy applies the policy of an app with the apps that
+// currently link to it.
+func applyAppNetworkPolicy(ctx context.Context, client *kubernetes.Clientset, links repository.AppLinkRepository, namespace string, appID uuid.UUID, cfg models.AppConfig) error {
+	incoming, err := links.ListByTarget(ctx, appID)
+	if err != nil {
+		return err
+	}
+	from := make([]uuid.UUID, 0, len(incoming))
+	for _, l := range incoming {
+		from = append(from, l.AppID)
+	}
+	return applyNetworkPolicy(ctx, client, namespace, buildAppNetworkPolicy(appID, cfg, from))
+}
+
+// withLinkEnv replaces the link config vars in env, those named in managed,
+// with those of links and keeps every other variable.
+func withLinkEnv(env []corev1.EnvVar, managed, namespace string, links []models.AppLink) []corev1.EnvVar {
+	old := map[string]bool{}
+	for _, name := range strings.Split(managed, ",") {
+		old[name] = true
+	}
+	out := make([]corev1.EnvVar, 0, len(env)+3*len(links))
+	for _, e := range env {
+		if !old[e.Name] {
+			out = append(out, e)
+		}
+	}
+	return append(out, linkEnvVars(namespace, links)...)
+}
+
+func linkEnvNames(namespace string, links []models.AppLink) string {
+	var names []string
+	for _, e := range linkEnvVars(namespace, links) {
+		names = append(names, e.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// envAlias turns an app name into a config var prefix: my-api becomes MY_API.
+func envAlias(name string) string {
+	alias := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	if alias == "" || alias[0] < 'A' || alias[0] > 'Z' {
+		alias = "APP_" + alias
+	}
+	if len(alias) > 40 {
+		alias = alias[:40]
+	}
+	return alias
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidMaintenance = errors.New("invalid maintenance settings")
+	ErrNoPlatformEndpoint = errors.New("ACTIVATOR_SERVICE is not set, there is no endpoint to serve the maintenance page")
+)
+
+const (
+	// MaintenanceBypassHeader carries the token that lets a client past the
+	// maintenance page.
+	MaintenanceBypassHeader = "X-Maintenance-Bypass"
+
+	defaultMaintenanceMessage = "This app is down for maintenance. Please check back soon."
+	defaultRetryAfterSeconds  = 300
+	maxMaintenanceMessage     = 2000
+)
+
+// MaintenanceOptions are the settings of a maintenance window; zero values
+// use the defaults and an empty bypass token is generated.
+type MaintenanceOptions struct {
+	Message           string
+	RetryAfterSeconds int32
+	AllowIPs          []string
+	BypassToken       string
+}
+
+// EnableMaintenance routes the app's domains to the maintenance page. The app
+// keeps running; enabling it again replaces the settings.
+func (s *activatorService) EnableMaintenance(ctx context.Context, appID uuid.UUID, opts MaintenanceOptions) (*models.AppMaintenance, error) {
+	if !s.enabled {
+		return nil, ErrNoPlatformEndpoint
+	}
+	if len(opts.Message) > maxMaintenanceMessage {
+		return nil, fmt.Errorf("%w: message is longer than %d characters", ErrInvalidMaintenance, maxMaintenanceMessage)
+	}
+	if opts.RetryAfterSeconds < 0 {
+		return nil, fmt.Errorf("%w: retry_after_seconds must not be negative", ErrInvalidMaintenance)
+	}
+	for _, a := range opts.AllowIPs {
+		if _, err := parseAllowedIP(a); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidMaintenance, err)
+		}
+	}
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := models.AppMaintenance{
+		Enabled:           true,
+		Message:           opts.Message,
+		RetryAfterSeconds: opts.RetryAfterSeconds,
+		AllowIPs:          opts.AllowIPs,
+		BypassToken:       opts.BypassToken,
+		Since:             app.Maintenance.Since,
+	}
+	if m.Message == "" {
+		m.Message = defaultMaintenanceMessage
+	}
+	if m.RetryAfterSeconds == 0 {
+		m.RetryAfterSeconds = defaultRetryAfterSeconds
+	}
+	if m.BypassToken == "" {
+		if m.BypassToken, err = randomPassword(); err != nil {
+			return nil, err
+		}
+	}
+	if !app.Maintenance.Enabled || m.Since == nil {
+		now := time.Now()
+		m.Since = &now
+	}
+
+	if err := s.appRepo.SetMaintenance(ctx, appID, m); err != nil {
+		return nil, err
+	}
+	if err := s.domains.RouteApp(ctx, appID); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// DisableMaintenance routes the app's domains back to the app.
+func (s *activatorService) DisableMaintenance(ctx context.Context, appID uuid.UUID) error {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return err
+	}
+	if err := s.appRepo.SetMaintenance(ctx, appID, models.AppMaintenance{}); err != nil {
+		return err
+	}
+	return s.domains.RouteApp(ctx, appID)
+}
+
+func (s *activatorService) GetMaintenance(ctx context.Context, appID uuid.UUID) (*models.AppMaintenance, error) {
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	return &app.Maintenance, nil
+}
+
+// MaintenancePage returns the maintenance settings when a request for host
+// from clientIP should get the maintenance page, and nil when it may reach the
+// app.
+func (s *activatorService) MaintenancePage(ctx context.Context, host, clientIP, bypassToken string) (*models.AppMaintenance, error) {
+	app, err := s.appForHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	m := app.Maintenance
+	if !m.Enabled {
+		return nil, nil
+	}
+	if bypassToken != "" && bypassToken == m.BypassToken {
+		return nil, nil
+	}
+	if ip := net.ParseIP(clientIP); ip != nil {
+		for _, a := range m.AllowIPs {
+			if n, err := parseAllowedIP(a); err == nil && n.Contains(ip) {
+				return nil, nil
+			}
+		}
+	}
+	return &m, nil
+}
+
+// parseAllowedIP reads an allowlist entry, an address or a CIDR.
+func parseAllowedIP(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a valid CIDR", s)
+		}
+		return n, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not a valid IP address", s)
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// appForHost returns the app a verified domain belongs to.
+func (s *activatorService) appForHost(ctx context.Context, host string) (*models.Application, error) {
+	domain, err := s.domainRepo.GetByHostname(ctx, strings.ToLower(host))
+	if err != nil {
+		return nil, err
+	}
+	if domain.VerifiedAt == nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.appRepo.GetByID(ctx, domain.AppID)
+}
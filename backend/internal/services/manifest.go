@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// annotation the deployment controller bumps on every rollout
+	annotationRevision = "deployment.kubernetes.io/revision"
+
+	defaultAppPort = 8080
+)
+
+// ReleaseManifests is the set of Kubernetes objects one release consists of.
+type ReleaseManifests struct {
+	Deployment *appsv1.Deployment
+	// ReleaseJob is nil when the app has no release command
+	ReleaseJob *batchv1.Job
+	// PreviewService is set for blue/green releases and reaches only the new pods
+	PreviewService *corev1.Service
+}
+
+// Objects returns the manifests in the order they are applied.
+func (m *ReleaseManifests) Objects() []runtime.Object {
+	var objs []runtime.Object
+	if m.ReleaseJob != nil {
+		objs = append(objs, m.ReleaseJob)
+	}
+	objs = append(objs, m.Deployment)
+	if m.PreviewService != nil {
+		objs = append(objs, m.PreviewService)
+	}
+	return objs
+}
+
+// ManifestDiff is the difference between a live object and what a deploy would apply.
+type ManifestDiff struct {
+	Kind     string
+	Name     string
+	LiveName string
+	Diff     string
+}
+
+// ManifestPreview is what a deploy would apply, without applying it.
+type ManifestPreview struct {
+	Objects []runtime.Object
+	// DryRun is set when the API server accepted the objects in a server-side dry-run
+	DryRun      bool
+	DryRunError string
+	Diffs       []ManifestDiff
+}
+
+// YAML renders the previewed objects as a multi-document YAML stream.
+func (p *ManifestPreview) YAML() ([]byte, error) {
+	return manifestsYAML(p.Objects)
+}
+
+// releaseInput is everything the manifests of a release are rendered from.
+type releaseInput struct {
+	App            models.Application
+	Deploy         *models.Deployment
+	ReleaseCommand string
+	Config         models.AppConfig
+	PullSecret     string
+	Volumes        []models.Volume
+	AddOns         []models.AddOn
+	Links          []models.AppLink
+	// PriorityClass puts the pods under a ResourceQuota; empty when the app
+	// has no quota
+	PriorityClass string
+}
+
+// renderManifests builds the Kubernetes objects of a release. It has no side
+// effects so the same output can be previewed and applied.
+func renderManifests(in releaseInput) *ReleaseManifests {
+	podVols, mounts := podVolumes(in.Volumes)
+	cfg := in.Config
+	port := primaryHTTPPort(cfg)
+	replicas := int32(1)
+	if cfg.Replicas != nil {
+		replicas = *cfg.Replicas
+	}
+	// add-on bindings come last so they win over a stale value in the config
+	namespace := appNamespace(&in.App)
+	env := append(configEnvVars(cfg.Env), linkEnvVars(namespace, in.Links)...)
+	env = append(env, addOnEnvVars(in.AddOns)...)
+
+	deployment := &appsv1.Deployment{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: deploymentResourceName(in.Deploy.ID),
+			Labels: map[string]string{
+				"app": in.App.Name,
+			},
+			Annotations: map[string]string{annotationLinkEnv: linkEnvNames(namespace, in.Links)},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: int32Ptr(replicas),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": in.App.Name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					// the release label tells this release's pods from those of the previous one;
+					// network policies select the app's pods by its id
+					Labels: map[string]string{"app": in.App.Name, labelAppID: in.App.ID.String(), labelDeploymentID: in.Deploy.ID.String()},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:           in.App.Name,
+							Image:          in.Deploy.PinnedImage(),
+							Ports:          containerPorts(cfg),
+							Env:            env,
+							Resources:      resourceRequirements(cfg.Resources),
+							ReadinessProbe: httpProbe(cfg.Readiness, port),
+							LivenessProbe:  httpProbe(cfg.Liveness, port),
+							VolumeMounts:   mounts,
+						},
+					},
+					Volumes:          podVols,
+					ImagePullSecrets: pullSecrets(in.PullSecret),
+				},
+			},
+		},
+	}
+	// a ReadWriteOnce claim can only be attached to one pod, so old pods go first
+	if hasReadWriteOnce(in.Volumes) {
+		deployment.Spec.Strategy = appsv1.DeploymentStrategy{Type: appsv1.RecreateDeploymentStrategyType}
+	}
+	if in.PriorityClass != "" {
+		pod := &deployment.Spec.Template.Spec
+		pod.PriorityClassName = in.PriorityClass
+		pod.Containers[0].Resources.Requests = quotaRequests(cfg.Resources)
+	}
+
+	m := &ReleaseManifests{Deployment: deployment}
+	if color := in.Deploy.Color; color != "" {
+		// each color selects only its own pods so blue and green can run side by side
+		deployment.Spec.Selector.MatchLabels[labelColor] = color
+		deployment.Spec.Template.Labels[labelColor] = color
+		m.PreviewService = buildAppService(previewServiceName(in.App.Name), map[string]string{
+			"app":             in.App.Name,
+			labelDeploymentID: in.Deploy.ID.String(),
+		}, appServicePorts(cfg))
+	}
+	if in.ReleaseCommand != "" {
+		labels := map[string]string{
+			labelManagedBy:    managedByPlatform,
+			labelAppID:        in.App.ID.String(),
+			labelDeploymentID: in.Deploy.ID.String(),
+		}
+		// migrations need the same config and add-on bindings as the app itself
+		m.ReleaseJob = buildJob(releaseJobName(in.Deploy.ID), in.Deploy.PinnedImage(), in.ReleaseCommand, env, nil, labels)
+		m.ReleaseJob.TypeMeta = metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"}
+		m.ReleaseJob.Spec.Template.Spec.ImagePullSecrets = pullSecrets(in.PullSecret)
+	}
+	return m
+}
+
+// renderRelease loads the app's volumes and add-ons and renders the release.
+// Settings come from the stored app, the image from the deploy request.
+func (s *deploymentService) renderRelease(ctx context.Context, deploy *models.Deployment, app models.Application, stored *models.Application, image *ResolvedImage) (*ReleaseManifests, error) {
+	if stored.Config.IsBlueGreen() && deploy.Color == "" {
+		color, err := s.nextColor(ctx, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		deploy.Color = color
+	}
+	volumes, err := s.volumeRepo.ListByApp(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	addOns, err := s.addOnRepo.ListByApp(ctx, app.ID, activeAddOnStatuses...)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.linkRepo.ListByApp(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	return renderManifests(releaseInput{
+		App:            app,
+		Deploy:         deploy,
+		ReleaseCommand: stored.ReleaseCommand,
+		Config:         stored.Config,
+		PullSecret:     image.PullSecret,
+		Volumes:        volumes,
+		AddOns:         addOns,
+		Links:          links,
+		PriorityClass:  quotaPriorityClass(stored),
+	}), nil
+}
+
+// PreviewDeploy renders the objects a deploy of app would create. When the
+// cluster is reachable the objects are also validated with a server-side
+// dry-run and diffed against the app's running release.
+func (s *deploymentService) PreviewDeploy(ctx context.Context, app models.Application) (*ManifestPreview, error) {
+	stored, err := s.appRepo.GetByID(ctx, app.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := s.registry.ResolveImage(ctx, stored, app.ImageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing is stored, the id only names the objects
+	deploy := &models.Deployment{ID: uuid.New(), AppID: app.ID, ImageURL: app.ImageURL, ImageDigest: image.Digest, Status: "PENDING"}
+	// rendered from the app the rollout sees, so the objects are named and
+	// placed as a deploy would create them
+	release := s.releaseApp(ctx, deploy)
+	m, err := s.renderRelease(ctx, deploy, release, stored, image)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &ManifestPreview{Objects: m.Objects()}
+	dryRun := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+
+	// the preview is still useful without a cluster, so dry-run errors are reported, not returned
+	namespace := appNamespace(&release)
+	planned, err := s.client.AppsV1().Deployments(namespace).Create(ctx, m.Deployment, dryRun)
+	if err != nil {
+		preview.DryRunError = err.Error()
+		return preview, nil
+	}
+	if m.ReleaseJob != nil {
+		if _, err := s.client.BatchV1().Jobs(namespace).Create(ctx, m.ReleaseJob, dryRun); err != nil {
+			preview.DryRunError = err.Error()
+			return preview, nil
+		}
+	}
+	preview.DryRun = true
+
+	live, err := s.liveDeployment(ctx, namespace, app.ID)
+	if err != nil {
+		return nil, err
+	}
+	planned.TypeMeta = m.Deployment.TypeMeta
+	diff, err := diffObjects(live, planned)
+	if err != nil {
+		return nil, err
+	}
+	d := ManifestDiff{Kind: "Deployment", Name: planned.Name, Diff: diff}
+	if live != nil {
+		d.LiveName = live.Name
+	}
+	preview.Diffs = append(preview.Diffs, d)
+	return preview, nil
+}
+
+// liveDeployment returns the k8s Deployment of the app's running release, or
+// nil when nothing is running.
+func (s *deploymentService) liveDeployment(ctx context.Context, namespace string, appID uuid.UUID) (*appsv1.Deployment, error) {
+	current, err := s.repo.GetLatestByApp(ctx, appID, "RUNNING")
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := s.client.AppsV1().Deployments(namespace).Get(ctx, deploymentResourceName(current.ID), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get live deployment: %w", err)
+	}
+	live.TypeMeta = metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"}
+	return live, nil
+}
+
+// diffObjects diffs two Deployments as YAML, ignoring fields the cluster
+// manages. A nil live object diffs against an empty document.
+func diffObjects(live, planned *appsv1.Deployment) (string, error) {
+	var from, to []byte
+	var err error
+	fromName := "live"
+	if live != nil {
+		fromName = "live/" + live.Name
+		if from, err = yaml.Marshal(normalizeDeployment(live)); err != nil {
+			return "", err
+		}
+	}
+	if to, err = yaml.Marshal(normalizeDeployment(planned)); err != nil {
+		return "", err
+	}
+	return unifiedDiff(fromName, "dry-run/"+planned.Name, string(from), string(to)), nil
+}
+
+func normalizeDeployment(d *appsv1.Deployment) *appsv1.Deployment {
+	d = d.DeepCopy()
+	d.Status = appsv1.DeploymentStatus{}
+	d.UID = ""
+	d.ResourceVersion = ""
+	d.Generation = 0
+	d.CreationTimestamp = metav1.Time{}
+	d.ManagedFields = nil
+	d.SelfLink = ""
+	delete(d.Annotations, annotationRevision)
+	if len(d.Annotations) == 0 {
+		d.Annotations = nil
+	}
+	return d
+}
+
+func manifestsYAML(objs []runtime.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		out, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+func configEnvVars(env map[string]string) []corev1.EnvVar {
+	vars := make([]corev1.EnvVar, 0, len(env))
+	for _, k := range sortedKeys(env) {
+		vars = append(vars, corev1.EnvVar{Name: k, Value: env[k]})
+	}
+	return vars
+}
+
+func resourceRequirements(r models.AppResources) corev1.ResourceRequirements {
+	var req corev1.ResourceRequirements
+	set := func(list *corev1.ResourceList, name corev1.ResourceName, value string) {
+		q, err := resource.ParseQuantity(value)
+		if value == "" || err != nil {
+			return
+		}
+		if *list == nil {
+			*list = corev1.ResourceList{}
+		}
+		(*list)[name] = q
+	}
+	set(&req.Requests, corev1.ResourceCPU, r.CPURequest)
+	set(&req.Requests, corev1.ResourceMemory, r.MemoryRequest)
+	set(&req.Limits, corev1.ResourceCPU, r.CPULimit)
+	set(&req.Limits, corev1.ResourceMemory, r.MemoryLimit)
+	return req
+}
+
+func httpProbe(p *models.AppProbe, port int32) *corev1.Probe {
+	if p == nil {
+		return nil
+	}
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{Path: p.Path, Port: intstr.FromInt(int(port))},
+		},
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+func pullSecrets(name string) []corev1.LocalObjectReference {
+	if name == "" {
+		return nil
+	}
+	return []corev1.LocalObjectReference{{Name: name}}
+}
+
+func releaseJobName(deployID uuid.UUID) string {
+	return fmt.Sprintf("release-%s", deployID.String()[0:8])
+}
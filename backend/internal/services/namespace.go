@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// appNamespace is the namespace the objects of app live in.
+func appNamespace(app *models.Application) string {
+	if app.Namespace != "" {
+		return app.Namespace
+	}
+	return defaultNamespace
+}
+
+// namespaceFor names a namespace of app's own as prefix<app>-<id>suffix.
+// The id keeps apart apps of the same name; the name part is shortened to
+// fit the 63 characters of a namespace name.
+func namespaceFor(app *models.Application, prefix, suffix string) string {
+	label := dnsLabel(app.Name)
+	if label == "" {
+		label = "app"
+	}
+	suffix = "-" + app.ID.String()[0:8] + suffix
+	if room := 63 - len(prefix) - len(suffix); len(label) > room {
+		label = strings.TrimRight(label[:room], "-")
+	}
+	return prefix + label + suffix
+}
+
+// ensureNamespace creates namespace unless it exists and applies the
+// policies every namespace apps run in has.
+func ensureNamespace(ctx context.Context, client *kubernetes.Clientset, namespace string) error {
+	if namespace != defaultNamespace {
+		ns := &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   namespace,
+				Labels: map[string]string{labelManagedBy: managedByPlatform},
+			},
+		}
+		_, err := client.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create k8s namespace %s: %w", namespace, err)
+		}
+	}
+	return ensureNamespacePolicies(ctx, client, namespace)
+}
+
+// deleteNamespace removes namespace with everything in it. The default
+// namespace is shared and never removed.
+func deleteNamespace(ctx context.Context, client *kubernetes.Clientset, namespace string) error {
+	if namespace == "" || namespace == defaultNamespace {
+		return nil
+	}
+	err := client.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("delete k8s namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// namespaceOf returns the namespace of the objects of the app appID.
+func namespaceOf(ctx context.Context, apps repository.AppRepository, appID uuid.UUID) (string, error) {
+	app, err := apps.GetByID(ctx, appID)
+	if err != nil {
+		return "", err
+	}
+	return appNamespace(app), nil
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	defaultDenyPolicyName    = "default-deny-ingress"
+	allowIngressPolicyName   = "allow-from-ingress-controller"
+	allowAPIServerPolicyName = "allow-from-api-server"
+	defaultIngressNamespace  = "ingress-nginx"
+)
+
+// namespacePolicies deny all traffic into the namespace's pods except from
+// the ingress controller and the API server, which may reach the pods of
+// every app: the activator and the blue/green preview go through the API
+// server's service proxy. Traffic between apps is allowed by the policy of
+// each app.
+func namespacePolicies(ingressNamespace string, apiServerCIDRs []string) []*networkingv1.NetworkPolicy {
+	meta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Labels: map[string]string{labelManagedBy: managedByPlatform}}
+	}
+	// app pods carry their release's id, add-on and job pods do not
+	appPods := metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: labelDeploymentID, Operator: metav1.LabelSelectorOpExists}},
+	}
+	policies := []*networkingv1.NetworkPolicy{
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+			ObjectMeta: meta(defaultDenyPolicyName),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			},
+		},
+		{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+			ObjectMeta: meta(allowIngressPolicyName),
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: appPods,
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+				Ingress: []networkingv1.NetworkPolicyIngressRule{{
+					From: []networkingv1.NetworkPolicyPeer{{
+						NamespaceSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{"kubernetes.io/metadata.name": ingressNamespace},
+						},
+					}},
+				}},
+			},
+		},
+	}
+	if len(apiServerCIDRs) == 0 {
+		// a rule without peers would let everything in
+		return policies
+	}
+
+	rule := networkingv1.NetworkPolicyIngressRule{}
+	for _, cidr := range apiServerCIDRs {
+		rule.From = append(rule.From, networkingv1.NetworkPolicyPeer{IPBlock: &networkingv1.IPBlock{CIDR: cidr}})
+	}
+	return append(policies, &networkingv1.NetworkPolicy{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: meta(allowAPIServerPolicyName),
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: appPods,
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     []networkingv1.NetworkPolicyIngressRule{rule},
+		},
+	})
+}
+
+// apiServerCIDRs are where the API server's service proxy connects to pods
+// from: API_SERVER_CIDRS, comma separated, where the proxy runs elsewhere
+// than the API server, else the addresses behind the kubernetes service.
+func apiServerCIDRs(ctx context.Context, client *kubernetes.Clientset) ([]string, error) {
+	if v := os.Getenv("API_SERVER_CIDRS"); v != "" {
+		var cidrs []string
+		for _, cidr := range strings.Split(v, ",") {
+			if cidr = strings.TrimSpace(cidr); cidr != "" {
+				cidrs = append(cidrs, cidr)
+			}
+		}
+		return cidrs, nil
+	}
+
+	endpoints, err := client.CoreV1().Endpoints(metav1.NamespaceDefault).Get(ctx, "kubernetes", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get k8s api server endpoints: %w", err)
+	}
+	var cidrs []string
+	for _, subset := range endpoints.Subsets {
+		for _, addr := range subset.Addresses {
+			if strings.Contains(addr.IP, ":") {
+				cidrs = append(cidrs, addr.IP+"/128")
+			} else {
+				cidrs = append(cidrs, addr.IP+"/32")
+			}
+		}
+	}
+	return cidrs, nil
+}
+
+// buildAppNetworkPolicy lets traffic into the pods of an app from: the app's
+// own pods, jobs and add-ons; the apps linked to it, on the ports the app
+// declares; and anywhere on the TCP and UDP ports it exposes.
+func buildAppNetworkPolicy(appID uuid.UUID, cfg models.AppConfig, linkedFrom []uuid.UUID) *networkingv1.NetworkPolicy {
+	appName := appResourceName(appID)
+	rules := []networkingv1.NetworkPolicyIngressRule{{
+		From: []networkingv1.NetworkPolicyPeer{appPeer(appID)},
+	}}
+
+	var declared, exposed []networkingv1.NetworkPolicyPort
+	for _, p := range appPorts(cfg) {
+		proto := transportProtocol(p)
+		port := intstr.FromInt(int(p.Port))
+		np := networkingv1.NetworkPolicyPort{Protocol: &proto, Port: &port}
+		declared = append(declared, np)
+		if p.Protocol != models.PortHTTP {
+			exposed = append(exposed, np)
+		}
+	}
+	if len(linkedFrom) > 0 {
+		rule := networkingv1.NetworkPolicyIngressRule{Ports: declared}
+		for _, id := range linkedFrom {
+			rule.From = append(rule.From, appPeer(id))
+		}
+		rules = append(rules, rule)
+	}
+	if len(exposed) > 0 {
+		// node ports and load balancers are reached from outside the cluster
+		rules = append(rules, networkingv1.NetworkPolicyIngressRule{Ports: exposed})
+	}
+
+	return &networkingv1.NetworkPolicy{
+		TypeMeta: metav1.TypeMeta{APIVersion: "networking.k8s.io/v1", Kind: "NetworkPolicy"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   appName,
+			Labels: map[string]string{labelManagedBy: managedByPlatform, labelAppID: appID.String(), "app": appName},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{labelAppID: appID.String()}},
+			PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeIngress},
+			Ingress:     rules,
+		},
+	}
+}
+
+// appPeer selects every pod of an app: its releases, jobs and add-ons.
+func appPeer(appID uuid.UUID) networkingv1.NetworkPolicyPeer {
+	return networkingv1.NetworkPolicyPeer{
+		PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{labelAppID: appID.String()}},
+	}
+}
+
+// ensureNamespacePolicies applies the policies every namespace apps run in has.
+func ensureNamespacePolicies(ctx context.Context, client *kubernetes.Clientset, namespace string) error {
+	ingressNamespace := os.Getenv("INGRESS_NAMESPACE")
+	if ingressNamespace == "" {
+		ingressNamespace = defaultIngressNamespace
+	}
+	cidrs, err := apiServerCIDRs(ctx, client)
+	if err != nil {
+		return err
+	}
+	for _, np := range namespacePolicies(ingressNamespace, cidrs) {
+		if err := applyNetworkPolicy(ctx, client, namespace, np); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyNetworkPolicy(ctx context.Context, client *kubernetes.Clientset, namespace string, np *networkingv1.NetworkPolicy) error {
+	policies := client.NetworkingV1().NetworkPolicies(namespace)
+	live, err := policies.Get(ctx, np.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = policies.Create(ctx, np, metav1.CreateOptions{})
+	} else if err == nil {
+		live.Labels = np.Labels
+		live.Spec = np.Spec
+		_, err = policies.Update(ctx, live, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("apply k8s network policy %s: %w", np.Name, err)
+	}
+	return nil
+}
+
+// linkEnvVars tell a linking app where each of its linked apps is served;
+// linked apps share the namespace of the app.
+func linkEnvVars(namespace string, links []models.AppLink) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, 3*len(links))
+	for _, l := range links {
+		host := fmt.Sprintf("%s.%s.svc.cluster.local", appResourceName(l.TargetAppID), namespace)
+		env = append(env,
+			corev1.EnvVar{Name: l.Alias + "_URL", Value: "http://" + host},
+			corev1.EnvVar{Name: l.Alias + "_HOST", Value: host},
+			corev1.EnvVar{Name: l.Alias + "_PORT", Value: "80"},
+		)
+	}
+	return env
+}
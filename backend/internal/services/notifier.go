@@ -0,0 +1,72 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Notification is a platform event the people behind an app should hear about.
+type Notification struct {
+	Event        string    `json:"event"`
+	AppID        uuid.UUID `json:"app_id"`
+	DeploymentID uuid.UUID `json:"deployment_id"`
+	Message      string    `json:"message"`
+	Time         time.Time `json:"time"`
+}
+
+const eventDeploymentRolledBack = "deployment.rolled_back"
+
+// NewNotifierFromEnv posts notifications to NOTIFY_WEBHOOK_URL, or only logs
+// them when it is not set.
+func NewNotifierFromEnv() Notifier {
+	if url := os.Getenv("NOTIFY_WEBHOOK_URL"); url != "" {
+		return NewWebhookNotifier(url)
+	}
+	return logNotifier{}
+}
+
+// NewWebhookNotifier posts each notification as JSON to url.
+func NewWebhookNotifier(url string) Notifier {
+	return &webhookNotifier{url: url, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type webhookNotifier struct {
+	url  string
+	http *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, note Notification) error {
+	body, err := json.Marshal(note)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("post notification: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("post notification: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, note Notification) error {
+	log.Printf("notify %s: app %s deployment %s: %s", note.Event, note.AppID, note.DeploymentID, note.Message)
+	return nil
+}
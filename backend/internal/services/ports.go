@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const labelPortName = "port-name"
+
+// appPorts returns the ports the app listens on with their defaults filled
+// in. An app that declares none listens for HTTP on its port.
+func appPorts(cfg models.AppConfig) []models.AppPort {
+	if len(cfg.Ports) == 0 {
+		port := cfg.Port
+		if port == 0 {
+			port = defaultAppPort
+		}
+		return []models.AppPort{{Name: servicePortName, Port: port, Protocol: models.PortHTTP, Path: "/"}}
+	}
+	ports := make([]models.AppPort, 0, len(cfg.Ports))
+	for _, p := range cfg.Ports {
+		if p.Protocol == "" {
+			p.Protocol = models.PortHTTP
+		}
+		if p.Protocol == models.PortHTTP && p.Path == "" {
+			p.Path = "/"
+		}
+		if p.Protocol != models.PortHTTP && p.Expose == "" {
+			p.Expose = models.ExposeNodePort
+		}
+		ports = append(ports, p)
+	}
+	return ports
+}
+
+// primaryHTTPPort is the port health checks go to and the app's Service
+// serves as "http". It is the first HTTP port, or the first port of an app
+// that has none.
+func primaryHTTPPort(cfg models.AppConfig) int32 {
+	ports := appPorts(cfg)
+	for _, p := range ports {
+		if p.Protocol == models.PortHTTP {
+			return p.Port
+		}
+	}
+	return ports[0].Port
+}
+
+// appServicePorts are the ports of the app's Service: the first HTTP port as
+// "http" on port 80, any other under its own name and number. TCP and UDP
+// ports have Services of their own.
+func appServicePorts(cfg models.AppConfig) []corev1.ServicePort {
+	var out []corev1.ServicePort
+	for _, p := range appPorts(cfg) {
+		if p.Protocol != models.PortHTTP {
+			continue
+		}
+		sp := corev1.ServicePort{Name: p.Name, Port: p.Port, TargetPort: intstr.FromInt(int(p.Port))}
+		if len(out) == 0 {
+			sp.Name, sp.Port = servicePortName, 80
+		}
+		out = append(out, sp)
+	}
+	return out
+}
+
+// servicePortFor is the name of the app Service port an HTTP port is served on.
+func servicePortFor(cfg models.AppConfig, port models.AppPort) string {
+	for _, sp := range appServicePorts(cfg) {
+		if sp.TargetPort.IntVal == port.Port {
+			return sp.Name
+		}
+	}
+	return servicePortName
+}
+
+func containerPorts(cfg models.AppConfig) []corev1.ContainerPort {
+	var out []corev1.ContainerPort
+	for _, p := range appPorts(cfg) {
+		out = append(out, corev1.ContainerPort{Name: p.Name, ContainerPort: p.Port, Protocol: transportProtocol(p)})
+	}
+	return out
+}
+
+func transportProtocol(p models.AppPort) corev1.Protocol {
+	if p.Protocol == models.PortUDP {
+		return corev1.ProtocolUDP
+	}
+	return corev1.ProtocolTCP
+}
+
+// buildPortService exposes a TCP or UDP port outside the cluster.
+func buildPortService(appName string, selector map[string]string, p models.AppPort) *corev1.Service {
+	return &corev1.Service{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Service"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   portServiceName(appName, p.Name),
+			Labels: map[string]string{labelManagedBy: managedByPlatform, "app": appName, labelPortName: p.Name},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceType(p.Expose),
+			Selector: selector,
+			Ports: []corev1.ServicePort{{
+				Name:       p.Name,
+				Protocol:   transportProtocol(p),
+				Port:       p.Port,
+				TargetPort: intstr.FromInt(int(p.Port)),
+			}},
+		},
+	}
+}
+
+func portServiceName(appName, portName string) string {
+	return appName + "-" + portName
+}
+
+// exposePorts points the Services of the app's TCP and UDP ports at the pods
+// matching selector, removes those of ports no longer declared and records
+// where each port can be reached.
+func (s *deploymentService) exposePorts(ctx context.Context, namespace string, appID uuid.UUID, cfg models.AppConfig, selector map[string]string) error {
+	appName := appResourceName(appID)
+	declared := map[string]bool{}
+	var names []string
+	for _, p := range appPorts(cfg) {
+		if p.Protocol == models.PortHTTP {
+			continue
+		}
+		if err := s.applyService(ctx, namespace, buildPortService(appName, selector, p)); err != nil {
+			return err
+		}
+		declared[portServiceName(appName, p.Name)] = true
+		names = append(names, p.Name)
+	}
+
+	services := s.client.CoreV1().Services(namespace)
+	live, err := services.List(ctx, metav1.ListOptions{LabelSelector: fmt.Sprintf("app=%s,%s", appName, labelPortName)})
+	if err != nil {
+		return fmt.Errorf("list port services of %s: %w", appName, err)
+	}
+	for _, svc := range live.Items {
+		if declared[svc.Name] {
+			continue
+		}
+		if err := services.Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete k8s service %s: %w", svc.Name, err)
+		}
+	}
+	if err := s.portRepo.DeleteExcept(ctx, appID, names); err != nil {
+		return err
+	}
+	return s.refreshPortEndpoints(ctx, namespace, appID, cfg)
+}
+
+// ListPorts returns where the app's TCP and UDP ports can be reached. The
+// addresses are read again from the cluster, as a load balancer is only
+// assigned one some time after its Service is created.
+func (s *deploymentService) ListPorts(ctx context.Context, appID uuid.UUID) ([]models.PortEndpoint, error) {
+	stored, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.refreshPortEndpoints(ctx, appNamespace(stored), appID, stored.Config); err != nil {
+		return nil, err
+	}
+	return s.portRepo.ListByApp(ctx, appID)
+}
+
+func (s *deploymentService) refreshPortEndpoints(ctx context.Context, namespace string, appID uuid.UUID, cfg models.AppConfig) error {
+	appName := appResourceName(appID)
+	var nodeAddr string
+	for _, p := range appPorts(cfg) {
+		if p.Protocol == models.PortHTTP {
+			continue
+		}
+		svc, err := s.client.CoreV1().Services(namespace).Get(ctx, portServiceName(appName, p.Name), metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			// exposed with the app's next release
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("get k8s service %s: %w", portServiceName(appName, p.Name), err)
+		}
+
+		e := &models.PortEndpoint{
+			AppID:       appID,
+			Name:        p.Name,
+			Protocol:    p.Protocol,
+			Port:        p.Port,
+			ServiceType: string(svc.Spec.Type),
+			ServiceName: svc.Name,
+		}
+		if len(svc.Spec.Ports) > 0 {
+			e.NodePort = svc.Spec.Ports[0].NodePort
+		}
+		switch {
+		case svc.Spec.Type == corev1.ServiceTypeLoadBalancer && len(svc.Status.LoadBalancer.Ingress) > 0:
+			lb := svc.Status.LoadBalancer.Ingress[0]
+			host := lb.IP
+			if host == "" {
+				host = lb.Hostname
+			}
+			e.Address = net.JoinHostPort(host, strconv.Itoa(int(p.Port)))
+		case svc.Spec.Type == corev1.ServiceTypeNodePort && e.NodePort != 0:
+			if nodeAddr == "" {
+				nodeAddr = s.nodeAddress(ctx)
+			}
+			if nodeAddr != "" {
+				e.Address = net.JoinHostPort(nodeAddr, strconv.Itoa(int(e.NodePort)))
+			}
+		}
+		if err := s.portRepo.Upsert(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nodeAddress is an address node ports can be reached on: a node's external
+// IP, or its internal one on clusters without.
+func (s *deploymentService) nodeAddress(ctx context.Context) string {
+	nodes, err := s.client.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Printf("list nodes: %v", err)
+		return ""
+	}
+	var internal string
+	for _, n := range nodes.Items {
+		for _, a := range n.Status.Addresses {
+			switch a.Type {
+			case corev1.NodeExternalIP:
+				return a.Address
+			case corev1.NodeInternalIP:
+				if internal == "" {
+					internal = a.Address
+				}
+			}
+		}
+	}
+	return internal
+}
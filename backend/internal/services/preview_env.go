@@ -0,0 +1,398 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidPreview          = errors.New("invalid preview")
+	ErrPreviewForbidden        = errors.New("you cannot manage the previews of this app")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+)
+
+// preview environments live this long after their last push unless
+// PREVIEW_TTL_HOURS says otherwise
+const defaultPreviewTTL = 72 * time.Hour
+
+// pull request actions of the git provider's webhooks
+const (
+	PullRequestOpened      = "opened"
+	PullRequestReopened    = "reopened"
+	PullRequestSynchronize = "synchronize"
+	PullRequestClosed      = "closed"
+)
+
+// PreviewSpec is the head of a pull request to preview.
+type PreviewSpec struct {
+	PullRequest int
+	Branch      string
+	CommitSHA   string
+	// defaults to the parent's image repository tagged with CommitSHA; the
+	// platform does not build it, CI has to push that tag before the preview
+	// is opened
+	Image string
+}
+
+// PullRequestEvent is a pull request event of the app's git provider.
+type PullRequestEvent struct {
+	Action      string
+	PullRequest int
+	Branch      string
+	CommitSHA   string
+	// every URL the repository is known by
+	RepoURLs []string
+}
+
+type previewEnvService struct {
+	appRepo     repository.AppRepository
+	apps        AppService
+	deployments DeploymentService
+	domains     DomainService
+	teamService TeamService
+	registry    RegistryService
+	client      *kubernetes.Clientset
+	// previews are served at pr-<n>.<app>.<baseDomain>; none get a URL when
+	// it is empty
+	baseDomain string
+	ttl        time.Duration
+	// key the git provider signs its webhooks with
+	webhookSecret []byte
+}
+
+func NewPreviewEnvService(appRepo repository.AppRepository, apps AppService, deployments DeploymentService, domains DomainService, teamService TeamService, registry RegistryService, client *kubernetes.Clientset) PreviewEnvService {
+	ttl := defaultPreviewTTL
+	if n, err := strconv.Atoi(os.Getenv("PREVIEW_TTL_HOURS")); err == nil && n > 0 {
+		ttl = time.Duration(n) * time.Hour
+	}
+	return &previewEnvService{
+		appRepo:       appRepo,
+		apps:          apps,
+		deployments:   deployments,
+		domains:       domains,
+		teamService:   teamService,
+		registry:      registry,
+		client:        client,
+		baseDomain:    strings.Trim(strings.ToLower(os.Getenv("PREVIEW_DOMAIN")), "."),
+		ttl:           ttl,
+		webhookSecret: []byte(os.Getenv("GIT_WEBHOOK_SECRET")),
+	}
+}
+
+// OpenPreview deploys the head of a pull request as a preview of the parent
+// app, creating the preview on the first push. Each push moves its expiry
+// TTL further out.
+func (s *previewEnvService) OpenPreview(ctx context.Context, user *models.User, parentID uuid.UUID, spec PreviewSpec) (*models.Application, *models.Deployment, error) {
+	parent, err := s.appRepo.GetByID(ctx, parentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.requireAccess(ctx, user, parent); err != nil {
+		return nil, nil, err
+	}
+	return s.open(ctx, parent, spec)
+}
+
+func (s *previewEnvService) ListPreviews(ctx context.Context, parentID uuid.UUID) ([]models.Application, error) {
+	if _, err := s.appRepo.GetByID(ctx, parentID); err != nil {
+		return nil, err
+	}
+	return s.appRepo.ListPreviews(ctx, parentID)
+}
+
+// ClosePreview destroys the preview of a pull request.
+func (s *previewEnvService) ClosePreview(ctx context.Context, user *models.User, parentID uuid.UUID, pullRequest int) error {
+	parent, err := s.appRepo.GetByID(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	if err := s.requireAccess(ctx, user, parent); err != nil {
+		return err
+	}
+	preview, err := s.appRepo.GetPreview(ctx, parentID, pullRequest)
+	if err != nil {
+		return err
+	}
+	return s.close(ctx, preview)
+}
+
+// VerifyWebhook checks the HMAC-SHA256 signature the git provider sends
+// with a webhook, as "sha256=<hex>". Webhooks are refused while
+// GIT_WEBHOOK_SECRET is not set.
+func (s *previewEnvService) VerifyWebhook(payload []byte, signature string) error {
+	if len(s.webhookSecret) == 0 {
+		return fmt.Errorf("%w: GIT_WEBHOOK_SECRET is not set", ErrInvalidWebhookSignature)
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	mac := hmac.New(sha256.New, s.webhookSecret)
+	mac.Write(payload)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// HandlePullRequest opens or updates the previews of the apps built from the
+// event's repository when the pull request is opened or pushed to, and
+// destroys them when it is closed. It returns the previews it deployed.
+func (s *previewEnvService) HandlePullRequest(ctx context.Context, ev PullRequestEvent) ([]models.Application, error) {
+	parents, err := s.appRepo.ListByGitURL(ctx, repoURLVariants(ev.RepoURLs))
+	if err != nil {
+		return nil, err
+	}
+	var deployed []models.Application
+	for i := range parents {
+		parent := &parents[i]
+		switch ev.Action {
+		case PullRequestOpened, PullRequestReopened, PullRequestSynchronize:
+			preview, _, err := s.open(ctx, parent, PreviewSpec{
+				PullRequest: ev.PullRequest,
+				Branch:      ev.Branch,
+				CommitSHA:   ev.CommitSHA,
+			})
+			if err != nil {
+				return deployed, fmt.Errorf("preview of %s: %w", parent.Name, err)
+			}
+			deployed = append(deployed, *preview)
+		case PullRequestClosed:
+			preview, err := s.appRepo.GetPreview(ctx, parent.ID, ev.PullRequest)
+			if errors.Is(err, repository.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return deployed, err
+			}
+			if err := s.close(ctx, preview); err != nil {
+				return deployed, fmt.Errorf("preview of %s: %w", parent.Name, err)
+			}
+		}
+	}
+	return deployed, nil
+}
+
+// ReapExpired destroys the previews that were not pushed to within their TTL.
+func (s *previewEnvService) ReapExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		expired, err := s.appRepo.ListExpiredPreviews(ctx, time.Now())
+		if err != nil {
+			log.Printf("previews: list expired: %v", err)
+			continue
+		}
+		for i := range expired {
+			if err := s.close(ctx, &expired[i]); err != nil {
+				log.Printf("preview %s: close expired: %v", expired[i].ID, err)
+				continue
+			}
+			log.Printf("preview %s: closed after its TTL ran out", expired[i].Name)
+		}
+	}
+}
+
+func (s *previewEnvService) open(ctx context.Context, parent *models.Application, spec PreviewSpec) (*models.Application, *models.Deployment, error) {
+	if parent.ParentID != nil {
+		return nil, nil, fmt.Errorf("%w: %s is a preview itself", ErrInvalidPreview, parent.Name)
+	}
+	if spec.PullRequest <= 0 {
+		return nil, nil, fmt.Errorf("%w: the pull request number must be positive", ErrInvalidPreview)
+	}
+	image := spec.Image
+	if image == "" {
+		if spec.CommitSHA == "" || parent.ImageURL == "" {
+			return nil, nil, fmt.Errorf("%w: an image, or a commit of an app that has an image, is required", ErrInvalidPreview)
+		}
+		image = imageRepository(parent.ImageURL) + ":" + spec.CommitSHA
+	}
+	// checked before the preview is created so a push CI has not built yet
+	// leaves nothing behind
+	if _, err := s.registry.ResolveImage(ctx, parent, image); err != nil {
+		if errors.Is(err, ErrInvalidImage) {
+			return nil, nil, fmt.Errorf("%w: image %s not found, CI must push it before the preview is opened: %v", ErrInvalidPreview, image, err)
+		}
+		return nil, nil, err
+	}
+
+	preview, err := s.appRepo.GetPreview(ctx, parent.ID, spec.PullRequest)
+	if errors.Is(err, repository.ErrNotFound) {
+		preview, err = s.apps.CreateApp(ctx, s.previewOf(parent, spec.PullRequest))
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the head is always deployed right away, so its deploy records the release
+	expires := time.Now().Add(s.ttl)
+	if err := s.appRepo.SetPreviewHead(ctx, preview.ID, spec.Branch, spec.CommitSHA, image, expires); err != nil {
+		return nil, nil, err
+	}
+	preview.Branch, preview.CommitSHA, preview.ImageURL, preview.ExpiresAt = spec.Branch, spec.CommitSHA, image, &expires
+
+	deploy, err := s.deployments.DeployApp(ctx, *preview)
+	if err != nil {
+		return nil, nil, err
+	}
+	if host := s.hostname(parent, spec.PullRequest); host != "" && len(appServicePorts(preview.Config)) > 0 {
+		if _, err := s.domains.AttachPlatformDomain(ctx, preview.ID, host); err != nil {
+			return nil, nil, err
+		}
+	}
+	return preview, deploy, nil
+}
+
+// close removes the preview's domains, k8s objects and namespace, then the
+// preview. Objects of a release still rolling out go with the namespace.
+func (s *previewEnvService) close(ctx context.Context, preview *models.Application) error {
+	domains, err := s.domains.ListDomains(ctx, preview.ID)
+	if err != nil {
+		return err
+	}
+	for _, d := range domains {
+		if err := s.domains.RemoveDomain(ctx, preview.ID, d.ID); err != nil {
+			return err
+		}
+	}
+
+	objects, err := listAppObjects(ctx, s.client)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if o.appID == nil || *o.appID != preview.ID {
+			continue
+		}
+		if err := o.delete(ctx); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete %s %s: %w", o.kind, o.name, err)
+		}
+	}
+	if err := deleteNamespace(ctx, s.client, preview.Namespace); err != nil {
+		return err
+	}
+	return s.apps.DeleteApp(ctx, preview.ID, true)
+}
+
+// previewOf returns a new preview of parent. It runs a single replica in a
+// namespace of its own and rolls out in place; the parent's domains, volumes
+// and links stay with the parent, so the preview cannot reach what the
+// parent is linked to.
+func (s *previewEnvService) previewOf(parent *models.Application, pullRequest int) *models.Application {
+	cfg := parent.Config
+	one := int32(1)
+	cfg.Replicas = &one
+	cfg.Domains = nil
+	cfg.Strategy = nil
+
+	preview := &models.Application{
+		Name:           fmt.Sprintf("%s-pr-%d", parent.Name, pullRequest),
+		OwnerID:        parent.OwnerID,
+		TeamID:         parent.TeamID,
+		Description:    fmt.Sprintf("Preview of pull request #%d of %s", pullRequest, parent.Name),
+		GitURL:         parent.GitURL,
+		Runtime:        parent.Runtime,
+		ReleaseCommand: parent.ReleaseCommand,
+		Config:         cfg,
+		ParentID:       &parent.ID,
+		PullRequest:    pullRequest,
+		Namespace:      namespaceFor(parent, "preview-", fmt.Sprintf("-pr-%d", pullRequest)),
+	}
+	if host := s.hostname(parent, pullRequest); host != "" {
+		preview.DeployURL = "https://" + host
+	}
+	return preview
+}
+
+func (s *previewEnvService) hostname(parent *models.Application, pullRequest int) string {
+	if s.baseDomain == "" {
+		return ""
+	}
+	label := dnsLabel(parent.Name)
+	if label == "" {
+		label = appResourceName(parent.ID)
+	}
+	return fmt.Sprintf("pr-%d.%s.%s", pullRequest, label, s.baseDomain)
+}
+
+// requireAccess returns ErrPreviewForbidden unless user may manage parent.
+func (s *previewEnvService) requireAccess(ctx context.Context, user *models.User, parent *models.Application) error {
+	ok, err := canManageApp(ctx, s.teamService, user, parent)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrPreviewForbidden, parent.Name)
+	}
+	return nil
+}
+
+// dnsLabel turns an app name into a DNS label: My API becomes my-api.
+func dnsLabel(name string) string {
+	label := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	label = strings.Trim(label, "-")
+	if len(label) > 50 {
+		label = strings.TrimRight(label[:50], "-")
+	}
+	return label
+}
+
+// imageRepository strips the tag or digest off an image reference.
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+// repoURLVariants adds the forms an app's git URL may take for the same
+// repository, with and without .git or a trailing slash.
+func repoURLVariants(urls []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, u := range urls {
+		if u == "" {
+			continue
+		}
+		base := strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+		for _, v := range []string{base, base + ".git", base + "/"} {
+			if !seen[v] {
+				seen[v] = true
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrInvalidQuota  = errors.New("invalid quota")
+)
+
+const (
+	// what a container without requests or limits is counted as
+	defaultCPUMillis = 100
+	defaultMemoryMiB = 128
+
+	// the k8s quota leaves room for the surge of a rolling, blue/green or
+	// canary release, which runs the old and new pods side by side
+	resourceQuotaHeadroom = 2
+)
+
+// QuotaLimits are the limits of a plan, or what a user or team uses of them.
+// Replicas is per app; the others are totals across the apps.
+type QuotaLimits struct {
+	Apps      int64
+	CPUMillis int64
+	MemoryMiB int64
+	Replicas  int64
+	Volumes   int64
+	Domains   int64
+}
+
+var quotaPlans = map[string]QuotaLimits{
+	models.PlanFree:       {Apps: 3, CPUMillis: 2000, MemoryMiB: 2048, Replicas: 3, Volumes: 2, Domains: 2},
+	models.PlanPro:        {Apps: 20, CPUMillis: 8000, MemoryMiB: 16384, Replicas: 10, Volumes: 20, Domains: 20},
+	models.PlanEnterprise: {Apps: 100, CPUMillis: 32000, MemoryMiB: 65536, Replicas: 50, Volumes: 100, Domains: 100},
+}
+
+// QuotaStatus is the plan of a user or team, its limits after overrides and
+// what is used of them.
+type QuotaStatus struct {
+	Plan   string
+	Limits QuotaLimits
+	Usage  QuotaLimits
+}
+
+// QuotaError names the limit a request would exceed.
+type QuotaError struct {
+	Limit     string
+	Max       int64
+	Requested int64
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s would be %d, the limit is %d", ErrQuotaExceeded, e.Limit, e.Requested, e.Max)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// quotaScope is whose quota an app counts against: its team's, or its
+// owner's for apps outside a team. Apps with neither are not limited.
+type quotaScope struct {
+	userID *uuid.UUID
+	teamID *uuid.UUID
+}
+
+func appQuotaScope(app *models.Application) (quotaScope, bool) {
+	switch {
+	case app.TeamID != nil:
+		return quotaScope{teamID: app.TeamID}, true
+	case app.OwnerID != nil:
+		return quotaScope{userID: app.OwnerID}, true
+	}
+	return quotaScope{}, false
+}
+
+// name is that of the k8s PriorityClass and ResourceQuota of the scope.
+func (q quotaScope) name() string {
+	if q.teamID != nil {
+		return "quota-team-" + q.teamID.String()[0:8]
+	}
+	return "quota-user-" + q.userID.String()[0:8]
+}
+
+// quotaPriorityClass is the PriorityClass the pods of app run with, which
+// puts them under the ResourceQuota of its user or team.
+func quotaPriorityClass(app *models.Application) string {
+	scope, ok := appQuotaScope(app)
+	if !ok {
+		return ""
+	}
+	return scope.name()
+}
+
+type quotaService struct {
+	repo       repository.QuotaRepository
+	appRepo    repository.AppRepository
+	volumeRepo repository.VolumeRepository
+	domainRepo repository.DomainRepository
+	userRepo   repository.UserRepository
+	teamRepo   repository.TeamRepository
+	client     *kubernetes.Clientset
+}
+
+func NewQuotaService(repo repository.QuotaRepository, appRepo repository.AppRepository, volumeRepo repository.VolumeRepository, domainRepo repository.DomainRepository, userRepo repository.UserRepository, teamRepo repository.TeamRepository, client *kubernetes.Clientset) QuotaService {
+	return &quotaService{
+		repo:       repo,
+		appRepo:    appRepo,
+		volumeRepo: volumeRepo,
+		domainRepo: domainRepo,
+		userRepo:   userRepo,
+		teamRepo:   teamRepo,
+		client:     client,
+	}
+}
+
+// CheckApp returns a *QuotaError when creating app, or saving it with its
+// current config, would take its user or team over a limit.
+func (s *quotaService) CheckApp(ctx context.Context, app *models.Application) error {
+	scope, ok := appQuotaScope(app)
+	if !ok {
+		return nil
+	}
+	limits, _, err := s.limits(ctx, scope)
+	if err != nil {
+		return err
+	}
+	apps, err := s.apps(ctx, scope)
+	if err != nil {
+		return err
+	}
+
+	// the app replaces its stored version, or is added when it is new
+	var before, after QuotaLimits
+	found := false
+	for i := range apps {
+		if apps[i].ID == app.ID {
+			found = true
+			addAppUsage(&before, &apps[i])
+			addAppUsage(&after, app)
+			continue
+		}
+		addAppUsage(&before, &apps[i])
+		addAppUsage(&after, &apps[i])
+	}
+	if !found {
+		addAppUsage(&after, app)
+	}
+
+	if replicas := int64(appReplicas(app.Config)); replicas > limits.Replicas {
+		return &QuotaError{Limit: "replicas", Max: limits.Replicas, Requested: replicas}
+	}
+	// a limit lowered by an admin does not lock out changes that use less
+	checks := []struct {
+		limit              string
+		max, before, after int64
+	}{
+		{"apps", limits.Apps, before.Apps, after.Apps},
+		{"cpu_millis", limits.CPUMillis, before.CPUMillis, after.CPUMillis},
+		{"memory_mib", limits.MemoryMiB, before.MemoryMiB, after.MemoryMiB},
+	}
+	for _, c := range checks {
+		if c.after > c.max && c.after > c.before {
+			return &QuotaError{Limit: c.limit, Max: c.max, Requested: c.after}
+		}
+	}
+	return nil
+}
+
+// CheckVolume returns a *QuotaError when the app's user or team has no
+// volume left.
+func (s *quotaService) CheckVolume(ctx context.Context, appID uuid.UUID) error {
+	return s.checkCount(ctx, appID, "volumes", func(l QuotaLimits) int64 { return l.Volumes }, s.volumeRepo.CountByApps)
+}
+
+// CheckDomain returns a *QuotaError when the app's user or team has no custom
+// domain left.
+func (s *quotaService) CheckDomain(ctx context.Context, appID uuid.UUID) error {
+	return s.checkCount(ctx, appID, "domains", func(l QuotaLimits) int64 { return l.Domains }, s.domainRepo.CountByApps)
+}
+
+func (s *quotaService) checkCount(ctx context.Context, appID uuid.UUID, limit string, max func(QuotaLimits) int64, count func(context.Context, []uuid.UUID) (int64, error)) error {
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return err
+	}
+	scope, ok := appQuotaScope(app)
+	if !ok {
+		return nil
+	}
+	limits, _, err := s.limits(ctx, scope)
+	if err != nil {
+		return err
+	}
+	apps, err := s.apps(ctx, scope)
+	if err != nil {
+		return err
+	}
+	n, err := count(ctx, appIDs(apps))
+	if err != nil {
+		return err
+	}
+	if n+1 > max(limits) {
+		return &QuotaError{Limit: limit, Max: max(limits), Requested: n + 1}
+	}
+	return nil
+}
+
+func (s *quotaService) GetUserQuota(ctx context.Context, userID uuid.UUID) (*QuotaStatus, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.status(ctx, quotaScope{userID: &userID})
+}
+
+func (s *quotaService) GetTeamQuota(ctx context.Context, teamID uuid.UUID) (*QuotaStatus, error) {
+	if _, err := s.teamRepo.GetByID(ctx, teamID); err != nil {
+		return nil, err
+	}
+	return s.status(ctx, quotaScope{teamID: &teamID})
+}
+
+// SetUserQuota puts the user on q's plan with q's overrides, replacing those
+// set before.
+func (s *quotaService) SetUserQuota(ctx context.Context, userID uuid.UUID, q models.Quota) (*QuotaStatus, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	q.UserID, q.TeamID = &userID, nil
+	return s.set(ctx, quotaScope{userID: &userID}, q)
+}
+
+// SetTeamQuota puts the team on q's plan with q's overrides, replacing those
+// set before.
+func (s *quotaService) SetTeamQuota(ctx context.Context, teamID uuid.UUID, q models.Quota) (*QuotaStatus, error) {
+	if _, err := s.teamRepo.GetByID(ctx, teamID); err != nil {
+		return nil, err
+	}
+	q.UserID, q.TeamID = nil, &teamID
+	return s.set(ctx, quotaScope{teamID: &teamID}, q)
+}
+
+func (s *quotaService) set(ctx context.Context, scope quotaScope, q models.Quota) (*QuotaStatus, error) {
+	if q.Plan == "" {
+		q.Plan = models.PlanFree
+	}
+	if _, ok := quotaPlans[q.Plan]; !ok {
+		return nil, fmt.Errorf("%w: unknown plan %q", ErrInvalidQuota, q.Plan)
+	}
+	for _, v := range []*int64{q.MaxApps, q.MaxCPUMillis, q.MaxMemoryMiB, q.MaxReplicas, q.MaxVolumes, q.MaxDomains} {
+		if v != nil && *v < 0 {
+			return nil, fmt.Errorf("%w: limits cannot be negative", ErrInvalidQuota)
+		}
+	}
+	q.ID = uuid.Nil
+	if err := s.repo.Save(ctx, &q); err != nil {
+		return nil, err
+	}
+
+	// the database is what requests are checked against; the k8s quota
+	// catches up with the next release otherwise
+	limits, _, err := s.limits(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyResourceQuota(ctx, scope, limits); err != nil {
+		log.Printf("quota %s: %v", scope.name(), err)
+	}
+	return s.status(ctx, scope)
+}
+
+// SyncResourceQuota applies the k8s PriorityClass and ResourceQuota that
+// limit what the pods of app's user or team may request.
+func (s *quotaService) SyncResourceQuota(ctx context.Context, app *models.Application) error {
+	scope, ok := appQuotaScope(app)
+	if !ok {
+		return nil
+	}
+	limits, _, err := s.limits(ctx, scope)
+	if err != nil {
+		return err
+	}
+	return s.applyResourceQuota(ctx, scope, limits)
+}
+
+func (s *quotaService) applyResourceQuota(ctx context.Context, scope quotaScope, limits QuotaLimits) error {
+	name := scope.name()
+	labels := map[string]string{labelManagedBy: managedByPlatform}
+
+	classes := s.client.SchedulingV1().PriorityClasses()
+	if _, err := classes.Get(ctx, name, metav1.GetOptions{}); apierrors.IsNotFound(err) {
+		never := corev1.PreemptNever
+		pc := &schedulingv1.PriorityClass{
+			ObjectMeta:       metav1.ObjectMeta{Name: name, Labels: labels},
+			Value:            0,
+			PreemptionPolicy: &never,
+			Description:      "puts the pods of apps under the ResourceQuota of the same name",
+		}
+		if _, err := classes.Create(ctx, pc, metav1.CreateOptions{}); err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("create k8s priority class %s: %w", name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("get k8s priority class %s: %w", name, err)
+	}
+
+	// a ResourceQuota only counts the pods of its own namespace, so each
+	// namespace the scope's apps run in gets the share its apps are counted
+	// for: the copies then add up to the scope's limits, not a multiple of
+	// them, however many environments and previews it has
+	apps, err := s.apps(ctx, scope)
+	if err != nil {
+		return err
+	}
+	shares := map[string]*QuotaLimits{}
+	for i := range apps {
+		namespace := appNamespace(&apps[i])
+		if shares[namespace] == nil {
+			shares[namespace] = &QuotaLimits{}
+		}
+		addAppUsage(shares[namespace], &apps[i])
+	}
+
+	for namespace, share := range shares {
+		// usage from before the limits were lowered stays within them
+		share.CPUMillis = min(share.CPUMillis, limits.CPUMillis)
+		share.MemoryMiB = min(share.MemoryMiB, limits.MemoryMiB)
+		rq := buildResourceQuota(name, *share)
+		quotas := s.client.CoreV1().ResourceQuotas(namespace)
+		live, err := quotas.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = quotas.Create(ctx, rq, metav1.CreateOptions{})
+			if apierrors.IsNotFound(err) {
+				// the namespace comes with the app's first release, which syncs the quota again
+				continue
+			}
+		} else if err == nil {
+			live.Labels = rq.Labels
+			live.Spec = rq.Spec
+			_, err = quotas.Update(ctx, live, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			return fmt.Errorf("apply k8s resource quota %s in %s: %w", name, namespace, err)
+		}
+	}
+	return nil
+}
+
+// buildResourceQuota limits the requests of the pods running with the
+// PriorityClass of the same name to headroom times share.
+func buildResourceQuota(name string, share QuotaLimits) *corev1.ResourceQuota {
+	return &corev1.ResourceQuota{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ResourceQuota"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{labelManagedBy: managedByPlatform},
+		},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: corev1.ResourceList{
+				corev1.ResourceRequestsCPU:    *resource.NewMilliQuantity(resourceQuotaHeadroom*share.CPUMillis, resource.DecimalSI),
+				corev1.ResourceRequestsMemory: *resource.NewQuantity(resourceQuotaHeadroom*share.MemoryMiB<<20, resource.BinarySI),
+			},
+			ScopeSelector: &corev1.ScopeSelector{
+				MatchExpressions: []corev1.ScopedResourceSelectorRequirement{{
+					ScopeName: corev1.ResourceQuotaScopePriorityClass,
+					Operator:  corev1.ScopeSelectorOpIn,
+					Values:    []string{name},
+				}},
+			},
+		},
+	}
+}
+
+// limits returns the scope's limits: its plan's with its overrides applied.
+func (s *quotaService) limits(ctx context.Context, scope quotaScope) (QuotaLimits, string, error) {
+	var q *models.Quota
+	var err error
+	if scope.teamID != nil {
+		q, err = s.repo.GetByTeam(ctx, *scope.teamID)
+	} else {
+		q, err = s.repo.GetByUser(ctx, *scope.userID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return quotaPlans[models.PlanFree], models.PlanFree, nil
+	}
+	if err != nil {
+		return QuotaLimits{}, "", err
+	}
+
+	limits, ok := quotaPlans[q.Plan]
+	if !ok {
+		limits = quotaPlans[models.PlanFree]
+	}
+	override := func(limit *int64, v *int64) {
+		if v != nil {
+			*limit = *v
+		}
+	}
+	override(&limits.Apps, q.MaxApps)
+	override(&limits.CPUMillis, q.MaxCPUMillis)
+	override(&limits.MemoryMiB, q.MaxMemoryMiB)
+	override(&limits.Replicas, q.MaxReplicas)
+	override(&limits.Volumes, q.MaxVolumes)
+	override(&limits.Domains, q.MaxDomains)
+	return limits, q.Plan, nil
+}
+
+func (s *quotaService) status(ctx context.Context, scope quotaScope) (*QuotaStatus, error) {
+	limits, plan, err := s.limits(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := s.apps(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+	st := &QuotaStatus{Plan: plan, Limits: limits}
+	for i := range apps {
+		addAppUsage(&st.Usage, &apps[i])
+	}
+	ids := appIDs(apps)
+	if st.Usage.Volumes, err = s.volumeRepo.CountByApps(ctx, ids); err != nil {
+		return nil, err
+	}
+	if st.Usage.Domains, err = s.domainRepo.CountByApps(ctx, ids); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+func (s *quotaService) apps(ctx context.Context, scope quotaScope) ([]models.Application, error) {
+	if scope.teamID != nil {
+		return s.appRepo.ListByTeam(ctx, *scope.teamID)
+	}
+	return s.appRepo.ListPersonal(ctx, *scope.userID)
+}
+
+// addAppUsage adds what app uses to u: CPU and memory for each of its
+// replicas, and the most replicas of any app.
+func addAppUsage(u *QuotaLimits, app *models.Application) {
+	replicas := int64(appReplicas(app.Config))
+	u.Apps++
+	u.CPUMillis += replicas * appCPUMillis(app.Config.Resources)
+	u.MemoryMiB += replicas * appMemoryMiB(app.Config.Resources)
+	if replicas > u.Replicas {
+		u.Replicas = replicas
+	}
+}
+
+// appCPUMillis is the CPU a container of the app is counted for: its request,
+// else its limit, which k8s then uses as the request.
+func appCPUMillis(r models.AppResources) int64 {
+	if q, ok := firstQuantity(r.CPURequest, r.CPULimit); ok {
+		return q.MilliValue()
+	}
+	return defaultCPUMillis
+}
+
+func appMemoryMiB(r models.AppResources) int64 {
+	if q, ok := firstQuantity(r.MemoryRequest, r.MemoryLimit); ok {
+		return (q.Value() + 1<<20 - 1) >> 20
+	}
+	return defaultMemoryMiB
+}
+
+func firstQuantity(values ...string) (resource.Quantity, bool) {
+	for _, v := range values {
+		if q, err := resource.ParseQuantity(v); v != "" && err == nil {
+			return q, true
+		}
+	}
+	return resource.Quantity{}, false
+}
+
+// quotaRequests are the requests of a container under a ResourceQuota, which
+// rejects pods that make none.
+func quotaRequests(r models.AppResources) corev1.ResourceList {
+	return corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(appCPUMillis(r), resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(appMemoryMiB(r)<<20, resource.BinarySI),
+	}
+}
+
+func appIDs(apps []models.Application) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(apps))
+	for _, a := range apps {
+		ids = append(ids, a.ID)
+	}
+	return ids
+}
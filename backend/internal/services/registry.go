@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+	"mini-paas/backend/pkg/registry"
+	"mini-paas/backend/pkg/secretbox"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidCredential   = errors.New("invalid registry credential")
+	ErrInvalidImage        = errors.New("invalid image")
+	ErrRegistryUnavailable = errors.New("registry unavailable")
+)
+
+var registryServerRe = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:[0-9]+)?$`)
+
+const (
+	labelCredentialID = "registry-credential-id"
+	// docker keys Docker Hub auth by its legacy index URL
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+)
+
+// ResolvedImage is an image reference that was found in its registry.
+type ResolvedImage struct {
+	Reference registry.Reference
+	Digest    string
+	// PullSecret names the dockerconfigjson Secret needed to pull the image;
+	// empty when it is pulled anonymously
+	PullSecret string
+
+	credential *models.RegistryCredential
+}
+
+type registryService struct {
+	repo     repository.RegistryCredentialRepository
+	teams    TeamService
+	box      *secretbox.Box
+	registry *registry.Client
+	client   *kubernetes.Clientset
+}
+
+func NewRegistryService(
+	repo repository.RegistryCredentialRepository,
+	teams TeamService,
+	box *secretbox.Box,
+	client *kubernetes.Clientset,
+) RegistryService {
+	rc := registry.NewClient()
+	if v := os.Getenv("INSECURE_REGISTRIES"); v != "" {
+		rc.Insecure = strings.Split(v, ",")
+	}
+	return &registryService{repo: repo, teams: teams, box: box, registry: rc, client: client}
+}
+
+// CreateCredential stores a credential for the user, or for teamID when set.
+func (s *registryService) CreateCredential(ctx context.Context, user *models.User, teamID *uuid.UUID, server, username, token string) (*models.RegistryCredential, error) {
+	server = normalizeRegistryServer(server)
+	if !registryServerRe.MatchString(server) {
+		return nil, fmt.Errorf("%w: server must be a registry host such as ghcr.io", ErrInvalidCredential)
+	}
+	if username == "" || token == "" {
+		return nil, fmt.Errorf("%w: username and token are required", ErrInvalidCredential)
+	}
+
+	cred := &models.RegistryCredential{Server: server, Username: username}
+	if teamID != nil {
+		if err := s.teams.RequireMember(ctx, *teamID, user.ID); err != nil {
+			return nil, err
+		}
+		cred.TeamID = teamID
+	} else {
+		cred.UserID = &user.ID
+	}
+
+	sealed, err := s.box.Seal([]byte(token))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt token: %w", err)
+	}
+	cred.TokenEncrypted = sealed
+
+	if err := s.repo.Create(ctx, cred); err != nil {
+		return nil, err
+	}
+	return cred, nil
+}
+
+// ListCredentials returns the user's own credentials and those of their teams.
+func (s *registryService) ListCredentials(ctx context.Context, user *models.User) ([]models.RegistryCredential, error) {
+	teams, err := s.teams.ListTeams(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	teamIDs := make([]uuid.UUID, 0, len(teams))
+	for _, t := range teams {
+		teamIDs = append(teamIDs, t.ID)
+	}
+	return s.repo.ListForOwners(ctx, &user.ID, teamIDs)
+}
+
+// DeleteCredential removes the credential and its synced pull Secret.
+func (s *registryService) DeleteCredential(ctx context.Context, user *models.User, id uuid.UUID) error {
+	cred, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case cred.TeamID != nil:
+		if err := s.teams.RequireMember(ctx, *cred.TeamID, user.ID); err != nil {
+			return err
+		}
+	case cred.UserID == nil || *cred.UserID != user.ID:
+		// other users' credentials are invisible, not forbidden
+		return repository.ErrNotFound
+	}
+
+	// a copy is synced into each namespace an app using it deployed to
+	secrets, err := s.client.CoreV1().Secrets(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", labelCredentialID, cred.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("list pull secrets: %w", err)
+	}
+	for _, secret := range secrets.Items {
+		err := s.client.CoreV1().Secrets(secret.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("delete pull secret: %w", err)
+		}
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// ResolveImage checks that image exists in its registry, authenticating with
+// the app team's or owner's credential for that registry when there is one.
+func (s *registryService) ResolveImage(ctx context.Context, app *models.Application, image string) (*ResolvedImage, error) {
+	ref, err := registry.ParseReference(image)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	cred, err := s.credentialFor(ctx, app, ref.Registry)
+	if err != nil {
+		return nil, err
+	}
+	var creds *registry.Credentials
+	if cred != nil {
+		token, err := s.box.Open(cred.TokenEncrypted)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt registry token: %w", err)
+		}
+		creds = &registry.Credentials{Username: cred.Username, Password: string(token)}
+	}
+
+	desc, err := s.registry.Resolve(ctx, ref, creds)
+	switch {
+	case errors.Is(err, registry.ErrManifestUnknown), errors.Is(err, registry.ErrUnauthorized):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	case err != nil:
+		return nil, fmt.Errorf("%w: %v", ErrRegistryUnavailable, err)
+	}
+
+	resolved := &ResolvedImage{Reference: ref, Digest: desc.Digest, credential: cred}
+	if cred != nil {
+		resolved.PullSecret = pullSecretName(cred.ID)
+	}
+	return resolved, nil
+}
+
+// SyncPullSecret writes the image's credential into namespace as a
+// kubernetes.io/dockerconfigjson Secret.
+func (s *registryService) SyncPullSecret(ctx context.Context, namespace string, img *ResolvedImage) error {
+	if img.credential == nil {
+		return nil
+	}
+	token, err := s.box.Open(img.credential.TokenEncrypted)
+	if err != nil {
+		return fmt.Errorf("decrypt registry token: %w", err)
+	}
+	secret, err := buildPullSecret(img.credential, string(token))
+	if err != nil {
+		return err
+	}
+
+	secrets := s.client.CoreV1().Secrets(namespace)
+	_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		// the token may have been rotated since the last sync
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("sync pull secret: %w", err)
+	}
+	return nil
+}
+
+// credentialFor picks the credential for server, preferring the app's team
+// over its owner.
+func (s *registryService) credentialFor(ctx context.Context, app *models.Application, server string) (*models.RegistryCredential, error) {
+	var teamIDs []uuid.UUID
+	if app.TeamID != nil {
+		teamIDs = append(teamIDs, *app.TeamID)
+	}
+	creds, err := s.repo.ListForOwners(ctx, app.OwnerID, teamIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned *models.RegistryCredential
+	for i := range creds {
+		c := &creds[i]
+		if c.Server != server {
+			continue
+		}
+		if c.TeamID != nil {
+			return c, nil
+		}
+		if owned == nil {
+			owned = c
+		}
+	}
+	return owned, nil
+}
+
+func buildPullSecret(cred *models.RegistryCredential, token string) (*corev1.Secret, error) {
+	key := cred.Server
+	if key == registry.DockerHub {
+		key = dockerHubAuthKey
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(cred.Username + ":" + token))
+	config, err := json.Marshal(map[string]any{
+		"auths": map[string]any{
+			key: map[string]string{"username": cred.Username, "password": token, "auth": auth},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: pullSecretName(cred.ID),
+			Labels: map[string]string{
+				labelManagedBy:    managedByPlatform,
+				labelCredentialID: cred.ID.String(),
+			},
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: config},
+	}, nil
+}
+
+func pullSecretName(credID uuid.UUID) string {
+	return "regcred-" + credID.String()[0:8]
+}
+
+// normalizeRegistryServer accepts the forms people paste from docker login.
+func normalizeRegistryServer(server string) string {
+	server = strings.ToLower(strings.TrimSpace(server))
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server, _, _ = strings.Cut(server, "/")
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return registry.DockerHub
+	}
+	return server
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	"sigs.k8s.io/yaml"
+)
+
+// Reasons a release is made for. Maintenance mode makes none: it only routes
+// the app's domains, what the app runs stays the same.
+const (
+	ReleaseCreate       = "create"
+	ReleaseDeploy       = "deploy"
+	ReleaseConfigChange = "config change"
+	ReleasePromotion    = "promotion"
+	// the config vars of links and add-ons are bound at rollout and hold
+	// credentials, so their releases record the change but not the values
+	ReleaseLinkChange  = "link change"
+	ReleaseAddOnChange = "add-on change"
+)
+
+// ReleaseDiff is the difference between two releases of an app, as a
+// unified diff of their snapshots; Diff is empty when they are the same.
+type ReleaseDiff struct {
+	From *models.Release
+	To   *models.Release
+	Diff string
+}
+
+// releaseSnapshot is what a release pins down, in the form releases are
+// diffed in.
+type releaseSnapshot struct {
+	Image          string           `json:"image"`
+	ImageDigest    string           `json:"image_digest,omitempty"`
+	ReleaseCommand string           `json:"release_command,omitempty"`
+	Config         models.AppConfig `json:"config"`
+}
+
+type releaseService struct {
+	repo    repository.ReleaseRepository
+	appRepo repository.AppRepository
+}
+
+func NewReleaseService(repo repository.ReleaseRepository, appRepo repository.AppRepository) ReleaseService {
+	return &releaseService{repo: repo, appRepo: appRepo}
+}
+
+// Record snapshots app's config and release command with image, pinned to
+// digest, as the app's next release.
+func (s *releaseService) Record(ctx context.Context, app *models.Application, image, digest, reason string) (*models.Release, error) {
+	rel := &models.Release{
+		AppID:          app.ID,
+		ImageURL:       image,
+		ImageDigest:    digest,
+		ReleaseCommand: app.ReleaseCommand,
+		Config:         app.Config,
+		Reason:         reason,
+	}
+	if err := s.repo.Create(ctx, rel); err != nil {
+		return nil, err
+	}
+	return rel, nil
+}
+
+// RecordConfigChange records a release when updated changed the config or
+// release command of previous. It keeps the image of the latest release, so
+// it is what the app runs once it is deployed again.
+func (s *releaseService) RecordConfigChange(ctx context.Context, previous, updated *models.Application) (*models.Release, error) {
+	before, err := snapshotOf(previous.ReleaseCommand, previous.Config)
+	if err != nil {
+		return nil, err
+	}
+	after, err := snapshotOf(updated.ReleaseCommand, updated.Config)
+	if err != nil {
+		return nil, err
+	}
+	if before == after {
+		return nil, nil
+	}
+	return s.RecordEnvChange(ctx, updated, ReleaseConfigChange)
+}
+
+// RecordEnvChange records a release of app for a change of what its pods get
+// other than the image, such as a link. It keeps the image of the latest
+// release, so it is what the app runs once it is deployed again.
+func (s *releaseService) RecordEnvChange(ctx context.Context, app *models.Application, reason string) (*models.Release, error) {
+	image, digest := app.ImageURL, ""
+	latest, err := s.repo.GetLatest(ctx, app.ID)
+	switch {
+	case err == nil:
+		image, digest = latest.ImageURL, latest.ImageDigest
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	return s.Record(ctx, app, image, digest, reason)
+}
+
+func (s *releaseService) ListReleases(ctx context.Context, appID uuid.UUID, page repository.Page) (repository.ListResult[models.Release], error) {
+	if _, err := s.appRepo.GetByID(ctx, appID); err != nil {
+		return repository.ListResult[models.Release]{}, err
+	}
+	return s.repo.ListByApp(ctx, appID, page)
+}
+
+func (s *releaseService) GetRelease(ctx context.Context, appID uuid.UUID, version int) (*models.Release, error) {
+	return s.repo.GetByVersion(ctx, appID, version)
+}
+
+func (s *releaseService) GetReleaseByID(ctx context.Context, id uuid.UUID) (*models.Release, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// DiffReleases compares versions from and to of the app's releases.
+func (s *releaseService) DiffReleases(ctx context.Context, appID uuid.UUID, from, to int) (*ReleaseDiff, error) {
+	a, err := s.repo.GetByVersion(ctx, appID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.repo.GetByVersion(ctx, appID, to)
+	if err != nil {
+		return nil, err
+	}
+	before, err := renderSnapshot(a)
+	if err != nil {
+		return nil, err
+	}
+	after, err := renderSnapshot(b)
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseDiff{
+		From: a,
+		To:   b,
+		Diff: unifiedDiff(fmt.Sprintf("v%d", a.Version), fmt.Sprintf("v%d", b.Version), before, after),
+	}, nil
+}
+
+func renderSnapshot(rel *models.Release) (string, error) {
+	out, err := yaml.Marshal(releaseSnapshot{
+		Image:          rel.ImageURL,
+		ImageDigest:    rel.ImageDigest,
+		ReleaseCommand: rel.ReleaseCommand,
+		Config:         rel.Config,
+	})
+	return string(out), err
+}
+
+// snapshotOf renders the parts of an app a config change release records.
+func snapshotOf(releaseCommand string, config models.AppConfig) (string, error) {
+	return renderSnapshot(&models.Release{ReleaseCommand: releaseCommand, Config: config})
+}
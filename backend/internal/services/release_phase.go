@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	labelDeploymentID = "deployment-id"
+
+	releaseTimeout = 30 * time.Minute
+	// number of output lines repeated in the failure message
+	releaseFailureTail = 20
+)
+
+// releaseAndRollout runs the app's release command as a Job with the new image
+// and only rolls the release out once the Job has succeeded.
+func (s *deploymentService) releaseAndRollout(ctx context.Context, deploy *models.Deployment, app models.Application, command string, m *ReleaseManifests) {
+	// the timeout bounds the Job only; the outcome is recorded even after it hit
+	jobCtx, cancel := context.WithTimeout(ctx, releaseTimeout)
+	defer cancel()
+
+	output, err := s.runReleasePhase(jobCtx, appNamespace(&app), deploy, command, m.ReleaseJob)
+	if errors.Is(err, context.Canceled) {
+		// CancelDeployment has already removed the job and freed the slot
+		return
+	}
+	if err != nil {
+		ctx := context.WithoutCancel(ctx)
+		_ = s.repo.UpdateStatus(ctx, deploy.ID, "FAILED")
+		msg := fmt.Sprintf("release phase failed: %v", err)
+		if len(output) > 0 {
+			start := max(0, len(output)-releaseFailureTail)
+			msg += "\n" + strings.Join(output[start:], "\n")
+		}
+		s.appendDeployLog(ctx, deploy, "deploy", "ERROR", msg)
+		s.finish(deploy.ID)
+		return
+	}
+
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", "release phase succeeded, rolling out")
+	if err := s.rollout(ctx, deploy, app, m); err != nil {
+		s.appendDeployLog(context.WithoutCancel(ctx), deploy, "deploy", "ERROR", err.Error())
+		s.finish(deploy.ID)
+	}
+}
+
+// runReleasePhase starts the release Job, copies its output into the
+// deployment logs as it is produced and waits for the Job to finish.
+func (s *deploymentService) runReleasePhase(ctx context.Context, namespace string, deploy *models.Deployment, command string, job *batchv1.Job) ([]string, error) {
+	jobName := job.Name
+
+	s.appendDeployLog(ctx, deploy, "deploy", "INFO", fmt.Sprintf("release phase started: %s", command))
+	if _, err := s.client.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("create release job: %w", err)
+	}
+
+	if err := waitForJobPod(ctx, s.client, namespace, jobName); err != nil {
+		return nil, fmt.Errorf("release job pod did not start: %w", err)
+	}
+
+	// follow the pod output so progress shows up while the job runs
+	var output []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pods, err := s.client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+		})
+		if err != nil || len(pods.Items) == 0 {
+			return
+		}
+		stream, err := s.client.CoreV1().Pods(namespace).
+			GetLogs(pods.Items[0].Name, &corev1.PodLogOptions{Follow: true}).
+			Stream(ctx)
+		if err != nil {
+			log.Printf("deploy %s: follow release logs: %v", deploy.ID, err)
+			return
+		}
+
+		lineCh := make(chan string)
+		go StreamToLines(ctx, stream, lineCh)
+		for line := range lineCh {
+			output = append(output, line)
+			s.appendDeployLog(ctx, deploy, "release", "INFO", line)
+		}
+	}()
+
+	_, succeeded, err := waitForJob(ctx, s.client, namespace, jobName)
+	<-done
+	if err != nil {
+		return output, err
+	}
+	if !succeeded {
+		code, _ := jobExitCode(ctx, s.client, namespace, jobName)
+		if code != nil {
+			return output, fmt.Errorf("release command exited with code %d", *code)
+		}
+		return output, fmt.Errorf("release command failed")
+	}
+	return output, nil
+}
+
+func (s *deploymentService) appendDeployLog(ctx context.Context, deploy *models.Deployment, source, level, message string) {
+	if err := s.logRepo.Append(ctx, &models.Log{
+		DeploymentID: deploy.ID,
+		Message:      message,
+		Level:        level,
+		Source:       source,
+	}); err != nil {
+		log.Printf("deploy %s: append log: %v", deploy.ID, err)
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	defaultHealthyWithin  = 5 * time.Minute
+	defaultRollbackWatch  = 5 * time.Minute
+	rollbackCheckInterval = 10 * time.Second
+)
+
+// rollbackPolicy returns the app's rollback policy, or nil when it has not opted in.
+func rollbackPolicy(cfg models.AppConfig) *models.AppRollback {
+	if cfg.Rollback == nil || !cfg.Rollback.Enabled {
+		return nil
+	}
+	return cfg.Rollback
+}
+
+func healthyWithin(p *models.AppRollback) time.Duration {
+	if p.HealthyWithinSeconds > 0 {
+		return time.Duration(p.HealthyWithinSeconds) * time.Second
+	}
+	return defaultHealthyWithin
+}
+
+func rollbackWatch(p *models.AppRollback) time.Duration {
+	if p.WatchSeconds > 0 {
+		return time.Duration(p.WatchSeconds) * time.Second
+	}
+	return defaultRollbackWatch
+}
+
+// watchRelease checks a release that just went RUNNING against the app's
+// thresholds for the policy's watch window and rolls it back if one is crossed.
+func (s *deploymentService) watchRelease(ctx context.Context, deployID uuid.UUID, app models.Application, policy *models.AppRollback) {
+	window := rollbackWatch(policy)
+	since := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	ticker := time.NewTicker(rollbackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// once a newer release has started, rolling this one back would undo it
+		latest, err := s.repo.GetLatestByApp(ctx, app.ID, "PENDING", "RELEASING", "DEPLOYING", "RUNNING")
+		if err != nil || latest.ID != deployID {
+			return
+		}
+
+		reason, err := s.unhealthyReason(ctx, latest, app, policy, since)
+		if err != nil {
+			log.Printf("deploy %s: health check: %v", deployID, err)
+			continue
+		}
+		if reason != "" {
+			s.rollback(context.WithoutCancel(ctx), deployID, app, fmt.Sprintf("%s within %s of going RUNNING", reason, window))
+			return
+		}
+	}
+}
+
+// unhealthyReason describes the first threshold of policy the release has
+// crossed, or returns "" while it is healthy.
+func (s *deploymentService) unhealthyReason(ctx context.Context, deploy *models.Deployment, app models.Application, policy *models.AppRollback, since time.Time) (string, error) {
+	if policy.MaxRestarts > 0 {
+		pods, err := releasePods(ctx, s.client, appNamespace(&app), deploy.ID)
+		if err != nil {
+			return "", err
+		}
+		var restarts int32
+		for _, pod := range pods {
+			for _, cs := range pod.Status.ContainerStatuses {
+				restarts += cs.RestartCount
+			}
+		}
+		if restarts > policy.MaxRestarts {
+			return fmt.Sprintf("%d container restarts, more than the %d allowed", restarts, policy.MaxRestarts), nil
+		}
+	}
+
+	if policy.MaxErrorRate > 0 && s.errorRates != nil {
+		rate, ok, err := s.errorRates.ErrorRate(ctx, deploy, app, since)
+		if err != nil {
+			return "", err
+		}
+		if ok && rate > policy.MaxErrorRate {
+			return fmt.Sprintf("error rate %.1f%%, above the %.1f%% allowed", rate*100, policy.MaxErrorRate*100), nil
+		}
+	}
+	return "", nil
+}
+
+// rollback reverts app from the release deployID to the release it
+// replaced: the one it superseded when it went RUNNING, which is scaled back
+// up, or the RUNNING one still serving when it never got that far. The
+// failed release's objects are removed once the previous release has its
+// pods back, and the previous one is deployed again if its objects are gone.
+// Both deployments record the reason and the app's people are notified.
+func (s *deploymentService) rollback(ctx context.Context, deployID uuid.UUID, app models.Application, reason string) {
+	failed, err := s.repo.GetByID(ctx, deployID)
+	if err != nil {
+		log.Printf("deploy %s: rollback: %v", deployID, err)
+		return
+	}
+	if err := s.repo.UpdateStatus(ctx, deployID, "ROLLED_BACK"); err != nil {
+		log.Printf("deploy %s: rollback: %v", deployID, err)
+		return
+	}
+	defer func() {
+		if err := s.discardRelease(ctx, appNamespace(&app), deployID); err != nil {
+			log.Printf("deploy %s: rollback: %v", deployID, err)
+		}
+	}()
+
+	previous, err := s.repo.GetSupersededBy(ctx, deployID)
+	if errors.Is(err, repository.ErrNotFound) {
+		previous, err = s.repo.GetLatestByApp(ctx, app.ID, "RUNNING")
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		msg := fmt.Sprintf("rolled back: %s; there is no earlier RUNNING release to restore", reason)
+		s.annotateRollback(ctx, failed, msg)
+		s.notifyRollback(ctx, failed, msg)
+		return
+	}
+	if err != nil {
+		log.Printf("deploy %s: rollback: find previous release: %v", deployID, err)
+		return
+	}
+
+	short := previous.ID.String()[0:8]
+	s.annotateRollback(ctx, failed, fmt.Sprintf("rolled back to %s: %s", short, reason))
+	s.annotateRollback(ctx, previous, fmt.Sprintf("restored after %s was rolled back: %s", deployID.String()[0:8], reason))
+
+	spec, err := livePodSpec(ctx, s.client, appNamespace(&app), previous.ID)
+	switch {
+	case apierrors.IsNotFound(err):
+		// its objects are gone, so queue the same image again, ahead of any
+		// deploy that was queued meanwhile rather than in place of it
+		redeploy := &models.Deployment{
+			ID:             uuid.New(),
+			AppID:          app.ID,
+			ImageURL:       previous.ImageURL,
+			ImageDigest:    previous.ImageDigest,
+			EnvironmentID:  previous.EnvironmentID,
+			ReleaseID:      previous.ReleaseID,
+			RollbackReason: fmt.Sprintf("redeploy of %s after %s was rolled back", short, deployID.String()[0:8]),
+		}
+		if err := s.repo.EnqueueAhead(ctx, redeploy); err != nil {
+			log.Printf("deploy %s: rollback: redeploy %s: %v", deployID, previous.ID, err)
+		}
+		s.notifyQueue()
+	case err != nil:
+		log.Printf("deploy %s: rollback: read previous release: %v", deployID, err)
+	default:
+		if previous.Status == "SUPERSEDED" {
+			// it was scaled to zero when the failed release went RUNNING
+			cfg := app.Config
+			if stored, err := s.appRepo.GetByID(ctx, app.ID); err == nil {
+				cfg = stored.Config
+			}
+			if err := s.scaleRelease(ctx, appNamespace(&app), previous.ID, appReplicas(cfg)); err != nil {
+				log.Printf("deploy %s: rollback: scale up %s: %v", deployID, previous.ID, err)
+			}
+			if err := s.repo.UpdateStatus(ctx, previous.ID, "RUNNING"); err != nil {
+				log.Printf("deploy %s: rollback: restore %s: %v", deployID, previous.ID, err)
+			}
+		}
+		// cron jobs moved to the failed image when it went RUNNING
+		if len(spec.Containers) > 0 {
+			if err := s.cronService.RebuildCronJobs(ctx, app.ID, *spec); err != nil {
+				log.Printf("deploy %s: rollback: rebuild cron jobs: %v", deployID, err)
+			}
+		}
+	}
+
+	s.notifyRollback(ctx, failed, fmt.Sprintf("release %s was rolled back to %s: %s", deployID.String()[0:8], short, reason))
+}
+
+func (s *deploymentService) annotateRollback(ctx context.Context, deploy *models.Deployment, reason string) {
+	if err := s.repo.SetRollbackReason(ctx, deploy.ID, reason); err != nil {
+		log.Printf("deploy %s: record rollback reason: %v", deploy.ID, err)
+	}
+	s.appendDeployLog(ctx, deploy, "deploy", "WARN", reason)
+}
+
+func (s *deploymentService) notifyRollback(ctx context.Context, failed *models.Deployment, message string) {
+	err := s.notifier.Notify(ctx, Notification{
+		Event:        eventDeploymentRolledBack,
+		AppID:        failed.AppID,
+		DeploymentID: failed.ID,
+		Message:      message,
+		Time:         time.Now(),
+	})
+	if err != nil {
+		log.Printf("deploy %s: notify rollback: %v", failed.ID, err)
+	}
+}
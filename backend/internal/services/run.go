@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrNoRunningDeployment = errors.New("application has no running deployment")
+	ErrEmptyCommand        = errors.New("run command is required")
+	ErrRunForbidden        = errors.New("you cannot run commands in this app")
+)
+
+const (
+	labelRunID = "run-id"
+
+	// how long StartRun waits for the job pod before handing out the stream
+	runPodStartTimeout = 60 * time.Second
+	runTimeout         = time.Hour
+	// finished run Jobs are left this long; their output is in the logs by then
+	runJobTTL = time.Hour
+)
+
+type runService struct {
+	repo        repository.RunRepository
+	appRepo     repository.AppRepository
+	deployRepo  repository.DeploymentRepository
+	logRepo     repository.LogRepository
+	teamService TeamService
+	client      *kubernetes.Clientset
+}
+
+func NewRunService(
+	repo repository.RunRepository,
+	appRepo repository.AppRepository,
+	deployRepo repository.DeploymentRepository,
+	logRepo repository.LogRepository,
+	teamService TeamService,
+	client *kubernetes.Clientset,
+) RunService {
+	return &runService{
+		repo:        repo,
+		appRepo:     appRepo,
+		deployRepo:  deployRepo,
+		logRepo:     logRepo,
+		teamService: teamService,
+		client:      client,
+	}
+}
+
+// StartRun runs command as a Job with the image and config vars of the app's
+// running release. The job gets the app's Secrets, so only users who may
+// manage the app can start one.
+func (s *runService) StartRun(ctx context.Context, user *models.User, appID uuid.UUID, command string) (*models.Run, error) {
+	if strings.TrimSpace(command) == "" {
+		return nil, ErrEmptyCommand
+	}
+	app, err := s.appRepo.GetByID(ctx, appID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return nil, err
+	}
+	namespace := appNamespace(app)
+
+	deploy, err := s.deployRepo.GetLatestByApp(ctx, appID, "RUNNING")
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrNoRunningDeployment
+		}
+		return nil, err
+	}
+
+	container, pullSecrets, err := s.releaseContainer(ctx, namespace, deploy)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &models.Run{
+		ID:           uuid.New(),
+		AppID:        appID,
+		DeploymentID: deploy.ID,
+		Command:      command,
+		Namespace:    namespace,
+		Status:       "PENDING",
+	}
+	run.JobName = fmt.Sprintf("run-%s", run.ID.String()[0:8])
+	if err := s.repo.Create(ctx, run); err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{
+		labelManagedBy: managedByPlatform,
+		labelAppID:     appID.String(),
+		labelRunID:     run.ID.String(),
+	}
+	job := buildJob(run.JobName, container.Image, command, container.Env, container.EnvFrom, labels)
+	job.Spec.Template.Spec.ImagePullSecrets = pullSecrets
+	job.Spec.TTLSecondsAfterFinished = int32Ptr(int32(runJobTTL / time.Second))
+	if _, err := s.client.BatchV1().Jobs(namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		run.Status = "FAILED"
+		_ = s.repo.UpdateResult(ctx, run)
+		return nil, fmt.Errorf("failed to create k8s job: %w", err)
+	}
+
+	// the caller streams logs right away, so wait for the pod to leave Pending
+	waitCtx, cancel := context.WithTimeout(ctx, runPodStartTimeout)
+	defer cancel()
+	if err := waitForJobPod(waitCtx, s.client, namespace, run.JobName); errors.Is(err, ErrPodCannotStart) {
+		// the job would never finish, so it goes and the run ends here
+		propagation := metav1.DeletePropagationBackground
+		_ = s.client.BatchV1().Jobs(namespace).Delete(ctx, run.JobName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		now := time.Now()
+		run.Status = "FAILED"
+		run.FinishedAt = &now
+		if err := s.repo.UpdateResult(ctx, run); err != nil {
+			return nil, err
+		}
+		_ = s.logRepo.Append(ctx, &models.Log{
+			DeploymentID: run.DeploymentID,
+			Message:      err.Error(),
+			Level:        "ERROR",
+			Source:       "run:" + run.JobName,
+		})
+		return run, nil
+	} else if err != nil {
+		log.Printf("run %s: pod not started: %v", run.ID, err)
+	}
+
+	now := time.Now()
+	run.Status = "RUNNING"
+	run.StartedAt = &now
+	if err := s.repo.UpdateResult(ctx, run); err != nil {
+		return nil, err
+	}
+
+	go s.trackRun(context.WithoutCancel(ctx), namespace, run)
+
+	return run, nil
+}
+
+// GetRun returns the run when user may manage its app.
+func (s *runService) GetRun(ctx context.Context, user *models.User, id uuid.UUID) (*models.Run, error) {
+	run, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	app, err := s.appRepo.GetByID(ctx, run.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireAccess(ctx, user, app); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// requireAccess returns ErrRunForbidden unless user may manage app.
+func (s *runService) requireAccess(ctx context.Context, user *models.User, app *models.Application) error {
+	ok, err := canManageApp(ctx, s.teamService, user, app)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrRunForbidden, app.Name)
+	}
+	return nil
+}
+
+// releaseContainer returns the container and pull secrets the release is
+// running with, falling back to the recorded image when the k8s Deployment is gone.
+func (s *runService) releaseContainer(ctx context.Context, namespace string, deploy *models.Deployment) (corev1.Container, []corev1.LocalObjectReference, error) {
+	spec, err := livePodSpec(ctx, s.client, namespace, deploy.ID)
+	if err == nil && len(spec.Containers) > 0 {
+		return spec.Containers[0], spec.ImagePullSecrets, nil
+	}
+	if deploy.ImageURL == "" {
+		return corev1.Container{}, nil, fmt.Errorf("deployment %s has no image", deploy.ID)
+	}
+	return corev1.Container{Image: deploy.PinnedImage()}, nil, nil
+}
+
+func (s *runService) trackRun(ctx context.Context, namespace string, run *models.Run) {
+	ctx, cancel := context.WithTimeout(ctx, runTimeout)
+	defer cancel()
+
+	job, succeeded, err := waitForJob(ctx, s.client, namespace, run.JobName)
+	if err != nil {
+		log.Printf("run %s: wait for job: %v", run.ID, err)
+	}
+
+	finished := time.Now()
+	if job != nil {
+		if job.Status.StartTime != nil {
+			started := job.Status.StartTime.Time
+			run.StartedAt = &started
+		}
+		if job.Status.CompletionTime != nil {
+			finished = job.Status.CompletionTime.Time
+		}
+	}
+	run.FinishedAt = &finished
+	if run.StartedAt != nil {
+		run.DurationMs = finished.Sub(*run.StartedAt).Milliseconds()
+	}
+
+	if code, err := jobExitCode(ctx, s.client, namespace, run.JobName); err == nil {
+		run.ExitCode = code
+	}
+
+	run.Status = "SUCCEEDED"
+	if !succeeded {
+		run.Status = "FAILED"
+	}
+	if err := s.repo.UpdateResult(ctx, run); err != nil {
+		log.Printf("run %s: update result: %v", run.ID, err)
+	}
+
+	// keep the output next to the release's logs once the pod is gone
+	lines, err := readJobLogs(ctx, s.client, namespace, run.JobName)
+	if err != nil {
+		log.Printf("run %s: read logs: %v", run.ID, err)
+	}
+	source := "run:" + run.JobName
+	for _, line := range lines {
+		_ = s.logRepo.Append(ctx, &models.Log{
+			DeploymentID: run.DeploymentID,
+			Message:      line,
+			Level:        "INFO",
+			Source:       source,
+		})
+	}
+}
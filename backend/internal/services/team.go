@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidTeam   = errors.New("invalid team")
+	ErrTeamExists    = errors.New("team already exists")
+	ErrNotTeamMember = errors.New("not a member of the team")
+)
+
+type teamService struct {
+	repo     repository.TeamRepository
+	userRepo repository.UserRepository
+}
+
+func NewTeamService(repo repository.TeamRepository, userRepo repository.UserRepository) TeamService {
+	return &teamService{repo: repo, userRepo: userRepo}
+}
+
+// CreateTeam creates a team with the creator as its first member.
+func (s *teamService) CreateTeam(ctx context.Context, user *models.User, name string) (*models.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be 1 to 100 characters", ErrInvalidTeam)
+	}
+	team := &models.Team{Name: name}
+	if err := s.repo.Create(ctx, team, user.ID); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, fmt.Errorf("%w: %s", ErrTeamExists, name)
+		}
+		return nil, err
+	}
+	return team, nil
+}
+
+func (s *teamService) ListTeams(ctx context.Context, userID uuid.UUID) ([]models.Team, error) {
+	return s.repo.ListByUser(ctx, userID)
+}
+
+// AddMember adds memberID to the team; only members can add others.
+func (s *teamService) AddMember(ctx context.Context, user *models.User, teamID, memberID uuid.UUID) error {
+	if err := s.RequireMember(ctx, teamID, user.ID); err != nil {
+		return err
+	}
+	if _, err := s.userRepo.GetByID(ctx, memberID); err != nil {
+		return err
+	}
+	if err := s.repo.AddMember(ctx, teamID, memberID); err != nil && !errors.Is(err, repository.ErrConflict) {
+		return err
+	}
+	return nil
+}
+
+// RequireMember returns ErrNotTeamMember unless userID belongs to the team.
+func (s *teamService) RequireMember(ctx context.Context, teamID, userID uuid.UUID) error {
+	if _, err := s.repo.GetByID(ctx, teamID); err != nil {
+		return err
+	}
+	ok, err := s.repo.IsMember(ctx, teamID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotTeamMember
+	}
+	return nil
+}
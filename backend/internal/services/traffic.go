@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"mini-paas/backend/internal/models"
+)
+
+// defaultTrafficQuery counts the requests ingress-nginx routed to the app's
+// Service.
+const defaultTrafficQuery = `sum(increase(nginx_ingress_controller_requests{service="$service"}[$window]))`
+
+// NewTrafficSourceFromEnv queries the Prometheus at PROMETHEUS_URL with
+// PROMETHEUS_TRAFFIC_QUERY. It returns nil when PROMETHEUS_URL is not set, in
+// which case idle apps are never scaled to zero.
+func NewTrafficSourceFromEnv() TrafficSource {
+	base := os.Getenv("PROMETHEUS_URL")
+	if base == "" {
+		return nil
+	}
+	query := os.Getenv("PROMETHEUS_TRAFFIC_QUERY")
+	if query == "" {
+		query = defaultTrafficQuery
+	}
+	return &prometheusTraffic{
+		base:  strings.TrimSuffix(base, "/"),
+		query: query,
+		http:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type prometheusTraffic struct {
+	base  string
+	query string
+	http  *http.Client
+}
+
+func (p *prometheusTraffic) Requests(ctx context.Context, app models.Application, window time.Duration) (float64, error) {
+	query := strings.NewReplacer(
+		"$app", app.Name,
+		"$service", appResourceName(app.ID),
+		"$window", fmt.Sprintf("%ds", int(window.Seconds())),
+	).Replace(p.query)
+
+	// a Service that was never requested has no series
+	n, _, err := queryPrometheus(ctx, p.http, p.base, query)
+	return n, err
+}
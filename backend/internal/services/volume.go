@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+
+	"mini-paas/backend/internal/models"
+	"mini-paas/backend/internal/repository"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+	ErrInvalidVolume   = errors.New("invalid volume")
+	ErrVolumeExists    = errors.New("volume already exists")
+	ErrVolumesAttached = errors.New("application has volumes, set purge_volumes to delete them")
+)
+
+var volumeNameRe = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+const labelVolumeName = "volume-name"
+
+type volumeService struct {
+	repo    repository.VolumeRepository
+	appRepo repository.AppRepository
+	quotas  QuotaService
+	client  *kubernetes.Clientset
+	// used when a volume does not name a StorageClass; empty means the cluster default
+	defaultStorageClass string
+}
+
+func NewVolumeService(repo repository.VolumeRepository, appRepo repository.AppRepository, quotas QuotaService, client *kubernetes.Clientset) VolumeService {
+	return &volumeService{
+		repo:                repo,
+		appRepo:             appRepo,
+		quotas:              quotas,
+		client:              client,
+		defaultStorageClass: os.Getenv("DEFAULT_STORAGE_CLASS"),
+	}
+}
+
+// CreateVolume records the volume and provisions its PersistentVolumeClaim.
+func (s *volumeService) CreateVolume(ctx context.Context, v *models.Volume) (*models.Volume, error) {
+	app, err := s.appRepo.GetByID(ctx, v.AppID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateVolume(v); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.ListByApp(ctx, v.AppID)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range existing {
+		if e.Name == v.Name {
+			return nil, fmt.Errorf("%w: %s", ErrVolumeExists, v.Name)
+		}
+		if e.MountPath == v.MountPath {
+			return nil, fmt.Errorf("%w: mount path %s is used by %s", ErrInvalidVolume, v.MountPath, e.Name)
+		}
+	}
+	if err := s.quotas.CheckVolume(ctx, v.AppID); err != nil {
+		return nil, err
+	}
+
+	if v.StorageClass == "" {
+		v.StorageClass = s.defaultStorageClass
+	}
+	v.ClaimName = fmt.Sprintf("vol-%s-%s", v.AppID.String()[0:8], v.Name)
+
+	// the claim has to be in the namespace of the pods that mount it
+	namespace := appNamespace(app)
+	if err := ensureNamespace(ctx, s.client, namespace); err != nil {
+		return nil, err
+	}
+	pvc := buildPersistentVolumeClaim(v)
+	if _, err := s.client.CoreV1().PersistentVolumeClaims(namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to create k8s pvc: %w", err)
+	}
+
+	if err := s.repo.Create(ctx, v); err != nil {
+		_ = s.deleteClaim(ctx, namespace, v.ClaimName)
+		return nil, err
+	}
+	return v, nil
+}
+
+func (s *volumeService) ListVolumes(ctx context.Context, appID uuid.UUID) ([]models.Volume, error) {
+	return s.repo.ListByApp(ctx, appID)
+}
+
+// DeleteVolume destroys the claim and with it the data of the volume.
+func (s *volumeService) DeleteVolume(ctx context.Context, appID, id uuid.UUID) error {
+	v, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if v.AppID != appID {
+		return repository.ErrNotFound
+	}
+	namespace, err := namespaceOf(ctx, s.appRepo, appID)
+	if err != nil {
+		return err
+	}
+	if err := s.deleteClaim(ctx, namespace, v.ClaimName); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// DeleteAppVolumes destroys every volume of an app.
+func (s *volumeService) DeleteAppVolumes(ctx context.Context, appID uuid.UUID) error {
+	volumes, err := s.repo.ListByApp(ctx, appID)
+	if err != nil {
+		return err
+	}
+	for _, v := range volumes {
+		if err := s.DeleteVolume(ctx, appID, v.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *volumeService) deleteClaim(ctx context.Context, namespace, claimName string) error {
+	err := s.client.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, claimName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete k8s pvc: %w", err)
+	}
+	return nil
+}
+
+func buildPersistentVolumeClaim(v *models.Volume) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: v.ClaimName,
+			Labels: map[string]string{
+				labelManagedBy:  managedByPlatform,
+				labelAppID:      v.AppID.String(),
+				labelVolumeName: v.Name,
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.PersistentVolumeAccessMode(v.AccessMode)},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: resource.MustParse(v.Size),
+				},
+			},
+		},
+	}
+	if v.StorageClass != "" {
+		sc := v.StorageClass
+		pvc.Spec.StorageClassName = &sc
+	}
+	return pvc
+}
+
+func validateVolume(v *models.Volume) error {
+	if !volumeNameRe.MatchString(v.Name) || len(v.Name) > 40 {
+		return fmt.Errorf("%w: name must be a lowercase DNS label of at most 40 characters", ErrInvalidVolume)
+	}
+	if _, err := resource.ParseQuantity(v.Size); err != nil {
+		return fmt.Errorf("%w: size %q", ErrInvalidVolume, v.Size)
+	}
+	if !path.IsAbs(v.MountPath) {
+		return fmt.Errorf("%w: mount path must be absolute", ErrInvalidVolume)
+	}
+
+	switch corev1.PersistentVolumeAccessMode(v.AccessMode) {
+	case "":
+		v.AccessMode = string(corev1.ReadWriteOnce)
+	case corev1.ReadWriteOnce, corev1.ReadOnlyMany, corev1.ReadWriteMany:
+	default:
+		return fmt.Errorf("%w: access mode %q", ErrInvalidVolume, v.AccessMode)
+	}
+	return nil
+}
+
+// podVolumes returns the pod volumes and container mounts for an app's claims.
+func podVolumes(volumes []models.Volume) ([]corev1.Volume, []corev1.VolumeMount) {
+	var podVols []corev1.Volume
+	var mounts []corev1.VolumeMount
+	for _, v := range volumes {
+		podVols = append(podVols, corev1.Volume{
+			Name: v.Name,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: v.ClaimName},
+			},
+		})
+		mounts = append(mounts, corev1.VolumeMount{Name: v.Name, MountPath: v.MountPath})
+	}
+	return podVols, mounts
+}
+
+// hasReadWriteOnce reports whether a rolling update would have two pods fight
+// over a single-writer claim.
+func hasReadWriteOnce(volumes []models.Volume) bool {
+	for _, v := range volumes {
+		if v.AccessMode == string(corev1.ReadWriteOnce) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mini-paas/backend/internal/models"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// noTraffic reports every app as idle.
+type noTraffic struct{}
+
+func (noTraffic) Requests(context.Context, models.Application, time.Duration) (float64, error) {
+	return 0, nil
+}
+
+const sleepyAppYAML = `
+name: sleepy-app
+source:
+  image: nginx:stable
+port: 80
+scaling:
+  idle_timeout_seconds: 60
+`
+
+func TestScaleToZeroIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"sleepy-user","email":"sleepy-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+
+	bad := strings.Replace(sleepyAppYAML, "60", "10", 1)
+	if resp, body := applyManifest(t, userID, bad); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("apply with a too short idle timeout expected 400 got %d: %v", resp.StatusCode, body)
+	}
+
+	resp, app := applyManifest(t, userID, sleepyAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+	appURL := testServer.URL + "/api/apps/app/" + appID
+
+	resp, domain := doAsUser(t, http.MethodPost, appURL+"/domains", "", `{"hostname":"sleepy.example.com","tls":"none"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add domain expected 201 got %d: %v", resp.StatusCode, domain)
+	}
+	challenge := domain["challenge"].(map[string]interface{})
+	dnsRecords.publish(challenge["name"].(string), challenge["value"].(string))
+	if resp, body := doAsUser(t, http.MethodPost, appURL+"/domains/"+domain["id"].(string)+"/verify", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify expected 200 got %d: %v", resp.StatusCode, body)
+	}
+
+	resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, created["id"].(string), 120*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+
+	// without traffic the app goes to sleep once its idle timeout is over
+	deadline := time.Now().Add(150 * time.Second)
+	for {
+		_, got := doAsUser(t, http.MethodGet, appURL, "", "")
+		if got["sleeping_since"] != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("app did not go to sleep: %v", got)
+		}
+		time.Sleep(2 * time.Second)
+	}
+	if typ := latestHistoryEvent(t, appURL); typ != models.EventSlept {
+		t.Fatalf("expected a slept event in the history got %q", typ)
+	}
+
+	// the activator reaches the app through the API server's service proxy,
+	// which the app namespace's default-deny must let in
+	var stored models.Application
+	if err := testDB.First(&stored, "id = ?", appID).Error; err != nil {
+		t.Fatal(err)
+	}
+	namespace := stored.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	policy, err := testK8s.NetworkingV1().NetworkPolicies(namespace).Get(context.Background(), "allow-from-api-server", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get the api server network policy: %v", err)
+	}
+	if len(policy.Spec.Ingress) != 1 || len(policy.Spec.Ingress[0].From) == 0 || policy.Spec.Ingress[0].From[0].IPBlock == nil {
+		t.Fatalf("expected the policy to let in the api server's addresses got %+v", policy.Spec.Ingress)
+	}
+
+	// the activator wakes the app and proxies the request through
+	req, _ := http.NewRequest(http.MethodGet, activatorServer.URL+"/", nil)
+	req.Host = "sleepy.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "nginx") {
+		t.Fatalf("request through the activator expected the nginx page got %d: %s", resp.StatusCode, body)
+	}
+
+	_, got := doAsUser(t, http.MethodGet, appURL, "", "")
+	if got["sleeping_since"] != nil {
+		t.Fatalf("expected the app to be awake got %v", got)
+	}
+	if typ := latestHistoryEvent(t, appURL); typ != models.EventWoke {
+		t.Fatalf("expected a woke event in the history got %q", typ)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, activatorServer.URL+"/", nil)
+	req.Host = "unknown.example.com"
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("request for an unknown host expected 404 got %d", resp.StatusCode)
+	}
+}
+
+func latestHistoryEvent(t *testing.T, appURL string) string {
+	t.Helper()
+	resp, history := doAsUser(t, http.MethodGet, appURL+"/history", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("history expected 200 got %d", resp.StatusCode)
+	}
+	items, _ := history["items"].([]interface{})
+	if len(items) == 0 {
+		return ""
+	}
+	typ, _ := items[0].(map[string]interface{})["type"].(string)
+	return typ
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mini-paas/backend/internal/models"
+)
+
+func TestAddOnIntegration(t *testing.T) {
+	// catalog
+	catResp, err := http.Get(testServer.URL + "/api/addons/catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catResp.Body.Close()
+	if catResp.StatusCode != http.StatusOK {
+		t.Fatalf("addon catalog expected 200 got %d", catResp.StatusCode)
+	}
+
+	// create app
+	appPayload := `{"name":"addon-app", "git_url":"https://example.com/repo.git"}`
+	owner := newTestUser(t, "addon-owner")
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, appPayload)
+	if appResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+	addOnsURL := testServer.URL + "/api/apps/app/" + appID + "/addons"
+
+	// unknown type
+	badResp, _ := http.Post(addOnsURL, "application/json", strings.NewReader(`{"type":"mongodb"}`))
+	badResp.Body.Close()
+	if badResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown addon type expected 400 got %d", badResp.StatusCode)
+	}
+
+	// provision
+	resp, err := http.Post(addOnsURL, "application/json", strings.NewReader(`{"type":"postgres"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("provision addon expected 202 got %d", resp.StatusCode)
+	}
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	addOnID := created["id"].(string)
+	if created["config_var"] != "DATABASE_URL" {
+		t.Fatalf("expected DATABASE_URL got %v", created["config_var"])
+	}
+
+	// a second database would shadow DATABASE_URL
+	dupResp, _ := http.Post(addOnsURL, "application/json", strings.NewReader(`{"type":"postgres"}`))
+	dupResp.Body.Close()
+	if dupResp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate addon expected 409 got %d", dupResp.StatusCode)
+	}
+
+	// get
+	resp2, _ := http.Get(addOnsURL + "/" + addOnID)
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("get addon expected 200 got %d", resp2.StatusCode)
+	}
+	resp2.Body.Close()
+
+	// deprovision
+	req, _ := http.NewRequest(http.MethodDelete, addOnsURL+"/"+addOnID, nil)
+	resp3, _ := http.DefaultClient.Do(req)
+	if resp3.StatusCode != http.StatusAccepted {
+		t.Fatalf("deprovision addon expected 202 got %d", resp3.StatusCode)
+	}
+	resp3.Body.Close()
+
+	// binding and unbinding DATABASE_URL each make a release
+	_, releases := doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+appID+"/releases", "", "")
+	items, _ := releases["items"].([]interface{})
+	if len(items) != 3 || items[0].(map[string]interface{})["reason"] != "add-on change" || items[1].(map[string]interface{})["reason"] != "add-on change" {
+		t.Fatalf("expected the app's creation and two add-on changes got %v", releases)
+	}
+
+	// deleting the app deletes the add-ons it still has
+	resp, redis := doAsUser(t, http.MethodPost, addOnsURL, "", `{"type":"redis"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("provision redis expected 202 got %d: %v", resp.StatusCode, redis)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, testServer.URL+"/api/apps/app/"+appID, owner, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete app expected 200 got %d", resp.StatusCode)
+	}
+	var addOn models.AddOn
+	if err := testDB.First(&addOn, "id = ?", redis["id"]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if addOn.Status != "DEPROVISIONED" {
+		t.Fatalf("expected the add-on of the deleted app to be deprovisioned got %s", addOn.Status)
+	}
+}
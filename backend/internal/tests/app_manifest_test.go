@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mini-paas/backend/internal/models"
+)
+
+const testAppYAML = `
+name: manifest-app
+description: declared in app.yaml
+source:
+  image: nginx:1.25
+port: 8081
+env:
+  GREETING: hello
+resources:
+  cpu_request: 100m
+  memory_limit: 256Mi
+probes:
+  readiness:
+    path: /healthz
+scaling:
+  replicas: 2
+domains:
+  - manifest.example.com
+`
+
+func applyManifest(t *testing.T, userID, body string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPut, testServer.URL+"/api/apps/apply", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/yaml")
+	if userID != "" {
+		req.Header.Set("X-User-ID", userID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var out map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp, out
+}
+
+func TestAppManifestIntegration(t *testing.T) {
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	owner, other := newUser("manifest-owner"), newUser("manifest-other")
+
+	if resp, _ := applyManifest(t, "", testAppYAML); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("apply without user expected 401 got %d", resp.StatusCode)
+	}
+
+	// first apply creates the app
+	resp, created := applyManifest(t, owner, testAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, created)
+	}
+	appID := created["id"].(string)
+
+	// applying the same manifest again updates in place
+	resp, updated := applyManifest(t, owner, testAppYAML)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("re-apply expected 200 got %d: %v", resp.StatusCode, updated)
+	}
+	if updated["id"] != appID {
+		t.Fatalf("re-apply created a new app: %v != %s", updated["id"], appID)
+	}
+
+	// another user cannot take the app over by applying a manifest of the same name
+	hijack := strings.Replace(testAppYAML, "nginx:1.25", "evil/nginx:latest", 1)
+	if resp, out := applyManifest(t, other, hijack); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("apply over another user's app expected 403 got %d: %v", resp.StatusCode, out)
+	}
+	var app models.Application
+	if err := testDB.First(&app, "id = ?", appID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if app.ImageURL != "nginx:1.25" {
+		t.Fatalf("expected the owner's image to be kept got %q", app.ImageURL)
+	}
+
+	// export round-trips the settings
+	exportResp, err := http.Get(testServer.URL + "/api/apps/app/" + appID + "/manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(exportResp.Body)
+	exportResp.Body.Close()
+	if exportResp.StatusCode != http.StatusOK {
+		t.Fatalf("export expected 200 got %d", exportResp.StatusCode)
+	}
+	for _, want := range []string{"name: manifest-app", "image: nginx:1.25", "port: 8081", "GREETING: hello", "replicas: 2", "manifest.example.com"} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("export missing %q:\n%s", want, body)
+		}
+	}
+
+	// invalid manifests are rejected with every problem listed
+	invalid := `
+name: Bad_Name
+source:
+  image: nginx
+  git: https://example.com/repo.git
+port: 70000
+`
+	resp, errBody := applyManifest(t, owner, invalid)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid manifest expected 400 got %d", resp.StatusCode)
+	}
+	if details, _ := errBody["details"].([]interface{}); len(details) != 3 {
+		t.Fatalf("expected 3 problems got %v", errBody["details"])
+	}
+
+	// unknown fields are typos, not silently ignored
+	resp, _ = applyManifest(t, owner, testAppYAML+"replica: 3\n")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown field expected 400 got %d", resp.StatusCode)
+	}
+}
@@ -1,31 +1,24 @@
 package tests
 
 import (
-	"encoding/json"
-	"io"
 	"net/http"
-	"strings"
 	"testing"
 )
 
 func TestAppIntegration(t *testing.T) {
-	//	create
+	owner, other := newTestUser(t, "app-owner"), newTestUser(t, "app-other")
+
+	//	create, which an anonymous caller may not: nothing would count the app
 	payload := `{"name":"test-app", "git_url":"https://example.com/repo.git", "description":"intergration_test"}`
-	resp, err := http.Post(
-		testServer.URL+"/api/apps",
-		"application/json",
-		strings.NewReader(payload))
-	if err != nil {
-		t.Fatalf("failed to create app: %v", err)
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", "", payload); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous create expected 401 got %d", resp.StatusCode)
 	}
-	defer resp.Body.Close()
+	resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, payload)
 	if resp.StatusCode != http.StatusCreated {
 		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
 	}
-	body, _ := io.ReadAll(resp.Body)
-	var created map[string]interface{}
-	json.Unmarshal(body, &created)
 	appID := created["id"].(string)
+	appURL := testServer.URL + "/api/apps/app/" + appID
 
 	//	get by id
 	resp2, _ := http.Get(testServer.URL + "/api/apps/app/" + appID)
@@ -41,13 +34,21 @@ func TestAppIntegration(t *testing.T) {
 	}
 	resp3.Body.Close()
 
+	//	only those who manage the app change or delete it
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		if resp, _ := doAsUser(t, method, appURL, "", `{"release_command":"env"}`); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("%s app without user expected 401 got %d", method, resp.StatusCode)
+		}
+		if resp, _ := doAsUser(t, method, appURL, other, `{"release_command":"env"}`); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s another user's app expected 403 got %d", method, resp.StatusCode)
+		}
+	}
+	if resp, updated := doAsUser(t, http.MethodPatch, appURL, owner, `{"description":"updated"}`); resp.StatusCode != http.StatusOK || updated["description"] != "updated" {
+		t.Fatalf("update app expected 200 got %d: %v", resp.StatusCode, updated)
+	}
+
 	//	delete
-	req, _ := http.NewRequest(
-		http.MethodDelete,
-		testServer.URL+"/api/apps/app/"+appID, nil)
-	resp4, _ := http.DefaultClient.Do(req)
-	if resp4.StatusCode != http.StatusOK {
-		t.Fatalf("delete app expected 200 got %d", resp4.StatusCode)
+	if resp, _ := doAsUser(t, http.MethodDelete, appURL, owner, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete app expected 200 got %d", resp.StatusCode)
 	}
-	resp4.Body.Close()
 }
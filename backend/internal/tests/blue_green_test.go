@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const blueGreenAppYAML = `
+name: blue-green-app
+source:
+  image: nginx:stable
+port: 80
+strategy:
+  type: blue-green
+  keep_idle_seconds: 600
+`
+
+func TestBlueGreenIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"bg-user","email":"bg-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+	resp, other := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"bg-other","email":"bg-other@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	otherID := other["id"].(string)
+
+	resp, app := applyManifest(t, userID, blueGreenAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+
+	deploy := func(image string) string {
+		t.Helper()
+		resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"`+image+`"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+		}
+		id := created["id"].(string)
+		if status := waitForDeployment(t, id, 90*time.Second); status != "READY" {
+			t.Fatalf("blue/green release expected READY got %q", status)
+		}
+		return id
+	}
+	get := func(id string) map[string]interface{} {
+		t.Helper()
+		_, body := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+id, "", "")
+		return body
+	}
+	promote := func(id string) {
+		t.Helper()
+		resp, body := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+id+"/promote", userID, "")
+		if resp.StatusCode != http.StatusOK || body["status"] != "RUNNING" {
+			t.Fatalf("promote expected 200 RUNNING got %d %v", resp.StatusCode, body)
+		}
+	}
+
+	// the first release waits next to nothing until it is promoted
+	blueID := deploy("nginx:stable")
+
+	// only users who can manage the app flip or drop its releases
+	for _, action := range []string{"promote", "discard"} {
+		if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+blueID+"/"+action, otherID, ""); resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("%s of another user's release expected 403 got %d", action, resp.StatusCode)
+		}
+	}
+	blue := get(blueID)
+	if blue["color"] != "blue" {
+		t.Fatalf("first release expected blue got %v", blue["color"])
+	}
+	previewURL, _ := blue["preview_url"].(string)
+	if previewURL == "" {
+		t.Fatalf("READY release has no preview_url: %v", blue)
+	}
+
+	// the preview is private and reaches the new pods
+	if resp, _ := doAsUser(t, http.MethodGet, testServer.URL+previewURL, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous preview expected 401 got %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest(http.MethodGet, testServer.URL+previewURL, nil)
+	req.Header.Set("X-User-ID", userID)
+	previewResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := io.ReadAll(previewResp.Body)
+	previewResp.Body.Close()
+	if previewResp.StatusCode != http.StatusOK || !strings.Contains(string(page), "nginx") {
+		t.Fatalf("preview expected the nginx page got %d: %.200s", previewResp.StatusCode, page)
+	}
+	promote(blueID)
+
+	// the next release is green and replaces blue, which is kept idle
+	greenID := deploy("nginx:alpine")
+	if green := get(greenID); green["color"] != "green" {
+		t.Fatalf("second release expected green got %v", green["color"])
+	}
+	promote(greenID)
+	blue = get(blueID)
+	if blue["status"] != "IDLE" || blue["retire_at"] == nil {
+		t.Fatalf("replaced release expected IDLE with retire_at got %v", blue)
+	}
+
+	// promoting the idle color is an instant rollback
+	promote(blueID)
+	if green := get(greenID); green["status"] != "IDLE" {
+		t.Fatalf("rolled back release expected IDLE got %v", green["status"])
+	}
+
+	// a release that fails its smoke test is discarded without taking traffic
+	nextID := deploy("nginx:stable-alpine")
+	resp, discarded := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+nextID+"/discard", userID, "")
+	if resp.StatusCode != http.StatusOK || discarded["status"] != "DISCARDED" {
+		t.Fatalf("discard expected 200 DISCARDED got %d %v", resp.StatusCode, discarded)
+	}
+	if live := get(blueID); live["status"] != "RUNNING" {
+		t.Fatalf("live release expected RUNNING got %v", live["status"])
+	}
+
+	// only READY or IDLE blue/green releases can be promoted
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+nextID+"/promote", userID, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("promote of discarded release expected 409 got %d", resp.StatusCode)
+	}
+}
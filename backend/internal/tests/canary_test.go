@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const canaryAppYAML = `
+name: canary-app
+source:
+  image: nginx:stable
+port: 80
+scaling:
+  replicas: 4
+strategy:
+  type: canary
+  canary_steps: [25, 50]
+`
+
+func TestCanaryIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"canary-user","email":"canary-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+	resp, other := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"canary-other","email":"canary-other@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	otherID := other["id"].(string)
+
+	// steps have to increase
+	bad := strings.Replace(canaryAppYAML, "[25, 50]", "[50, 25]", 1)
+	if resp, body := applyManifest(t, userID, bad); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("apply with decreasing steps expected 400 got %d: %v", resp.StatusCode, body)
+	}
+
+	resp, app := applyManifest(t, userID, canaryAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+
+	deploy := func(image, want string) string {
+		t.Helper()
+		resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"`+image+`"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+		}
+		id := created["id"].(string)
+		if status := waitForDeployment(t, id, 120*time.Second); status != want {
+			t.Fatalf("deployment expected %s got %q", want, status)
+		}
+		return id
+	}
+	status := func(id string) map[string]interface{} {
+		t.Helper()
+		_, body := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+id+"/status", "", "")
+		return body
+	}
+	advance := func(id string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		return doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+id+"/advance", userID, "")
+	}
+
+	// the first release has nothing to be a canary of
+	stableID := deploy("nginx:stable", "RUNNING")
+	if s := status(stableID); s["canary"] != nil {
+		t.Fatalf("first release should not be a canary: %v", s)
+	}
+
+	// the second starts on the first step: 1 of 4 pods
+	canaryID := deploy("nginx:alpine", "CANARY")
+	s := status(canaryID)
+	canary, _ := s["canary"].(map[string]interface{})
+	if canary == nil || canary["step"] != float64(1) || canary["weight"] != float64(25) || canary["stable_id"] != stableID {
+		t.Fatalf("canary expected step 1 at 25%% of %s got %v", stableID, s)
+	}
+	if canary["canary_replicas"] != float64(1) || canary["stable_replicas"] != float64(3) {
+		t.Fatalf("canary expected 1 canary and 3 stable pods got %v", canary)
+	}
+
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+canaryID+"/advance", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous advance expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+canaryID+"/advance", otherID, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("advance of another user's canary expected 403 got %d", resp.StatusCode)
+	}
+	if resp, body := advance(canaryID); resp.StatusCode != http.StatusOK || body["status"] != "CANARY" {
+		t.Fatalf("advance expected 200 CANARY got %d %v", resp.StatusCode, body)
+	}
+	if canary, _ := status(canaryID)["canary"].(map[string]interface{}); canary["step"] != float64(2) || canary["weight"] != float64(50) {
+		t.Fatalf("canary expected step 2 at 50%% got %v", canary)
+	}
+
+	// the last step promotes it and retires the stable release
+	if resp, body := advance(canaryID); resp.StatusCode != http.StatusOK || body["status"] != "RUNNING" {
+		t.Fatalf("final advance expected 200 RUNNING got %d %v", resp.StatusCode, body)
+	}
+	if s := status(stableID); s["status"] != "RETIRED" {
+		t.Fatalf("stable release expected RETIRED got %v", s["status"])
+	}
+	events, _ := status(canaryID)["events"].([]interface{})
+	if len(events) != 3 {
+		t.Fatalf("expected 2 steps and a promotion event got %v", events)
+	}
+	if last := events[2].(map[string]interface{}); last["type"] != "canary_promoted" || last["weight"] != float64(100) {
+		t.Fatalf("last event expected canary_promoted at 100%% got %v", last)
+	}
+
+	if resp, _ := advance(canaryID); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("advance of a promoted release expected 409 got %d", resp.StatusCode)
+	}
+}
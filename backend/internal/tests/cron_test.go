@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"mini-paas/backend/internal/models"
+)
+
+func TestCronIntegration(t *testing.T) {
+	// create app
+	appPayload := `{"name":"cron-app", "git_url":"https://example.com/repo.git"}`
+	owner := newTestUser(t, "cron-owner")
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, appPayload)
+	if appResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+	cronURL := testServer.URL + "/api/apps/app/" + appID + "/cron"
+
+	// invalid schedule
+	badPayload := `{"name":"cleanup", "schedule":"every minute", "command":"echo hi"}`
+	badResp, err := http.Post(cronURL, "application/json", strings.NewReader(badPayload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badResp.Body.Close()
+	if badResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid schedule expected 400 got %d", badResp.StatusCode)
+	}
+
+	// create
+	payload := `{"name":"cleanup", "schedule":"*/5 * * * *", "command":"echo hi"}`
+	resp, err := http.Post(cronURL, "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create cron job expected 201 got %d", resp.StatusCode)
+	}
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	cronID := created["id"].(string)
+	if created["concurrency_policy"] != "Forbid" {
+		t.Fatalf("expected default concurrency policy Forbid got %v", created["concurrency_policy"])
+	}
+
+	// update
+	updatePayload := `{"name":"cleanup", "schedule":"0 * * * *", "command":"echo bye", "concurrency_policy":"Replace"}`
+	req, _ := http.NewRequest(http.MethodPut, cronURL+"/"+cronID, strings.NewReader(updatePayload))
+	req.Header.Set("Content-Type", "application/json")
+	resp2, _ := http.DefaultClient.Do(req)
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("update cron job expected 200 got %d", resp2.StatusCode)
+	}
+	resp2.Body.Close()
+
+	// list
+	resp3, _ := http.Get(cronURL)
+	if resp3.StatusCode != http.StatusOK {
+		t.Fatalf("list cron jobs expected 200 got %d", resp3.StatusCode)
+	}
+	resp3.Body.Close()
+
+	// delete
+	req2, _ := http.NewRequest(http.MethodDelete, cronURL+"/"+cronID, nil)
+	resp4, _ := http.DefaultClient.Do(req2)
+	if resp4.StatusCode != http.StatusOK {
+		t.Fatalf("delete cron job expected 200 got %d", resp4.StatusCode)
+	}
+	resp4.Body.Close()
+
+	// deleting the app takes its cron jobs with it
+	if resp, body := doAsUser(t, http.MethodPost, cronURL, "", payload); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create cron job expected 201 got %d: %v", resp.StatusCode, body)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, testServer.URL+"/api/apps/app/"+appID, owner, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete app expected 200 got %d", resp.StatusCode)
+	}
+	var left int64
+	if err := testDB.Model(&models.CronJob{}).Where("app_id = ?", appID).Count(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if left != 0 {
+		t.Fatalf("expected the app's cron jobs to be deleted, %d left", left)
+	}
+}
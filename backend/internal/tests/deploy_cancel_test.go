@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestDeployCancelIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"canceller","email":"canceller@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+	resp, other := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"cancel-other","email":"cancel-other@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	otherID := other["id"].(string)
+
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", userID, `{"name":"cancel-app", "git_url":"https://example.com/repo.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+uuid.NewString()+"/cancel", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous cancel expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+uuid.NewString()+"/cancel", userID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("cancel of unknown deployment expected 404 got %d", resp.StatusCode)
+	}
+
+	// a first release that runs
+	resp, first := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	firstID := first["id"].(string)
+	if status := waitForDeployment(t, firstID, 90*time.Second); status != "RUNNING" {
+		t.Fatalf("first deployment expected RUNNING got %q", status)
+	}
+
+	// a second one cancelled while it is queued or rolling out
+	resp, second := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v2", "image_url":"nginx:alpine"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	secondID := second["id"].(string)
+
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+secondID+"/cancel", otherID, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cancel of another user's deployment expected 403 got %d", resp.StatusCode)
+	}
+	resp, cancelled := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+secondID+"/cancel", userID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("cancel expected 200 got %d: %v", resp.StatusCode, cancelled)
+	}
+	if cancelled["status"] != "CANCELLED" || cancelled["cancelled_by"] != userID {
+		t.Fatalf("expected CANCELLED by %s got %v", userID, cancelled)
+	}
+
+	// the cancelled deployment stays cancelled and the first keeps running
+	time.Sleep(10 * time.Second)
+	_, status := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+secondID+"/status", "", "")
+	if status["status"] != "CANCELLED" {
+		t.Fatalf("cancelled deployment expected CANCELLED got %v", status["status"])
+	}
+	_, status = doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+firstID+"/status", "", "")
+	if status["status"] != "RUNNING" {
+		t.Fatalf("previous deployment expected RUNNING got %v", status["status"])
+	}
+
+	// finished deployments cannot be cancelled
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+secondID+"/cancel", userID, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second cancel expected 409 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/"+firstID+"/cancel", userID, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("cancel of running deployment expected 409 got %d", resp.StatusCode)
+	}
+}
+
+// waitForDeployment polls the status API until the deployment leaves the
+// queue and its rollout, and returns the last status seen.
+func waitForDeployment(t *testing.T, id string, timeout time.Duration) string {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	var status string
+	for time.Now().Before(deadline) {
+		_, body := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+id+"/status", "", "")
+		status, _ = body["status"].(string)
+		switch status {
+		case "RUNNING", "READY", "CANARY", "FAILED", "CANCELLED", "SUPERSEDED":
+			return status
+		}
+		time.Sleep(3 * time.Second)
+	}
+	return status
+}
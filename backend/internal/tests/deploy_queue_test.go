@@ -0,0 +1,65 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeployQueueIntegration(t *testing.T) {
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", newTestUser(t, "queue-owner"), `{"name":"queue-app", "git_url":"https://example.com/repo.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+
+	// three deploys in a row: each is queued, and the app never rolls out
+	// more than one at a time
+	var ids []string
+	for _, image := range []string{"nginx:stable", "nginx:stable-alpine", "nginx:alpine"} {
+		payload := `{"app_id":"` + appID + `", "version":"v1", "image_url":"` + image + `"}`
+		resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", payload)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+		}
+		if created["status"] != "QUEUED" {
+			t.Fatalf("expected QUEUED got %v", created["status"])
+		}
+		ids = append(ids, created["id"].(string))
+	}
+
+	// the last request is the one that ends up running
+	deadline := time.Now().Add(120 * time.Second)
+	var lastStatus string
+	for time.Now().Before(deadline) {
+		_, status := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+ids[2]+"/status", "", "")
+		lastStatus, _ = status["status"].(string)
+		if lastStatus == "QUEUED" {
+			if pos, _ := status["queue_position"].(float64); pos < 1 {
+				t.Fatalf("queued deployment without a queue position: %v", status)
+			}
+		}
+		if lastStatus == "RUNNING" || lastStatus == "FAILED" {
+			break
+		}
+		time.Sleep(3 * time.Second)
+	}
+	if lastStatus != "RUNNING" {
+		t.Fatalf("latest deployment expected RUNNING got %q", lastStatus)
+	}
+
+	// a request still waiting when a newer one arrived was skipped
+	superseded := 0
+	for _, id := range ids[:2] {
+		_, status := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+id+"/status", "", "")
+		switch status["status"] {
+		case "SUPERSEDED":
+			superseded++
+		case "QUEUED", "PENDING", "RELEASING", "DEPLOYING":
+			t.Fatalf("deployment %s still active after a newer one finished: %v", id, status["status"])
+		}
+	}
+	if superseded == 0 {
+		t.Fatalf("expected an earlier deployment to be superseded")
+	}
+}
@@ -12,20 +12,10 @@ import (
 func TestDeploymentIntegration(t *testing.T) {
 	// create app prerequisite
 	appPayload := `{"name":"dep-app", "git_url":"https://example.com/repo.git"}`
-	appResp, err := http.Post(
-		testServer.URL+"/api/apps",
-		"application/json",
-		strings.NewReader(appPayload),
-	)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer appResp.Body.Close()
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", newTestUser(t, "dep-owner"), appPayload)
 	if appResp.StatusCode != http.StatusCreated {
 		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
 	}
-	var appCreated map[string]interface{}
-	json.NewDecoder(appResp.Body).Decode(&appCreated)
 	appID := appCreated["id"].(string)
 
 	//  deploy app to Minikube
@@ -47,6 +37,14 @@ func TestDeploymentIntegration(t *testing.T) {
 	json.NewDecoder(resp.Body).Decode(&created)
 	deployID := created["id"].(string)
 
+	// the tag is resolved and pinned to a digest
+	if created["image_url"] != "nginx:stable" {
+		t.Fatalf("expected image_url nginx:stable got %v", created["image_url"])
+	}
+	if digest, _ := created["image_digest"].(string); !strings.HasPrefix(digest, "sha256:") {
+		t.Fatalf("expected a sha256 image_digest got %v", created["image_digest"])
+	}
+
 	// poll status until RUNNING or FAILED or timeout
 	deadline := time.Now().Add(90 * time.Second)
 	var lastStatus string
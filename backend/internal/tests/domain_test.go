@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubResolver answers TXT lookups from records the tests publish.
+type stubResolver struct {
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+var dnsRecords = &stubResolver{records: map[string][]string{}}
+
+func (r *stubResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	txt, ok := r.records[name]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", name)
+	}
+	return txt, nil
+}
+
+func (r *stubResolver) publish(name, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[name] = append(r.records[name], value)
+}
+
+func TestDomainIntegration(t *testing.T) {
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", newTestUser(t, "domain-owner"), `{"name":"domain-app", "git_url":"https://example.com/repo.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	domainsURL := testServer.URL + "/api/apps/app/" + app["id"].(string) + "/domains"
+
+	if resp, _ := doAsUser(t, http.MethodPost, domainsURL, "", `{"hostname":"not a host"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid hostname expected 400 got %d", resp.StatusCode)
+	}
+
+	resp, domain := doAsUser(t, http.MethodPost, domainsURL, "", `{"hostname":"Shop.Example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add domain expected 201 got %d: %v", resp.StatusCode, domain)
+	}
+	if domain["hostname"] != "shop.example.com" || domain["verified"] != false || domain["tls"] != "cert-manager" {
+		t.Fatalf("unexpected domain %v", domain)
+	}
+	challenge, _ := domain["challenge"].(map[string]interface{})
+	if challenge == nil || challenge["type"] != "TXT" || challenge["name"] != "_mini-paas-challenge.shop.example.com" {
+		t.Fatalf("expected a TXT challenge got %v", domain["challenge"])
+	}
+	domainURL := domainsURL + "/" + domain["id"].(string)
+
+	if resp, _ := doAsUser(t, http.MethodPost, domainsURL, "", `{"hostname":"shop.example.com"}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate domain expected 409 got %d", resp.StatusCode)
+	}
+
+	// nothing is published yet
+	if resp, _ := doAsUser(t, http.MethodPost, domainURL+"/verify", "", ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("verify without record expected 409 got %d", resp.StatusCode)
+	}
+
+	dnsRecords.publish(challenge["name"].(string), challenge["value"].(string))
+	resp, verified := doAsUser(t, http.MethodPost, domainURL+"/verify", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify expected 200 got %d: %v", resp.StatusCode, verified)
+	}
+	if verified["verified"] != true || verified["challenge"] != nil || verified["cert_status"] != "PENDING" {
+		t.Fatalf("expected verified domain waiting for its certificate got %v", verified)
+	}
+
+	// an uploaded certificate must cover the hostname
+	certPEM, keyPEM := selfSignedCert(t, "other.example.com")
+	if resp, _ := doAsUser(t, http.MethodPut, domainURL+"/certificate", "", certJSON(certPEM, keyPEM)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("certificate for another host expected 400 got %d", resp.StatusCode)
+	}
+	certPEM, keyPEM = selfSignedCert(t, "shop.example.com")
+	resp, uploaded := doAsUser(t, http.MethodPut, domainURL+"/certificate", "", certJSON(certPEM, keyPEM))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload certificate expected 200 got %d: %v", resp.StatusCode, uploaded)
+	}
+	if uploaded["tls"] != "uploaded" || uploaded["cert_status"] != "ISSUED" || uploaded["cert_expires_at"] == nil {
+		t.Fatalf("expected issued uploaded certificate got %v", uploaded)
+	}
+
+	_, list := doAsUser(t, http.MethodGet, domainsURL, "", "")
+	items, _ := list["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["cert_status"] != "ISSUED" {
+		t.Fatalf("expected one domain with an issued certificate got %v", list)
+	}
+
+	if resp, _ := doAsUser(t, http.MethodDelete, domainURL, "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("remove domain expected 200 got %d", resp.StatusCode)
+	}
+	_, list = doAsUser(t, http.MethodGet, domainsURL, "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 0 {
+		t.Fatalf("expected no domains after removal got %v", items)
+	}
+}
+
+func selfSignedCert(t *testing.T, host string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return string(certPEM), string(keyPEM)
+}
+
+func certJSON(certPEM, keyPEM string) string {
+	body, _ := json.Marshal(map[string]string{"certificate": certPEM, "private_key": keyPEM})
+	return string(body)
+}
@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-paas/backend/internal/models"
+)
+
+func TestEnvironmentIntegration(t *testing.T) {
+	resp, owner := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"env-owner","email":"env-owner@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	ownerID := owner["id"].(string)
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", ownerID, `{"name":"env-shop", "git_url":"https://example.com/env-shop.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+	envsURL := testServer.URL + "/api/apps/app/" + appID + "/environments"
+
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL, "", `{"name":"staging"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("create environment without user expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL, ownerID, `{"name":"Staging!"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("create environment with invalid name expected 400 got %d", resp.StatusCode)
+	}
+	resp, staging := doAsUser(t, http.MethodPost, envsURL, ownerID, `{"name":"staging","replicas":1,"env":{"STAGE":"staging"}}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create staging expected 201 got %d: %v", resp.StatusCode, staging)
+	}
+	if staging["env_app"] != "env-shop-staging" || staging["position"] != float64(1) {
+		t.Fatalf("unexpected staging environment %v", staging)
+	}
+	// each environment runs in a namespace of its own
+	if want := "env-shop-" + appID[0:8] + "-staging"; staging["namespace"] != want {
+		t.Fatalf("expected staging namespace %s got %v", want, staging["namespace"])
+	}
+	resp, production := doAsUser(t, http.MethodPost, envsURL, ownerID, `{"name":"production","replicas":2}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create production expected 201 got %d: %v", resp.StatusCode, production)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL, ownerID, `{"name":"staging"}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate environment expected 409 got %d", resp.StatusCode)
+	}
+
+	// each environment runs as an app of its own, with its own config
+	var stagingApp models.Application
+	if err := testDB.First(&stagingApp, "id = ?", staging["env_app_id"]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cfg := stagingApp.Config; cfg.Env["STAGE"] != "staging" || cfg.Replicas == nil || *cfg.Replicas != 1 {
+		t.Fatalf("expected the staging config on its app got %+v", cfg)
+	}
+	if stagingApp.Namespace != staging["namespace"] {
+		t.Fatalf("expected the staging app in %v got %q", staging["namespace"], stagingApp.Namespace)
+	}
+
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL+"/staging/promote", ownerID, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("promote without a running release expected 409 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL+"/production/promote", ownerID, ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("promote from the last environment expected 400 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, envsURL+"/qa/promote", ownerID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("promote from unknown environment expected 404 got %d", resp.StatusCode)
+	}
+
+	resp, deployed := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+staging["env_app_id"].(string)+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy to staging expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, deployed["id"].(string), 120*time.Second); status != "RUNNING" {
+		t.Fatalf("staging deployment expected RUNNING got %q", status)
+	}
+
+	resp, promoted := doAsUser(t, http.MethodPost, envsURL+"/staging/promote", ownerID, "")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("promote expected 202 got %d: %v", resp.StatusCode, promoted)
+	}
+	release := promoted["deployment"].(map[string]interface{})
+	if promoted["environment"] != "production" || release["app_id"] != production["env_app_id"] ||
+		release["promoted_from"] != deployed["id"] || release["image_digest"] != deployed["image_digest"] {
+		t.Fatalf("expected the staging release on production got %v", promoted)
+	}
+
+	// config is per environment: only the image moves, production keeps its own
+	var snapshot models.Release
+	if err := testDB.First(&snapshot, "id = ?", release["release_id"]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cfg := snapshot.Config; cfg.Env["STAGE"] != "" || cfg.Replicas == nil || *cfg.Replicas != 2 {
+		t.Fatalf("expected the promoted release to run the production config got %+v", cfg)
+	}
+	var productionApp models.Application
+	if err := testDB.First(&productionApp, "id = ?", production["env_app_id"]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if cfg := productionApp.Config; cfg.Env["STAGE"] != "" || cfg.Replicas == nil || *cfg.Replicas != 2 {
+		t.Fatalf("expected promote to keep the production config got %+v", cfg)
+	}
+
+	// deployments can be listed per environment
+	_, list := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments?environment="+production["id"].(string), "", "")
+	items, _ := list["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["id"] != release["id"] {
+		t.Fatalf("expected the promoted release in production got %v", list)
+	}
+
+	if status := waitForDeployment(t, release["id"].(string), 120*time.Second); status != "RUNNING" {
+		t.Fatalf("production deployment expected RUNNING got %q", status)
+	}
+	_, envs := doAsUser(t, http.MethodGet, envsURL, "", "")
+	items, _ = envs["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("expected two environments got %v", envs)
+	}
+	if running, _ := items[1].(map[string]interface{})["release"].(map[string]interface{}); running["id"] != release["id"] {
+		t.Fatalf("expected production to run the promoted release got %v", items[1])
+	}
+}
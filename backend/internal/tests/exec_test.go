@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+func TestExecIntegration(t *testing.T) {
+	// exec requires an authenticated user
+	resp, err := http.Get(testServer.URL + "/api/deployments/" + uuid.NewString() + "/exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("exec without user expected 401 got %d", resp.StatusCode)
+	}
+
+	// unknown user is rejected as well
+	req, _ := http.NewRequest(http.MethodGet, testServer.URL+"/api/deployments/"+uuid.NewString()+"/exec", nil)
+	req.Header.Set("X-User-ID", uuid.NewString())
+	resp2, _ := http.DefaultClient.Do(req)
+	if resp2.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("exec with unknown user expected 401 got %d", resp2.StatusCode)
+	}
+	resp2.Body.Close()
+
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	owner, other := newUser("exec-owner"), newUser("exec-other")
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, `{"name":"exec-app", "git_url":"https://example.com/exec-app.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	resp, deployed := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+app["id"].(string)+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	deployID := deployed["id"].(string)
+	if status := waitForDeployment(t, deployID, 120*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+	execURL := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/api/deployments/" + deployID + "/exec"
+
+	// a shell into someone else's app is refused before the upgrade
+	_, resp, err = websocket.DefaultDialer.Dial(execURL, http.Header{"X-User-ID": {other}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("exec into another user's app expected 403 got %v", resp)
+	}
+
+	// the owner gets a terminal
+	conn, resp, err := websocket.DefaultDialer.Dial(execURL, http.Header{"X-User-ID": {owner}})
+	if err != nil {
+		t.Fatalf("exec as owner: %v (%v)", err, resp)
+	}
+	defer conn.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("exec as owner expected 101 got %d", resp.StatusCode)
+	}
+	if err := conn.WriteJSON(map[string]string{"op": "stdin", "data": "echo exec-ok\nexit\n"}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+	var out strings.Builder
+	for !strings.Contains(out.String(), "exec-ok") {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected the command output in the terminal got %q: %v", out.String(), err)
+		}
+		out.Write(msg)
+	}
+}
@@ -0,0 +1,91 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"mini-paas/backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestGarbageCollectionIntegration(t *testing.T) {
+	resp, admin := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"gc-admin","email":"gc-admin@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	adminID := admin["id"].(string)
+	if err := testDB.Model(&models.User{}).Where("id = ?", adminID).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", adminID, `{"name":"gc-app", "git_url":"https://example.com/gc-app.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := uuid.MustParse(app["id"].(string))
+
+	// twelve failed releases, the oldest first and a discarded blue/green
+	// one among them, and a log line past retention
+	var ids []uuid.UUID
+	start := time.Now().Add(-12 * time.Hour)
+	for i := 0; i < 12; i++ {
+		d := models.Deployment{ID: uuid.New(), AppID: appID, Version: "v1", ImageURL: "nginx:latest", Status: "FAILED", CreatedAt: start.Add(time.Duration(i) * time.Hour)}
+		if i == 1 {
+			d.Status, d.Color = "DISCARDED", "green"
+		}
+		if err := testDB.Create(&d).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, d.ID)
+	}
+	if err := testDB.Create(&models.Log{DeploymentID: ids[11], Message: "old", Timestamp: time.Now().AddDate(0, 0, -40)}).Error; err != nil {
+		t.Fatal(err)
+	}
+	count := func(id uuid.UUID) int64 {
+		t.Helper()
+		var n int64
+		testDB.Model(&models.Deployment{}).Where("id = ?", id).Count(&n)
+		return n
+	}
+	pruned := func(report map[string]interface{}) map[string]bool {
+		out := map[string]bool{}
+		items, _ := report["pruned"].([]interface{})
+		for _, item := range items {
+			out[item.(map[string]interface{})["id"].(string)] = true
+		}
+		return out
+	}
+
+	if resp, _ := doAsUser(t, http.MethodGet, testServer.URL+"/api/admin/gc", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("report without user expected 401 got %d", resp.StatusCode)
+	}
+
+	resp, report := doAsUser(t, http.MethodGet, testServer.URL+"/api/admin/gc", adminID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("report expected 200 got %d: %v", resp.StatusCode, report)
+	}
+	planned := pruned(report)
+	if report["dry_run"] != true || !planned[ids[0].String()] || !planned[ids[1].String()] || planned[ids[2].String()] {
+		t.Fatalf("expected the two oldest releases, the discarded one too, to be pruned got %v", report["pruned"])
+	}
+	if logs, _ := report["logs"].(float64); logs < 1 {
+		t.Fatalf("expected the old log line in the report got %v", report["logs"])
+	}
+	if count(ids[0]) != 1 {
+		t.Fatal("a dry run deleted a release")
+	}
+
+	resp, report = doAsUser(t, http.MethodPost, testServer.URL+"/api/admin/gc", adminID, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("collect expected 200 got %d: %v", resp.StatusCode, report)
+	}
+	if count(ids[0]) != 0 || count(ids[1]) != 0 || count(ids[2]) != 1 || count(ids[11]) != 1 {
+		t.Fatal("expected only the two oldest releases to be deleted")
+	}
+	var logs int64
+	testDB.Model(&models.Log{}).Where("deployment_id = ?", ids[11]).Count(&logs)
+	if logs != 0 {
+		t.Fatalf("expected the old log line to be deleted, %d left", logs)
+	}
+}
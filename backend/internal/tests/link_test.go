@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestLinkIntegration(t *testing.T) {
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	newApp := func(userID, name string) string {
+		t.Helper()
+		resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", userID, `{"name":"`+name+`", "git_url":"https://example.com/`+name+`.git"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+		}
+		return app["id"].(string)
+	}
+	owner, other := newUser("link-owner"), newUser("link-other")
+	frontend, api, foreign := newApp(owner, "link-frontend"), newApp(owner, "link-api"), newApp(other, "link-foreign")
+	linksURL := testServer.URL + "/api/apps/app/" + frontend + "/links"
+
+	if resp, _ := doAsUser(t, http.MethodPost, linksURL, "", `{"target_app_id":"`+api+`"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("link without user expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, linksURL, owner, `{"target_app_id":"`+frontend+`"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("link to itself expected 400 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, linksURL, owner, `{"target_app_id":"`+foreign+`"}`); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("link to another tenant's app expected 403 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, linksURL, owner, `{"target_app_id":"`+api+`","alias":"not valid"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("link with invalid alias expected 400 got %d", resp.StatusCode)
+	}
+
+	resp, link := doAsUser(t, http.MethodPost, linksURL, owner, `{"target_app_id":"`+api+`"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("link expected 201 got %d: %v", resp.StatusCode, link)
+	}
+	if link["alias"] != "LINK_API" {
+		t.Fatalf("expected alias from the target's name got %v", link["alias"])
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, linksURL, owner, `{"target_app_id":"`+api+`"}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second link to the same app expected 409 got %d", resp.StatusCode)
+	}
+
+	_, list := doAsUser(t, http.MethodGet, linksURL, "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 1 {
+		t.Fatalf("expected one link got %v", list)
+	}
+
+	// the linking app's releases are told where the target is
+	preview := func() string {
+		t.Helper()
+		resp, err := http.Post(testServer.URL+"/api/deployments/preview?format=yaml", "application/json",
+			strings.NewReader(`{"app_id":"`+frontend+`", "version":"v1", "image_url":"nginx:latest"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("preview expected 200 got %d: %s", resp.StatusCode, body)
+		}
+		return string(body)
+	}
+	wantURL := "value: http://app-" + api[0:8] + ".default.svc.cluster.local"
+	if body := preview(); !strings.Contains(body, "name: LINK_API_URL") || !strings.Contains(body, wantURL) {
+		t.Fatalf("expected LINK_API_URL in the release env got:\n%s", body)
+	}
+
+	linkURL := linksURL + "/" + link["id"].(string)
+	if resp, _ := doAsUser(t, http.MethodDelete, linkURL, other, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unlink by another tenant expected 403 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, linkURL, owner, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("unlink expected 200 got %d", resp.StatusCode)
+	}
+	if body := preview(); strings.Contains(body, "LINK_API_URL") {
+		t.Fatalf("expected no link env after unlinking got:\n%s", body)
+	}
+}
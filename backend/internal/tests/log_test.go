@@ -10,19 +10,10 @@ import (
 func TestLogIntegration(t *testing.T) {
 	// create app
 	appPayload := `{"name":"log-app", "git_url":"https://example.com/repo.git"}`
-	appResp, err := http.Post(
-		testServer.URL+"/api/apps",
-		"application/json",
-		strings.NewReader(appPayload))
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer appResp.Body.Close()
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", newTestUser(t, "log-owner"), appPayload)
 	if appResp.StatusCode != http.StatusCreated {
 		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
 	}
-	var appCreated map[string]interface{}
-	json.NewDecoder(appResp.Body).Decode(&appCreated)
 	appID := appCreated["id"].(string)
 
 	// create deployment
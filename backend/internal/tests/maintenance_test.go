@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"maintenance-user","email":"maintenance-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+
+	resp, app := applyManifest(t, userID, "name: maintenance-app\nsource:\n  image: nginx:stable\nport: 80\n")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+	appURL := testServer.URL + "/api/apps/app/" + appID
+
+	resp, domain := doAsUser(t, http.MethodPost, appURL+"/domains", "", `{"hostname":"maintenance.example.com","tls":"none"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("add domain expected 201 got %d: %v", resp.StatusCode, domain)
+	}
+	challenge := domain["challenge"].(map[string]interface{})
+	dnsRecords.publish(challenge["name"].(string), challenge["value"].(string))
+	if resp, body := doAsUser(t, http.MethodPost, appURL+"/domains/"+domain["id"].(string)+"/verify", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify expected 200 got %d: %v", resp.StatusCode, body)
+	}
+
+	resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, created["id"].(string), 120*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+
+	_, before := doAsUser(t, http.MethodGet, appURL+"/releases", "", "")
+
+	if resp, _ := doAsUser(t, http.MethodPost, appURL+"/maintenance", "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("enable without user expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, appURL+"/maintenance", userID, `{"allow_ips":["10.0.0.0/8","not-an-ip"]}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("enable with invalid allowlist expected 400 got %d", resp.StatusCode)
+	}
+
+	resp, m := doAsUser(t, http.MethodPost, appURL+"/maintenance", userID, `{"message":"Back at <b>noon</b>","retry_after_seconds":120,"allow_ips":["203.0.113.7"]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("enable expected 200 got %d: %v", resp.StatusCode, m)
+	}
+	token, _ := m["bypass_token"].(string)
+	if m["enabled"] != true || token == "" || m["bypass_header"] != "X-Maintenance-Bypass" {
+		t.Fatalf("expected enabled maintenance with a bypass token got %v", m)
+	}
+
+	get := func(header map[string]string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, activatorServer.URL+"/", nil)
+		req.Host = "maintenance.example.com"
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get(nil)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "120" {
+		t.Fatalf("expected 503 with Retry-After 120 got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if !strings.Contains(body, "Back at &lt;b&gt;noon&lt;/b&gt;") {
+		t.Fatalf("expected the escaped message on the page got %s", body)
+	}
+
+	// allowed clients still reach the app
+	if resp, body := get(map[string]string{"X-Forwarded-For": "203.0.113.7"}); resp.StatusCode != http.StatusOK || !strings.Contains(body, "nginx") {
+		t.Fatalf("allowlisted client expected the app got %d: %s", resp.StatusCode, body)
+	}
+	if resp, body := get(map[string]string{"X-Maintenance-Bypass": token}); resp.StatusCode != http.StatusOK || !strings.Contains(body, "nginx") {
+		t.Fatalf("client with the bypass token expected the app got %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := get(map[string]string{"X-Maintenance-Bypass": "wrong"}); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("client with a wrong token expected 503 got %d", resp.StatusCode)
+	}
+
+	if resp, _ := doAsUser(t, http.MethodDelete, appURL+"/maintenance", userID, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("disable expected 200 got %d", resp.StatusCode)
+	}
+	if _, m := doAsUser(t, http.MethodGet, appURL+"/maintenance", userID, ""); m["enabled"] != false {
+		t.Fatalf("expected maintenance off got %v", m)
+	}
+	// maintenance only routes the domains, the app runs the same release
+	if _, after := doAsUser(t, http.MethodGet, appURL+"/releases", "", ""); after["total"] != before["total"] {
+		t.Fatalf("expected no release for maintenance got %v then %v", before["total"], after["total"])
+	}
+	if resp, body := get(nil); resp.StatusCode != http.StatusOK || !strings.Contains(body, "nginx") {
+		t.Fatalf("after maintenance expected the app got %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const portsAppYAML = `
+name: ports-app
+source:
+  image: nginx:stable
+ports:
+  - name: web
+    port: 80
+  - name: mqtt
+    port: 1883
+    protocol: tcp
+  - name: metrics
+    port: 9125
+    protocol: udp
+    expose: NodePort
+`
+
+func TestPortsIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"ports-user","email":"ports-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+
+	bad := strings.Replace(portsAppYAML, "expose: NodePort", "path: /metrics", 1)
+	if resp, body := applyManifest(t, userID, bad); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("udp port with a path expected 400 got %d: %v", resp.StatusCode, body)
+	}
+	if resp, body := applyManifest(t, userID, portsAppYAML+"port: 8080\n"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("port and ports together expected 400 got %d: %v", resp.StatusCode, body)
+	}
+
+	resp, app := applyManifest(t, userID, portsAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+
+	// ports are exposed when a release goes live
+	_, list := doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+appID+"/ports", "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 0 {
+		t.Fatalf("expected no endpoints before the first deploy got %v", items)
+	}
+
+	resp, created := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, created["id"].(string), 90*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+
+	_, list = doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+appID+"/ports", "", "")
+	items, _ := list["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("expected the tcp and udp ports only got %v", items)
+	}
+	byName := map[string]map[string]interface{}{}
+	for _, it := range items {
+		e := it.(map[string]interface{})
+		byName[e["name"].(string)] = e
+	}
+	mqtt := byName["mqtt"]
+	if mqtt == nil || mqtt["protocol"] != "tcp" || mqtt["service_type"] != "NodePort" || mqtt["node_port"] == nil {
+		t.Fatalf("expected mqtt on a node port got %v", mqtt)
+	}
+	if addr, _ := mqtt["address"].(string); addr == "" {
+		t.Fatalf("expected an external address for mqtt got %v", mqtt)
+	}
+	if metrics := byName["metrics"]; metrics == nil || metrics["protocol"] != "udp" {
+		t.Fatalf("expected metrics as udp got %v", metrics)
+	}
+
+	// dropping a port removes its endpoint with the next release
+	trimmed := strings.Replace(portsAppYAML, "  - name: metrics\n    port: 9125\n    protocol: udp\n    expose: NodePort\n", "", 1)
+	if resp, body := applyManifest(t, userID, trimmed); resp.StatusCode != http.StatusOK {
+		t.Fatalf("re-apply expected 200 got %d: %v", resp.StatusCode, body)
+	}
+	resp, created = doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v2", "image_url":"nginx:alpine"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, created["id"].(string), 90*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+	_, list = doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+appID+"/ports", "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 1 {
+		t.Fatalf("expected only mqtt after removing metrics got %v", items)
+	}
+}
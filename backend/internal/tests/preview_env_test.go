@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"mini-paas/backend/internal/models"
+)
+
+// gitWebhookSecret signs the git provider webhooks the tests send.
+const gitWebhookSecret = "preview-webhook-secret"
+
+func sendGitWebhook(t *testing.T, event, signature, body string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, testServer.URL+"/api/webhooks/git", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", signature)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return resp, out
+}
+
+func signGitWebhook(body string) string {
+	mac := hmac.New(sha256.New, []byte(gitWebhookSecret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestPreviewEnvIntegration(t *testing.T) {
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	owner, other := newUser("preview-owner"), newUser("preview-other")
+
+	// a repository of its own, so apps of earlier runs do not match the webhooks
+	run := time.Now().UnixNano()
+	name := fmt.Sprintf("shop-%d", run)
+	repo := fmt.Sprintf("https://git.example.com/acme/shop-%d", run)
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, `{"name":"`+name+`", "git_url":"`+repo+`.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+	if err := testDB.Model(&models.Application{}).Where("id = ?", appID).Update("image_url", "nginx:latest").Error; err != nil {
+		t.Fatal(err)
+	}
+	previewsURL := testServer.URL + "/api/apps/app/" + appID + "/previews"
+
+	if resp, _ := doAsUser(t, http.MethodPost, previewsURL, "", `{"pull_request":42}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("open preview without user expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, previewsURL, other, `{"pull_request":42,"image":"nginx:alpine"}`); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("open preview of another user's app expected 403 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, previewsURL, owner, `{"pull_request":42}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("open preview without image or commit expected 400 got %d", resp.StatusCode)
+	}
+	// CI builds the commit's image; one that was not pushed creates no preview
+	if resp, out := doAsUser(t, http.MethodPost, previewsURL, owner, `{"pull_request":42,"commit_sha":"not-pushed-by-ci"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("open preview of an unpushed commit expected 400 got %d: %v", resp.StatusCode, out)
+	}
+	if _, list := doAsUser(t, http.MethodGet, previewsURL, "", ""); len(list["items"].([]interface{})) != 0 {
+		t.Fatalf("expected no preview for the unpushed commit got %v", list)
+	}
+
+	resp, preview := doAsUser(t, http.MethodPost, previewsURL, owner, `{"pull_request":42,"branch":"feature/cart","image":"nginx:alpine"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("open preview expected 202 got %d: %v", resp.StatusCode, preview)
+	}
+	previewID := preview["id"].(string)
+	host := fmt.Sprintf("pr-42.%s.apps.example.com", name)
+	if preview["parent_id"] != appID || preview["url"] != "https://"+host || preview["deployment_id"] == nil {
+		t.Fatalf("unexpected preview %v", preview)
+	}
+	// each preview runs in a namespace of its own, removed when it is closed
+	if want := fmt.Sprintf("preview-%s-%s-pr-42", name, appID[0:8]); preview["namespace"] != want {
+		t.Fatalf("expected preview namespace %s got %v", want, preview["namespace"])
+	}
+
+	// the preview is routed at its own hostname right away
+	_, domains := doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+previewID+"/domains", "", "")
+	items, _ := domains["items"].([]interface{})
+	if len(items) != 1 || items[0].(map[string]interface{})["hostname"] != host || items[0].(map[string]interface{})["verified"] != true {
+		t.Fatalf("expected the verified preview hostname got %v", domains)
+	}
+
+	// pushes to the pull request arrive as webhooks
+	webhook := func(action, sha string) string {
+		return `{"action":"` + action + `","number":42,` +
+			`"pull_request":{"head":{"ref":"feature/cart","sha":"` + sha + `"}},` +
+			`"repository":{"clone_url":"` + repo + `.git","html_url":"` + repo + `"}}`
+	}
+	body := webhook("synchronize", "alpine")
+	if resp, _ := sendGitWebhook(t, "pull_request", "sha256=00", body); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unsigned webhook expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := sendGitWebhook(t, "push", signGitWebhook(`{}`), `{}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("other events expected 200 got %d", resp.StatusCode)
+	}
+	// the head commit names the tag CI pushed; nginx happens to have one called alpine
+	resp, pushed := sendGitWebhook(t, "pull_request", signGitWebhook(body), body)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("synchronize webhook expected 202 got %d: %v", resp.StatusCode, pushed)
+	}
+	items, _ = pushed["items"].([]interface{})
+	if len(items) != 1 {
+		t.Fatalf("expected the preview to be redeployed got %v", pushed)
+	}
+	redeployed := items[0].(map[string]interface{})
+	if redeployed["id"] != previewID || redeployed["image_url"] != "nginx:alpine" || redeployed["commit_sha"] != "alpine" {
+		t.Fatalf("expected the same preview on the new commit got %v", redeployed)
+	}
+	// a new head makes no release of its own, the deploy of each push records it
+	_, releases := doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+previewID+"/releases", "", "")
+	items, _ = releases["items"].([]interface{})
+	if len(items) != 3 || items[0].(map[string]interface{})["reason"] != "deploy" || items[0].(map[string]interface{})["image_url"] != "nginx:alpine" {
+		t.Fatalf("expected the creation and a deploy per push got %v", releases)
+	}
+
+	_, list := doAsUser(t, http.MethodGet, previewsURL, "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 1 {
+		t.Fatalf("expected one preview got %v", list)
+	}
+
+	// closing the pull request destroys the preview
+	body = webhook("closed", "alpine")
+	if resp, out := sendGitWebhook(t, "pull_request", signGitWebhook(body), body); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("closed webhook expected 202 got %d: %v", resp.StatusCode, out)
+	}
+	_, list = doAsUser(t, http.MethodGet, previewsURL, "", "")
+	if items, _ := list["items"].([]interface{}); len(items) != 0 {
+		t.Fatalf("expected no previews after closing got %v", list)
+	}
+	if resp, _ := doAsUser(t, http.MethodGet, testServer.URL+"/api/apps/app/"+previewID, "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("closed preview expected 404 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, previewsURL+"/42", owner, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("closing a closed preview expected 404 got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDeployPreviewIntegration(t *testing.T) {
+	// create app with a release command so the preview includes the release Job
+	appPayload := `{"name":"preview-app", "git_url":"https://example.com/repo.git", "release_command":"echo migrating"}`
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", newTestUser(t, "deploy-preview-owner"), appPayload)
+	if appResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+
+	payload := `{"app_id":"` + appID + `", "version":"v1", "image_url":"nginx:latest"}`
+	resp, err := http.Post(
+		testServer.URL+"/api/deployments/preview",
+		"application/json",
+		strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("preview expected 200 got %d", resp.StatusCode)
+	}
+	var preview struct {
+		Objects []struct {
+			Kind     string `json:"kind"`
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		} `json:"objects"`
+		DryRun bool `json:"dry_run"`
+	}
+	json.NewDecoder(resp.Body).Decode(&preview)
+	if len(preview.Objects) != 2 || preview.Objects[0].Kind != "Job" || preview.Objects[1].Kind != "Deployment" {
+		t.Fatalf("unexpected preview objects: %+v", preview.Objects)
+	}
+	// the preview names the objects as the rollout does
+	if got := preview.Objects[1].Metadata.Labels["app"]; got != "app-"+appID[0:8] {
+		t.Fatalf("expected the Deployment labelled app-%s got %q", appID[0:8], got)
+	}
+
+	// YAML output
+	yamlResp, err := http.Post(
+		testServer.URL+"/api/deployments/preview?format=yaml",
+		"application/json",
+		strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(yamlResp.Body)
+	yamlResp.Body.Close()
+	if yamlResp.StatusCode != http.StatusOK {
+		t.Fatalf("yaml preview expected 200 got %d", yamlResp.StatusCode)
+	}
+	if !strings.Contains(string(body), "kind: Deployment") || !strings.Contains(string(body), "image: nginx:latest") {
+		t.Fatalf("unexpected yaml preview:\n%s", body)
+	}
+
+	// dry run on the deploy endpoint must not record a deployment
+	dryResp, err := http.Post(
+		testServer.URL+"/api/deployments/deploy?dry_run=true",
+		"application/json",
+		strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dryResp.Body.Close()
+	if dryResp.StatusCode != http.StatusOK {
+		t.Fatalf("dry run deploy expected 200 got %d", dryResp.StatusCode)
+	}
+
+	listResp, err := http.Get(testServer.URL + "/api/deployments?owner_id=" + appID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listResp.Body.Close()
+	var list map[string]interface{}
+	json.NewDecoder(listResp.Body).Decode(&list)
+	if items, _ := list["items"].([]interface{}); len(items) != 0 {
+		t.Fatalf("dry run created %d deployments", len(items))
+	}
+
+	// unknown app
+	missing := `{"app_id":"00000000-0000-0000-0000-000000000000", "version":"v1", "image_url":"nginx:latest"}`
+	missingResp, err := http.Post(
+		testServer.URL+"/api/deployments/preview",
+		"application/json",
+		strings.NewReader(missing))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingResp.Body.Close()
+	if missingResp.StatusCode != http.StatusNotFound {
+		t.Fatalf("preview of unknown app expected 404 got %d", missingResp.StatusCode)
+	}
+}
@@ -0,0 +1,89 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"mini-paas/backend/internal/models"
+)
+
+func TestQuotaIntegration(t *testing.T) {
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	createApp := func(userID, name string) (*http.Response, map[string]interface{}) {
+		t.Helper()
+		return doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", userID, `{"name":"`+name+`", "git_url":"https://example.com/`+name+`.git"}`)
+	}
+	user, admin := newUser("quota-user"), newUser("quota-admin")
+	if err := testDB.Model(&models.User{}).Where("id = ?", admin).Update("role", models.RoleAdmin).Error; err != nil {
+		t.Fatal(err)
+	}
+	quotaURL := testServer.URL + "/api/admin/quotas/users/" + user
+
+	// the free plan allows three apps
+	for _, name := range []string{"quota-a", "quota-b", "quota-c"} {
+		if resp, app := createApp(user, name); resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create %s expected 201 got %d: %v", name, resp.StatusCode, app)
+		}
+	}
+	resp, body := createApp(user, "quota-d")
+	if resp.StatusCode != http.StatusForbidden || body["limit"] != "apps" {
+		t.Fatalf("fourth app expected 403 on the apps limit got %d: %v", resp.StatusCode, body)
+	}
+
+	// only admins see and change quotas
+	if resp, _ := doAsUser(t, http.MethodGet, quotaURL, user, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("quota as non-admin expected 403 got %d", resp.StatusCode)
+	}
+	resp, quota := doAsUser(t, http.MethodGet, quotaURL, admin, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get quota expected 200 got %d: %v", resp.StatusCode, quota)
+	}
+	usage := quota["usage"].(map[string]interface{})
+	if quota["plan"] != models.PlanFree || usage["apps"] != float64(3) || usage["cpu_millis"] != float64(300) {
+		t.Fatalf("unexpected quota: %v", quota)
+	}
+
+	if resp, _ := doAsUser(t, http.MethodPut, quotaURL, admin, `{"plan":"platinum"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unknown plan expected 400 got %d", resp.StatusCode)
+	}
+	resp, quota = doAsUser(t, http.MethodPut, quotaURL, admin, `{"plan":"free","max_apps":4}`)
+	if resp.StatusCode != http.StatusOK || quota["limits"].(map[string]interface{})["apps"] != float64(4) {
+		t.Fatalf("override expected 200 with 4 apps got %d: %v", resp.StatusCode, quota)
+	}
+	resp, body = createApp(user, "quota-d")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("app within the override expected 201 got %d: %v", resp.StatusCode, body)
+	}
+	appID := body["id"].(string)
+
+	// scaling past the plan's replicas is rejected
+	resp, body = doAsUser(t, http.MethodPut, testServer.URL+"/api/apps/apply", user,
+		`{"name":"quota-d","source":{"image":"nginx:latest"},"scaling":{"replicas":5}}`)
+	if resp.StatusCode != http.StatusForbidden || body["limit"] != "replicas" {
+		t.Fatalf("scale to 5 replicas expected 403 on the replicas limit got %d: %v", resp.StatusCode, body)
+	}
+
+	// releases run under the user's k8s quota
+	previewResp, preview := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/preview", "",
+		`{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:latest"}`)
+	if previewResp.StatusCode != http.StatusOK {
+		t.Fatalf("preview expected 200 got %d", previewResp.StatusCode)
+	}
+	objects := preview["objects"].([]interface{})
+	spec := objects[len(objects)-1].(map[string]interface{})["spec"].(map[string]interface{})
+	podSpec := spec["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	if podSpec["priorityClassName"] != "quota-user-"+user[0:8] {
+		t.Fatalf("expected the user's priority class got %v", podSpec["priorityClassName"])
+	}
+
+	if resp, _ := doAsUser(t, http.MethodGet, testServer.URL+"/api/admin/quotas/teams/00000000-0000-0000-0000-000000000000", admin, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("quota of unknown team expected 404 got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testImageDigest = "sha256:6e3f8ab1f1d2c9f3a7d5e2a4b9c8d7e6f5a4b3c2d1e0f9a8b7c6d5e4f3a2b1c0"
+
+// newTestRegistry serves a single private manifest, team/app:v1, behind basic auth.
+func newTestRegistry(username, token string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != username || p != token {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test-registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v2/team/app/manifests/v1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+		w.Header().Set("Docker-Content-Digest", testImageDigest)
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func doAsUser(t *testing.T, method, url, userID, body string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if userID != "" {
+		req.Header.Set("X-User-ID", userID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return resp, out
+}
+
+// newTestUser creates a user named name and returns its id.
+func newTestUser(t *testing.T, name string) string {
+	t.Helper()
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user %s expected 201 got %d", name, resp.StatusCode)
+	}
+	return user["id"].(string)
+}
+
+func TestRegistryCredentialsIntegration(t *testing.T) {
+	reg := newTestRegistry("ci", "s3cret")
+	defer reg.Close()
+	host := strings.TrimPrefix(reg.URL, "http://")
+
+	// users and a team
+	resp, owner := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"reg-owner","email":"reg-owner@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	ownerID := owner["id"].(string)
+	resp, outsider := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"reg-outsider","email":"reg-outsider@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	outsiderID := outsider["id"].(string)
+
+	resp, team := doAsUser(t, http.MethodPost, testServer.URL+"/api/teams", ownerID, `{"name":"registry-team"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create team expected 201 got %d", resp.StatusCode)
+	}
+	teamID := team["id"].(string)
+
+	// credentials require a user and team membership
+	credPayload := `{"server":"` + host + `", "username":"ci", "token":"s3cret", "team_id":"` + teamID + `"}`
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/registry-credentials", "", credPayload); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("anonymous credential expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/registry-credentials", outsiderID, credPayload); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("non-member credential expected 403 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/registry-credentials", ownerID, `{"server":"not a host", "username":"ci", "token":"x"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid server expected 400 got %d", resp.StatusCode)
+	}
+
+	resp, cred := doAsUser(t, http.MethodPost, testServer.URL+"/api/registry-credentials", ownerID, credPayload)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create credential expected 201 got %d", resp.StatusCode)
+	}
+	if _, leaked := cred["token"]; leaked {
+		t.Fatalf("credential response leaks the token: %v", cred)
+	}
+	credID := cred["id"].(string)
+
+	// team app pulls through the team credential
+	appPayload := `{"name":"private-app", "git_url":"https://example.com/repo.git", "team_id":"` + teamID + `"}`
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", ownerID, appPayload)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+
+	deployPayload := `{"app_id":"` + appID + `", "version":"v1", "image_url":"` + host + `/team/app:v1"}`
+	resp, preview := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/preview", "", deployPayload)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("preview expected 200 got %d: %v", resp.StatusCode, preview)
+	}
+	objects, _ := preview["objects"].([]interface{})
+	if len(objects) == 0 {
+		t.Fatalf("preview returned no objects")
+	}
+	raw, _ := json.Marshal(objects[len(objects)-1])
+	if !strings.Contains(string(raw), `"imagePullSecrets":[{"name":"regcred-`+credID[:8]+`"}]`) {
+		t.Fatalf("deployment does not reference the pull secret: %s", raw)
+	}
+	// the tag is pinned to the digest the registry returned
+	if !strings.Contains(string(raw), `"image":"`+host+`/team/app@`+testImageDigest+`"`) {
+		t.Fatalf("deployment image is not pinned to the digest: %s", raw)
+	}
+
+	// a tag the registry does not have is rejected before deploying
+	missing := `{"app_id":"` + appID + `", "version":"v2", "image_url":"` + host + `/team/app:v2"}`
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", missing); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("deploy of missing image expected 400 got %d", resp.StatusCode)
+	}
+
+	// without the credential the private registry refuses the pull
+	if resp, _ := doAsUser(t, http.MethodDelete, testServer.URL+"/api/registry-credentials/"+credID, ownerID, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete credential expected 200 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/preview", "", deployPayload); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("preview without credential expected 400 got %d", resp.StatusCode)
+	}
+}
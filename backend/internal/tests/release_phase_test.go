@@ -0,0 +1,82 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReleasePhaseIntegration(t *testing.T) {
+	owner := newTestUser(t, "release-phase-owner")
+
+	// create app with a release command
+	appPayload := `{"name":"release-app", "git_url":"https://example.com/repo.git", "release_command":"echo migrating"}`
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, appPayload)
+	if appResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+
+	// switch to a failing release command
+	patchResp, updated := doAsUser(t, http.MethodPatch, testServer.URL+"/api/apps/app/"+appID, owner, `{"release_command":"echo broken migration; exit 3"}`)
+	if patchResp.StatusCode != http.StatusOK {
+		t.Fatalf("update app expected 200 got %d", patchResp.StatusCode)
+	}
+	if updated["release_command"] != "echo broken migration; exit 3" {
+		t.Fatalf("release command not updated: %v", updated["release_command"])
+	}
+
+	// deploy: the failing release phase must block the rollout
+	payload := `{"app_id":"` + appID + `", "version":"v1", "image_url":"busybox:stable"}`
+	resp, err := http.Post(
+		testServer.URL+"/api/deployments/deploy",
+		"application/json",
+		strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	var created map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&created)
+	deployID := created["id"].(string)
+	if created["status"] != "QUEUED" {
+		t.Fatalf("expected QUEUED got %v", created["status"])
+	}
+
+	deadline := time.Now().Add(90 * time.Second)
+	var lastStatus string
+	for time.Now().Before(deadline) {
+		resp2, err := http.Get(testServer.URL + "/api/deployments/" + deployID + "/status")
+		if err != nil {
+			t.Fatalf("status request failed: %v", err)
+		}
+		var statusResp map[string]interface{}
+		json.NewDecoder(resp2.Body).Decode(&statusResp)
+		resp2.Body.Close()
+		lastStatus, _ = statusResp["status"].(string)
+		if lastStatus != "RELEASING" {
+			break
+		}
+		time.Sleep(3 * time.Second)
+	}
+	if lastStatus != "FAILED" {
+		t.Fatalf("failing release phase expected FAILED got %q", lastStatus)
+	}
+
+	// the job output is attached to the deployment logs
+	resp3, _ := http.Get(testServer.URL + "/api/logs?deployment_id=" + deployID)
+	if resp3.StatusCode != http.StatusOK {
+		t.Fatalf("list logs expected 200 got %d", resp3.StatusCode)
+	}
+	var logs map[string]interface{}
+	json.NewDecoder(resp3.Body).Decode(&logs)
+	resp3.Body.Close()
+	if items, _ := logs["items"].([]interface{}); len(items) == 0 {
+		t.Fatalf("expected release phase logs")
+	}
+}
@@ -0,0 +1,103 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReleaseIntegration(t *testing.T) {
+	resp, owner := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"release-owner","email":"release-owner@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	ownerID := owner["id"].(string)
+	resp, app := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", ownerID, `{"name":"release-shop", "git_url":"https://example.com/release-shop.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := app["id"].(string)
+	appURL := testServer.URL + "/api/apps/app/" + appID
+	releasesURL := appURL + "/releases"
+
+	// the app starts out with the config it was created with
+	resp, v1 := doAsUser(t, http.MethodGet, releasesURL+"/1", "", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get release expected 200 got %d", resp.StatusCode)
+	}
+	if v1["reason"] != "create" || v1["image_digest"] != "" {
+		t.Fatalf("unexpected first release %v", v1)
+	}
+
+	// a deploy records the image digest with the config
+	resp, deployed := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if deployed["release_id"] == nil {
+		t.Fatalf("expected the deployment to name its release got %v", deployed)
+	}
+	_, v2 := doAsUser(t, http.MethodGet, releasesURL+"/2", "", "")
+	if v2["id"] != deployed["release_id"] || v2["reason"] != "deploy" || v2["image_url"] != "nginx:stable" || v2["image_digest"] != deployed["image_digest"] {
+		t.Fatalf("unexpected deploy release %v", v2)
+	}
+
+	// changes that leave the config alone make no release
+	if resp, _ := doAsUser(t, http.MethodPatch, appURL, ownerID, `{"description":"the release shop"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("update description expected 200 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPatch, appURL, ownerID, `{"release_command":"echo migrate"}`); resp.StatusCode != http.StatusOK {
+		t.Fatalf("update release command expected 200 got %d", resp.StatusCode)
+	}
+	_, list := doAsUser(t, http.MethodGet, releasesURL, "", "")
+	items, _ := list["items"].([]interface{})
+	if list["total"] != float64(3) || len(items) != 3 {
+		t.Fatalf("expected three releases got %v", list)
+	}
+	v3 := items[0].(map[string]interface{})
+	if v3["version"] != float64(3) || v3["reason"] != "config change" || v3["release_command"] != "echo migrate" || v3["image_digest"] != v2["image_digest"] {
+		t.Fatalf("expected the config change on the deployed image got %v", v3)
+	}
+
+	_, diff := doAsUser(t, http.MethodGet, releasesURL+"/diff?from=2&to=3", "", "")
+	if diff["changed"] != true || !strings.Contains(fmt.Sprint(diff["diff"]), "+release_command: echo migrate") {
+		t.Fatalf("expected the release command in the diff got %v", diff)
+	}
+
+	// linking changes the config vars the pods get, so it makes a release
+	resp, target := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", ownerID, `{"name":"release-db", "git_url":"https://example.com/release-db.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create target app expected 201 got %d", resp.StatusCode)
+	}
+	resp, link := doAsUser(t, http.MethodPost, appURL+"/links", ownerID, `{"target_app_id":"`+target["id"].(string)+`"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create link expected 201 got %d: %v", resp.StatusCode, link)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, appURL+"/links/"+link["id"].(string), ownerID, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete link expected 200 got %d", resp.StatusCode)
+	}
+	_, list = doAsUser(t, http.MethodGet, releasesURL, "", "")
+	items, _ = list["items"].([]interface{})
+	if list["total"] != float64(5) || len(items) != 5 {
+		t.Fatalf("expected a release for the link and one for the unlink got %v", list)
+	}
+	for _, item := range items[:2] {
+		if rel := item.(map[string]interface{}); rel["reason"] != "link change" || rel["image_digest"] != v2["image_digest"] {
+			t.Fatalf("expected a link change on the deployed image got %v", rel)
+		}
+	}
+
+	if _, same := doAsUser(t, http.MethodGet, releasesURL+"/diff?from=2&to=2", "", ""); same["changed"] != false {
+		t.Fatalf("expected a release to equal itself got %v", same)
+	}
+	if resp, _ := doAsUser(t, http.MethodGet, releasesURL+"/diff?from=1&to=9", "", ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("diff with unknown release expected 404 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodGet, releasesURL+"/diff?from=1", "", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("diff without to expected 400 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodGet, releasesURL+"/latest", "", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid release version expected 400 got %d", resp.StatusCode)
+	}
+}
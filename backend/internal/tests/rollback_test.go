@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	notificationsMu sync.Mutex
+	notifications   []map[string]interface{}
+)
+
+// newTestWebhook records the notifications the platform sends.
+func newTestWebhook() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&n)
+		notificationsMu.Lock()
+		notifications = append(notifications, n)
+		notificationsMu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func notificationFor(deployID string) map[string]interface{} {
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+	for _, n := range notifications {
+		if n["deployment_id"] == deployID {
+			return n
+		}
+	}
+	return nil
+}
+
+const rollbackAppYAML = `
+name: rollback-app
+source:
+  image: nginx:stable
+port: 80
+rollback:
+  enabled: true
+  healthy_within_seconds: 45
+  watch_seconds: 60
+  max_restarts: 1
+`
+
+func TestAutomaticRollbackIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"rollback-user","email":"rollback-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+
+	resp, app := applyManifest(t, userID, rollbackAppYAML)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+
+	// invalid policies are rejected
+	bad := strings.Replace(rollbackAppYAML, "max_restarts: 1", "max_error_rate: 1.5", 1)
+	if resp, _ := applyManifest(t, userID, bad); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid rollback policy expected 400 got %d", resp.StatusCode)
+	}
+
+	// a healthy release
+	resp, good := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	goodID := good["id"].(string)
+	if status := waitForDeployment(t, goodID, 90*time.Second); status != "RUNNING" {
+		t.Fatalf("healthy release expected RUNNING got %q", status)
+	}
+
+	// a release whose container exits straight away never becomes ready
+	resp, broken := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v2", "image_url":"busybox:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	brokenID := broken["id"].(string)
+
+	deadline := time.Now().Add(150 * time.Second)
+	var status string
+	for time.Now().Before(deadline) {
+		_, body := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+brokenID+"/status", "", "")
+		if status, _ = body["status"].(string); status == "ROLLED_BACK" || status == "FAILED" {
+			break
+		}
+		time.Sleep(5 * time.Second)
+	}
+	if status != "ROLLED_BACK" {
+		t.Fatalf("broken release expected ROLLED_BACK got %q", status)
+	}
+
+	// both releases say why, the previous one is running again and someone was told
+	_, rolledBack := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+brokenID, "", "")
+	if reason, _ := rolledBack["rollback_reason"].(string); !strings.Contains(reason, goodID[:8]) {
+		t.Fatalf("rolled back release reason does not name the restored release: %v", rolledBack)
+	}
+	_, restored := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+goodID, "", "")
+	if restored["status"] != "RUNNING" {
+		t.Fatalf("previous release expected RUNNING got %v", restored["status"])
+	}
+	if reason, _ := restored["rollback_reason"].(string); !strings.Contains(reason, brokenID[:8]) {
+		t.Fatalf("restored release reason does not name the rolled back release: %v", restored)
+	}
+	n := notificationFor(brokenID)
+	if n == nil || n["event"] != "deployment.rolled_back" {
+		t.Fatalf("expected a rollback notification got %v", n)
+	}
+}
+
+func TestSupersededReleaseIntegration(t *testing.T) {
+	resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"supersede-user","email":"supersede-user@example.com"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+	}
+	userID := user["id"].(string)
+
+	resp, app := applyManifest(t, userID, "name: supersede-app\nsource:\n  image: nginx:stable\nport: 80\n")
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("apply expected 201 got %d: %v", resp.StatusCode, app)
+	}
+	appID := app["id"].(string)
+
+	var ids []string
+	for _, version := range []string{"v1", "v2"} {
+		resp, dep := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"`+version+`", "image_url":"nginx:stable"}`)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("deploy %s expected 202 got %d", version, resp.StatusCode)
+		}
+		id := dep["id"].(string)
+		if status := waitForDeployment(t, id, 90*time.Second); status != "RUNNING" {
+			t.Fatalf("release %s expected RUNNING got %q", version, status)
+		}
+		ids = append(ids, id)
+	}
+
+	// the first release stops serving but is kept for a rollback
+	_, first := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+ids[0], "", "")
+	if first["status"] != "SUPERSEDED" || first["superseded_by"] != ids[1] {
+		t.Fatalf("first release expected SUPERSEDED by %s got %v", ids[1], first)
+	}
+	_, second := doAsUser(t, http.MethodGet, testServer.URL+"/api/deployments/"+ids[1], "", "")
+	if second["status"] != "RUNNING" {
+		t.Fatalf("second release expected RUNNING got %v", second["status"])
+	}
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRunIntegration(t *testing.T) {
+	newUser := func(name string) string {
+		t.Helper()
+		resp, user := doAsUser(t, http.MethodPost, testServer.URL+"/api/users", "", `{"name":"`+name+`","email":"`+name+`@example.com"}`)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("create user expected 201 got %d", resp.StatusCode)
+		}
+		return user["id"].(string)
+	}
+	owner, other := newUser("run-owner"), newUser("run-other")
+
+	// create app without any deployment
+	resp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, `{"name":"run-app", "git_url":"https://example.com/repo.git"}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", resp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+	runURL := testServer.URL + "/api/apps/app/" + appID + "/run"
+
+	// the job gets the app's secrets, so only those who manage the app run commands
+	resp, err := http.Post(runURL, "application/json", strings.NewReader(`{"command":"env"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("run without user expected 401 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodPost, runURL, other, `{"command":"env"}`); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("run in another user's app expected 403 got %d", resp.StatusCode)
+	}
+
+	// run requires a running release
+	if resp, _ := doAsUser(t, http.MethodPost, runURL, owner, `{"command":"echo migrate"}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("run without deployment expected 409 got %d", resp.StatusCode)
+	}
+
+	// a blank command is rejected before anything runs
+	if resp, _ := doAsUser(t, http.MethodPost, runURL, owner, `{"command":"   "}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("run with blank command expected 400 got %d", resp.StatusCode)
+	}
+
+	// unknown run
+	if resp, _ := doAsUser(t, http.MethodGet, testServer.URL+"/api/runs/"+uuid.NewString(), owner, ""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("get unknown run expected 404 got %d", resp.StatusCode)
+	}
+
+	// on a running release the command runs to completion
+	resp, deployed := doAsUser(t, http.MethodPost, testServer.URL+"/api/deployments/deploy", "", `{"app_id":"`+appID+`", "version":"v1", "image_url":"nginx:stable"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("deploy expected 202 got %d", resp.StatusCode)
+	}
+	if status := waitForDeployment(t, deployed["id"].(string), 120*time.Second); status != "RUNNING" {
+		t.Fatalf("deployment expected RUNNING got %q", status)
+	}
+	resp, run := doAsUser(t, http.MethodPost, runURL, owner, `{"command":"echo migrated"}`)
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("run expected 202 got %d: %v", resp.StatusCode, run)
+	}
+	if run["deployment_id"] != deployed["id"] || run["command"] != "echo migrated" {
+		t.Fatalf("expected the run on the running release got %v", run)
+	}
+	runURL = testServer.URL + "/api/runs/" + run["id"].(string)
+	if resp, _ := doAsUser(t, http.MethodGet, runURL, other, ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("get another user's run expected 403 got %d", resp.StatusCode)
+	}
+	deadline := time.Now().Add(120 * time.Second)
+	for time.Now().Before(deadline) && run["status"] != "SUCCEEDED" && run["status"] != "FAILED" {
+		time.Sleep(2 * time.Second)
+		_, run = doAsUser(t, http.MethodGet, runURL, owner, "")
+	}
+	if run["status"] != "SUCCEEDED" || run["exit_code"] != float64(0) || run["finished_at"] == nil {
+		t.Fatalf("expected the run to succeed with exit code 0 got %v", run)
+	}
+}
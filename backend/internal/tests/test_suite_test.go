@@ -1,21 +1,37 @@
 package tests
 
 import (
+	"bytes"
+	"context"
 	"log"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"mini-paas/backend/internal/api"
 	"mini-paas/backend/internal/db"
 	"mini-paas/backend/internal/repository"
 	"mini-paas/backend/internal/services"
+	"mini-paas/backend/pkg/k8s"
+	"mini-paas/backend/pkg/secretbox"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"k8s.io/client-go/kubernetes"
 )
 
 var testServer *httptest.Server
 
+// testDB lets tests set up what the API cannot, such as admin users.
+var testDB *gorm.DB
+
+// testK8s lets tests check what the platform put into the cluster.
+var testK8s *kubernetes.Clientset
+
+// activatorServer receives the requests for apps scaled to zero.
+var activatorServer *httptest.Server
+
 func TestMain(m *testing.M) {
 	dsn := "host=localhost user=postgres password=123 dbname=mini_paas_test port=5432 sslmode=disable"
 	database, err := db.ConnectDB(dsn)
@@ -27,30 +43,97 @@ func TestMain(m *testing.M) {
 	if err := db.RunMigrations(database); err != nil {
 		log.Fatalf("failed to migrate DB: %v", err)
 	}
+	testDB = database
 
 	// init repo
 	appRepo := repository.NewAppRepository(database)
 	depRepo := repository.NewDeploymentRepository(database)
+	depEventRepo := repository.NewDeploymentEventRepository(database)
+	portRepo := repository.NewPortEndpointRepository(database)
 	userRepo := repository.NewUserRepository(database)
 	logRepo := repository.NewLogRepository(database)
+	cronRepo := repository.NewCronJobRepository(database)
+	runRepo := repository.NewRunRepository(database)
+	auditRepo := repository.NewAuditRepository(database)
+	volumeRepo := repository.NewVolumeRepository(database)
+	addOnRepo := repository.NewAddOnRepository(database)
+	teamRepo := repository.NewTeamRepository(database)
+	registryCredRepo := repository.NewRegistryCredentialRepository(database)
+	domainRepo := repository.NewDomainRepository(database)
+	linkRepo := repository.NewAppLinkRepository(database)
+	quotaRepo := repository.NewQuotaRepository(database)
+	envRepo := repository.NewEnvironmentRepository(database)
+	releaseRepo := repository.NewReleaseRepository(database)
+
+	k8sConfig, err := k8s.NewConfigFromKubeConfig()
+	if err != nil {
+		log.Fatalf("failed to load kubeconfig: %v", err)
+	}
+	k8sClient, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		log.Fatalf("failed to create k8s client: %v", err)
+	}
+	testK8s = k8sClient
+
+	credentialBox, err := secretbox.New(bytes.Repeat([]byte{0x42}, 32))
+	if err != nil {
+		log.Fatalf("failed to create credentials box: %v", err)
+	}
+
+	// domains of sleeping apps are routed to this Service
+	os.Setenv("ACTIVATOR_SERVICE", "mini-paas-activator:80")
+	// pull request previews get a hostname here, and webhooks are signed
+	os.Setenv("PREVIEW_DOMAIN", "apps.example.com")
+	os.Setenv("GIT_WEBHOOK_SECRET", gitWebhookSecret)
 
 	// init services
-	appSvc := services.NewAppService(appRepo)
-	depSvc := services.NewDeploymentService(depRepo)
+	quotaSvc := services.NewQuotaService(quotaRepo, appRepo, volumeRepo, domainRepo, userRepo, teamRepo, k8sClient)
+	volumeSvc := services.NewVolumeService(volumeRepo, appRepo, quotaSvc, k8sClient)
+	releaseSvc := services.NewReleaseService(releaseRepo, appRepo)
+	teamSvc := services.NewTeamService(teamRepo, userRepo)
+	cronSvc := services.NewCronService(cronRepo, appRepo, depRepo, logRepo, k8sClient)
+	addOnSvc := services.NewAddOnService(addOnRepo, appRepo, depRepo, releaseSvc, k8sClient)
+	appSvc := services.NewAppService(appRepo, volumeSvc, cronSvc, addOnSvc, quotaSvc, releaseSvc, teamSvc)
 	userSvc := services.NewUserService(userRepo)
+	registrySvc := services.NewRegistryService(registryCredRepo, teamSvc, credentialBox, k8sClient)
+	webhook := newTestWebhook()
+	depSvc := services.NewDeploymentService(depRepo, depEventRepo, portRepo, appRepo, logRepo, volumeRepo, addOnRepo, linkRepo, envRepo, cronSvc, registrySvc, quotaSvc, releaseSvc, teamSvc, services.NewWebhookNotifier(webhook.URL), nil)
 	logSvc := services.NewLogService(logRepo)
+	runSvc := services.NewRunService(runRepo, appRepo, depRepo, logRepo, teamSvc, k8sClient)
+	k8sLogSvc := services.NewK8sLogService(k8sClient, depRepo)
+	execSvc := services.NewExecService(k8sClient, k8sConfig, depRepo, appRepo, auditRepo, teamSvc)
+	domainSvc := services.NewDomainService(domainRepo, appRepo, quotaSvc, dnsRecords, k8sClient)
+	linkSvc := services.NewLinkService(linkRepo, appRepo, depRepo, releaseSvc, teamSvc, k8sClient)
+	activatorSvc := services.NewActivatorService(appRepo, depRepo, depEventRepo, domainRepo, domainSvc, noTraffic{}, k8sClient)
+	gcSvc := services.NewGCService(depRepo, appRepo, logRepo, k8sClient)
+	previewSvc := services.NewPreviewEnvService(appRepo, appSvc, depSvc, domainSvc, teamSvc, registrySvc, k8sClient)
+	envSvc := services.NewEnvironmentService(envRepo, appRepo, depRepo, appSvc, depSvc, teamSvc)
+
+	if err := linkSvc.EnsureNamespacePolicies(context.Background()); err != nil {
+		log.Fatalf("failed to apply namespace network policies: %v", err)
+	}
+
+	// deploys are queued; the worker is what rolls them out
+	go depSvc.ProcessQueue(context.Background(), 2*time.Second)
+	go activatorSvc.WatchIdle(context.Background(), 2*time.Second)
 
 	// set up gin + routes
 	gin.SetMode(gin.TestMode)
 	r := gin.Default()
-	api.SetUpRoutes(r, appSvc, depSvc, userSvc, logSvc)
+	api.SetUpRoutes(r, appSvc, depSvc, userSvc, logSvc, cronSvc, runSvc, k8sLogSvc, execSvc, volumeSvc, addOnSvc, teamSvc, registrySvc, domainSvc, activatorSvc, linkSvc, quotaSvc, gcSvc, previewSvc, envSvc, releaseSvc)
 
 	// start server
 	testServer = httptest.NewServer(r)
 
+	activator := gin.Default()
+	api.SetUpActivatorRoutes(activator, activatorSvc)
+	activatorServer = httptest.NewServer(activator)
+
 	//	run test
 	code := m.Run()
 	testServer.Close()
+	activatorServer.Close()
+	webhook.Close()
 
 	os.Exit(code)
 }
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestVolumeIntegration(t *testing.T) {
+	owner := newTestUser(t, "volume-owner")
+
+	// create app
+	appResp, appCreated := doAsUser(t, http.MethodPost, testServer.URL+"/api/apps", owner, `{"name":"volume-app", "git_url":"https://example.com/repo.git"}`)
+	if appResp.StatusCode != http.StatusCreated {
+		t.Fatalf("create app expected 201 got %d", appResp.StatusCode)
+	}
+	appID := appCreated["id"].(string)
+	volumesURL := testServer.URL + "/api/apps/app/" + appID + "/volumes"
+
+	// invalid size
+	badResp, err := http.Post(volumesURL, "application/json",
+		strings.NewReader(`{"name":"data", "size":"lots", "mount_path":"/data"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badResp.Body.Close()
+	if badResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid volume expected 400 got %d", badResp.StatusCode)
+	}
+
+	// create
+	payload := `{"name":"data", "size":"1Gi", "mount_path":"/data"}`
+	resp, err := http.Post(volumesURL, "application/json", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create volume expected 201 got %d", resp.StatusCode)
+	}
+
+	// duplicate name
+	dupResp, _ := http.Post(volumesURL, "application/json", strings.NewReader(payload))
+	dupResp.Body.Close()
+	if dupResp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate volume expected 409 got %d", dupResp.StatusCode)
+	}
+
+	// list
+	resp2, _ := http.Get(volumesURL)
+	if resp2.StatusCode != http.StatusOK {
+		t.Fatalf("list volumes expected 200 got %d", resp2.StatusCode)
+	}
+	resp2.Body.Close()
+
+	// deleting the app keeps volumes unless purged explicitly
+	if resp, _ := doAsUser(t, http.MethodDelete, testServer.URL+"/api/apps/app/"+appID, owner, ""); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("delete app with volumes expected 409 got %d", resp.StatusCode)
+	}
+	if resp, _ := doAsUser(t, http.MethodDelete, testServer.URL+"/api/apps/app/"+appID+"?purge_volumes=true", owner, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete app with purge_volumes expected 200 got %d", resp.StatusCode)
+	}
+}
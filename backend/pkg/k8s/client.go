@@ -5,16 +5,27 @@ import (
 	"path/filepath"
 
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
 )
 
-func NewClientFromKubeConfig() (*kubernetes.Clientset, error) {
+// NewConfigFromKubeConfig loads the rest config from ~/.kube/config. It is
+// needed alongside the clientset for streaming subresources such as exec.
+func NewConfigFromKubeConfig() (*rest.Config, error) {
 	kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
 	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		return nil, fmt.Errorf("build kubeconfig: %w", err)
 	}
+	return cfg, nil
+}
+
+func NewClientFromKubeConfig() (*kubernetes.Clientset, error) {
+	cfg, err := NewConfigFromKubeConfig()
+	if err != nil {
+		return nil, err
+	}
 	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("new clientset: %w", err)
@@ -0,0 +1,258 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	ErrManifestUnknown = errors.New("manifest not found")
+	ErrUnauthorized    = errors.New("registry denied access")
+	ErrUnavailable     = errors.New("registry unavailable")
+)
+
+// manifest media types we accept, multi-arch indexes first
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Credentials authenticate against a registry; Password may be a token.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Descriptor identifies the manifest a reference resolved to.
+type Descriptor struct {
+	Digest    string
+	MediaType string
+	Size      int64
+}
+
+type Client struct {
+	HTTP *http.Client
+	// Insecure lists registries spoken to over plain HTTP. Loopback
+	// registries always are, so a local registry works out of the box.
+	Insecure []string
+}
+
+func NewClient() *Client {
+	return &Client{HTTP: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Resolve looks up the manifest of ref and returns its digest. creds may be
+// nil for anonymous pulls.
+func (c *Client) Resolve(ctx context.Context, ref Reference, creds *Credentials) (*Descriptor, error) {
+	u := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", c.scheme(ref.Registry), ref.endpoint(), ref.Repository, ref.manifestRef())
+
+	resp, err := c.do(ctx, http.MethodHead, u, ref, creds)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	desc := &Descriptor{
+		Digest:    resp.Header.Get("Docker-Content-Digest"),
+		MediaType: resp.Header.Get("Content-Type"),
+		Size:      resp.ContentLength,
+	}
+	if desc.Digest != "" {
+		return desc, nil
+	}
+
+	// not every registry sends the digest on HEAD; hash the manifest instead
+	resp, err = c.do(ctx, http.MethodGet, u, ref, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	sum := sha256.Sum256(body)
+	desc.Digest = "sha256:" + hex.EncodeToString(sum[:])
+	desc.Size = int64(len(body))
+	return desc, nil
+}
+
+// do sends a manifest request, answering an auth challenge once.
+func (c *Client) do(ctx context.Context, method, u string, ref Reference, creds *Credentials) (*http.Response, error) {
+	resp, err := c.send(ctx, method, u, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		auth, err := c.authorize(ctx, challenge, ref, creds)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(ctx, method, u, auth); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrManifestUnknown, ref)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, ref.Name())
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s returned %s", ErrUnavailable, ref.Registry, resp.Status)
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, u, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with a Basic header or a
+// bearer token fetched from the challenge realm.
+func (c *Client) authorize(ctx context.Context, challenge string, ref Reference, creds *Credentials) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if creds == nil {
+			return "", fmt.Errorf("%w: %s requires credentials", ErrUnauthorized, ref.Registry)
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, ref, creds)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported auth challenge %q", ErrUnauthorized, challenge)
+	}
+}
+
+func (c *Client) fetchToken(ctx context.Context, params map[string]string, ref Reference, creds *Credentials) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("%w: bad token realm %q", ErrUnavailable, params["realm"])
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return "", fmt.Errorf("%w: %s", ErrUnauthorized, ref.Name())
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token endpoint returned %s", ErrUnavailable, resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("%w: decode token: %v", ErrUnavailable, err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+func (c *Client) scheme(registry string) string {
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+	for _, r := range c.Insecure {
+		if r == registry {
+			return "http"
+		}
+	}
+	return "https"
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into its scheme
+// and parameters.
+func parseChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for rest != "" {
+		rest = strings.TrimLeft(rest, " ,")
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			end := strings.Index(after[1:], `"`)
+			if end < 0 {
+				value, rest = after[1:], ""
+			} else {
+				value, rest = after[1:end+1], after[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(after, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return scheme, params
+}
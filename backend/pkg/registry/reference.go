@@ -0,0 +1,105 @@
+// Package registry resolves image references against an OCI / Docker
+// registry over the distribution HTTP API.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	DockerHub = "docker.io"
+	// the API endpoint behind DockerHub
+	dockerHubEndpoint = "registry-1.docker.io"
+)
+
+var (
+	ErrInvalidReference = errors.New("invalid image reference")
+
+	repositoryRe = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+	tagRe        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestRe     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference is a parsed image reference such as
+// "registry.example.com:5000/team/app:v1" or "nginx@sha256:...".
+type Reference struct {
+	// Registry is host[:port]; DockerHub for unqualified names
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+// ParseReference parses an image reference. A reference with neither a tag
+// nor a digest gets the "latest" tag, as docker does.
+func ParseReference(s string) (Reference, error) {
+	var ref Reference
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.Digest = name[i+1:]
+		name = name[:i]
+		if !digestRe.MatchString(ref.Digest) {
+			return Reference{}, fmt.Errorf("%w: digest %q", ErrInvalidReference, ref.Digest)
+		}
+	}
+
+	// a tag is a colon in the last path component; an earlier colon is a port
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.Tag = name[i+1:]
+		name = name[:i]
+		if !tagRe.MatchString(ref.Tag) {
+			return Reference{}, fmt.Errorf("%w: tag %q", ErrInvalidReference, ref.Tag)
+		}
+	}
+
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry = first
+		ref.Repository = rest
+	} else {
+		ref.Registry = DockerHub
+		ref.Repository = name
+		if !found {
+			ref.Repository = "library/" + name
+		}
+	}
+	if !repositoryRe.MatchString(ref.Repository) {
+		return Reference{}, fmt.Errorf("%w: repository %q", ErrInvalidReference, ref.Repository)
+	}
+
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Name is the reference without tag or digest.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// String formats the reference with its digest if known, else its tag.
+func (r Reference) String() string {
+	if r.Digest != "" {
+		return r.Name() + "@" + r.Digest
+	}
+	return r.Name() + ":" + r.Tag
+}
+
+// manifestRef is what goes in the manifests URL: the digest wins over the tag.
+func (r Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) endpoint() string {
+	if r.Registry == DockerHub {
+		return dockerHubEndpoint
+	}
+	return r.Registry
+}